@@ -4,15 +4,32 @@ import (
 	"backend/config"
 	"backend/internal/adapters/db"
 	adaptersHttp "backend/internal/adapters/http"
+	"backend/internal/adapters/sandbox"
+	"backend/internal/adapters/tinkoff"
 	"backend/internal/adapters/yookassa"
+	"backend/internal/app/capture"
+	"backend/internal/app/certificate"
+	"backend/internal/app/feed"
+	"backend/internal/app/loyalty"
+	"backend/internal/app/offline"
+	appOrder "backend/internal/app/order"
 	appPayment "backend/internal/app/payment"
+	"backend/internal/app/paymentevent"
 	"backend/internal/app/product"
+	"backend/internal/app/receipt"
+	"backend/internal/app/recommendation"
+	"backend/internal/app/reconcile"
+	"backend/internal/app/refund"
+	"backend/internal/app/review"
+	"backend/internal/app/subscription"
+	domainPayment "backend/internal/domain/payment"
 	"backend/pkg/logger"
 	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"syscall"
@@ -50,6 +67,13 @@ func main() {
 
 	logger.Init(cfg.Logger.Level)
 
+	// От адреса фронтенда строятся ссылки в фиде, sitemap и письмах
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if u, err := url.Parse(frontendURL); err != nil || u.Scheme == "" || u.Host == "" {
+		logger.Fatal("FRONTEND_URL не задан или не является абсолютным адресом",
+			zap.String("frontend_url", frontendURL))
+	}
+
 	connData := fmt.Sprintf(
 		"user=%s password=%s dbname=%s host=%s port=%s sslmode=disable",
 		os.Getenv("DB_USER"),
@@ -68,31 +92,96 @@ func main() {
 	productRepo := db.NewUserRepository(connDb)
 	productService := product.NewService(productRepo)
 
-	// Получение переменных окружения для ЮKassa
+	// Назначаем slug товарам, добавленным или переименованным с прошлого запуска
+	if err := productService.SyncSlugs(); err != nil {
+		logger.Error("Ошибка синхронизации slug товаров", zap.Error(err))
+	}
+
+	orderRepo := db.NewOrderRepository(connDb)
+	orderService := appOrder.NewService(orderRepo)
+
+	reviewRepo := db.NewReviewRepository(connDb)
+	reviewService := review.NewService(reviewRepo, productService, orderService)
+
+	recommendationRepo := db.NewRecommendationRepository(connDb)
+	recommendationService := recommendation.NewService(recommendationRepo, productService, cfg.Recommendations)
+
+	// Платежные провайдеры подключаются, если для них заданы ключи
+	var paymentProviders []domainPayment.Provider
+
 	yookassaShopID := os.Getenv("YOOKASSA_SHOP_ID")
 	yookassaSecretKey := os.Getenv("YOOKASSA_SECRET_KEY")
-
-	// Валидация
-	if yookassaShopID == "" {
-		logger.Fatal("YOOKASSA_SHOP_ID не установлен в .env")
+	if yookassaShopID != "" && yookassaSecretKey != "" {
+		paymentProviders = append(paymentProviders, yookassa.NewPaymentRepository(yookassaShopID, yookassaSecretKey, cfg.Payment.YooKassa))
+	} else if cfg.Payment.Provider == yookassa.ProviderName {
+		logger.Fatal("YOOKASSA_SHOP_ID и YOOKASSA_SECRET_KEY не установлены в .env")
 	}
-	if yookassaSecretKey == "" {
-		logger.Fatal("YOOKASSA_SECRET_KEY не установлен в .env")
+
+	if cfg.Payment.Tinkoff.TerminalKey != "" && cfg.Payment.Tinkoff.Password != "" {
+		paymentProviders = append(paymentProviders, tinkoff.NewPaymentRepository(cfg.Payment.Tinkoff))
 	}
 
-	// Инициализация репозитория ЮKassa
-	yookassaRepo := yookassa.NewPaymentRepository(yookassaShopID, yookassaSecretKey)
+	// Тестовый провайдер для локальной разработки: оплата подтверждается
+	// на странице /sandbox/payment/:id без реальной платежной системы.
+	// Страница и его вебхук не защищены, поэтому вместе с настоящими
+	// провайдерами он не запускается.
+	var sandboxProvider *sandbox.PaymentRepository
+	if cfg.Payment.Sandbox.Enabled || cfg.Payment.Provider == sandbox.ProviderName {
+		if len(paymentProviders) > 0 {
+			logger.Fatal("Тестовый провайдер sandbox нельзя включать вместе с настоящими платежными провайдерами",
+				zap.String("provider", paymentProviders[0].Name()))
+		}
+		sandboxProvider = sandbox.NewPaymentRepository(cfg.Payment.Sandbox)
+		paymentProviders = append(paymentProviders, sandboxProvider)
+		logger.Warn("Включен тестовый платежный провайдер sandbox - не используйте его в продакшене",
+			zap.String("base_url", cfg.Payment.Sandbox.BaseURL))
+	}
 
-	// Инициализация сервиса платежей - передаем репозиторий
-	paymentService := appPayment.NewService(yookassaRepo)
+	// Инициализация сервиса платежей
+	idempotencyRepo := db.NewIdempotencyRepository(connDb)
+	paymentService := appPayment.NewService(paymentProviders, idempotencyRepo, cfg.Payment)
+	if !paymentService.HasProvider(paymentService.DefaultProvider()) {
+		logger.Fatal("Платежный провайдер по умолчанию не настроен",
+			zap.String("provider", paymentService.DefaultProvider()))
+	}
+	if err := paymentService.ValidateReceiptConfig(); err != nil {
+		logger.Fatal("Некорректные настройки чеков", zap.Error(err))
+	}
 
-	router := adaptersHttp.Router(productService, paymentService, cfg)
+	certificateRepo := db.NewCertificateRepository(connDb)
+	certificateService := certificate.NewService(certificateRepo, orderService, cfg.GiftCertificates, cfg.Notifications.ManagerEmail)
+	loyaltyRepo := db.NewLoyaltyRepository(connDb)
+	loyaltyService := loyalty.NewService(loyaltyRepo, cfg.Loyalty, frontendURL)
+	refundService := refund.NewService(orderService, paymentService, certificateService, loyaltyService)
+	captureService := capture.NewService(orderService, paymentService, certificateService, loyaltyService, cfg.Payment)
+	receiptService := receipt.NewService(orderService, paymentService)
+	subscriptionRepo := db.NewSubscriptionRepository(connDb)
+	subscriptionService := subscription.NewService(subscriptionRepo, orderService, paymentService, cfg.Subscriptions, frontendURL)
+	inboxRepo := db.NewInboxRepository(connDb)
+	offlineService := offline.NewService(orderService, receiptService, certificateService, loyaltyService, cfg.Notifications.ManagerEmail)
+	paymentEventService := paymentevent.NewService(orderService, paymentService, receiptService, subscriptionService, certificateService, loyaltyService, inboxRepo, cfg.Notifications.ManagerEmail)
+	reconcileService := reconcile.NewService(orderService, paymentService, paymentEventService, certificateService, loyaltyService, cfg.Payment)
+
+	// Фид каталога для Яндекс.Маркета
+	feedService := feed.NewService(productService, cfg.Feed, frontendURL)
+
+	router := adaptersHttp.Router(productService, paymentService, paymentEventService, orderService, refundService, captureService, receiptService, reviewService, recommendationService, feedService, subscriptionService, offlineService, certificateService, loyaltyService, sandboxProvider, cfg)
 
 	srv := &http.Server{
 		Addr:    cfg.Server.Port,
 		Handler: router,
 	}
 
+	// Фоновые задачи останавливаются вместе с сервером
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+
+	go recommendationService.Run(jobsCtx)
+	go captureService.Run(jobsCtx)
+	go reconcileService.Run(jobsCtx)
+	go subscriptionService.Run(jobsCtx)
+	go loyaltyService.Run(jobsCtx)
+
 	// Запуск сервера
 	go func() {
 		logger.Info("Запуск сервера",
@@ -109,6 +198,7 @@ func main() {
 	// Ожидание сигнала завершения
 	<-quit
 	logger.Info("Получен сигнал завершения, остановка сервера...")
+	stopJobs()
 
 	// Graceful shutdown
 	if err := srv.Shutdown(ctx); err != nil {
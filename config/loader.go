@@ -11,11 +11,28 @@ type Config struct {
     Server ServerConfig `mapstructure:"server"`
     Logger LoggerConfig `mapstructure:"logger"`
     CORS CORSConfig `mapstructure:"cors"`
+    Feed FeedConfig `mapstructure:"feed"`
+    Admin AdminConfig `mapstructure:"admin"`
+    Recommendations RecommendationsConfig `mapstructure:"recommendations"`
+    Payment PaymentConfig `mapstructure:"payment"`
+    Subscriptions SubscriptionsConfig `mapstructure:"subscriptions"`
+    GiftCertificates GiftCertificatesConfig `mapstructure:"gift_certificates"`
+    Loyalty LoyaltyConfig `mapstructure:"loyalty"`
+    Notifications NotificationsConfig `mapstructure:"notifications"`
+}
+
+// NotificationsConfig - адреса служебных писем. ManagerEmail берется из
+// MANAGER_EMAIL.
+type NotificationsConfig struct {
+    ManagerEmail string `mapstructure:"manager_email"` // кому уходят письма о заказах и выплатах
 }
 
 type ServerConfig struct {
     Version string `mapstructure:"version"`
 	Port string `mapstructure:"port"`
+    // TrustedProxies - адреса обратных прокси, которым доверяется X-Forwarded-For.
+    // Пусто - IP клиента берется из соединения и не может быть подделан заголовком.
+    TrustedProxies []string `mapstructure:"trusted_proxies"`
 }
 
 type LoggerConfig struct {
@@ -31,6 +48,99 @@ type CORSConfig struct {
 	MaxAge           int      `mapstructure:"max_age"`
 }
 
+type FeedConfig struct {
+    ShopName string `mapstructure:"shop_name"`
+    Company  string `mapstructure:"company"`
+    CacheTTL int    `mapstructure:"cache_ttl"` // секунды
+}
+
+// AdminConfig - доступ к маршрутам менеджеров. Токен берется из ADMIN_TOKEN.
+type AdminConfig struct {
+    Token string `mapstructure:"token"`
+}
+
+// RecommendationsConfig - пересчет блока «С этим товаром покупают»
+type RecommendationsConfig struct {
+    Interval   int `mapstructure:"interval"`    // период пересчета, секунды
+    MaxRelated int `mapstructure:"max_related"` // сколько связей хранить на товар
+    MinScore   int `mapstructure:"min_score"`   // минимум совместных покупок
+}
+
+// PaymentConfig - параметры приема платежей
+type PaymentConfig struct {
+    Provider            string         `mapstructure:"provider"`             // провайдер по умолчанию
+    FallbackProviders   []string       `mapstructure:"fallback_providers"`   // резервные провайдеры по порядку
+    SelectableProviders []string       `mapstructure:"selectable_providers"` // какие провайдеры, кроме основного, покупатель может выбрать сам; sandbox не добавлять
+    YooKassa            YooKassaConfig `mapstructure:"yookassa"`
+    Receipt             ReceiptConfig  `mapstructure:"receipt"`
+    Tinkoff             TinkoffConfig  `mapstructure:"tinkoff"`
+    Sandbox             SandboxConfig  `mapstructure:"sandbox"`
+    TwoStage            bool           `mapstructure:"two_stage"`          // холдирование с подтверждением менеджером
+    AutoVoidMargin      int            `mapstructure:"auto_void_margin"`   // за сколько секунд до истечения холда отменять его
+    AutoVoidInterval    int            `mapstructure:"auto_void_interval"` // период проверки истекающих холдов, секунды
+    ReconcileInterval   int            `mapstructure:"reconcile_interval"` // период сверки неоплаченных заказов, секунды
+    ReconcileDelay      int            `mapstructure:"reconcile_delay"`    // сколько секунд ждать вебхук до первой сверки
+    ReconcileMaxAge     int            `mapstructure:"reconcile_max_age"`  // через сколько секунд отменять неоплаченный заказ (срок жизни платежа)
+    PayoutsEnabled      bool           `mapstructure:"payouts_enabled"`    // принимать уведомления о выплатах (payout.*)
+}
+
+// YooKassaConfig - параметры клиента API ЮKassa. Идентификатор магазина и
+// секретный ключ берутся из YOOKASSA_SHOP_ID и YOOKASSA_SECRET_KEY.
+type YooKassaConfig struct {
+    Timeout          int `mapstructure:"timeout"`           // время на одну попытку запроса, секунды
+    ConnectTimeout   int `mapstructure:"connect_timeout"`   // установка соединения и TLS, секунды
+    MaxRetries       int `mapstructure:"max_retries"`       // повторы при сбое сети, 5xx и 429; 0 - без повторов
+    RetryMaxDelay    int `mapstructure:"retry_max_delay"`   // предельная пауза между попытками, секунды
+    BreakerThreshold int `mapstructure:"breaker_threshold"` // сбоев подряд до приостановки запросов; 0 - не приостанавливать
+    BreakerCooldown  int `mapstructure:"breaker_cooldown"`  // на сколько секунд приостанавливать запросы
+}
+
+// ReceiptConfig - налоговые признаки позиций чека 54-ФЗ по умолчанию. Ставку
+// НДС и предмет расчета можно переопределить у товара.
+type ReceiptConfig struct {
+    VatCode                int    `mapstructure:"vat_code"`                 // код ставки НДС: 1 - без НДС, 2 - 0%, 3 - 10%, 4 - 20%, ...
+    PaymentMode            string `mapstructure:"payment_mode"`             // способ расчета при оплате; при предоплате полный расчет - после передачи товара
+    PaymentSubject         string `mapstructure:"payment_subject"`          // предмет расчета товаров: commodity, excise, ...
+    DeliveryVatCode        int    `mapstructure:"delivery_vat_code"`        // ставка НДС доставки
+    DeliveryPaymentSubject string `mapstructure:"delivery_payment_subject"` // предмет расчета доставки
+}
+
+// TinkoffConfig - параметры Т-Кассы. Ключ терминала и пароль берутся из
+// TINKOFF_TERMINAL_KEY и TINKOFF_PASSWORD.
+type TinkoffConfig struct {
+    TerminalKey     string `mapstructure:"terminal_key"`
+    Password        string `mapstructure:"password"`
+    Taxation        string `mapstructure:"taxation"`         // система налогообложения: osn, usn_income, ...
+    NotificationURL string `mapstructure:"notification_url"` // адрес /webhook/payment/tinkoff
+}
+
+// SandboxConfig - тестовый провайдер для локальной разработки. Подключается,
+// если enabled или payment.provider = sandbox. Не включать на боевом сервере.
+type SandboxConfig struct {
+    Enabled bool   `mapstructure:"enabled"`
+    BaseURL string `mapstructure:"base_url"` // адрес бэкенда для страницы оплаты и вебхуков
+}
+
+// SubscriptionsConfig - автосписания по подпискам
+type SubscriptionsConfig struct {
+    Interval    int   `mapstructure:"interval"`     // период запуска планировщика списаний, секунды
+    RetryDelays []int `mapstructure:"retry_delays"` // паузы перед повторными списаниями после неудачи, секунды; после последней подписка отменяется
+}
+
+// GiftCertificatesConfig - подарочные сертификаты
+type GiftCertificatesConfig struct {
+    ValidityDays int `mapstructure:"validity_days"` // срок действия с момента покупки, дни; 0 - бессрочно
+}
+
+// LoyaltyConfig - бонусная программа
+type LoyaltyConfig struct {
+    Enabled         bool    `mapstructure:"enabled"`
+    EarnPercent     float64 `mapstructure:"earn_percent"`      // сколько процентов оплаченной деньгами суммы товаров начисляется бонусами
+    MaxSpendPercent float64 `mapstructure:"max_spend_percent"` // какую часть суммы товаров можно оплатить бонусами, проценты
+    ValidityDays    int     `mapstructure:"validity_days"`     // через сколько дней сгорают начисленные бонусы; 0 - не сгорают
+    ExpireInterval  int     `mapstructure:"expire_interval"`   // период списания сгоревших бонусов, секунды
+}
+
 var (
     cfg     *Config
     cfgOnce sync.Once
@@ -57,6 +167,59 @@ func Load() (*Config, error) {
         viper.SetDefault("database.port", 5432)
         viper.SetDefault("cors.allow_origins", []string{"*"})
         viper.SetDefault("cors.allow_methods", []string{"GET", "POST", "PUT", "DELETE"})
+        viper.SetDefault("feed.shop_name", "Vitalis Life")
+        viper.SetDefault("feed.company", "Vitalis Life")
+        viper.SetDefault("feed.cache_ttl", 3600)
+        viper.SetDefault("recommendations.interval", 3600)
+        viper.SetDefault("recommendations.max_related", 20)
+        viper.SetDefault("recommendations.min_score", 1)
+        viper.SetDefault("payment.provider", "yookassa")
+        viper.SetDefault("payment.selectable_providers", []string{"yookassa", "tinkoff"})
+        viper.SetDefault("payment.yookassa.timeout", 30)
+        viper.SetDefault("payment.yookassa.connect_timeout", 10)
+        viper.SetDefault("payment.yookassa.max_retries", 3)
+        viper.SetDefault("payment.yookassa.retry_max_delay", 5)
+        viper.SetDefault("payment.yookassa.breaker_threshold", 5)
+        viper.SetDefault("payment.yookassa.breaker_cooldown", 30)
+        viper.SetDefault("payment.receipt.vat_code", 1)
+        viper.SetDefault("payment.receipt.payment_mode", "full_prepayment")
+        viper.SetDefault("payment.receipt.payment_subject", "commodity")
+        viper.SetDefault("payment.receipt.delivery_vat_code", 1)
+        viper.SetDefault("payment.receipt.delivery_payment_subject", "service")
+        viper.SetDefault("payment.tinkoff.taxation", "usn_income")
+        viper.SetDefault("payment.sandbox.enabled", false)
+        viper.SetDefault("payment.sandbox.base_url", "http://localhost:8080")
+        viper.SetDefault("payment.two_stage", false)
+        viper.SetDefault("payment.auto_void_margin", 3600)
+        viper.SetDefault("payment.auto_void_interval", 600)
+        viper.SetDefault("payment.reconcile_interval", 300)
+        viper.SetDefault("payment.reconcile_delay", 300)
+        // Неоплаченный платеж ЮKassa отменяется через час; запас - чтобы увидеть отмену
+        viper.SetDefault("payment.reconcile_max_age", 4500)
+        viper.SetDefault("payment.payouts_enabled", false)
+        viper.SetDefault("subscriptions.interval", 300)
+        // Повторы через 1, 3 и 5 дней после неудачного списания
+        viper.SetDefault("subscriptions.retry_delays", []int{86400, 259200, 432000})
+        viper.SetDefault("gift_certificates.validity_days", 365)
+        viper.SetDefault("loyalty.enabled", false)
+        viper.SetDefault("loyalty.earn_percent", 5)
+        viper.SetDefault("loyalty.max_spend_percent", 30)
+        viper.SetDefault("loyalty.validity_days", 365)
+        viper.SetDefault("loyalty.expire_interval", 3600)
+        viper.SetDefault("notifications.manager_email", "orders@vitalis-life.ru")
+
+        envBindings := map[string]string{
+            "admin.token":                  "ADMIN_TOKEN",
+            "payment.tinkoff.terminal_key": "TINKOFF_TERMINAL_KEY",
+            "payment.tinkoff.password":     "TINKOFF_PASSWORD",
+            "notifications.manager_email":  "MANAGER_EMAIL",
+        }
+        for key, env := range envBindings {
+            if err := viper.BindEnv(key, env); err != nil {
+                loadErr = fmt.Errorf("failed to bind env %s: %w", env, err)
+                return
+            }
+        }
 
 
         if err := viper.ReadInConfig(); err != nil {
@@ -70,6 +233,11 @@ func Load() (*Config, error) {
             return
         }
 
+        if err := c.validateIntervals(); err != nil {
+            loadErr = fmt.Errorf("config validation failed: %w", err)
+            return
+        }
+
         // if err := validation.Config(&c); err != nil {
         //     loadErr = fmt.Errorf("config validation failed: %w", err)
         //     return
@@ -80,3 +248,24 @@ func Load() (*Config, error) {
 
     return cfg, loadErr
 }
+
+// validateIntervals проверяет периоды фоновых задач: time.NewTicker
+// паникует на нулевом и отрицательном периоде
+func (c *Config) validateIntervals() error {
+    intervals := []struct {
+        key   string
+        value int
+    }{
+        {"recommendations.interval", c.Recommendations.Interval},
+        {"payment.auto_void_interval", c.Payment.AutoVoidInterval},
+        {"payment.reconcile_interval", c.Payment.ReconcileInterval},
+        {"subscriptions.interval", c.Subscriptions.Interval},
+        {"loyalty.expire_interval", c.Loyalty.ExpireInterval},
+    }
+    for _, i := range intervals {
+        if i.value <= 0 {
+            return fmt.Errorf("%s должен быть больше нуля, получено %d", i.key, i.value)
+        }
+    }
+    return nil
+}
@@ -0,0 +1,291 @@
+package db
+
+import (
+	"backend/internal/domain/certificate"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type CertificateRepository struct {
+	db *sql.DB
+}
+
+func NewCertificateRepository(db *sql.DB) *CertificateRepository {
+	return &CertificateRepository{db: db}
+}
+
+const certificateColumns = `id, code, order_id, product_id, amount, balance, currency, email,
+	status, created_at, expires_at`
+
+func scanCertificate(row rowScanner) (*certificate.Certificate, error) {
+	var c certificate.Certificate
+	var expiresAt sql.NullTime
+
+	if err := row.Scan(
+		&c.ID,
+		&c.Code,
+		&c.OrderID,
+		&c.ProductID,
+		&c.Amount,
+		&c.Balance,
+		&c.Currency,
+		&c.Email,
+		&c.Status,
+		&c.CreatedAt,
+		&expiresAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		c.ExpiresAt = &expiresAt.Time
+	}
+	return &c, nil
+}
+
+func (r *CertificateRepository) Create(orderID int, certs []*certificate.Certificate) (created bool, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	// Блокировка заказа не дает выпустить сертификаты дважды при повторном уведомлении
+	if _, err = tx.Exec(`SELECT id FROM orders WHERE id = $1 FOR UPDATE`, orderID); err != nil {
+		return false, fmt.Errorf("ошибка блокировки заказа %d: %w", orderID, err)
+	}
+	var exists bool
+	if err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM gift_certificates WHERE order_id = $1)`, orderID).Scan(&exists); err != nil {
+		return false, fmt.Errorf("ошибка при получении сертификатов заказа %d: %w", orderID, err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	for _, c := range certs {
+		err = tx.QueryRow(`
+			INSERT INTO gift_certificates (code, order_id, product_id, amount, balance, currency,
+				email, status, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+			RETURNING id, created_at
+		`, c.Code, orderID, c.ProductID, c.Amount, c.Balance, c.Currency,
+			c.Email, c.Status, c.ExpiresAt).Scan(&c.ID, &c.CreatedAt)
+		if err != nil {
+			return false, fmt.Errorf("ошибка сохранения сертификата: %w", err)
+		}
+		c.OrderID = orderID
+	}
+
+	return true, nil
+}
+
+func (r *CertificateRepository) GetByCode(code string) (*certificate.Certificate, error) {
+	c, err := scanCertificate(r.db.QueryRow(`SELECT `+certificateColumns+` FROM gift_certificates WHERE code = $1`, code))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, certificate.ErrNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении сертификата: %w", err)
+	}
+	return c, nil
+}
+
+func (r *CertificateRepository) GetByOrderID(orderID int) ([]*certificate.Certificate, error) {
+	rows, err := r.db.Query(`SELECT `+certificateColumns+` FROM gift_certificates
+		WHERE order_id = $1
+		ORDER BY id`, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении сертификатов: %w", err)
+	}
+	defer rows.Close()
+
+	certs := make([]*certificate.Certificate, 0)
+	for rows.Next() {
+		c, err := scanCertificate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании сертификата: %w", err)
+		}
+		certs = append(certs, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return certs, nil
+}
+
+func (r *CertificateRepository) Cancel(orderID, productID, count int) (int, error) {
+	result, err := r.db.Exec(`
+		UPDATE gift_certificates SET status = $1, balance = 0
+		WHERE id IN (
+			SELECT id FROM gift_certificates
+			WHERE order_id = $2 AND product_id = $3 AND status = $4 AND balance = amount
+			ORDER BY id
+			LIMIT $5
+			FOR UPDATE
+		)
+	`, certificate.StatusCanceled, orderID, productID, certificate.StatusActive, count)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка отмены сертификатов заказа %d: %w", orderID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка проверки измененных строк: %w", err)
+	}
+
+	return int(rowsAffected), nil
+}
+
+func (r *CertificateRepository) Redeem(code string, orderID int, currency string, limit float64, now time.Time) (redemption *certificate.Redemption, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	c, err := scanCertificate(tx.QueryRow(`SELECT `+certificateColumns+` FROM gift_certificates
+		WHERE code = $1
+		FOR UPDATE`, code))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, certificate.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении сертификата: %w", err)
+	}
+	if err = c.Available(currency, now); err != nil {
+		return nil, err
+	}
+
+	amount := limit
+	if c.Balance < amount {
+		amount = c.Balance
+	}
+
+	if _, err = tx.Exec(`UPDATE gift_certificates SET balance = balance - $1 WHERE id = $2`, amount, c.ID); err != nil {
+		return nil, fmt.Errorf("ошибка списания с сертификата: %w", err)
+	}
+	if _, err = tx.Exec(`UPDATE orders SET certificate_amount = certificate_amount + $1 WHERE id = $2`, amount, orderID); err != nil {
+		return nil, fmt.Errorf("ошибка обновления заказа %d: %w", orderID, err)
+	}
+
+	redemption = &certificate.Redemption{
+		CertificateID: c.ID,
+		OrderID:       orderID,
+		Amount:        amount,
+		Status:        certificate.RedemptionHeld,
+	}
+	err = tx.QueryRow(`
+		INSERT INTO gift_certificate_redemptions (certificate_id, order_id, amount, status)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, c.ID, orderID, amount, redemption.Status).Scan(&redemption.ID, &redemption.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сохранения списания с сертификата: %w", err)
+	}
+
+	return redemption, nil
+}
+
+func (r *CertificateRepository) Release(orderID int) (released float64, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	rows, err := tx.Query(`
+		UPDATE gift_certificate_redemptions SET status = $1, updated_at = NOW()
+		WHERE order_id = $2 AND status = $3
+		RETURNING certificate_id, amount
+	`, certificate.RedemptionReleased, orderID, certificate.RedemptionHeld)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка отмены списаний по заказу %d: %w", orderID, err)
+	}
+
+	amounts := make(map[int]float64)
+	for rows.Next() {
+		var certificateID int
+		var amount float64
+		if err = rows.Scan(&certificateID, &amount); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка при сканировании списания: %w", err)
+		}
+		amounts[certificateID] += amount
+		released += amount
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return 0, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	// Остаток отмененного сертификата не восстанавливается
+	for certificateID, amount := range amounts {
+		if _, err = tx.Exec(`UPDATE gift_certificates SET balance = balance + $1 WHERE id = $2 AND status = $3`,
+			amount, certificateID, certificate.StatusActive); err != nil {
+			return 0, fmt.Errorf("ошибка возврата остатка сертификата: %w", err)
+		}
+	}
+
+	return released, nil
+}
+
+func (r *CertificateRepository) Apply(orderID int) error {
+	_, err := r.db.Exec(`
+		UPDATE gift_certificate_redemptions SET status = $1, updated_at = NOW()
+		WHERE order_id = $2 AND status = $3
+	`, certificate.RedemptionApplied, orderID, certificate.RedemptionHeld)
+	if err != nil {
+		return fmt.Errorf("ошибка подтверждения списаний по заказу %d: %w", orderID, err)
+	}
+	return nil
+}
+
+func (r *CertificateRepository) GetRedemptions(certificateID int) ([]*certificate.Redemption, error) {
+	rows, err := r.db.Query(`
+		SELECT id, certificate_id, order_id, amount, status, created_at
+		FROM gift_certificate_redemptions
+		WHERE certificate_id = $1
+		ORDER BY created_at, id
+	`, certificateID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении списаний: %w", err)
+	}
+	defer rows.Close()
+
+	redemptions := make([]*certificate.Redemption, 0)
+	for rows.Next() {
+		var rd certificate.Redemption
+		if err := rows.Scan(&rd.ID, &rd.CertificateID, &rd.OrderID, &rd.Amount, &rd.Status, &rd.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании списания: %w", err)
+		}
+		redemptions = append(redemptions, &rd)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return redemptions, nil
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"backend/internal/domain/payment"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// staleReservation - через сколько незавершенная резервация ключа считается
+// брошенной (процесс упал посреди создания платежа) и ключ можно занять снова
+const staleReservation = "10 minutes"
+
+type IdempotencyRepository struct {
+	db *sql.DB
+}
+
+func NewIdempotencyRepository(db *sql.DB) *IdempotencyRepository {
+	return &IdempotencyRepository{db: db}
+}
+
+func (r *IdempotencyRepository) Reserve(scope, key, requestHash string) (*payment.IdempotencyRecord, bool, error) {
+	query := `
+		INSERT INTO payment_idempotency (scope, key, request_hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (scope, key) DO UPDATE
+			SET status = 'in_progress', updated_at = NOW()
+			WHERE payment_idempotency.request_hash = EXCLUDED.request_hash
+			  AND (payment_idempotency.status = 'failed'
+			    OR (payment_idempotency.status = 'in_progress'
+			      AND payment_idempotency.updated_at < NOW() - INTERVAL '` + staleReservation + `'))
+		RETURNING COALESCE(order_id, 0)
+	`
+
+	reserved := payment.IdempotencyRecord{Scope: scope, Key: key, RequestHash: requestHash}
+	err := r.db.QueryRow(query, scope, key, requestHash).Scan(&reserved.OrderID)
+	if err == nil {
+		return &reserved, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, false, fmt.Errorf("ошибка резервирования ключа идемпотентности: %w", err)
+	}
+
+	var rec payment.IdempotencyRecord
+	var status string
+	var orderID sql.NullInt64
+	var paymentID sql.NullString
+	var response []byte
+
+	if err := r.db.QueryRow(`
+		SELECT scope, key, request_hash, status, order_id, payment_id, response, created_at
+		FROM payment_idempotency WHERE scope = $1 AND key = $2
+	`, scope, key).Scan(&rec.Scope, &rec.Key, &rec.RequestHash, &status, &orderID, &paymentID, &response, &rec.CreatedAt); err != nil {
+		return nil, false, fmt.Errorf("ошибка чтения ключа идемпотентности: %w", err)
+	}
+
+	rec.Completed = status == "completed"
+	rec.OrderID = int(orderID.Int64)
+	rec.PaymentID = paymentID.String
+	rec.Response = response
+
+	return &rec, false, nil
+}
+
+func (r *IdempotencyRepository) AttachOrder(scope, key string, orderID int) error {
+	query := `UPDATE payment_idempotency SET order_id = $3, updated_at = NOW() WHERE scope = $1 AND key = $2`
+
+	if _, err := r.db.Exec(query, scope, key, orderID); err != nil {
+		return fmt.Errorf("ошибка сохранения заказа по ключу идемпотентности: %w", err)
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) Complete(scope, key, paymentID string, response []byte) error {
+	query := `
+		UPDATE payment_idempotency
+		SET status = 'completed', payment_id = $3, response = $4, updated_at = NOW()
+		WHERE scope = $1 AND key = $2
+	`
+
+	if _, err := r.db.Exec(query, scope, key, paymentID, response); err != nil {
+		return fmt.Errorf("ошибка сохранения ответа по ключу идемпотентности: %w", err)
+	}
+	return nil
+}
+
+func (r *IdempotencyRepository) Release(scope, key string) error {
+	// Ключ без заказа удаляется - его можно использовать с другим запросом.
+	// Ключ с заказом помечается неудачным: повтор продолжит тот же заказ.
+	query := `
+		WITH released AS (
+			DELETE FROM payment_idempotency
+			WHERE scope = $1 AND key = $2 AND status = 'in_progress' AND order_id IS NULL
+		)
+		UPDATE payment_idempotency SET status = 'failed', updated_at = NOW()
+		WHERE scope = $1 AND key = $2 AND status = 'in_progress' AND order_id IS NOT NULL
+	`
+
+	if _, err := r.db.Exec(query, scope, key); err != nil {
+		return fmt.Errorf("ошибка освобождения ключа идемпотентности: %w", err)
+	}
+	return nil
+}
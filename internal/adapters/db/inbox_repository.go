@@ -0,0 +1,163 @@
+package db
+
+import (
+	"backend/internal/domain/payment"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// staleClaim - через сколько захваченное событие считается брошенным
+// (процесс упал во время обработки) и его можно захватить снова
+const staleClaim = "10 minutes"
+
+type InboxRepository struct {
+	db *sql.DB
+}
+
+func NewInboxRepository(db *sql.DB) *InboxRepository {
+	return &InboxRepository{db: db}
+}
+
+const inboxColumns = `id, provider, event_type, object_id, source, payload, raw_body,
+	status, attempts, last_error, received_at, processed_at`
+
+func scanInboxEvent(row rowScanner) (*payment.InboxEvent, error) {
+	var e payment.InboxEvent
+	var payload []byte
+	var processedAt sql.NullTime
+
+	if err := row.Scan(
+		&e.ID,
+		&e.Provider,
+		&e.EventType,
+		&e.ObjectID,
+		&e.Source,
+		&payload,
+		&e.RawBody,
+		&e.Status,
+		&e.Attempts,
+		&e.LastError,
+		&e.ReceivedAt,
+		&processedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	e.Payload = payload
+	if processedAt.Valid {
+		e.ProcessedAt = &processedAt.Time
+	}
+
+	return &e, nil
+}
+
+func (r *InboxRepository) Save(e *payment.InboxEvent) (bool, error) {
+	query := `
+		INSERT INTO payment_inbox (provider, event_type, object_id, source, payload, raw_body)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (provider, event_type, object_id) DO NOTHING
+		RETURNING ` + inboxColumns
+
+	saved, err := scanInboxEvent(r.db.QueryRow(query,
+		e.Provider, e.EventType, e.ObjectID, e.Source, []byte(e.Payload), e.RawBody))
+	if err == nil {
+		*e = *saved
+		return true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return false, fmt.Errorf("ошибка сохранения события: %w", err)
+	}
+
+	existing, err := scanInboxEvent(r.db.QueryRow(`
+		SELECT `+inboxColumns+` FROM payment_inbox
+		WHERE provider = $1 AND event_type = $2 AND object_id = $3
+	`, e.Provider, e.EventType, e.ObjectID))
+	if err != nil {
+		return false, fmt.Errorf("ошибка чтения события: %w", err)
+	}
+
+	*e = *existing
+	return false, nil
+}
+
+func (r *InboxRepository) GetByID(id int) (*payment.InboxEvent, error) {
+	e, err := scanInboxEvent(r.db.QueryRow(`SELECT `+inboxColumns+` FROM payment_inbox WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: id %d", payment.ErrInboxEventNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка при получении события: %w", err)
+	}
+
+	return e, nil
+}
+
+func (r *InboxRepository) GetByStatus(status payment.InboxStatus, limit, offset int) ([]*payment.InboxEvent, error) {
+	query := `SELECT ` + inboxColumns + ` FROM payment_inbox
+		WHERE status = $1
+		ORDER BY received_at DESC
+		LIMIT $2 OFFSET $3`
+
+	rows, err := r.db.Query(query, status, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении событий: %w", err)
+	}
+	defer rows.Close()
+
+	events := make([]*payment.InboxEvent, 0)
+	for rows.Next() {
+		e, err := scanInboxEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании событий: %w", err)
+		}
+		events = append(events, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return events, nil
+}
+
+func (r *InboxRepository) Claim(id int) (bool, error) {
+	query := `
+		UPDATE payment_inbox
+		SET status = 'processing', attempts = attempts + 1, claimed_at = NOW()
+		WHERE id = $1
+		  AND (status IN ('received', 'failed', 'rejected')
+		       OR (status = 'processing' AND claimed_at < NOW() - INTERVAL '` + staleClaim + `'))
+	`
+
+	res, err := r.db.Exec(query, id)
+	if err != nil {
+		return false, fmt.Errorf("ошибка захвата события: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка захвата события: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (r *InboxRepository) MarkProcessed(id int) error {
+	if _, err := r.db.Exec(`
+		UPDATE payment_inbox SET status = 'processed', last_error = '', processed_at = NOW()
+		WHERE id = $1
+	`, id); err != nil {
+		return fmt.Errorf("ошибка обновления события: %w", err)
+	}
+	return nil
+}
+
+func (r *InboxRepository) MarkFailed(id int, status payment.InboxStatus, lastError string) error {
+	if _, err := r.db.Exec(`
+		UPDATE payment_inbox SET status = $2, last_error = $3
+		WHERE id = $1
+	`, id, status, lastError); err != nil {
+		return fmt.Errorf("ошибка обновления события: %w", err)
+	}
+	return nil
+}
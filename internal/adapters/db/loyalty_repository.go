@@ -0,0 +1,332 @@
+package db
+
+import (
+	"backend/internal/domain/loyalty"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+type LoyaltyRepository struct {
+	db *sql.DB
+}
+
+func NewLoyaltyRepository(db *sql.DB) *LoyaltyRepository {
+	return &LoyaltyRepository{db: db}
+}
+
+const loyaltyAccountColumns = `id, email, token, balance, created_at`
+
+func scanLoyaltyAccount(row rowScanner) (*loyalty.Account, error) {
+	var a loyalty.Account
+	if err := row.Scan(&a.ID, &a.Email, &a.Token, &a.Balance, &a.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+const loyaltyEntryColumns = `id, account_id, kind, amount, remaining, COALESCE(order_id, 0), reference,
+	expires_at, created_at`
+
+func scanLoyaltyEntry(row rowScanner) (*loyalty.Entry, error) {
+	var e loyalty.Entry
+	var expiresAt sql.NullTime
+
+	if err := row.Scan(
+		&e.ID,
+		&e.AccountID,
+		&e.Kind,
+		&e.Amount,
+		&e.Remaining,
+		&e.OrderID,
+		&e.Reference,
+		&expiresAt,
+		&e.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if expiresAt.Valid {
+		e.ExpiresAt = &expiresAt.Time
+	}
+	return &e, nil
+}
+
+func (r *LoyaltyRepository) GetOrCreateAccount(email, token string) (*loyalty.Account, error) {
+	_, err := r.db.Exec(`
+		INSERT INTO loyalty_accounts (email, token)
+		VALUES ($1, $2)
+		ON CONFLICT (email) DO NOTHING
+	`, email, token)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания бонусного счета: %w", err)
+	}
+	return r.GetByEmail(email)
+}
+
+func (r *LoyaltyRepository) GetByEmail(email string) (*loyalty.Account, error) {
+	return r.getAccount(`SELECT `+loyaltyAccountColumns+` FROM loyalty_accounts WHERE email = $1`, email)
+}
+
+func (r *LoyaltyRepository) GetByToken(token string) (*loyalty.Account, error) {
+	return r.getAccount(`SELECT `+loyaltyAccountColumns+` FROM loyalty_accounts WHERE token = $1`, token)
+}
+
+func (r *LoyaltyRepository) getAccount(query string, arg string) (*loyalty.Account, error) {
+	a, err := scanLoyaltyAccount(r.db.QueryRow(query, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, loyalty.ErrNotFound
+		}
+		return nil, fmt.Errorf("ошибка при получении бонусного счета: %w", err)
+	}
+	return a, nil
+}
+
+func (r *LoyaltyRepository) GetEntries(accountID, limit, offset int) ([]*loyalty.Entry, error) {
+	return r.queryEntries(`SELECT `+loyaltyEntryColumns+` FROM loyalty_ledger
+		WHERE account_id = $1
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3`, accountID, limit, offset)
+}
+
+func (r *LoyaltyRepository) GetOrderEntries(orderID int) ([]*loyalty.Entry, error) {
+	return r.queryEntries(`SELECT `+loyaltyEntryColumns+` FROM loyalty_ledger
+		WHERE order_id = $1
+		ORDER BY created_at, id`, orderID)
+}
+
+func (r *LoyaltyRepository) queryEntries(query string, args ...interface{}) ([]*loyalty.Entry, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении операций с бонусами: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make([]*loyalty.Entry, 0)
+	for rows.Next() {
+		e, err := scanLoyaltyEntry(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании операции с бонусами: %w", err)
+		}
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return entries, nil
+}
+
+func (r *LoyaltyRepository) Credit(e *loyalty.Entry) (credited bool, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	err = tx.QueryRow(`
+		INSERT INTO loyalty_ledger (account_id, kind, amount, remaining, order_id, reference, expires_at)
+		VALUES ($1, $2, $3, $3, NULLIF($4, 0), $5, $6)
+		ON CONFLICT (account_id, kind, reference) DO NOTHING
+		RETURNING id, created_at
+	`, e.AccountID, e.Kind, e.Amount, e.OrderID, e.Reference, e.ExpiresAt).Scan(&e.ID, &e.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка начисления бонусов: %w", err)
+	}
+	e.Remaining = e.Amount
+
+	if _, err = tx.Exec(`UPDATE loyalty_accounts SET balance = balance + $1 WHERE id = $2`, e.Amount, e.AccountID); err != nil {
+		return false, fmt.Errorf("ошибка обновления бонусного счета: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *LoyaltyRepository) Debit(e *loyalty.Entry, partial bool, now time.Time) (debited bool, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	// Блокировка счета не дает параллельным списаниям уйти в минус
+	if _, err = tx.Exec(`SELECT id FROM loyalty_accounts WHERE id = $1 FOR UPDATE`, e.AccountID); err != nil {
+		return false, fmt.Errorf("ошибка блокировки бонусного счета: %w", err)
+	}
+
+	var exists bool
+	if err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM loyalty_ledger WHERE account_id = $1 AND kind = $2 AND reference = $3)`,
+		e.AccountID, e.Kind, e.Reference).Scan(&exists); err != nil {
+		return false, fmt.Errorf("ошибка при получении операций с бонусами: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+
+	// Сгоревшие, но еще не списанные планировщиком бонусы тратить нельзя
+	if _, err = expireLots(tx, `AND account_id = $2`, now, e.AccountID); err != nil {
+		return false, err
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, remaining FROM loyalty_ledger
+		WHERE account_id = $1 AND remaining > 0
+		ORDER BY expires_at NULLS LAST, id
+	`, e.AccountID)
+	if err != nil {
+		return false, fmt.Errorf("ошибка при получении начислений: %w", err)
+	}
+	type lot struct {
+		id        int
+		remaining float64
+	}
+	var lots []lot
+	available := 0.0
+	for rows.Next() {
+		var l lot
+		if err = rows.Scan(&l.id, &l.remaining); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("ошибка при сканировании начисления: %w", err)
+		}
+		lots = append(lots, l)
+		available += l.remaining
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return false, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	amount := e.Amount
+	if amount > available+0.005 {
+		if !partial {
+			return false, fmt.Errorf("%w: на счете %.2f", loyalty.ErrInsufficientPoints, available)
+		}
+		amount = math.Round(available*100) / 100
+	}
+	if amount <= 0 {
+		return false, nil
+	}
+
+	left := amount
+	for _, l := range lots {
+		if left <= 0 {
+			break
+		}
+		take := math.Min(l.remaining, left)
+		if _, err = tx.Exec(`UPDATE loyalty_ledger SET remaining = remaining - $1 WHERE id = $2`, take, l.id); err != nil {
+			return false, fmt.Errorf("ошибка списания с начисления: %w", err)
+		}
+		left = math.Round((left-take)*100) / 100
+	}
+
+	if _, err = tx.Exec(`UPDATE loyalty_accounts SET balance = balance - $1 WHERE id = $2`, amount, e.AccountID); err != nil {
+		return false, fmt.Errorf("ошибка обновления бонусного счета: %w", err)
+	}
+
+	e.Amount = -amount
+	err = tx.QueryRow(`
+		INSERT INTO loyalty_ledger (account_id, kind, amount, order_id, reference)
+		VALUES ($1, $2, $3, NULLIF($4, 0), $5)
+		RETURNING id, created_at
+	`, e.AccountID, e.Kind, e.Amount, e.OrderID, e.Reference).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("ошибка сохранения списания бонусов: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *LoyaltyRepository) Expire(now time.Time) (expired int, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	// Счета блокируются в том же порядке, что и при списании, - сначала счет,
+	// потом его начисления
+	if _, err = tx.Exec(`
+		SELECT id FROM loyalty_accounts
+		WHERE id IN (SELECT account_id FROM loyalty_ledger WHERE remaining > 0 AND expires_at <= $1)
+		ORDER BY id
+		FOR UPDATE
+	`, now); err != nil {
+		return 0, fmt.Errorf("ошибка блокировки бонусных счетов: %w", err)
+	}
+
+	return expireLots(tx, "", now)
+}
+
+// expireLots списывает остатки начислений со сроком до now. filter
+// дополняет условие выборки начислений, его параметры начинаются с $2.
+func expireLots(tx *sql.Tx, filter string, now time.Time, args ...interface{}) (int, error) {
+	rows, err := tx.Query(`
+		SELECT id, account_id, remaining FROM loyalty_ledger
+		WHERE remaining > 0 AND expires_at <= $1 `+filter+`
+		ORDER BY id
+		FOR UPDATE
+	`, append([]interface{}{now}, args...)...)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка при получении сгорающих бонусов: %w", err)
+	}
+	type lot struct {
+		id        int
+		accountID int
+		remaining float64
+	}
+	var lots []lot
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.accountID, &l.remaining); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("ошибка при сканировании начисления: %w", err)
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	for _, l := range lots {
+		if _, err := tx.Exec(`UPDATE loyalty_ledger SET remaining = 0 WHERE id = $1`, l.id); err != nil {
+			return 0, fmt.Errorf("ошибка списания сгоревших бонусов: %w", err)
+		}
+		if _, err := tx.Exec(`UPDATE loyalty_accounts SET balance = balance - $1 WHERE id = $2`, l.remaining, l.accountID); err != nil {
+			return 0, fmt.Errorf("ошибка обновления бонусного счета: %w", err)
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO loyalty_ledger (account_id, kind, amount, reference)
+			VALUES ($1, $2, $3, $4)
+		`, l.accountID, loyalty.KindExpire, -l.remaining, fmt.Sprintf("lot:%d", l.id)); err != nil {
+			return 0, fmt.Errorf("ошибка сохранения сгорания бонусов: %w", err)
+		}
+	}
+
+	return len(lots), nil
+}
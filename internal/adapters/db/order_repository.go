@@ -0,0 +1,668 @@
+package db
+
+import (
+	"backend/internal/domain/order"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type OrderRepository struct {
+	db *sql.DB
+}
+
+func NewOrderRepository(db *sql.DB) *OrderRepository {
+	return &OrderRepository{db: db}
+}
+
+const orderColumns = `id, payment_id, provider, email, phone, customer_name, delivery_type,
+	delivery_address, comment, items, items_total, delivery_cost, amount,
+	currency, status, created_at, paid_at, hold_expires_at, fulfillment_status, fulfilled_at, offline_method,
+	certificate_amount, bonus_amount`
+
+func scanOrder(row rowScanner) (*order.Order, error) {
+	var o order.Order
+	var paymentID sql.NullString
+	var items []byte
+	var paidAt, holdExpiresAt, fulfilledAt sql.NullTime
+	var fulfillmentStatus, offlineMethod sql.NullString
+
+	if err := row.Scan(
+		&o.ID,
+		&paymentID,
+		&o.Provider,
+		&o.Email,
+		&o.Phone,
+		&o.CustomerName,
+		&o.DeliveryType,
+		&o.DeliveryAddress,
+		&o.Comment,
+		&items,
+		&o.ItemsTotal,
+		&o.DeliveryCost,
+		&o.Amount,
+		&o.Currency,
+		&o.Status,
+		&o.CreatedAt,
+		&paidAt,
+		&holdExpiresAt,
+		&fulfillmentStatus,
+		&fulfilledAt,
+		&offlineMethod,
+		&o.CertificateAmount,
+		&o.BonusAmount,
+	); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(items, &o.Items); err != nil {
+		return nil, fmt.Errorf("ошибка разбора позиций заказа %d: %w", o.ID, err)
+	}
+
+	o.PaymentID = paymentID.String
+	if paidAt.Valid {
+		o.PaidAt = &paidAt.Time
+	}
+	if holdExpiresAt.Valid {
+		o.HoldExpiresAt = &holdExpiresAt.Time
+	}
+	o.FulfillmentStatus = order.FulfillmentStatus(fulfillmentStatus.String)
+	if fulfilledAt.Valid {
+		o.FulfilledAt = &fulfilledAt.Time
+	}
+	o.OfflineMethod = order.OfflineMethod(offlineMethod.String)
+
+	return &o, nil
+}
+
+// Create сохраняет новый заказ, заполняет его ID и дату создания и списывает
+// остатки товаров. Остаток может уйти в минус - оформление заказа не
+// блокируется, а перепродажа видна по отрицательному остатку.
+func (r *OrderRepository) Create(o *order.Order) (err error) {
+	items, err := json.Marshal(o.Items)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации позиций заказа: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	query := `
+		INSERT INTO orders (email, phone, customer_name, delivery_type, delivery_address,
+			comment, items, items_total, delivery_cost, amount, currency, status, provider, bonus_amount)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		RETURNING id, created_at
+	`
+
+	if err = tx.QueryRow(query,
+		o.Email,
+		o.Phone,
+		o.CustomerName,
+		o.DeliveryType,
+		o.DeliveryAddress,
+		o.Comment,
+		items,
+		o.ItemsTotal,
+		o.DeliveryCost,
+		o.Amount,
+		o.Currency,
+		o.Status,
+		o.Provider,
+		o.BonusAmount,
+	).Scan(&o.ID, &o.CreatedAt); err != nil {
+		return fmt.Errorf("ошибка сохранения заказа: %w", err)
+	}
+
+	for _, item := range o.Items {
+		if err = adjustStock(tx, item.ProductID, -item.Quantity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *OrderRepository) GetByID(id int) (*order.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE id = $1`
+
+	o, err := scanOrder(r.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: id %d", order.ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка при получении заказа: %w", err)
+	}
+
+	return o, nil
+}
+
+func (r *OrderRepository) GetByPaymentID(paymentID string) (*order.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders WHERE payment_id = $1`
+
+	o, err := scanOrder(r.db.QueryRow(query, paymentID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: payment_id %s", order.ErrNotFound, paymentID)
+		}
+		return nil, fmt.Errorf("ошибка при получении заказа: %w", err)
+	}
+
+	return o, nil
+}
+
+func (r *OrderRepository) GetByStatus(status order.Status, limit, offset int) ([]*order.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders
+		WHERE status = $1
+		ORDER BY created_at
+		LIMIT $2 OFFSET $3`
+
+	return r.query(query, status, limit, offset)
+}
+
+func (r *OrderRepository) GetExpiringHolds(before time.Time) ([]*order.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders
+		WHERE status = $1 AND hold_expires_at IS NOT NULL AND hold_expires_at < $2
+		ORDER BY hold_expires_at`
+
+	return r.query(query, order.StatusWaitingForCapture, before)
+}
+
+func (r *OrderRepository) GetPendingPayments(from, to time.Time) ([]*order.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders
+		WHERE status = $1 AND payment_id IS NOT NULL AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at`
+
+	return r.query(query, order.StatusPending, from, to)
+}
+
+func (r *OrderRepository) GetStalePending(before time.Time) ([]*order.Order, error) {
+	query := `SELECT ` + orderColumns + ` FROM orders
+		WHERE status = $1 AND provider IS DISTINCT FROM $2 AND created_at < $3
+		ORDER BY created_at`
+
+	return r.query(query, order.StatusPending, order.ProviderOffline, before)
+}
+
+func (r *OrderRepository) AttachPayment(id int, provider, paymentID string) error {
+	return r.exec(id, `UPDATE orders SET provider = $1, payment_id = $2 WHERE id = $3`, provider, paymentID, id)
+}
+
+func (r *OrderRepository) UpdateStatus(id int, status order.Status) error {
+	return r.exec(id, `UPDATE orders SET status = $1 WHERE id = $2`, status, id)
+}
+
+func (r *OrderRepository) Cancel(id int) (canceled bool, err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return false, fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var data []byte
+	err = tx.QueryRow(`
+		UPDATE orders SET status = $1
+		WHERE id = $2 AND status IN ($3, $4)
+		RETURNING items
+	`, order.StatusCanceled, id, order.StatusPending, order.StatusWaitingForCapture).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		var exists bool
+		if err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM orders WHERE id = $1)`, id).Scan(&exists); err != nil {
+			return false, fmt.Errorf("ошибка при получении заказа: %w", err)
+		}
+		if !exists {
+			return false, fmt.Errorf("%w: id %d", order.ErrNotFound, id)
+		}
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка отмены заказа %d: %w", id, err)
+	}
+
+	var items []order.Item
+	if err = json.Unmarshal(data, &items); err != nil {
+		return false, fmt.Errorf("ошибка разбора позиций заказа %d: %w", id, err)
+	}
+
+	for _, item := range items {
+		if err = adjustStock(tx, item.ProductID, item.Quantity); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+func (r *OrderRepository) MarkPaid(id int, paidAt time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE orders SET status = $1, paid_at = $2
+		WHERE id = $3 AND status IN ($4, $5)
+	`, order.StatusPaid, paidAt, id, order.StatusPending, order.StatusWaitingForCapture)
+	if err != nil {
+		return false, fmt.Errorf("ошибка обновления заказа %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки измененных строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *OrderRepository) MarkPaidOffline(id int, method order.OfflineMethod, paidAt time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE orders SET status = $1, paid_at = $2, offline_method = $3
+		WHERE id = $4 AND status = $5 AND provider = $6
+	`, order.StatusPaid, paidAt, string(method), id, order.StatusPending, order.ProviderOffline)
+	if err != nil {
+		return false, fmt.Errorf("ошибка обновления заказа %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки измененных строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *OrderRepository) SetWaitingForCapture(id int, holdExpiresAt *time.Time) error {
+	return r.exec(id, `UPDATE orders SET status = $1, hold_expires_at = $2 WHERE id = $3`,
+		order.StatusWaitingForCapture, holdExpiresAt, id)
+}
+
+func (r *OrderRepository) UpdateItems(id int, items []order.Item, itemsTotal, amount float64) (err error) {
+	data, err := json.Marshal(items)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации позиций заказа: %w", err)
+	}
+
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	var oldData []byte
+	if err = tx.QueryRow(`SELECT items FROM orders WHERE id = $1 FOR UPDATE`, id).Scan(&oldData); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: id %d", order.ErrNotFound, id)
+		}
+		return fmt.Errorf("ошибка при получении заказа: %w", err)
+	}
+
+	var oldItems []order.Item
+	if err = json.Unmarshal(oldData, &oldItems); err != nil {
+		return fmt.Errorf("ошибка разбора позиций заказа %d: %w", id, err)
+	}
+
+	if _, err = tx.Exec(`UPDATE orders SET items = $1, items_total = $2, amount = $3 WHERE id = $4`,
+		data, itemsTotal, amount, id); err != nil {
+		return fmt.Errorf("ошибка обновления заказа %d: %w", id, err)
+	}
+
+	// Возвращаем в остатки то, что исключено из заказа
+	delta := make(map[int]float64)
+	for _, item := range oldItems {
+		delta[item.ProductID] += item.Quantity
+	}
+	for _, item := range items {
+		delta[item.ProductID] -= item.Quantity
+	}
+	for productID, quantity := range delta {
+		if quantity = order.RoundQuantity(quantity); quantity == 0 {
+			continue
+		}
+		if err = adjustStock(tx, productID, quantity); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *OrderRepository) HasPaidProduct(email string, productID int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1 FROM orders
+			WHERE LOWER(email) = LOWER($1)
+			  AND status IN ($2, $3)
+			  AND items @> $4::jsonb
+		)
+	`
+
+	filter, err := json.Marshal([]map[string]int{{"productId": productID}})
+	if err != nil {
+		return false, fmt.Errorf("ошибка сериализации фильтра: %w", err)
+	}
+
+	var exists bool
+	if err := r.db.QueryRow(query, email, order.StatusPaid, order.StatusPartiallyRefunded, string(filter)).Scan(&exists); err != nil {
+		return false, fmt.Errorf("ошибка проверки покупки: %w", err)
+	}
+
+	return exists, nil
+}
+
+func (r *OrderRepository) query(query string, args ...interface{}) ([]*order.Order, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении заказов: %w", err)
+	}
+	defer rows.Close()
+
+	orders := []*order.Order{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании заказов: %w", err)
+		}
+		orders = append(orders, o)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return orders, nil
+}
+
+// adjustStock меняет остаток товара на delta. Удаленные из каталога товары пропускаются.
+func adjustStock(tx *sql.Tx, productID int, delta float64) error {
+	if _, err := tx.Exec(`UPDATE product SET stock = stock + $1 WHERE id = $2`, delta, productID); err != nil {
+		return fmt.Errorf("ошибка изменения остатка товара %d: %w", productID, err)
+	}
+	return nil
+}
+
+// exec выполняет UPDATE заказа и проверяет, что заказ существует
+func (r *OrderRepository) exec(id int, query string, args ...interface{}) error {
+	result, err := r.db.Exec(query, args...)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления заказа %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка проверки измененных строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id %d", order.ErrNotFound, id)
+	}
+
+	return nil
+}
+
+func (r *OrderRepository) AddRefund(refund *order.Refund) error {
+	items, err := json.Marshal(refund.Items)
+	if err != nil {
+		return fmt.Errorf("ошибка сериализации позиций возврата: %w", err)
+	}
+
+	// Уведомление об успешном возврате могло прийти раньше ответа API:
+	// тогда запись уже есть, дополняем ее и не понижаем статус
+	query := `
+		INSERT INTO order_refunds (order_id, refund_id, amount, items, include_delivery, reason, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (refund_id) DO UPDATE SET
+			items = EXCLUDED.items,
+			include_delivery = EXCLUDED.include_delivery,
+			reason = EXCLUDED.reason,
+			status = CASE WHEN order_refunds.status = 'succeeded' THEN order_refunds.status ELSE EXCLUDED.status END
+		RETURNING id, created_at, status
+	`
+
+	if err := r.db.QueryRow(query,
+		refund.OrderID,
+		refund.RefundID,
+		refund.Amount,
+		items,
+		refund.IncludeDelivery,
+		refund.Reason,
+		refund.Status,
+	).Scan(&refund.ID, &refund.CreatedAt, &refund.Status); err != nil {
+		return fmt.Errorf("ошибка сохранения возврата: %w", err)
+	}
+
+	return nil
+}
+
+func (r *OrderRepository) ConfirmRefund(refund *order.Refund) (bool, error) {
+	query := `
+		INSERT INTO order_refunds (order_id, refund_id, amount, reason, status)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (refund_id) DO UPDATE SET status = EXCLUDED.status
+		RETURNING id, amount, reason, created_at, (xmax = 0) AS created
+	`
+
+	var created bool
+	if err := r.db.QueryRow(query,
+		refund.OrderID,
+		refund.RefundID,
+		refund.Amount,
+		refund.Reason,
+		refund.Status,
+	).Scan(&refund.ID, &refund.Amount, &refund.Reason, &refund.CreatedAt, &created); err != nil {
+		return false, fmt.Errorf("ошибка подтверждения возврата: %w", err)
+	}
+
+	return created, nil
+}
+
+func (r *OrderRepository) GetRefunds(orderID int) ([]*order.Refund, error) {
+	query := `
+		SELECT id, order_id, refund_id, amount, items, include_delivery, reason, status, created_at
+		FROM order_refunds
+		WHERE order_id = $1
+		ORDER BY created_at
+	`
+
+	rows, err := r.db.Query(query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении возвратов: %w", err)
+	}
+	defer rows.Close()
+
+	refunds := []*order.Refund{}
+	for rows.Next() {
+		var refund order.Refund
+		var items []byte
+
+		if err := rows.Scan(
+			&refund.ID,
+			&refund.OrderID,
+			&refund.RefundID,
+			&refund.Amount,
+			&items,
+			&refund.IncludeDelivery,
+			&refund.Reason,
+			&refund.Status,
+			&refund.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании возвратов: %w", err)
+		}
+
+		if err := json.Unmarshal(items, &refund.Items); err != nil {
+			return nil, fmt.Errorf("ошибка разбора позиций возврата %d: %w", refund.ID, err)
+		}
+
+		refunds = append(refunds, &refund)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return refunds, nil
+}
+
+func (r *OrderRepository) AddMarkingCodes(orderID int, codes []order.MarkingCode) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	// Повторное сканирование кода того же заказа ничего не меняет,
+	// код чужого заказа не обновляется и строка не возвращается
+	query := `
+		INSERT INTO order_marking_codes (order_id, product_id, code)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (code) DO UPDATE SET product_id = EXCLUDED.product_id
+		WHERE order_marking_codes.order_id = EXCLUDED.order_id
+		RETURNING id, created_at
+	`
+	for i := range codes {
+		codes[i].OrderID = orderID
+		err = tx.QueryRow(query, orderID, codes[i].ProductID, codes[i].Code).Scan(&codes[i].ID, &codes[i].CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("%w: код %s уже привязан к другому заказу", order.ErrInvalidMarkingCode, codes[i].Code)
+		}
+		if err != nil {
+			return fmt.Errorf("ошибка сохранения кода маркировки: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (r *OrderRepository) GetMarkingCodes(orderID int) ([]*order.MarkingCode, error) {
+	query := `
+		SELECT id, order_id, product_id, code, created_at
+		FROM order_marking_codes
+		WHERE order_id = $1
+		ORDER BY id
+	`
+
+	rows, err := r.db.Query(query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении кодов маркировки: %w", err)
+	}
+	defer rows.Close()
+
+	codes := []*order.MarkingCode{}
+	for rows.Next() {
+		var code order.MarkingCode
+		if err := rows.Scan(&code.ID, &code.OrderID, &code.ProductID, &code.Code, &code.CreatedAt); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании кодов маркировки: %w", err)
+		}
+		codes = append(codes, &code)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return codes, nil
+}
+
+func (r *OrderRepository) SetFulfillment(id int, status order.FulfillmentStatus, fulfilledAt time.Time) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE orders SET fulfillment_status = $1, fulfilled_at = $2
+		WHERE id = $3 AND fulfillment_status IS NULL AND status IN ($4, $5)
+	`, string(status), fulfilledAt, id, order.StatusPaid, order.StatusPartiallyRefunded)
+	if err != nil {
+		return false, fmt.Errorf("ошибка обновления заказа %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки измененных строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *OrderRepository) AddReceipt(receipt *order.Receipt) (bool, error) {
+	query := `
+		INSERT INTO order_receipts (order_id, kind, receipt_id, refund_id, amount, status)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6)
+		ON CONFLICT (order_id, kind) WHERE kind <> 'refund' DO NOTHING
+		RETURNING id, created_at
+	`
+
+	err := r.db.QueryRow(query,
+		receipt.OrderID,
+		string(receipt.Kind),
+		receipt.ReceiptID,
+		receipt.RefundID,
+		receipt.Amount,
+		receipt.Status,
+	).Scan(&receipt.ID, &receipt.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("ошибка сохранения чека: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *OrderRepository) GetReceipts(orderID int) ([]*order.Receipt, error) {
+	query := `
+		SELECT id, order_id, kind, COALESCE(receipt_id, ''), COALESCE(refund_id, ''), amount, status, created_at
+		FROM order_receipts
+		WHERE order_id = $1
+		ORDER BY created_at, id
+	`
+
+	rows, err := r.db.Query(query, orderID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении чеков: %w", err)
+	}
+	defer rows.Close()
+
+	receipts := []*order.Receipt{}
+	for rows.Next() {
+		var receipt order.Receipt
+		if err := rows.Scan(
+			&receipt.ID,
+			&receipt.OrderID,
+			&receipt.Kind,
+			&receipt.ReceiptID,
+			&receipt.RefundID,
+			&receipt.Amount,
+			&receipt.Status,
+			&receipt.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании чеков: %w", err)
+		}
+		receipts = append(receipts, &receipt)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return receipts, nil
+}
@@ -5,6 +5,9 @@ import (
     "backend/internal/domain/product"
     "fmt"
     "errors"
+    "strings"
+
+    "github.com/lib/pq"
 )
 
 type ProductRepository struct {
@@ -15,11 +18,157 @@ func NewUserRepository(db *sql.DB) *ProductRepository {
 	return &ProductRepository{db: db}
 }
 
+// productSelect выбирает товар вместе с его характеристиками
+const productSelect = `
+    SELECT p.id, p.title, p.slug, p.price, p.description, p.discount, p.img,
+           p.category_id, p.stock, p.created_at, p.vat_code, p.payment_subject,
+           p.marked, p.gift_certificate, p.unit, p.quantity_step, p.min_quantity,
+           a.composition, a.kcal, a.protein, a.fat, a.carbs,
+           a.allergens, a.certifications, a.shelf_life_days,
+           COALESCE(rs.rating, 0), COALESCE(rs.review_count, 0)
+    FROM product p
+    LEFT JOIN product_attributes a ON a.product_id = p.id
+    LEFT JOIN (
+        SELECT product_id, ROUND(AVG(rating), 1) AS rating, COUNT(*) AS review_count
+        FROM review
+        WHERE status = 'approved'
+        GROUP BY product_id
+    ) rs ON rs.product_id = p.id
+`
+
+// rowScanner - общий интерфейс для *sql.Row и *sql.Rows
+type rowScanner interface {
+    Scan(dest ...interface{}) error
+}
+
+// scanProduct читает товар из строки результата
+func scanProduct(row rowScanner) (*product.Product, error) {
+    var p product.Product
+    var img, slug, composition sql.NullString
+    var categoryID, shelfLife, vatCode sql.NullInt64
+    var paymentSubject sql.NullString
+    var kcal, protein, fat, carbs, stock sql.NullFloat64
+    var allergens, certifications []string
+
+    if err := row.Scan(
+        &p.ID,
+        &p.Title,
+        &slug,
+        &p.Price,
+        &p.Description,
+        &p.Discount,
+        &img,
+        &categoryID,
+        &stock,
+        &p.CreatedAt,
+        &vatCode,
+        &paymentSubject,
+        &p.Marked,
+        &p.GiftCertificate,
+        &p.Unit,
+        &p.QuantityStep,
+        &p.MinQuantity,
+        &composition,
+        &kcal,
+        &protein,
+        &fat,
+        &carbs,
+        pq.Array(&allergens),
+        pq.Array(&certifications),
+        &shelfLife,
+        &p.Rating,
+        &p.ReviewCount,
+    ); err != nil {
+        return nil, err
+    }
+
+    if img.Valid {
+        p.Image = img.String
+    }
+    if slug.Valid {
+        p.Slug = slug.String
+    }
+    if categoryID.Valid {
+        p.CategoryID = int(categoryID.Int64)
+    }
+    if stock.Valid {
+        p.Stock = &stock.Float64
+    }
+    p.VatCode = int(vatCode.Int64)
+    p.PaymentSubject = paymentSubject.String
+
+    p.Attributes = product.Attributes{
+        Composition:    composition.String,
+        ShelfLifeDays:  int(shelfLife.Int64),
+        Allergens:      make([]product.Allergen, 0, len(allergens)),
+        Certifications: make([]product.Certification, 0, len(certifications)),
+    }
+    if kcal.Valid {
+        p.Attributes.Nutrition = &product.Nutrition{
+            Kcal:    kcal.Float64,
+            Protein: protein.Float64,
+            Fat:     fat.Float64,
+            Carbs:   carbs.Float64,
+        }
+    }
+    for _, a := range allergens {
+        p.Attributes.Allergens = append(p.Attributes.Allergens, product.Allergen(a))
+    }
+    for _, c := range certifications {
+        p.Attributes.Certifications = append(p.Attributes.Certifications, product.Certification(c))
+    }
+
+    return &p, nil
+}
+
 // GetAll возвращает все продукты из базы данных
 func (r *ProductRepository) GetAll() ([]*product.Product, error) {
-    query := `SELECT id, title, price, description, discount, img, created_at FROM product`
-    
-    rows, err := r.db.Query(query)
+    return r.Find(product.Filter{})
+}
+
+// Find возвращает товары, подходящие под фильтр
+func (r *ProductRepository) Find(filter product.Filter) ([]*product.Product, error) {
+    var conditions []string
+    var args []interface{}
+
+    addArg := func(value interface{}) string {
+        args = append(args, value)
+        return fmt.Sprintf("$%d", len(args))
+    }
+
+    if filter.CategoryID > 0 {
+        conditions = append(conditions, "p.category_id = "+addArg(filter.CategoryID))
+    }
+    if len(filter.Certifications) > 0 {
+        values := make([]string, len(filter.Certifications))
+        for i, c := range filter.Certifications {
+            values[i] = string(c)
+        }
+        conditions = append(conditions, "a.certifications @> "+addArg(pq.Array(values)))
+    }
+    if len(filter.ExcludeAllergens) > 0 {
+        values := make([]string, len(filter.ExcludeAllergens))
+        for i, a := range filter.ExcludeAllergens {
+            values[i] = string(a)
+        }
+        // Товар без заполненных характеристик не попадает в выборку: про него
+        // нельзя утверждать, что он не содержит аллергенов
+        conditions = append(conditions, "a.product_id IS NOT NULL AND NOT (a.allergens && "+addArg(pq.Array(values))+")")
+    }
+    if filter.MaxKcal > 0 {
+        conditions = append(conditions, "a.kcal <= "+addArg(filter.MaxKcal))
+    }
+    if filter.MinProtein > 0 {
+        conditions = append(conditions, "a.protein >= "+addArg(filter.MinProtein))
+    }
+
+    query := productSelect
+    if len(conditions) > 0 {
+        query += " WHERE " + strings.Join(conditions, " AND ")
+    }
+    query += " ORDER BY p.id"
+
+    rows, err := r.db.Query(query, args...)
     if err != nil {
         return nil, fmt.Errorf("ошибка при получении товаров: %w", err)
     }
@@ -27,55 +176,147 @@ func (r *ProductRepository) GetAll() ([]*product.Product, error) {
 
     var products []*product.Product
     for rows.Next() {
-        var p product.Product
-        var img sql.NullString
-        
-        if err := rows.Scan(
-            &p.ID,
-            &p.Title,
-            &p.Price,
-            &p.Description,
-            &p.Discount,
-            &img,
-            &p.CreatedAt,
-        ); err != nil {
+        p, err := scanProduct(rows)
+        if err != nil {
             return nil, fmt.Errorf("ошибка при сканировании товаров: %w", err)
         }
-        
-        if img.Valid {
-            p.Image = img.String
-        }
-        
-        products = append(products, &p)
+
+        products = append(products, p)
     }
 
     if err := rows.Err(); err != nil {
         return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
     }
-    
+
     return products, nil
 }
 
 func (r *ProductRepository) GetByID(id int) (*product.Product, error) {
-    query := `SELECT id, title, price, description, discount, img, created_at FROM product WHERE id = $1`
-    
-    var p product.Product
-    err := r.db.QueryRow(query, id).Scan(
-        &p.ID,
-        &p.Title,
-        &p.Price,
-        &p.Description,
-        &p.Discount,
-        &p.Image,
-        &p.CreatedAt,
-    )
-    
+    query := productSelect + ` WHERE p.id = $1`
+
+    p, err := scanProduct(r.db.QueryRow(query, id))
     if err != nil {
         if errors.Is(err, sql.ErrNoRows) {
-            return nil, fmt.Errorf("товар с id %d не найден", id)
+            return nil, fmt.Errorf("%w: id %d", product.ErrNotFound, id)
         }
         return nil, fmt.Errorf("ошибка при получении товара: %w", err)
     }
-    
-    return &p, nil
+
+    return p, nil
+}
+
+// GetCategories возвращает все категории каталога
+func (r *ProductRepository) GetCategories() ([]*product.Category, error) {
+    query := `SELECT id, name, parent_id FROM category ORDER BY id`
+
+    rows, err := r.db.Query(query)
+    if err != nil {
+        return nil, fmt.Errorf("ошибка при получении категорий: %w", err)
+    }
+    defer rows.Close()
+
+    var categories []*product.Category
+    for rows.Next() {
+        var c product.Category
+        var parentID sql.NullInt64
+
+        if err := rows.Scan(&c.ID, &c.Name, &parentID); err != nil {
+            return nil, fmt.Errorf("ошибка при сканировании категорий: %w", err)
+        }
+
+        if parentID.Valid {
+            c.ParentID = int(parentID.Int64)
+        }
+
+        categories = append(categories, &c)
+    }
+
+    if err := rows.Err(); err != nil {
+        return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+    }
+
+    return categories, nil
+}
+
+// GetBySlug возвращает товар по его текущему slug
+func (r *ProductRepository) GetBySlug(slug string) (*product.Product, error) {
+    query := productSelect + ` WHERE p.slug = $1`
+
+    p, err := scanProduct(r.db.QueryRow(query, slug))
+    if err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return nil, fmt.Errorf("%w: slug %s", product.ErrNotFound, slug)
+        }
+        return nil, fmt.Errorf("ошибка при получении товара: %w", err)
+    }
+
+    return p, nil
+}
+
+func (r *ProductRepository) GetSlugRedirect(oldSlug string) (string, error) {
+    query := `
+        SELECT p.slug
+        FROM product_slug_history h
+        JOIN product p ON p.id = h.product_id
+        WHERE h.slug = $1 AND p.slug IS NOT NULL
+    `
+
+    var slug string
+    if err := r.db.QueryRow(query, oldSlug).Scan(&slug); err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            return "", fmt.Errorf("%w: slug %s", product.ErrNotFound, oldSlug)
+        }
+        return "", fmt.Errorf("ошибка при поиске редиректа: %w", err)
+    }
+
+    return slug, nil
+}
+
+func (r *ProductRepository) IsSlugTaken(slug string, productID int) (bool, error) {
+    query := `
+        SELECT EXISTS (SELECT 1 FROM product WHERE slug = $1 AND id <> $2)
+            OR EXISTS (SELECT 1 FROM product_slug_history WHERE slug = $1 AND product_id <> $2)
+    `
+
+    var taken bool
+    if err := r.db.QueryRow(query, slug, productID).Scan(&taken); err != nil {
+        return false, fmt.Errorf("ошибка при проверке slug: %w", err)
+    }
+
+    return taken, nil
+}
+
+func (r *ProductRepository) UpdateSlug(productID int, newSlug, oldSlug string) (err error) {
+    tx, err := r.db.Begin()
+    if err != nil {
+        return fmt.Errorf("ошибка начала транзакции: %w", err)
+    }
+    defer func() {
+        if err != nil {
+            tx.Rollback()
+        } else {
+            err = tx.Commit()
+        }
+    }()
+
+    if oldSlug != "" {
+        if _, err = tx.Exec(`
+            INSERT INTO product_slug_history (slug, product_id)
+            VALUES ($1, $2)
+            ON CONFLICT (slug) DO NOTHING
+        `, oldSlug, productID); err != nil {
+            return fmt.Errorf("ошибка сохранения старого slug: %w", err)
+        }
+    }
+
+    // Если товару возвращают прежний slug, он больше не нужен в истории
+    if _, err = tx.Exec(`DELETE FROM product_slug_history WHERE slug = $1`, newSlug); err != nil {
+        return fmt.Errorf("ошибка очистки истории slug: %w", err)
+    }
+
+    if _, err = tx.Exec(`UPDATE product SET slug = $1 WHERE id = $2`, newSlug, productID); err != nil {
+        return fmt.Errorf("ошибка обновления slug: %w", err)
+    }
+
+    return nil
 }
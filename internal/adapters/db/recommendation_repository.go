@@ -0,0 +1,120 @@
+package db
+
+import (
+	"backend/internal/domain/order"
+	"backend/internal/domain/recommendation"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+type RecommendationRepository struct {
+	db *sql.DB
+}
+
+func NewRecommendationRepository(db *sql.DB) *RecommendationRepository {
+	return &RecommendationRepository{db: db}
+}
+
+func (r *RecommendationRepository) PaidOrderBaskets() ([][]int, error) {
+	rows, err := r.db.Query(`SELECT items FROM orders WHERE status IN ($1, $2)`,
+		order.StatusPaid, order.StatusPartiallyRefunded)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении заказов: %w", err)
+	}
+	defer rows.Close()
+
+	var baskets [][]int
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании заказов: %w", err)
+		}
+
+		var items []order.Item
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, fmt.Errorf("ошибка разбора позиций заказа: %w", err)
+		}
+
+		basket := make([]int, 0, len(items))
+		for _, item := range items {
+			basket = append(basket, item.ProductID)
+		}
+		baskets = append(baskets, basket)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return baskets, nil
+}
+
+func (r *RecommendationRepository) ReplaceRelated(related map[int][]recommendation.Related) (err error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return fmt.Errorf("ошибка начала транзакции: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	if _, err = tx.Exec(`DELETE FROM product_related`); err != nil {
+		return fmt.Errorf("ошибка очистки рекомендаций: %w", err)
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO product_related (product_id, related_id, score)
+		SELECT $1, $2, $3
+		WHERE EXISTS (SELECT 1 FROM product WHERE id = $1)
+		  AND EXISTS (SELECT 1 FROM product WHERE id = $2)
+	`)
+	if err != nil {
+		return fmt.Errorf("ошибка подготовки запроса: %w", err)
+	}
+	defer stmt.Close()
+
+	for productID, items := range related {
+		for _, item := range items {
+			if _, err = stmt.Exec(productID, item.ProductID, item.Score); err != nil {
+				return fmt.Errorf("ошибка сохранения рекомендаций: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (r *RecommendationRepository) GetRelated(productID, limit int) ([]recommendation.Related, error) {
+	query := `
+		SELECT related_id, score FROM product_related
+		WHERE product_id = $1
+		ORDER BY score DESC, related_id
+		LIMIT $2
+	`
+
+	rows, err := r.db.Query(query, productID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении рекомендаций: %w", err)
+	}
+	defer rows.Close()
+
+	var related []recommendation.Related
+	for rows.Next() {
+		var item recommendation.Related
+		if err := rows.Scan(&item.ProductID, &item.Score); err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании рекомендаций: %w", err)
+		}
+		related = append(related, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return related, nil
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"backend/internal/domain/review"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+type ReviewRepository struct {
+	db *sql.DB
+}
+
+func NewReviewRepository(db *sql.DB) *ReviewRepository {
+	return &ReviewRepository{db: db}
+}
+
+const reviewColumns = `id, product_id, author_name, email, rating, text, photos,
+	verified_purchase, status, moderator_comment, created_at, moderated_at`
+
+func scanReview(row rowScanner) (*review.Review, error) {
+	var rv review.Review
+	var moderatedAt sql.NullTime
+
+	if err := row.Scan(
+		&rv.ID,
+		&rv.ProductID,
+		&rv.AuthorName,
+		&rv.Email,
+		&rv.Rating,
+		&rv.Text,
+		pq.Array(&rv.Photos),
+		&rv.VerifiedPurchase,
+		&rv.Status,
+		&rv.ModeratorComment,
+		&rv.CreatedAt,
+		&moderatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if rv.Photos == nil {
+		rv.Photos = []string{}
+	}
+	if moderatedAt.Valid {
+		rv.ModeratedAt = &moderatedAt.Time
+	}
+
+	return &rv, nil
+}
+
+func (r *ReviewRepository) Create(rv *review.Review) error {
+	query := `
+		INSERT INTO review (product_id, author_name, email, rating, text, photos, verified_purchase, status)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	if err := r.db.QueryRow(query,
+		rv.ProductID,
+		rv.AuthorName,
+		rv.Email,
+		rv.Rating,
+		rv.Text,
+		pq.Array(rv.Photos),
+		rv.VerifiedPurchase,
+		rv.Status,
+	).Scan(&rv.ID, &rv.CreatedAt); err != nil {
+		return fmt.Errorf("ошибка сохранения отзыва: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReviewRepository) GetByID(id int) (*review.Review, error) {
+	query := `SELECT ` + reviewColumns + ` FROM review WHERE id = $1`
+
+	rv, err := scanReview(r.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: id %d", review.ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка при получении отзыва: %w", err)
+	}
+
+	return rv, nil
+}
+
+func (r *ReviewRepository) GetByProduct(productID int, status review.Status, limit, offset int) ([]*review.Review, error) {
+	query := `SELECT ` + reviewColumns + ` FROM review
+		WHERE product_id = $1 AND status = $2
+		ORDER BY created_at DESC
+		LIMIT $3 OFFSET $4`
+
+	return r.query(query, productID, status, limit, offset)
+}
+
+func (r *ReviewRepository) GetByStatus(status review.Status, limit, offset int) ([]*review.Review, error) {
+	query := `SELECT ` + reviewColumns + ` FROM review
+		WHERE status = $1
+		ORDER BY created_at
+		LIMIT $2 OFFSET $3`
+
+	return r.query(query, status, limit, offset)
+}
+
+func (r *ReviewRepository) Moderate(id int, status review.Status, comment string) error {
+	query := `
+		UPDATE review
+		SET status = $1, moderator_comment = $2, moderated_at = NOW()
+		WHERE id = $3
+	`
+
+	result, err := r.db.Exec(query, status, comment, id)
+	if err != nil {
+		return fmt.Errorf("ошибка модерации отзыва %d: %w", id, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка проверки измененных строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id %d", review.ErrNotFound, id)
+	}
+
+	return nil
+}
+
+func (r *ReviewRepository) query(query string, args ...interface{}) ([]*review.Review, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении отзывов: %w", err)
+	}
+	defer rows.Close()
+
+	reviews := []*review.Review{}
+	for rows.Next() {
+		rv, err := scanReview(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании отзывов: %w", err)
+		}
+		reviews = append(reviews, rv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return reviews, nil
+}
@@ -0,0 +1,338 @@
+package db
+
+import (
+	"backend/internal/domain/subscription"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type SubscriptionRepository struct {
+	db *sql.DB
+}
+
+func NewSubscriptionRepository(db *sql.DB) *SubscriptionRepository {
+	return &SubscriptionRepository{db: db}
+}
+
+const planColumns = `id, name, description, price, currency, interval_unit, interval_count, active, created_at`
+
+func scanPlan(row rowScanner) (*subscription.Plan, error) {
+	var p subscription.Plan
+	if err := row.Scan(
+		&p.ID,
+		&p.Name,
+		&p.Description,
+		&p.Price,
+		&p.Currency,
+		&p.Interval.Unit,
+		&p.Interval.Count,
+		&p.Active,
+		&p.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+const subscriptionColumns = `id, plan_id, token, email, phone, customer_name, delivery_address,
+	status, provider, payment_method_id, payment_method_title, next_charge_at, failed_attempts,
+	cancel_reason, created_at, paused_at, canceled_at`
+
+func scanSubscription(row rowScanner) (*subscription.Subscription, error) {
+	var s subscription.Subscription
+	var nextChargeAt, pausedAt, canceledAt sql.NullTime
+
+	if err := row.Scan(
+		&s.ID,
+		&s.PlanID,
+		&s.Token,
+		&s.Email,
+		&s.Phone,
+		&s.CustomerName,
+		&s.DeliveryAddress,
+		&s.Status,
+		&s.Provider,
+		&s.PaymentMethodID,
+		&s.PaymentMethodTitle,
+		&nextChargeAt,
+		&s.FailedAttempts,
+		&s.CancelReason,
+		&s.CreatedAt,
+		&pausedAt,
+		&canceledAt,
+	); err != nil {
+		return nil, err
+	}
+
+	if nextChargeAt.Valid {
+		s.NextChargeAt = &nextChargeAt.Time
+	}
+	if pausedAt.Valid {
+		s.PausedAt = &pausedAt.Time
+	}
+	if canceledAt.Valid {
+		s.CanceledAt = &canceledAt.Time
+	}
+
+	return &s, nil
+}
+
+func (r *SubscriptionRepository) GetPlans(activeOnly bool) ([]*subscription.Plan, error) {
+	query := `SELECT ` + planColumns + ` FROM subscription_plans`
+	if activeOnly {
+		query += ` WHERE active`
+	}
+	query += ` ORDER BY price, id`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении тарифов: %w", err)
+	}
+	defer rows.Close()
+
+	plans := []*subscription.Plan{}
+	for rows.Next() {
+		p, err := scanPlan(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании тарифа: %w", err)
+		}
+		plans = append(plans, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return plans, nil
+}
+
+func (r *SubscriptionRepository) GetPlan(id int) (*subscription.Plan, error) {
+	p, err := scanPlan(r.db.QueryRow(`SELECT `+planColumns+` FROM subscription_plans WHERE id = $1`, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: тариф %d", subscription.ErrNotFound, id)
+		}
+		return nil, fmt.Errorf("ошибка при получении тарифа: %w", err)
+	}
+	return p, nil
+}
+
+func (r *SubscriptionRepository) Create(s *subscription.Subscription) error {
+	query := `
+		INSERT INTO subscriptions (plan_id, token, email, phone, customer_name, delivery_address,
+			status, provider)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+
+	if err := r.db.QueryRow(query,
+		s.PlanID,
+		s.Token,
+		s.Email,
+		s.Phone,
+		s.CustomerName,
+		s.DeliveryAddress,
+		s.Status,
+		s.Provider,
+	).Scan(&s.ID, &s.CreatedAt); err != nil {
+		return fmt.Errorf("ошибка сохранения подписки: %w", err)
+	}
+
+	return nil
+}
+
+func (r *SubscriptionRepository) GetByID(id int) (*subscription.Subscription, error) {
+	return r.get(fmt.Sprintf("id %d", id), `SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = $1`, id)
+}
+
+func (r *SubscriptionRepository) GetByToken(token string) (*subscription.Subscription, error) {
+	// Токен - секрет покупателя, в текст ошибки он не попадает
+	return r.get("по ссылке", `SELECT `+subscriptionColumns+` FROM subscriptions WHERE token = $1`, token)
+}
+
+func (r *SubscriptionRepository) GetByStatus(status subscription.Status, limit, offset int) ([]*subscription.Subscription, error) {
+	if status == "" {
+		return r.query(`SELECT `+subscriptionColumns+` FROM subscriptions
+			ORDER BY created_at DESC
+			LIMIT $1 OFFSET $2`, limit, offset)
+	}
+	return r.query(`SELECT `+subscriptionColumns+` FROM subscriptions
+		WHERE status = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3`, status, limit, offset)
+}
+
+func (r *SubscriptionRepository) GetDue(now time.Time, limit int) ([]*subscription.Subscription, error) {
+	query := `SELECT ` + subscriptionColumns + ` FROM subscriptions s
+		WHERE status IN ($1, $2) AND next_charge_at <= $3
+			AND NOT EXISTS (
+				SELECT 1 FROM subscription_charges c
+				WHERE c.subscription_id = s.id AND c.status = $4
+			)
+		ORDER BY next_charge_at
+		LIMIT $5`
+
+	return r.query(query, subscription.StatusActive, subscription.StatusPastDue, now,
+		subscription.ChargePending, limit)
+}
+
+func (r *SubscriptionRepository) Update(s *subscription.Subscription) error {
+	result, err := r.db.Exec(`
+		UPDATE subscriptions SET status = $1, payment_method_id = $2, payment_method_title = $3,
+			next_charge_at = $4, failed_attempts = $5, cancel_reason = $6, paused_at = $7, canceled_at = $8
+		WHERE id = $9
+	`,
+		s.Status,
+		s.PaymentMethodID,
+		s.PaymentMethodTitle,
+		s.NextChargeAt,
+		s.FailedAttempts,
+		s.CancelReason,
+		s.PausedAt,
+		s.CanceledAt,
+		s.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка обновления подписки %d: %w", s.ID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка проверки измененных строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: id %d", subscription.ErrNotFound, s.ID)
+	}
+
+	return nil
+}
+
+func (r *SubscriptionRepository) AddCharge(c *subscription.Charge) error {
+	query := `
+		INSERT INTO subscription_charges (subscription_id, order_id, payment_id, initiator, amount, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	if err := r.db.QueryRow(query,
+		c.SubscriptionID,
+		c.OrderID,
+		c.PaymentID,
+		c.Initiator,
+		c.Amount,
+		c.Status,
+	).Scan(&c.ID, &c.CreatedAt); err != nil {
+		return fmt.Errorf("ошибка сохранения списания: %w", err)
+	}
+
+	return nil
+}
+
+const chargeColumns = `id, subscription_id, order_id, payment_id, initiator, amount, status, reason, created_at`
+
+func scanCharge(row rowScanner) (*subscription.Charge, error) {
+	var c subscription.Charge
+	if err := row.Scan(
+		&c.ID,
+		&c.SubscriptionID,
+		&c.OrderID,
+		&c.PaymentID,
+		&c.Initiator,
+		&c.Amount,
+		&c.Status,
+		&c.Reason,
+		&c.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *SubscriptionRepository) GetChargeByPaymentID(paymentID string) (*subscription.Charge, error) {
+	c, err := scanCharge(r.db.QueryRow(`SELECT `+chargeColumns+` FROM subscription_charges WHERE payment_id = $1`, paymentID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: списание payment_id %s", subscription.ErrNotFound, paymentID)
+		}
+		return nil, fmt.Errorf("ошибка при получении списания: %w", err)
+	}
+	return c, nil
+}
+
+func (r *SubscriptionRepository) CompleteCharge(paymentID, status, reason string) (bool, error) {
+	result, err := r.db.Exec(`
+		UPDATE subscription_charges SET status = $1, reason = $2
+		WHERE payment_id = $3 AND status = $4
+	`, status, reason, paymentID, subscription.ChargePending)
+	if err != nil {
+		return false, fmt.Errorf("ошибка обновления списания %s: %w", paymentID, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("ошибка проверки измененных строк: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+func (r *SubscriptionRepository) GetCharges(subscriptionID int) ([]*subscription.Charge, error) {
+	rows, err := r.db.Query(`SELECT `+chargeColumns+` FROM subscription_charges
+		WHERE subscription_id = $1
+		ORDER BY created_at, id`, subscriptionID)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении списаний: %w", err)
+	}
+	defer rows.Close()
+
+	charges := []*subscription.Charge{}
+	for rows.Next() {
+		c, err := scanCharge(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании списания: %w", err)
+		}
+		charges = append(charges, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return charges, nil
+}
+
+func (r *SubscriptionRepository) get(what, query string, arg interface{}) (*subscription.Subscription, error) {
+	s, err := scanSubscription(r.db.QueryRow(query, arg))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: %s", subscription.ErrNotFound, what)
+		}
+		return nil, fmt.Errorf("ошибка при получении подписки: %w", err)
+	}
+	return s, nil
+}
+
+func (r *SubscriptionRepository) query(query string, args ...interface{}) ([]*subscription.Subscription, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка при получении подписок: %w", err)
+	}
+	defer rows.Close()
+
+	subscriptions := []*subscription.Subscription{}
+	for rows.Next() {
+		s, err := scanSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка при сканировании подписки: %w", err)
+		}
+		subscriptions = append(subscriptions, s)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка при обработке результатов: %w", err)
+	}
+
+	return subscriptions, nil
+}
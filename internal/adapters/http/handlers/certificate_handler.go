@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	appCertificate "backend/internal/app/certificate"
+	domainCertificate "backend/internal/domain/certificate"
+	"backend/pkg/logger"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// CertificateHandler - проверка остатка подарочного сертификата покупателем
+// и просмотр сертификата в админке
+type CertificateHandler struct {
+	service *appCertificate.Service
+}
+
+func NewCertificateHandler(service *appCertificate.Service) *CertificateHandler {
+	return &CertificateHandler{service: service}
+}
+
+// GetBalance возвращает остаток и срок действия сертификата по коду. Кому и
+// в каком заказе продан сертификат, покупателю не показывается.
+func (h *CertificateHandler) GetBalance(c *gin.Context) {
+	cert, err := h.service.GetByCode(c.Param("code"))
+	if err != nil {
+		respondCertificateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":       cert.Code,
+		"amount":     cert.Amount,
+		"balance":    cert.Balance,
+		"currency":   cert.Currency,
+		"status":     cert.Status,
+		"expires_at": cert.ExpiresAt,
+	})
+}
+
+// GetByCode возвращает сертификат с историей списаний
+func (h *CertificateHandler) GetByCode(c *gin.Context) {
+	cert, redemptions, err := h.service.GetWithRedemptions(c.Param("code"))
+	if err != nil {
+		respondCertificateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"certificate": cert,
+		"redemptions": redemptions,
+	})
+}
+
+// respondCertificateError переводит ошибки работы с сертификатом в HTTP-ответ
+func respondCertificateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domainCertificate.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Сертификат не найден"})
+	case errors.Is(err, domainCertificate.ErrUnavailable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		logger.Error("Ошибка обработки сертификата", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+	}
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"backend/internal/app/feed"
+	"backend/pkg/logger"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type FeedHandler struct {
+	service  *feed.Service
+	cacheTTL int
+}
+
+func NewFeedHandler(service *feed.Service, cacheTTL int) *FeedHandler {
+	return &FeedHandler{service: service, cacheTTL: cacheTTL}
+}
+
+// GetYandexYML отдает фид каталога в формате YML для Яндекс.Маркета
+func (h *FeedHandler) GetYandexYML(c *gin.Context) {
+	data, generatedAt, err := h.service.GetYML()
+	if err != nil {
+		logger.Error("Ошибка формирования YML-фида", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", h.cacheTTL))
+	c.Header("Last-Modified", generatedAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", data)
+}
+
+// GetSitemap отдает sitemap.xml с товарами и категориями
+func (h *FeedHandler) GetSitemap(c *gin.Context) {
+	data, generatedAt, err := h.service.GetSitemap()
+	if err != nil {
+		logger.Error("Ошибка формирования sitemap.xml", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", h.cacheTTL))
+	c.Header("Last-Modified", generatedAt.UTC().Format(http.TimeFormat))
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", data)
+}
@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	appLoyalty "backend/internal/app/loyalty"
+	domainLoyalty "backend/internal/domain/loyalty"
+	"backend/pkg/logger"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// LoyaltyHandler - баланс и история бонусов покупателя
+type LoyaltyHandler struct {
+	service *appLoyalty.Service
+}
+
+func NewLoyaltyHandler(service *appLoyalty.Service) *LoyaltyHandler {
+	return &LoyaltyHandler{service: service}
+}
+
+// GetByToken возвращает баланс бонусного счета и операции с бонусами,
+// начиная с последних
+func (h *LoyaltyHandler) GetByToken(c *gin.Context) {
+	limit, offset := pagination(c)
+	account, entries, err := h.service.GetHistory(c.Param("token"), limit, offset)
+	if err != nil {
+		respondLoyaltyError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account": account,
+		"entries": entries,
+	})
+}
+
+// respondLoyaltyError переводит ошибки бонусной программы в HTTP-ответ
+func respondLoyaltyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domainLoyalty.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Бонусный счет не найден"})
+	default:
+		logger.Error("Ошибка обработки бонусного счета", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+	}
+}
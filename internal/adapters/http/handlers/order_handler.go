@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	appCapture "backend/internal/app/capture"
+	appOffline "backend/internal/app/offline"
+	appOrder "backend/internal/app/order"
+	appReceipt "backend/internal/app/receipt"
+	appRefund "backend/internal/app/refund"
+	domainOrder "backend/internal/domain/order"
+	domainPayment "backend/internal/domain/payment"
+	"backend/pkg/logger"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// OrderHandler - управление заказами для менеджеров
+type OrderHandler struct {
+	service        *appOrder.Service
+	refundService  *appRefund.Service
+	captureService *appCapture.Service
+	receiptService *appReceipt.Service
+	offlineService *appOffline.Service
+}
+
+func NewOrderHandler(service *appOrder.Service, refundService *appRefund.Service, captureService *appCapture.Service, receiptService *appReceipt.Service, offlineService *appOffline.Service) *OrderHandler {
+	return &OrderHandler{
+		service:        service,
+		refundService:  refundService,
+		captureService: captureService,
+		receiptService: receiptService,
+		offlineService: offlineService,
+	}
+}
+
+// List возвращает заказы с указанным статусом (?status=waiting_for_capture)
+func (h *OrderHandler) List(c *gin.Context) {
+	status := domainOrder.Status(c.DefaultQuery("status", string(domainOrder.StatusWaitingForCapture)))
+
+	limit, offset := pagination(c)
+	orders, err := h.service.GetByStatus(status, limit, offset)
+	if err != nil {
+		logger.Error("Ошибка при получении заказов", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orders)
+}
+
+// GetByID возвращает заказ
+func (h *OrderHandler) GetByID(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	o, err := h.service.GetByID(id)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// Refund оформляет полный или частичный возврат по заказу
+func (h *OrderHandler) Refund(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Items           []domainOrder.ItemQuantity `json:"items" binding:"dive"`
+		IncludeDelivery bool                       `json:"includeDelivery"`
+		Reason          string                     `json:"reason"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	refund, err := h.refundService.Refund(c.Request.Context(), appRefund.Request{
+		OrderID:         id,
+		Items:           request.Items,
+		IncludeDelivery: request.IncludeDelivery,
+		Reason:          request.Reason,
+	})
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, refund)
+}
+
+// ListRefunds возвращает возвраты по заказу
+func (h *OrderHandler) ListRefunds(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	refunds, err := h.refundService.GetRefunds(id)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, refunds)
+}
+
+// Capture подтверждает заказ и списывает холд. Можно указать позиции,
+// которые есть в наличии - спишется только их стоимость с доставкой.
+func (h *OrderHandler) Capture(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Items []domainOrder.ItemQuantity `json:"items" binding:"dive"`
+	}
+	// Тело необязательно - без него списывается весь холд
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":   "Неверные данные запроса",
+				"details": err.Error(),
+			})
+			return
+		}
+	}
+
+	o, err := h.captureService.Capture(c.Request.Context(), id, request.Items)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// Void отменяет холд по заказу
+func (h *OrderHandler) Void(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	o, err := h.captureService.Void(c.Request.Context(), id)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// ListMarkingCodes возвращает коды маркировки, отсканированные при сборке заказа
+func (h *OrderHandler) ListMarkingCodes(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	codes, err := h.receiptService.GetMarkingCodes(id)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// AddMarkingCodes сохраняет коды маркировки единиц товара. Повторно
+// отправленные коды пропускаются, поэтому запрос можно повторять.
+func (h *OrderHandler) AddMarkingCodes(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Codes []domainOrder.MarkingCode `json:"codes" binding:"required,min=1,dive"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	codes, err := h.receiptService.AddMarkingCodes(id, request.Codes)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, codes)
+}
+
+// Fulfill отмечает заказ доставленным или полученным в пункте выдачи. Если
+// покупатель вносил предоплату, отправляется чек полного расчета.
+func (h *OrderHandler) Fulfill(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Status domainOrder.FulfillmentStatus `json:"status" binding:"required,oneof=delivered picked_up"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	o, err := h.receiptService.Fulfill(c.Request.Context(), id, request.Status)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// OfflinePayment отмечает, что покупатель заплатил курьеру или в пункте
+// выдачи (method: cash или card). Заказ отмечается переданным, покупателю
+// отправляется чек полного расчета. Если чек не отправлен, запрос можно повторить.
+func (h *OrderHandler) OfflinePayment(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Method domainOrder.OfflineMethod `json:"method" binding:"required,oneof=cash card"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	o, err := h.offlineService.RecordPayment(c.Request.Context(), id, request.Method)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// CancelOffline отменяет неоплаченный заказ с оплатой при получении
+func (h *OrderHandler) CancelOffline(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	o, err := h.offlineService.Cancel(id)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, o)
+}
+
+// ListReceipts возвращает историю чеков по заказу
+func (h *OrderHandler) ListReceipts(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	receipts, err := h.receiptService.GetReceipts(id)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, receipts)
+}
+
+// SettlementReceipt повторно отправляет чек полного расчета по переданному
+// заказу, если при передаче его отправить не удалось
+func (h *OrderHandler) SettlementReceipt(c *gin.Context) {
+	id, ok := orderIDParam(c)
+	if !ok {
+		return
+	}
+
+	receipt, err := h.receiptService.IssueSettlement(c.Request.Context(), id)
+	if err != nil {
+		respondOrderError(c, id, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, receipt)
+}
+
+func orderIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный id заказа"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondOrderError переводит ошибки работы с заказом в HTTP-ответ
+func respondOrderError(c *gin.Context, orderID int, err error) {
+	switch {
+	case errors.Is(err, domainOrder.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Заказ не найден"})
+	case errors.Is(err, domainOrder.ErrInvalidRefund), errors.Is(err, domainOrder.ErrInvalidCapture),
+		errors.Is(err, domainOrder.ErrInvalidMarkingCode), errors.Is(err, domainOrder.ErrSettlementNotAllowed),
+		errors.Is(err, domainOrder.ErrInvalidFulfillment), errors.Is(err, domainOrder.ErrInvalidOfflinePayment),
+		errors.Is(err, domainPayment.ErrInvalidReceipt), errors.Is(err, domainPayment.ErrReceiptsNotSupported):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, domainPayment.ErrProviderUnavailable):
+		respondProviderUnavailable(c)
+	default:
+		logger.Error("Ошибка обработки заказа",
+			zap.Int("order_id", orderID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+	}
+}
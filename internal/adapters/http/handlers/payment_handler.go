@@ -1,43 +1,76 @@
 package handlers
 
 import (
+	appCertificate "backend/internal/app/certificate"
+	appLoyalty "backend/internal/app/loyalty"
+	appOffline "backend/internal/app/offline"
+	appOrder "backend/internal/app/order"
 	appPayment "backend/internal/app/payment"
 	appProduct "backend/internal/app/product" // ПРАВИЛЬНЫЙ ИМПОРТ
+	domainCertificate "backend/internal/domain/certificate"
+	domainLoyalty "backend/internal/domain/loyalty"
+	domainOrder "backend/internal/domain/order"
 	domainPayment "backend/internal/domain/payment"
+	domainProduct "backend/internal/domain/product"
 	"backend/pkg/logger"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// maxIdempotencyKeyLength - максимальная длина заголовка Idempotency-Key
+const maxIdempotencyKeyLength = 255
+
 // ОБНОВЛЕННАЯ СТРУКТУРА С ДОБАВЛЕНИЕM PRODUCT SERVICE
 type PaymentHandler struct {
-	service        *appPayment.Service
-	productService *appProduct.Service
+	service            *appPayment.Service
+	productService     *appProduct.Service
+	orderService       *appOrder.Service
+	offlineService     *appOffline.Service
+	certificateService *appCertificate.Service
+	loyaltyService     *appLoyalty.Service
 }
 
-func NewPaymentHandler(service *appPayment.Service, productService *appProduct.Service) *PaymentHandler {
+func NewPaymentHandler(service *appPayment.Service, productService *appProduct.Service, orderService *appOrder.Service, offlineService *appOffline.Service, certificateService *appCertificate.Service, loyaltyService *appLoyalty.Service) *PaymentHandler {
 	return &PaymentHandler{
-		service:        service,
-		productService: productService,
+		service:            service,
+		productService:     productService,
+		orderService:       orderService,
+		offlineService:     offlineService,
+		certificateService: certificateService,
+		loyaltyService:     loyaltyService,
 	}
 }
 
+// paymentTypeOffline - оплата курьеру или в пункте выдачи, без платежной системы
+const paymentTypeOffline = "offline"
+
 // НОВАЯ СТРУКТУРА ДЛЯ ВХОДЯЩЕГО ЗАПРОСА (только ID и quantity)
 type CartItemRequest struct {
-	ProductID int `json:"productId" binding:"required"`
-	Quantity  int `json:"quantity" binding:"required,gt=0"`
+	ProductID int     `json:"productId" binding:"required"`
+	Quantity  float64 `json:"quantity" binding:"required,gt=0"` // для весового товара - дробное
 }
 
 // НОВАЯ СТРУКТУРА ДЛЯ ОБОГАЩЕННЫХ ДАННЫХ (с названием и ценой)
 type CartItemResponse struct {
 	ProductID int     `json:"productId"`
-	Quantity  int     `json:"quantity"`
+	Quantity  float64 `json:"quantity"`
 	Price     float64 `json:"price"`
 	Name      string  `json:"name"`
+	Unit      string  `json:"unit,omitempty"`
+	// GiftCertificate - подарочный сертификат: доставка на него не начисляется
+	GiftCertificate bool `json:"giftCertificate,omitempty"`
+	// Налоговые признаки для чека; в metadata платежа не передаются
+	VatCode        int    `json:"-"`
+	PaymentSubject string `json:"-"`
+	Marked         bool   `json:"-"`
 }
 
 func (h *PaymentHandler) CreatePayment(c *gin.Context) {
@@ -45,7 +78,7 @@ func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 		Amount          float64           `json:"amount" binding:"required,gt=0"`
 		Description     string            `json:"description"`
 		Currency        string            `json:"currency" binding:"required,oneof=RUB USD EUR"`
-		ReturnURL       string            `json:"returnUrl" binding:"required,url"`
+		ReturnURL       string            `json:"returnUrl" binding:"omitempty,url"` // обязателен для redirect и mobile_application
 		Email           string            `json:"email" binding:"required,email"`
 		Phone           string            `json:"phone" binding:"required"`
 		CustomerName    string            `json:"customerName" binding:"required"`
@@ -53,6 +86,19 @@ func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 		DeliveryAddress string            `json:"deliveryAddress"`
 		Comment         string            `json:"comment"`
 		CartItems       []CartItemRequest `json:"cartItems" binding:"required,min=1"`
+		Provider        string            `json:"provider"` // пусто - провайдер по умолчанию
+		// ConfirmationType - redirect (по умолчанию), embedded, qr или mobile_application.
+		// PaymentMethod - способ оплаты, выбранный на сайте: sbp, sberbank, bank_card, ...
+		ConfirmationType string `json:"confirmationType"`
+		PaymentMethod    string `json:"paymentMethod"`
+		// PaymentType - online (по умолчанию) или offline: оплата при получении
+		PaymentType string `json:"paymentType" binding:"omitempty,oneof=online offline"`
+		// CertificateCode - код подарочного сертификата, которым оплачивается часть или весь заказ
+		CertificateCode string `json:"certificateCode"`
+		// BonusPoints - сколько бонусов списать в счет заказа; LoyaltyToken -
+		// секрет ссылки на бонусный счет из писем покупателю
+		BonusPoints  float64 `json:"bonusPoints" binding:"omitempty,gte=0"`
+		LoyaltyToken string  `json:"loyaltyToken"`
 	}
 
 	if err := c.ShouldBindJSON(&paymentRequest); err != nil {
@@ -64,6 +110,78 @@ func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 		return
 	}
 
+	// Ключ идемпотентности защищает от двойного нажатия «Оплатить»: повтор
+	// запроса с тем же ключом вернет уже созданный платеж. Ключи действуют в
+	// пределах покупателя - одинаковые ключи разных покупателей не пересекаются.
+	idem := idempotency{
+		scope: strings.ToLower(strings.TrimSpace(paymentRequest.Email)),
+		key:   c.GetHeader("Idempotency-Key"),
+	}
+	previousOrderID := 0
+	if idem.key != "" {
+		if len(idem.key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Слишком длинный Idempotency-Key"})
+			return
+		}
+
+		canonical, err := json.Marshal(paymentRequest)
+		if err != nil {
+			logger.Error("Failed to marshal payment request", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обработки запроса"})
+			return
+		}
+		sum := sha256.Sum256(canonical)
+		requestHash := hex.EncodeToString(sum[:])
+
+		record, err := h.service.BeginIdempotent(idem.scope, idem.key, requestHash)
+		switch {
+		case errors.Is(err, domainPayment.ErrIdempotencyKeyReused):
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		case errors.Is(err, domainPayment.ErrIdempotencyInProgress):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case err != nil:
+			logger.Error("Failed to check idempotency key", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обработки запроса"})
+			return
+		case record.Completed:
+			logger.Info("Replaying payment response for idempotency key",
+				zap.String("payment_id", record.PaymentID))
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(http.StatusOK, "application/json; charset=utf-8", record.Response)
+			return
+		}
+		previousOrderID = record.OrderID
+
+		// Если платеж создать не удалось, освобождаем ключ для повтора
+		defer func() {
+			if c.Writer.Status() != http.StatusOK {
+				if err := h.service.ReleaseIdempotent(idem.scope, idem.key); err != nil {
+					logger.Error("Failed to release idempotency key", zap.Error(err))
+				}
+			}
+		}()
+	}
+
+	// Сценарий подтверждения проверяем до создания заказа. При оплате при
+	// получении платеж не создается и подтверждать нечего.
+	offline := paymentRequest.PaymentType == paymentTypeOffline
+	confirmationType := domainPayment.ConfirmationType(paymentRequest.ConfirmationType)
+	if confirmationType == "" {
+		confirmationType = domainPayment.ConfirmationRedirect
+	}
+	if !offline {
+		if err := domainPayment.ValidateConfirmation(confirmationType, paymentRequest.PaymentMethod); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if confirmationType.NeedsReturnURL() && paymentRequest.ReturnURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "returnUrl обязателен для сценария " + string(confirmationType)})
+			return
+		}
+	}
+
 	// Дополнительная валидация: если доставка, то адрес обязателен
 	if paymentRequest.DeliveryType == "delivery" && paymentRequest.DeliveryAddress == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -72,6 +190,35 @@ func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 		return
 	}
 
+	if !offline && paymentRequest.Provider != "" && !h.service.Selectable(paymentRequest.Provider) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Неизвестный способ оплаты",
+		})
+		return
+	}
+
+	if paymentRequest.CertificateCode != "" && offline {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Сертификатом можно оплатить только онлайн-заказ",
+		})
+		return
+	}
+
+	if paymentRequest.BonusPoints > 0 {
+		if offline {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Бонусами можно оплатить только онлайн-заказ",
+			})
+			return
+		}
+		if paymentRequest.LoyaltyToken == "" {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": "Для списания бонусов нужна ссылка на бонусный счет",
+			})
+			return
+		}
+	}
+
 	// Валидация телефона
 	if len(paymentRequest.Phone) < 5 {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -80,8 +227,45 @@ func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 		return
 	}
 
+	options := paymentOptions{
+		ReturnURL:        paymentRequest.ReturnURL,
+		Provider:         paymentRequest.Provider,
+		ConfirmationType: confirmationType,
+		PaymentMethod:    paymentRequest.PaymentMethod,
+	}
+
+	// Повтор после неудачной попытки продолжает ее заказ: сумма и ключ
+	// платежа не меняются, и если платеж все-таки был создан, платежная
+	// система вернет его же, а не спишет деньги второй раз
+	if previousOrderID != 0 {
+		previous, err := h.orderService.GetByID(previousOrderID)
+		if err != nil {
+			logger.Error("Failed to get order for idempotency key", zap.Int("order_id", previousOrderID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения заказа"})
+			return
+		}
+		switch previous.Status {
+		case domainOrder.StatusPending:
+			if previous.AmountDue() <= 0 {
+				h.payByCertificate(c, previous, idem)
+				return
+			}
+			h.payOrder(c, previous, options, idem)
+			return
+		case domainOrder.StatusCanceled:
+			// Платеж по заказу точно не создан - оформляем заказ заново
+		default:
+			h.respondProcessedOrder(c, previous, idem)
+			return
+		}
+	}
+
 	// 1. ПОЛУЧАЕМ ПОЛНЫЕ ДАННЫЕ О ТОВАРАХ ИЗ БАЗЫ
 	enrichedItems, err := h.enrichCartItems(paymentRequest.CartItems)
+	if errors.Is(err, domainProduct.ErrInvalidQuantity) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		logger.Error("Failed to get product details", zap.Error(err))
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка получения данных о товарах: " + err.Error()})
@@ -90,111 +274,364 @@ func (h *PaymentHandler) CreatePayment(c *gin.Context) {
 
 	// 2. ПЕРЕСЧИТЫВАЕМ СУММУ НА ОСНОВЕ РЕАЛЬНЫХ ЦЕН
 	itemsTotal := 0.0
+	goodsTotal := 0.0
+	hasCertificates := false
 	for _, item := range enrichedItems {
-		itemsTotal += item.Price * float64(item.Quantity)
+		lineTotal := domainOrder.LineTotal(item.Price, item.Quantity)
+		itemsTotal += lineTotal
+		if item.GiftCertificate {
+			hasCertificates = true
+		} else {
+			goodsTotal += lineTotal
+		}
 	}
 
-	// 3. РАССЧИТЫВАЕМ ДОСТАВКУ
-	deliveryCost := calculateDeliveryCost(itemsTotal, paymentRequest.DeliveryType)
+	// Сертификат нельзя купить другим сертификатом
+	if paymentRequest.CertificateCode != "" && hasCertificates {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": "Подарочный сертификат нельзя оплатить другим сертификатом",
+		})
+		return
+	}
+
+	// 3. РАССЧИТЫВАЕМ ДОСТАВКУ (сертификаты не доставляются)
+	deliveryCost := calculateDeliveryCost(goodsTotal, paymentRequest.DeliveryType)
 	totalAmount := itemsTotal + deliveryCost
 
-	// 4. СОЗДАЕМ ОПИСАНИЕ ЗАКАЗА
-	description := fmt.Sprintf("Заказ из %d товаров: ", len(enrichedItems))
-	for _, item := range enrichedItems {
-		description += fmt.Sprintf("%s (x%d), ", item.Name, item.Quantity)
+	// 4. СОХРАНЯЕМ ЗАКАЗ ДО СОЗДАНИЯ ПЛАТЕЖА, ЧТОБЫ НЕ ПОТЕРЯТЬ ЕГО ПРИ СБОЕ
+	orderItems := make([]domainOrder.Item, len(enrichedItems))
+	for i, item := range enrichedItems {
+		orderItems[i] = domainOrder.Item{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+			Name:      item.Name,
+			Unit:      item.Unit,
+
+			GiftCertificate: item.GiftCertificate,
+			VatCode:         item.VatCode,
+			PaymentSubject:  item.PaymentSubject,
+			Marked:          item.Marked,
+		}
+	}
+
+	// Бонусы снижают цены товаров, поэтому чек, возвраты и расчет при
+	// передаче товара работают с уже уменьшенными ценами. Доставка считается
+	// от суммы товаров до скидки.
+	var loyaltyAccount *domainLoyalty.Account
+	bonusAmount := 0.0
+	if paymentRequest.BonusPoints > 0 {
+		loyaltyAccount, orderItems, bonusAmount, err = h.loyaltyService.Discount(paymentRequest.LoyaltyToken, orderItems, paymentRequest.BonusPoints)
+		if errors.Is(err, domainLoyalty.ErrNotFound) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Бонусный счет не найден"})
+			return
+		}
+		if errors.Is(err, domainLoyalty.ErrInvalidSpend) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			logger.Error("Failed to apply bonus points", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка применения бонусов"})
+			return
+		}
+
+		itemsTotal = 0
+		for _, item := range orderItems {
+			itemsTotal += item.Total()
+		}
+		totalAmount = itemsTotal + deliveryCost
+	}
+
+	order := &domainOrder.Order{
+		Email:           paymentRequest.Email,
+		Phone:           paymentRequest.Phone,
+		CustomerName:    paymentRequest.CustomerName,
+		DeliveryType:    paymentRequest.DeliveryType,
+		DeliveryAddress: paymentRequest.DeliveryAddress,
+		Comment:         paymentRequest.Comment,
+		Items:           orderItems,
+		ItemsTotal:      itemsTotal,
+		DeliveryCost:    deliveryCost,
+		Amount:          totalAmount,
+		Currency:        paymentRequest.Currency,
+		BonusAmount:     bonusAmount,
 	}
-	description = description[:len(description)-2] // Убираем последнюю запятую
+	if offline {
+		h.placeOfflineOrder(c, order, idem)
+		return
+	}
+	if err := h.orderService.Create(order); err != nil {
+		logger.Error("Failed to save order", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сохранения заказа"})
+		return
+	}
+
+	// Без привязки к ключу повтор оформил бы второй заказ с другим ключом
+	// платежа - лучше сразу отказать
+	if idem.key != "" {
+		if err := h.service.AttachIdempotentOrder(idem.scope, idem.key, order.ID); err != nil {
+			logger.Error("Failed to attach order to idempotency key", zap.Int("order_id", order.ID), zap.Error(err))
+			h.cancelOrder(order)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сохранения заказа"})
+			return
+		}
+	}
+
+	if loyaltyAccount != nil {
+		if err := h.loyaltyService.Spend(loyaltyAccount, order); err != nil {
+			h.cancelOrder(order)
+			if errors.Is(err, domainLoyalty.ErrInsufficientPoints) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			logger.Error("Failed to spend bonus points", zap.Int("order_id", order.ID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка списания бонусов"})
+			return
+		}
+	}
+
+	// Резервируем остаток сертификата: к оплате остается разница
+	if paymentRequest.CertificateCode != "" {
+		if _, err := h.certificateService.Redeem(paymentRequest.CertificateCode, order); err != nil {
+			h.cancelOrder(order)
+			if errors.Is(err, domainCertificate.ErrNotFound) || errors.Is(err, domainCertificate.ErrUnavailable) {
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+				return
+			}
+			logger.Error("Failed to redeem gift certificate", zap.Int("order_id", order.ID), zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка применения сертификата"})
+			return
+		}
+
+		if order.AmountDue() <= 0 {
+			h.payByCertificate(c, order, idem)
+			return
+		}
+	}
+
+	h.payOrder(c, order, options, idem)
+}
+
+// idempotency - ключ Idempotency-Key запроса покупателя scope; пустой key -
+// запрос без ключа
+type idempotency struct {
+	scope string
+	key   string
+}
 
+// paymentOptions - параметры платежа из запроса, которых нет в заказе
+type paymentOptions struct {
+	ReturnURL        string
+	Provider         string
+	ConfirmationType domainPayment.ConfirmationType
+	PaymentMethod    string
+}
+
+// payOrder создает платеж по сохраненному заказу. Сумма, чек и metadata
+// берутся из заказа, ключ идемпотентности платежной системы - из его номера,
+// поэтому повтор для того же заказа не создаст второй платеж.
+func (h *PaymentHandler) payOrder(c *gin.Context, order *domainOrder.Order, options paymentOptions, idem idempotency) {
 	//  ПОДГОТАВЛИВАЕМ МЕТАДАННЫЕ С ПОЛНЫМИ ДАННЫМИ И ЧЕКОМ
-	cartItemsJSON, err := json.Marshal(enrichedItems)
+	cartItemsJSON, err := json.Marshal(cartItemsFromOrder(order.Items))
 	if err != nil {
-    	logger.Error("Failed to marshal cart items", zap.Error(err))
-    	c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обработки корзины"})
-    	return
+		logger.Error("Failed to marshal cart items", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка обработки корзины"})
+		return
 	}
 
 	metadata := map[string]interface{}{
-    	"email":           paymentRequest.Email,
-    	"phone":           paymentRequest.Phone,
-    	"customerName":    paymentRequest.CustomerName,
-    	"deliveryType":    paymentRequest.DeliveryType,
-    	"deliveryAddress": paymentRequest.DeliveryAddress,
-    	"comment":         paymentRequest.Comment,
-    	"cartItems":       string(cartItemsJSON),
-    	"itemsTotal":      itemsTotal,
-    	"deliveryCost":    deliveryCost,
-    	// УБИРАЕМ receipt_items из metadata
+		"orderId":         order.ID,
+		"email":           order.Email,
+		"phone":           order.Phone,
+		"customerName":    order.CustomerName,
+		"deliveryType":    order.DeliveryType,
+		"deliveryAddress": order.DeliveryAddress,
+		"comment":         order.Comment,
+		"cartItems":       string(cartItemsJSON),
+		"itemsTotal":      order.ItemsTotal,
+		"deliveryCost":    order.DeliveryCost,
+	}
+	if order.CertificateAmount > 0 {
+		metadata["certificateAmount"] = order.CertificateAmount
+	}
+	if order.BonusAmount > 0 {
+		metadata["bonusAmount"] = order.BonusAmount
 	}
-
-	
 
 	// ФОРМИРУЕМ ДАННЫЕ ДЛЯ ЧЕКА 54-ФЗ
-	// 7. ФОРМИРУЕМ ЧЕК ОТДЕЛЬНО ДЛЯ ПЕРЕДАЧИ В СЕРВИС
-	receiptItems := make([]map[string]interface{}, len(enrichedItems))
-	for i, item := range enrichedItems {
-    	// Правильный формат: цена за единицу товара
-    	pricePerItem := fmt.Sprintf("%.2f", item.Price)
-    	quantity := fmt.Sprintf("%d", item.Quantity)
-    
-    	receiptItems[i] = map[string]interface{}{
-        	"description":     item.Name,
-        	"quantity":        quantity,
-        	"amount": map[string]interface{}{
-            	"value":    pricePerItem, // Цена за 1 штуку
-            	"currency": "RUB",
-        	},
-        	"vat_code":        "1",
-        	"payment_mode":    "full_payment",
-        	"payment_subject": "commodity",
-    	}
-    
-    	// Для отладки - логируем каждый товар
- 		logger.Debug("Receipt item",
-        	zap.String("name", item.Name),
-        	zap.String("price", pricePerItem),
-        	zap.String("quantity", quantity))
-	}
-
-	if deliveryCost > 0 {
-    deliveryItem := map[string]interface{}{
-        "description":     "Доставка",
-        "quantity":        "1",
-        "amount": map[string]interface{}{
-            "value":    fmt.Sprintf("%.2f", deliveryCost),
-            "currency": "RUB",
-        },
-        "vat_code":        "1",
-        "payment_mode":    "full_payment",
-        "payment_subject": "service", // Услуга, а не товар
-    }
-    receiptItems = append(receiptItems, deliveryItem)
-}
-	
-
-	
-
-	//  СОЗДАЕМ ПЛАТЕЖ С ПРАВИЛЬНОЙ СУММОЙ
-	domainPaymentReq := &domainPayment.PaymentRequest{
-    Amount:      totalAmount,
-    Description: description,
-    Currency:    paymentRequest.Currency,
-    ReturnURL:   paymentRequest.ReturnURL,
-    Email:       paymentRequest.Email,
-    Phone:       paymentRequest.Phone,
-    Metadata:    metadata,
-    ReceiptItems: receiptItems, // Передаем чек отдельным полем
-}
+	receiptItems := h.service.BuildReceiptItems(order.Items, order.DeliveryCost, order.Currency)
+	amountDue := order.AmountDue()
+	if order.CertificateAmount > 0 {
+		receiptItems = h.service.BuildPartialPrepaymentItems(order.Items, order.DeliveryCost, order.Currency, amountDue)
+	}
 
-	paymentResp, err := h.service.CreatePayment(domainPaymentReq)
+	paymentResp, err := h.service.CreatePayment(c.Request.Context(), &domainPayment.PaymentRequest{
+		Amount:            amountDue,
+		Description:       orderDescription(order.Items),
+		Currency:          order.Currency,
+		ReturnURL:         options.ReturnURL,
+		Email:             order.Email,
+		Phone:             order.Phone,
+		Metadata:          metadata,
+		ReceiptItems:      receiptItems, // Передаем чек отдельным полем
+		OrderID:           order.ID,
+		Provider:          options.Provider,
+		ConfirmationType:  options.ConfirmationType,
+		PaymentMethodType: options.PaymentMethod,
+		IdempotenceKey:    appPayment.OrderIdempotenceKey(order.ID),
+	})
 	if err != nil {
-		logger.Error("Failed to create payment", zap.Error(err))
+		logger.Error("Failed to create payment", zap.Int("order_id", order.ID), zap.Error(err))
+		// Платежная система не ответила - платеж мог быть создан. Заказ
+		// остается в ожидании: повтор с тем же ключом продолжит его, а
+		// брошенный заказ отменит сверка.
+		if errors.Is(err, domainPayment.ErrProviderUnavailable) {
+			respondProviderUnavailable(c)
+			return
+		}
+		h.cancelOrder(order)
+		if errors.Is(err, domainPayment.ErrConfirmationNotSupported) {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка создания платежа: " + err.Error()})
 		return
 	}
 
+	if err := h.orderService.AttachPayment(order.ID, paymentResp.Provider, paymentResp.ID); err != nil {
+		logger.Error("Failed to attach payment to order",
+			zap.Int("order_id", order.ID),
+			zap.String("payment_id", paymentResp.ID),
+			zap.Error(err))
+	}
+
+	h.respondPayment(c, paymentResp, idem)
+}
+
+// respondProcessedOrder отвечает на повтор запроса, заказ по которому уже
+// оплачен или отменен после оплаты: текущим состоянием платежа
+func (h *PaymentHandler) respondProcessedOrder(c *gin.Context, order *domainOrder.Order, idem idempotency) {
+	if order.PaymentID == "" {
+		h.respondOrder(c, order, idem)
+		return
+	}
+
+	paymentResp, err := h.service.GetPaymentStatus(c.Request.Context(), order.Provider, order.PaymentID)
+	if err != nil {
+		logger.Error("Failed to get payment status", zap.Int("order_id", order.ID), zap.Error(err))
+		if errors.Is(err, domainPayment.ErrProviderUnavailable) {
+			respondProviderUnavailable(c)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment status"})
+		return
+	}
+
+	h.respondPayment(c, paymentResp, idem)
+}
+
+// respondPayment отвечает созданным платежом и сохраняет ответ для повтора
+// запроса с тем же ключом идемпотентности
+func (h *PaymentHandler) respondPayment(c *gin.Context, paymentResp *domainPayment.PaymentResponse, idem idempotency) {
+	if idem.key != "" {
+		response, err := json.Marshal(paymentResp)
+		if err == nil {
+			err = h.service.CompleteIdempotent(idem.scope, idem.key, paymentResp.ID, response)
+		}
+		if err != nil {
+			logger.Error("Failed to save idempotent response",
+				zap.String("payment_id", paymentResp.ID),
+				zap.Error(err))
+		}
+	}
+
 	c.JSON(http.StatusOK, paymentResp)
 }
 
+// cancelOrder отменяет заказ, платеж по которому точно не создан, и
+// возвращает зарезервированные под него сертификат и бонусы
+func (h *PaymentHandler) cancelOrder(order *domainOrder.Order) {
+	if err := h.orderService.Cancel(order.ID); err != nil {
+		logger.Error("Failed to cancel order", zap.Int("order_id", order.ID), zap.Error(err))
+		return
+	}
+	if err := h.certificateService.Release(order.ID); err != nil {
+		logger.Error("Failed to release gift certificate", zap.Int("order_id", order.ID), zap.Error(err))
+	}
+	if err := h.loyaltyService.Restore(order); err != nil {
+		logger.Error("Failed to restore bonus points", zap.Int("order_id", order.ID), zap.Error(err))
+	}
+}
+
+// orderDescription - описание платежа: товары заказа с количеством
+func orderDescription(items []domainOrder.Item) string {
+	description := fmt.Sprintf("Заказ из %d товаров: ", len(items))
+	for _, item := range items {
+		description += fmt.Sprintf("%s (%g %s), ", item.Name, item.Quantity, domainProduct.Unit(item.Unit).Title())
+	}
+	return description[:len(description)-2] // Убираем последнюю запятую
+}
+
+// cartItemsFromOrder - корзина для metadata платежа по позициям заказа
+func cartItemsFromOrder(items []domainOrder.Item) []CartItemResponse {
+	cartItems := make([]CartItemResponse, len(items))
+	for i, item := range items {
+		cartItems[i] = CartItemResponse{
+			ProductID:       item.ProductID,
+			Quantity:        item.Quantity,
+			Price:           item.Price,
+			Name:            item.Name,
+			Unit:            item.Unit,
+			GiftCertificate: item.GiftCertificate,
+		}
+	}
+	return cartItems
+}
+
+// placeOfflineOrder сохраняет заказ с оплатой при получении. Платеж не
+// создается, в ответе - сам заказ в статусе pending.
+func (h *PaymentHandler) placeOfflineOrder(c *gin.Context, order *domainOrder.Order, idem idempotency) {
+	if err := h.offlineService.PlaceOrder(order); err != nil {
+		logger.Error("Failed to save offline order", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сохранения заказа"})
+		return
+	}
+
+	h.respondOrder(c, order, idem)
+}
+
+// payByCertificate завершает заказ, целиком оплаченный сертификатом. Платеж
+// не создается, в ответе - оплаченный заказ.
+func (h *PaymentHandler) payByCertificate(c *gin.Context, order *domainOrder.Order, idem idempotency) {
+	paid, err := h.certificateService.PayOrder(order)
+	if err != nil {
+		logger.Error("Failed to pay order by gift certificate", zap.Int("order_id", order.ID), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка оплаты сертификатом"})
+		return
+	}
+
+	h.respondOrder(c, paid, idem)
+}
+
+// respondOrder отвечает заказом, созданным без платежа, и сохраняет ответ
+// для повтора запроса с тем же ключом идемпотентности
+func (h *PaymentHandler) respondOrder(c *gin.Context, order *domainOrder.Order, idem idempotency) {
+	if idem.key != "" {
+		response, err := json.Marshal(order)
+		if err == nil {
+			err = h.service.CompleteIdempotent(idem.scope, idem.key, "", response)
+		}
+		if err != nil {
+			logger.Error("Failed to save idempotent response",
+				zap.Int("order_id", order.ID),
+				zap.Error(err))
+		}
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
 // НОВАЯ ФУНКЦИЯ: ПОЛУЧЕНИЕ ДАННЫХ О ТОВАРАХ ИЗ БАЗЫ
 func (h *PaymentHandler) enrichCartItems(cartItems []CartItemRequest) ([]CartItemResponse, error) {
 	enrichedItems := make([]CartItemResponse, len(cartItems))
@@ -206,17 +643,25 @@ func (h *PaymentHandler) enrichCartItems(cartItems []CartItemRequest) ([]CartIte
 			return nil, fmt.Errorf("failed to get product %d: %w", item.ProductID, err)
 		}
 
-		// Используем актуальную цену (со скидкой если есть)
-		price := product.Price
-		if product.Discount > 0 {
-			price = product.Price * (1 - float64(product.Discount)/100)
+		// Весовой товар продается с шагом и минимальным количеством
+		if err := product.ValidateQuantity(item.Quantity); err != nil {
+			return nil, err
 		}
 
+		// Используем актуальную цену (со скидкой если есть)
+		price := product.FinalPrice()
+
 		enrichedItems[i] = CartItemResponse{
 			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
+			Quantity:  domainOrder.RoundQuantity(item.Quantity),
 			Price:     price,
 			Name:      product.Title, // ТЕПЕРЬ ЗДЕСЬ БУДЕТ НАЗВАНИЕ
+			Unit:      string(product.Unit),
+
+			GiftCertificate: product.GiftCertificate,
+			VatCode:         product.VatCode,
+			PaymentSubject:  product.PaymentSubject,
+			Marked:          product.Marked,
 		}
 	}
 
@@ -249,9 +694,13 @@ func (h *PaymentHandler) GetStatus(c *gin.Context) {
 		return
 	}
 
-	paymentResp, err := h.service.GetPaymentStatus(paymentID)
+	paymentResp, err := h.service.GetPaymentStatus(c.Request.Context(), h.paymentProvider(paymentID), paymentID)
 	if err != nil {
 		logger.Error("Failed to get payment status", zap.Error(err))
+		if errors.Is(err, domainPayment.ErrProviderUnavailable) {
+			respondProviderUnavailable(c)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get payment status"})
 		return
 	}
@@ -267,12 +716,36 @@ func (h *PaymentHandler) Cancel(c *gin.Context) {
 		return
 	}
 
-	err := h.service.CancelPayment(paymentID)
+	err := h.service.CancelPayment(c.Request.Context(), h.paymentProvider(paymentID), paymentID)
 	if err != nil {
 		logger.Error("Failed to cancel payment", zap.Error(err))
+		if errors.Is(err, domainPayment.ErrProviderUnavailable) {
+			respondProviderUnavailable(c)
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel payment"})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Payment cancelled successfully"})
-}
\ No newline at end of file
+}
+
+// paymentProvider возвращает провайдера, через которого проведен платеж.
+// Для платежей без заказа используется провайдер по умолчанию.
+func (h *PaymentHandler) paymentProvider(paymentID string) string {
+	o, err := h.orderService.GetByPaymentID(paymentID)
+	if err != nil {
+		if !errors.Is(err, domainOrder.ErrNotFound) {
+			logger.Error("Failed to get order by payment", zap.String("payment_id", paymentID), zap.Error(err))
+		}
+		return ""
+	}
+	return o.Provider
+}
+
+// respondProviderUnavailable сообщает покупателю, что платежная система не
+// отвечает и запрос стоит повторить позже
+func respondProviderUnavailable(c *gin.Context) {
+	c.Header("Retry-After", "30")
+	c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Платежная система временно недоступна, попробуйте позже"})
+}
@@ -2,9 +2,15 @@ package handlers
 
 import (
 	"backend/internal/app/product"
+	domainProduct "backend/internal/domain/product"
 	"backend/pkg/logger"
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
+	"path"
     "strconv"
+    "strings"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
@@ -17,9 +23,22 @@ func NewProductHandler(service *product.Service) *ProductHandler {
     return &ProductHandler{service: service}
 }
 
+// GetAllProducts возвращает каталог. Поддерживает фильтры:
+// category_id, certifications (через запятую), exclude_allergens (через запятую),
+// max_kcal, min_protein - например ?certifications=gluten_free&exclude_allergens=nuts
 func (h *ProductHandler) GetAllProducts(c *gin.Context) {
-    products, err := h.service.GetAllProducts()
+    filter, err := parseProductFilter(c)
     if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные параметры фильтра", "details": err.Error()})
+        return
+    }
+
+    products, err := h.service.FindProducts(filter)
+    if err != nil {
+        if errors.Is(err, domainProduct.ErrInvalidFilter) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные параметры фильтра", "details": err.Error()})
+            return
+        }
         logger.Error("Ошибка при получении данных",
             zap.Error(err),
         )
@@ -30,6 +49,56 @@ func (h *ProductHandler) GetAllProducts(c *gin.Context) {
     c.JSON(http.StatusOK, products)
 }
 
+func parseProductFilter(c *gin.Context) (domainProduct.Filter, error) {
+    var filter domainProduct.Filter
+
+    if v := c.Query("category_id"); v != "" {
+        id, err := strconv.Atoi(v)
+        if err != nil {
+            return filter, fmt.Errorf("category_id: %w", err)
+        }
+        filter.CategoryID = id
+    }
+
+    for _, v := range splitQueryList(c, "certifications") {
+        filter.Certifications = append(filter.Certifications, domainProduct.Certification(v))
+    }
+    for _, v := range splitQueryList(c, "exclude_allergens") {
+        filter.ExcludeAllergens = append(filter.ExcludeAllergens, domainProduct.Allergen(v))
+    }
+
+    if v := c.Query("max_kcal"); v != "" {
+        kcal, err := strconv.ParseFloat(v, 64)
+        if err != nil {
+            return filter, fmt.Errorf("max_kcal: %w", err)
+        }
+        filter.MaxKcal = kcal
+    }
+    if v := c.Query("min_protein"); v != "" {
+        protein, err := strconv.ParseFloat(v, 64)
+        if err != nil {
+            return filter, fmt.Errorf("min_protein: %w", err)
+        }
+        filter.MinProtein = protein
+    }
+
+    return filter, nil
+}
+
+// splitQueryList собирает значения параметра, переданные как через запятую,
+// так и повторением параметра
+func splitQueryList(c *gin.Context, key string) []string {
+    var result []string
+    for _, raw := range c.QueryArray(key) {
+        for _, v := range strings.Split(raw, ",") {
+            if v = strings.TrimSpace(v); v != "" {
+                result = append(result, v)
+            }
+        }
+    }
+    return result
+}
+
 func (h *ProductHandler) GetByIdProducts(c *gin.Context) {
     idParam := c.Param("id")
 
@@ -52,4 +121,30 @@ func (h *ProductHandler) GetByIdProducts(c *gin.Context) {
     }
     
     c.JSON(http.StatusOK, products)
-}
\ No newline at end of file
+}
+// GetBySlug возвращает товар по ЧПУ-адресу. Для устаревших адресов
+// отвечает постоянным редиректом на актуальный.
+func (h *ProductHandler) GetBySlug(c *gin.Context) {
+    productSlug := c.Param("slug")
+
+    p, redirectSlug, err := h.service.GetBySlug(productSlug)
+    if err != nil {
+        if errors.Is(err, domainProduct.ErrNotFound) {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Товар не найден"})
+            return
+        }
+        logger.Error("Ошибка при получении данных",
+            zap.Error(err),
+        )
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+        return
+    }
+
+    if redirectSlug != "" {
+        location := path.Join(path.Dir(c.Request.URL.Path), url.PathEscape(redirectSlug))
+        c.Redirect(http.StatusMovedPermanently, location)
+        return
+    }
+
+    c.JSON(http.StatusOK, p)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	appRecommendation "backend/internal/app/recommendation"
+	domainProduct "backend/internal/domain/product"
+	"backend/pkg/logger"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const defaultRelatedLimit = 8
+
+type RecommendationHandler struct {
+	service *appRecommendation.Service
+}
+
+func NewRecommendationHandler(service *appRecommendation.Service) *RecommendationHandler {
+	return &RecommendationHandler{service: service}
+}
+
+// GetRelated возвращает товары, которые часто покупают вместе с данным
+func (h *RecommendationHandler) GetRelated(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный id товара"})
+		return
+	}
+
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultRelatedLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	products, err := h.service.GetRelated(productID, limit)
+	if err != nil {
+		if errors.Is(err, domainProduct.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Товар не найден"})
+			return
+		}
+		logger.Error("Ошибка при получении рекомендаций",
+			zap.Int("product_id", productID),
+			zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, products)
+}
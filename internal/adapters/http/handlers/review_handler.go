@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	appReview "backend/internal/app/review"
+	domainProduct "backend/internal/domain/product"
+	domainReview "backend/internal/domain/review"
+	"backend/pkg/logger"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+type ReviewHandler struct {
+	service *appReview.Service
+}
+
+func NewReviewHandler(service *appReview.Service) *ReviewHandler {
+	return &ReviewHandler{service: service}
+}
+
+// Create принимает отзыв покупателя и отправляет его на модерацию
+func (h *ReviewHandler) Create(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный id товара"})
+		return
+	}
+
+	var request struct {
+		AuthorName string   `json:"authorName" binding:"required"`
+		Email      string   `json:"email" binding:"required,email"`
+		Rating     int      `json:"rating" binding:"required"`
+		Text       string   `json:"text"`
+		Photos     []string `json:"photos"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	rv := &domainReview.Review{
+		ProductID:  productID,
+		AuthorName: request.AuthorName,
+		Email:      request.Email,
+		Rating:     request.Rating,
+		Text:       request.Text,
+		Photos:     request.Photos,
+	}
+
+	if err := h.service.Submit(rv); err != nil {
+		switch {
+		case errors.Is(err, domainReview.ErrInvalid):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, domainProduct.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Товар не найден"})
+		default:
+			logger.Error("Ошибка сохранения отзыва", zap.Error(err))
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"id":      rv.ID,
+		"status":  rv.Status,
+		"message": "Отзыв отправлен на модерацию",
+	})
+}
+
+// ListByProduct возвращает опубликованные отзывы о товаре
+func (h *ReviewHandler) ListByProduct(c *gin.Context) {
+	productID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный id товара"})
+		return
+	}
+
+	limit, offset := pagination(c)
+	reviews, err := h.service.GetPublished(productID, limit, offset)
+	if err != nil {
+		logger.Error("Ошибка при получении отзывов", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// ListForModeration возвращает очередь отзывов для менеджеров (?status=pending по умолчанию)
+func (h *ReviewHandler) ListForModeration(c *gin.Context) {
+	status := domainReview.Status(c.DefaultQuery("status", string(domainReview.StatusPending)))
+
+	limit, offset := pagination(c)
+	reviews, err := h.service.GetForModeration(status, limit, offset)
+	if err != nil {
+		if errors.Is(err, domainReview.ErrInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		logger.Error("Ошибка при получении отзывов", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, reviews)
+}
+
+// Approve публикует отзыв
+func (h *ReviewHandler) Approve(c *gin.Context) {
+	h.moderate(c, h.service.Approve)
+}
+
+// Reject отклоняет отзыв
+func (h *ReviewHandler) Reject(c *gin.Context) {
+	h.moderate(c, h.service.Reject)
+}
+
+func (h *ReviewHandler) moderate(c *gin.Context, action func(id int, comment string) (*domainReview.Review, error)) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный id отзыва"})
+		return
+	}
+
+	var request struct {
+		Comment string `json:"comment"`
+	}
+	// Тело необязательно - комментарий модератора можно не указывать
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&request); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Неверные данные запроса", "details": err.Error()})
+			return
+		}
+	}
+
+	rv, err := action(id, request.Comment)
+	if err != nil {
+		if errors.Is(err, domainReview.ErrNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Отзыв не найден"})
+			return
+		}
+		logger.Error("Ошибка модерации отзыва", zap.Int("review_id", id), zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, rv)
+}
+
+// pagination читает limit и offset из параметров запроса
+func pagination(c *gin.Context) (limit, offset int) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	offset, err = strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	return limit, offset
+}
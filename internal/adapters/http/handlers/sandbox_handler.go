@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"backend/internal/adapters/sandbox"
+	"backend/pkg/logger"
+	"errors"
+	"html/template"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// sandboxPage - страница подтверждения тестового платежа
+var sandboxPage = template.Must(template.New("sandbox").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>Тестовая оплата</title>
+<style>
+body { font-family: sans-serif; max-width: 480px; margin: 60px auto; }
+.actions { display: flex; gap: 12px; margin-top: 24px; }
+button { padding: 10px 20px; font-size: 16px; cursor: pointer; }
+.warning { color: #a15c00; }
+</style>
+</head>
+<body>
+<h1>Тестовая оплата</h1>
+<p class="warning">Платеж проводится тестовым провайдером, деньги не списываются.</p>
+<p><b>Платеж:</b> {{.ID}}</p>
+<p><b>Сумма:</b> {{.Amount.Value}} {{.Amount.Currency}}</p>
+<p><b>Описание:</b> {{.Description}}</p>
+<p><b>Статус:</b> {{.Status}}</p>
+{{if eq .Status "pending"}}
+<div class="actions">
+<form method="post" action="/sandbox/payment/{{.ID}}/succeed"><button type="submit">Оплатить</button></form>
+<form method="post" action="/sandbox/payment/{{.ID}}/fail"><button type="submit">Отказать</button></form>
+</div>
+{{end}}
+</body>
+</html>
+`))
+
+// SandboxHandler обслуживает страницу оплаты тестового провайдера
+type SandboxHandler struct {
+	provider *sandbox.PaymentRepository
+}
+
+func NewSandboxHandler(provider *sandbox.PaymentRepository) *SandboxHandler {
+	return &SandboxHandler{provider: provider}
+}
+
+// Page показывает страницу подтверждения с кнопками «Оплатить» и «Отказать»
+func (h *SandboxHandler) Page(c *gin.Context) {
+	payment, err := h.provider.Page(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusNotFound, "Платеж не найден")
+		return
+	}
+
+	c.Status(http.StatusOK)
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	if err := sandboxPage.Execute(c.Writer, payment); err != nil {
+		logger.Error("Failed to render sandbox page", zap.Error(err))
+	}
+}
+
+// Succeed подтверждает оплату и возвращает покупателя на returnUrl
+func (h *SandboxHandler) Succeed(c *gin.Context) {
+	h.complete(c, h.provider.Succeed)
+}
+
+// Fail отклоняет оплату и возвращает покупателя на returnUrl
+func (h *SandboxHandler) Fail(c *gin.Context) {
+	h.complete(c, h.provider.Fail)
+}
+
+func (h *SandboxHandler) complete(c *gin.Context, action func(paymentID string) (string, error)) {
+	paymentID := c.Param("id")
+
+	returnURL, err := action(paymentID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sandbox.ErrPaymentNotFound):
+			c.String(http.StatusNotFound, "Платеж не найден")
+		case errors.Is(err, sandbox.ErrInvalidState):
+			c.String(http.StatusConflict, "Платеж уже обработан")
+		default:
+			logger.Error("Sandbox payment action failed", zap.String("payment_id", paymentID), zap.Error(err))
+			c.String(http.StatusInternalServerError, "Ошибка обработки платежа")
+		}
+		return
+	}
+
+	if returnURL == "" {
+		c.Redirect(http.StatusSeeOther, "/sandbox/payment/"+paymentID)
+		return
+	}
+	c.Redirect(http.StatusSeeOther, returnURL)
+}
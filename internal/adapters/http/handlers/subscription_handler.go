@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	appSubscription "backend/internal/app/subscription"
+	domainPayment "backend/internal/domain/payment"
+	domainSubscription "backend/internal/domain/subscription"
+	"backend/pkg/logger"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// SubscriptionHandler - оформление подписок, управление ими по ссылке
+// покупателя и просмотр в админке
+type SubscriptionHandler struct {
+	service *appSubscription.Service
+}
+
+func NewSubscriptionHandler(service *appSubscription.Service) *SubscriptionHandler {
+	return &SubscriptionHandler{service: service}
+}
+
+// ListPlans возвращает тарифы, доступные для оформления
+func (h *SubscriptionHandler) ListPlans(c *gin.Context) {
+	plans, err := h.service.GetPlans(true)
+	if err != nil {
+		logger.Error("Ошибка при получении тарифов подписки", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, plans)
+}
+
+// Subscribe оформляет подписку и создает первый платеж. Покупателя нужно
+// перенаправить на confirmation_url; token - ссылка на управление подпиской.
+func (h *SubscriptionHandler) Subscribe(c *gin.Context) {
+	var request struct {
+		PlanID          int    `json:"planId" binding:"required"`
+		Email           string `json:"email" binding:"required,email"`
+		Phone           string `json:"phone" binding:"required"`
+		CustomerName    string `json:"customerName" binding:"required"`
+		DeliveryAddress string `json:"deliveryAddress" binding:"required"`
+		ReturnURL       string `json:"returnUrl" binding:"required"`
+		Provider        string `json:"provider"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	sub := &domainSubscription.Subscription{
+		PlanID:          request.PlanID,
+		Email:           request.Email,
+		Phone:           request.Phone,
+		CustomerName:    request.CustomerName,
+		DeliveryAddress: request.DeliveryAddress,
+		Provider:        request.Provider,
+	}
+	payment, err := h.service.Subscribe(c.Request.Context(), sub, request.ReturnURL)
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subscription": sub,
+		"token":        sub.Token,
+		"payment":      payment,
+	})
+}
+
+// GetByToken возвращает подписку по ссылке покупателя
+func (h *SubscriptionHandler) GetByToken(c *gin.Context) {
+	sub, err := h.service.GetByToken(c.Param("token"))
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, sub)
+}
+
+// Pause приостанавливает подписку
+func (h *SubscriptionHandler) Pause(c *gin.Context) {
+	h.respond(c)(h.service.Pause(c.Param("token")))
+}
+
+// Resume возобновляет подписку
+func (h *SubscriptionHandler) Resume(c *gin.Context) {
+	h.respond(c)(h.service.Resume(c.Param("token")))
+}
+
+// Cancel отменяет подписку по ссылке покупателя
+func (h *SubscriptionHandler) Cancel(c *gin.Context) {
+	h.respond(c)(h.service.Cancel(c.Param("token")))
+}
+
+// Pay создает платеж за просроченный период, например другой картой
+func (h *SubscriptionHandler) Pay(c *gin.Context) {
+	var request struct {
+		ReturnURL string `json:"returnUrl" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "Неверные данные запроса",
+			"details": err.Error(),
+		})
+		return
+	}
+
+	payment, err := h.service.Pay(c.Request.Context(), c.Param("token"), request.ReturnURL)
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, payment)
+}
+
+// List возвращает подписки для менеджера (?status=past_due; без статуса - все)
+func (h *SubscriptionHandler) List(c *gin.Context) {
+	status := domainSubscription.Status(c.Query("status"))
+
+	limit, offset := pagination(c)
+	subs, err := h.service.GetByStatus(status, limit, offset)
+	if err != nil {
+		logger.Error("Ошибка при получении подписок", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+		return
+	}
+
+	c.JSON(http.StatusOK, subs)
+}
+
+// GetByID возвращает подписку с историей списаний
+func (h *SubscriptionHandler) GetByID(c *gin.Context) {
+	id, ok := subscriptionIDParam(c)
+	if !ok {
+		return
+	}
+
+	sub, err := h.service.GetByID(id)
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+	charges, err := h.service.GetCharges(id)
+	if err != nil {
+		respondSubscriptionError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"subscription": sub,
+		"charges":      charges,
+	})
+}
+
+// CancelByManager отменяет подписку из админки
+func (h *SubscriptionHandler) CancelByManager(c *gin.Context) {
+	id, ok := subscriptionIDParam(c)
+	if !ok {
+		return
+	}
+
+	h.respond(c)(h.service.CancelByManager(id))
+}
+
+// respond отдает подписку после изменения или ошибку
+func (h *SubscriptionHandler) respond(c *gin.Context) func(*domainSubscription.Subscription, error) {
+	return func(sub *domainSubscription.Subscription, err error) {
+		if err != nil {
+			respondSubscriptionError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, sub)
+	}
+}
+
+func subscriptionIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный id подписки"})
+		return 0, false
+	}
+	return id, true
+}
+
+// respondSubscriptionError переводит ошибки работы с подпиской в HTTP-ответ
+func respondSubscriptionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, domainSubscription.ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Подписка не найдена"})
+	case errors.Is(err, domainSubscription.ErrInvalidTransition), errors.Is(err, domainSubscription.ErrPlanUnavailable),
+		errors.Is(err, domainPayment.ErrRecurringNotSupported), errors.Is(err, domainPayment.ErrUnknownProvider),
+		errors.Is(err, domainPayment.ErrInvalidReceipt):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, domainPayment.ErrProviderUnavailable):
+		respondProviderUnavailable(c)
+	default:
+		logger.Error("Ошибка обработки подписки", zap.Error(err))
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+	}
+}
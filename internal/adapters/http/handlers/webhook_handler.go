@@ -1,165 +1,201 @@
 package handlers
 
 import (
+	appPayment "backend/internal/app/payment"
+	appPaymentEvent "backend/internal/app/paymentevent"
+	domainPayment "backend/internal/domain/payment"
 	"backend/pkg/logger"
-	"backend/pkg/templates"
-	"backend/pkg/smtp_sender"
-	"encoding/json"
+	"errors"
 	"net"
 	"net/http"
-	"os"
+	"strconv"
 	"strings"
 
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+// defaultWebhookProvider - провайдер уведомлений, приходящих на /webhook/payment
+const defaultWebhookProvider = "yookassa"
+
 type WebhookHandler struct {
-    // Можно добавить зависимости если нужно
+    paymentService *appPayment.Service
+    eventService   *appPaymentEvent.Service
 }
 
-func NewWebhookHandler() *WebhookHandler {
-    return &WebhookHandler{}
+func NewWebhookHandler(paymentService *appPayment.Service, eventService *appPaymentEvent.Service) *WebhookHandler {
+    return &WebhookHandler{
+        paymentService: paymentService,
+        eventService:   eventService,
+    }
 }
 
 func (h *WebhookHandler) HandlePaymentWebhook(c *gin.Context) {
-    // Проверяем IP адрес отправителя
-    clientIP := c.ClientIP()
-    
-    // Разрешенные IP адреса ЮKassa (официальные из документации)
-    allowedIPs := []string{
-        "185.71.76.0/27",    // ЮKassa диапазон 1
-        "185.71.77.0/27",    // ЮKassa диапазон 2  
-        "77.75.153.0/25",    // ЮKassa диапазон 3
-        "77.75.154.128/25",  // ЮKassa диапазон 4
-        "2a02:5180::/32",    // IPv6 диапазон
-    }
-    
-    if !isIPAllowed(clientIP, allowedIPs) {
-        logger.Warn("Webhook from unauthorized IP", 
-            zap.String("ip", clientIP),
-            zap.String("path", c.Request.URL.Path),
-            zap.String("method", c.Request.Method))
-        c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+    provider := c.Param("provider")
+    if provider == "" {
+        provider = defaultWebhookProvider
+    }
+    if !h.paymentService.HasProvider(provider) {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Unknown payment provider"})
         return
     }
 
-    var notification struct {
-        Event  string                 `json:"event"`
-        Object map[string]interface{} `json:"object"`
+    clientIP := c.ClientIP()
+
+    // Уведомления ЮKassa не подписаны, поэтому проверяем IP адрес отправителя.
+    // Остальные провайдеры подписывают уведомления, подпись проверяет адаптер.
+    if provider == defaultWebhookProvider {
+        // Разрешенные IP адреса ЮKassa (официальные из документации)
+        allowedIPs := []string{
+            "185.71.76.0/27",    // ЮKassa диапазон 1
+            "185.71.77.0/27",    // ЮKassa диапазон 2
+            "77.75.153.0/25",    // ЮKassa диапазон 3
+            "77.75.154.128/25",  // ЮKassa диапазон 4
+            "2a02:5180::/32",    // IPv6 диапазон
+        }
+
+        if !isIPAllowed(clientIP, allowedIPs) {
+            logger.Warn("Webhook from unauthorized IP",
+                zap.String("ip", clientIP),
+                zap.String("path", c.Request.URL.Path),
+                zap.String("method", c.Request.Method))
+            c.JSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+            return
+        }
     }
 
-    if err := c.BindJSON(&notification); err != nil {
-        logger.Error("Invalid webhook data", zap.Error(err))
+    body, err := c.GetRawData()
+    if err != nil {
+        logger.Error("Failed to read webhook body", zap.Error(err))
         c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data"})
         return
     }
 
-    // БЕЗОПАСНОЕ ЛОГИРОВАНИЕ - проверяем наличие полей
-    paymentID, hasID := notification.Object["id"].(string)
-    if hasID {
-        logger.Info("Webhook received", 
-            zap.String("event", notification.Event),
-            zap.String("payment_id", paymentID),
+    event, err := h.paymentService.ParseWebhook(provider, body)
+    if err != nil {
+        logger.Error("Invalid webhook data",
+            zap.String("provider", provider),
+            zap.String("source_ip", clientIP),
+            zap.Error(err))
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook data"})
+        return
+    }
+
+    if event == nil {
+        logger.Info("Webhook ignored",
+            zap.String("provider", provider),
             zap.String("source_ip", clientIP))
     } else {
-        logger.Info("Webhook received (no payment ID)", 
-            zap.String("event", notification.Event),
+        logger.Info("Webhook received",
+            zap.String("provider", provider),
+            zap.String("event", string(event.Type)),
+            zap.String("payment_id", event.PaymentID),
             zap.String("source_ip", clientIP))
+
+        // Событие сохраняется во входящих и обрабатывается один раз. Тело
+        // уведомления не считается достоверным: платеж перечитывается из API
+        // провайдера и сверяется с заказом.
+        _, err := h.eventService.Receive(c.Request.Context(), event, body, domainPayment.SourceWebhook)
+        switch {
+        case errors.Is(err, domainPayment.ErrEventMismatch):
+            // Повтор не исправит расхождение - подтверждаем получение, но заказ не трогаем
+            logger.Error("Webhook does not match payment, ignored",
+                zap.String("provider", provider),
+                zap.String("event", string(event.Type)),
+                zap.String("payment_id", event.PaymentID),
+                zap.String("source_ip", clientIP),
+                zap.Error(err))
+        case err != nil:
+            // Провайдер повторит уведомление позже
+            logger.Error("Failed to process webhook",
+                zap.String("provider", provider),
+                zap.String("event", string(event.Type)),
+                zap.String("payment_id", event.PaymentID),
+                zap.Error(err))
+            c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Processing failed, retry later"})
+            return
+        }
+    }
+
+    // Всегда подтверждаем получение в формате, который ожидает провайдер
+    contentType, ack, err := h.paymentService.WebhookAck(provider)
+    if err != nil {
+        c.JSON(http.StatusOK, gin.H{"status": "ok"})
+        return
     }
+    c.Data(http.StatusOK, contentType, ack)
+}
 
-    // Обрабатываем только успешные платежи
-    if notification.Event == "payment.succeeded" {
-        h.handleSuccessfulPayment(notification.Object)
+// ListEvents возвращает входящие события платежных систем (?status=failed)
+func (h *WebhookHandler) ListEvents(c *gin.Context) {
+    status := domainPayment.InboxStatus(c.DefaultQuery("status", string(domainPayment.InboxFailed)))
+
+    limit, offset := pagination(c)
+    events, err := h.eventService.GetInboxEvents(status, limit, offset)
+    if err != nil {
+        logger.Error("Ошибка при получении событий", zap.Error(err))
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+        return
     }
 
-    // Всегда отвечаем 200 OK на вебхуки
-    c.JSON(http.StatusOK, gin.H{"status": "ok"})
+    c.JSON(http.StatusOK, events)
 }
 
-func (h *WebhookHandler) handleSuccessfulPayment(paymentData map[string]interface{}) {
-    // Извлекаем данные из metadata с проверками
-    metadata, ok := paymentData["metadata"].(map[string]interface{})
+// GetEvent возвращает входящее событие вместе с исходным телом уведомления
+func (h *WebhookHandler) GetEvent(c *gin.Context) {
+    id, ok := eventIDParam(c)
     if !ok {
-        logger.Error("Invalid metadata format in webhook")
         return
     }
 
-    // БЕЗОПАСНОЕ ИЗВЛЕЧЕНИЕ ДАННЫХ
-    email, _ := metadata["email"].(string)
-    customerName, _ := metadata["customerName"].(string)
-    phone, _ := metadata["phone"].(string)
-    deliveryType, _ := metadata["deliveryType"].(string)
-    deliveryAddress, _ := metadata["deliveryAddress"].(string)
-    comment, _ := metadata["comment"].(string)
-    cartItemsJSON, _ := metadata["cartItems"].(string)
-
-    // БЕЗОПАСНОЕ ИЗВЛЕЧЕНИЕ ДАННЫХ О ПЛАТЕЖЕ
-    var amount, currency, description, paymentID string
-    
-    if amountData, ok := paymentData["amount"].(map[string]interface{}); ok {
-        amount, _ = amountData["value"].(string)
-        currency, _ = amountData["currency"].(string)
-    }
-    
-    description, _ = paymentData["description"].(string)
-    paymentID, _ = paymentData["id"].(string)
-
-    // Парсим JSON с товарами
-    var cartItems []templates.CartItem
-    if cartItemsJSON != "" {
-        if err := json.Unmarshal([]byte(cartItemsJSON), &cartItems); err != nil {
-            logger.Error("Failed to parse cart items", zap.Error(err))
-            // Продолжаем обработку даже если не удалось распарсить товары
-            cartItems = []templates.CartItem{}
-        }
+    event, err := h.eventService.GetInboxEvent(id)
+    if err != nil {
+        respondEventError(c, id, err)
+        return
     }
 
-    // Формируем данные заказа
-    order := templates.OrderData{
-        CustomerName:    customerName,
-        Email:           email,
-        Phone:           phone,
-        DeliveryType:    deliveryType,
-        DeliveryAddress: deliveryAddress,
-        Comment:         comment,
-        PaymentID:       paymentID,
-        Amount:          amount,
-        Currency:        currency,
-        Description:     description,
-        CartItems:       cartItems,
-    }
-
-    // Получаем email менеджера из переменных окружения
-    managerEmail := os.Getenv("MANAGER_EMAIL")
-    if managerEmail == "" {
-        managerEmail = "orders@vitalis-life.ru" // email по умолчанию
-    }
-
-    // Отправляем письма в горутине (асинхронно)
-    go func() {
-        err := smtp_sender.SendOrderEmails(order, managerEmail)
-        if err != nil {
-            logger.Error("Failed to send order emails", 
-                zap.Error(err),
-                zap.String("client_email", email),
-                zap.String("payment_id", paymentID))
-        } else {
-            logger.Info("Order emails sent successfully",
-                zap.String("client_email", email),
-                zap.String("payment_id", paymentID))
-        }
-    }()
+    c.JSON(http.StatusOK, event)
+}
+
+// RetryEvent повторно обрабатывает событие, завершившееся ошибкой
+func (h *WebhookHandler) RetryEvent(c *gin.Context) {
+    id, ok := eventIDParam(c)
+    if !ok {
+        return
+    }
+
+    event, err := h.eventService.Retry(c.Request.Context(), id)
+    if err != nil {
+        respondEventError(c, id, err)
+        return
+    }
+
+    c.JSON(http.StatusOK, event)
+}
+
+func eventIDParam(c *gin.Context) (int, bool) {
+    id, err := strconv.Atoi(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Некорректный id события"})
+        return 0, false
+    }
+    return id, true
+}
+
+func respondEventError(c *gin.Context, eventID int, err error) {
+    switch {
+    case errors.Is(err, domainPayment.ErrInboxEventNotFound):
+        c.JSON(http.StatusNotFound, gin.H{"error": "Событие не найдено"})
+    case errors.Is(err, domainPayment.ErrInboxEventProcessed):
+        c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+    default:
+        logger.Error("Ошибка обработки события", zap.Int("inbox_id", eventID), zap.Error(err))
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
+    }
 }
 
 // isIPAllowed проверяет, разрешен ли IP адрес
 func isIPAllowed(ipStr string, allowedIPs []string) bool {
-    // Пропускаем локальные адреса для тестирования
-    if ipStr == "::1" || ipStr == "127.0.0.1" || strings.HasPrefix(ipStr, "192.168.") {
-        logger.Debug("Local IP allowed for testing", zap.String("ip", ipStr))
-        return true
-    }
-    
     clientIP := net.ParseIP(ipStr)
     if clientIP == nil {
         logger.Warn("Invalid IP address", zap.String("ip", ipStr))
@@ -3,7 +3,11 @@ package http
 import(
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 	"backend/config"
+	"backend/pkg/logger"
+	"crypto/subtle"
+	"net/http"
 	"time"
 )
 
@@ -16,4 +20,26 @@ func CORSNew(config config.CORSConfig) gin.HandlerFunc {
 		AllowCredentials: config.AllowCredentials,
 		MaxAge:           time.Second * time.Duration(config.MaxAge),
 	})
-}
\ No newline at end of file
+}
+// AdminAuth пропускает только запросы с верным токеном менеджера в заголовке
+// X-Admin-Token. Если токен не настроен, административные маршруты закрыты.
+func AdminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			logger.Warn("ADMIN_TOKEN не задан, административные маршруты недоступны")
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+			return
+		}
+
+		provided := c.GetHeader("X-Admin-Token")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			logger.Warn("Неверный токен администратора",
+				zap.String("ip", c.ClientIP()),
+				zap.String("path", c.Request.URL.Path))
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,8 +1,22 @@
 package http
 
 import (
+    "expvar"
+    appCapture "backend/internal/app/capture"
+    appCertificate "backend/internal/app/certificate"
+    appFeed "backend/internal/app/feed"
+    appLoyalty "backend/internal/app/loyalty"
+    appOffline "backend/internal/app/offline"
+    appOrder "backend/internal/app/order"
     appPayment "backend/internal/app/payment"
+    appPaymentEvent "backend/internal/app/paymentevent"
     appProduct "backend/internal/app/product"
+    appReceipt "backend/internal/app/receipt"
+    appRecommendation "backend/internal/app/recommendation"
+    appRefund "backend/internal/app/refund"
+    appReview "backend/internal/app/review"
+    appSubscription "backend/internal/app/subscription"
+    "backend/internal/adapters/sandbox"
     "backend/internal/adapters/http/handlers"
     "backend/pkg/logger"
     "backend/config"
@@ -13,9 +27,29 @@ import (
 func Router(
     productService *appProduct.Service, 
     paymentService *appPayment.Service, 
+    paymentEventService *appPaymentEvent.Service,
+    orderService *appOrder.Service,
+    refundService *appRefund.Service,
+    captureService *appCapture.Service,
+    receiptService *appReceipt.Service,
+    reviewService *appReview.Service,
+    recommendationService *appRecommendation.Service,
+    feedService *appFeed.Service,
+    subscriptionService *appSubscription.Service,
+    offlineService *appOffline.Service,
+    certificateService *appCertificate.Service,
+    loyaltyService *appLoyalty.Service,
+    sandboxProvider *sandbox.PaymentRepository, // nil, если тестовый провайдер выключен
     cfg *config.Config,
 ) *gin.Engine {
     router := gin.Default()
+
+    // Без доверенных прокси ClientIP() не читает X-Forwarded-For, иначе
+    // проверку IP отправителя вебхука можно обойти подделанным заголовком.
+    // С ошибкой в списке gin доверял бы всем адресам, поэтому не запускаемся.
+    if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+        logger.Fatal("Некорректный список доверенных прокси в server.trusted_proxies", zap.Error(err))
+    }
     
     router.Use(CORSNew(cfg.CORS))
     
@@ -27,8 +61,15 @@ func Router(
     })
     
     productHandler := handlers.NewProductHandler(productService)
-    paymentHandler := handlers.NewPaymentHandler(paymentService, productService)
-    webhookHandler := handlers.NewWebhookHandler()
+    paymentHandler := handlers.NewPaymentHandler(paymentService, productService, orderService, offlineService, certificateService, loyaltyService)
+    webhookHandler := handlers.NewWebhookHandler(paymentService, paymentEventService)
+    reviewHandler := handlers.NewReviewHandler(reviewService)
+    recommendationHandler := handlers.NewRecommendationHandler(recommendationService)
+    orderHandler := handlers.NewOrderHandler(orderService, refundService, captureService, receiptService, offlineService)
+    feedHandler := handlers.NewFeedHandler(feedService, cfg.Feed.CacheTTL)
+    subscriptionHandler := handlers.NewSubscriptionHandler(subscriptionService)
+    certificateHandler := handlers.NewCertificateHandler(certificateService)
+    loyaltyHandler := handlers.NewLoyaltyHandler(loyaltyService)
 
     public := router.Group("/api/v1/public")
     {
@@ -36,6 +77,10 @@ func Router(
         {
             product.GET("/", productHandler.GetAllProducts)
             product.GET("/:id", productHandler.GetByIdProducts)
+            product.GET("/by-slug/:slug", productHandler.GetBySlug)
+            product.GET("/:id/reviews", reviewHandler.ListByProduct)
+            product.POST("/:id/reviews", reviewHandler.Create)
+            product.GET("/:id/related", recommendationHandler.GetRelated)
         }
 
         payment := public.Group("/payment")
@@ -44,7 +89,86 @@ func Router(
             payment.GET("/:id/status", paymentHandler.GetStatus)      // Исправлено на GetStatus
             payment.POST("/:id/cancel", paymentHandler.Cancel)        // Исправлено на Cancel
         }
+
+        public.GET("/subscription-plans", subscriptionHandler.ListPlans)
+
+        // Управление подпиской по секретной ссылке из ответа на оформление и писем
+        subscriptions := public.Group("/subscriptions")
+        {
+            subscriptions.POST("/", subscriptionHandler.Subscribe)
+            subscriptions.GET("/:token", subscriptionHandler.GetByToken)
+            subscriptions.POST("/:token/pause", subscriptionHandler.Pause)
+            subscriptions.POST("/:token/resume", subscriptionHandler.Resume)
+            subscriptions.POST("/:token/cancel", subscriptionHandler.Cancel)
+            subscriptions.POST("/:token/pay", subscriptionHandler.Pay)
+        }
+
+        // Остаток подарочного сертификата по коду
+        public.GET("/gift-certificates/:code", certificateHandler.GetBalance)
+
+        // Баланс и история бонусов по секретной ссылке из писем
+        public.GET("/loyalty/:token", loyaltyHandler.GetByToken)
+    }
+
+    admin := router.Group("/api/v1/admin", AdminAuth(cfg.Admin.Token))
+    {
+        admin.GET("/metrics", gin.WrapH(expvar.Handler()))
+
+        reviews := admin.Group("/reviews")
+        {
+            reviews.GET("/", reviewHandler.ListForModeration)
+            reviews.POST("/:id/approve", reviewHandler.Approve)
+            reviews.POST("/:id/reject", reviewHandler.Reject)
+        }
+
+        webhooks := admin.Group("/webhooks")
+        {
+            webhooks.GET("/", webhookHandler.ListEvents)
+            webhooks.GET("/:id", webhookHandler.GetEvent)
+            webhooks.POST("/:id/retry", webhookHandler.RetryEvent)
+        }
+
+        orders := admin.Group("/orders")
+        {
+            orders.GET("/", orderHandler.List)
+            orders.GET("/:id", orderHandler.GetByID)
+            orders.POST("/:id/capture", orderHandler.Capture)
+            orders.POST("/:id/void", orderHandler.Void)
+            orders.GET("/:id/refunds", orderHandler.ListRefunds)
+            orders.POST("/:id/refunds", orderHandler.Refund)
+            orders.POST("/:id/fulfill", orderHandler.Fulfill)
+            orders.GET("/:id/receipts", orderHandler.ListReceipts)
+            orders.GET("/:id/marking-codes", orderHandler.ListMarkingCodes)
+            orders.POST("/:id/marking-codes", orderHandler.AddMarkingCodes)
+            orders.POST("/:id/settlement-receipt", orderHandler.SettlementReceipt)
+            orders.POST("/:id/offline-payment", orderHandler.OfflinePayment)
+            orders.POST("/:id/cancel", orderHandler.CancelOffline)
+        }
+
+        subscriptions := admin.Group("/subscriptions")
+        {
+            subscriptions.GET("/", subscriptionHandler.List)
+            subscriptions.GET("/:id", subscriptionHandler.GetByID)
+            subscriptions.POST("/:id/cancel", subscriptionHandler.CancelByManager)
+        }
+
+        admin.GET("/gift-certificates/:code", certificateHandler.GetByCode)
+    }
+
+    router.POST("/webhook/payment", webhookHandler.HandlePaymentWebhook)          // ЮKassa
+    router.POST("/webhook/payment/:provider", webhookHandler.HandlePaymentWebhook)
+    router.GET("/feed/yandex.yml", feedHandler.GetYandexYML)
+    router.GET("/sitemap.xml", feedHandler.GetSitemap)
+
+    if sandboxProvider != nil {
+        sandboxHandler := handlers.NewSandboxHandler(sandboxProvider)
+
+        sandboxPayment := router.Group("/sandbox/payment")
+        {
+            sandboxPayment.GET("/:id", sandboxHandler.Page)
+            sandboxPayment.POST("/:id/succeed", sandboxHandler.Succeed)
+            sandboxPayment.POST("/:id/fail", sandboxHandler.Fail)
+        }
     }
-    router.POST("/webhook/payment", webhookHandler.HandlePaymentWebhook)
     return router
-}
\ No newline at end of file
+}
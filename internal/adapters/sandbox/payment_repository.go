@@ -0,0 +1,432 @@
+package sandbox
+
+import (
+    "backend/config"
+    domainPayment "backend/internal/domain/payment"
+    "backend/pkg/logger"
+    "bytes"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "net/http"
+    "sync"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+// ProviderName - идентификатор тестового провайдера в конфигурации и заказах
+const ProviderName = "sandbox"
+
+// holdPeriod - срок холда тестовых двухстадийных платежей
+const holdPeriod = 7 * 24 * time.Hour
+
+// ErrPaymentNotFound возвращается для неизвестного ID платежа
+var ErrPaymentNotFound = errors.New("sandbox: payment not found")
+
+// ErrInvalidState возвращается, если операция невозможна в текущем статусе платежа
+var ErrInvalidState = errors.New("sandbox: invalid payment state")
+
+// payment - платеж, хранящийся в памяти процесса
+type payment struct {
+    response  domainPayment.PaymentResponse
+    capture   bool
+    save      bool   // сохранить способ оплаты после успешной оплаты
+    method    string // способ оплаты, выбранный на сайте
+    returnURL string
+}
+
+// PaymentRepository - платежный провайдер для локальной разработки и e2e-тестов.
+// Платежи хранятся в памяти, оплата подтверждается на собственной странице
+// подтверждения, уведомления отправляются на /webhook/payment/sandbox.
+type PaymentRepository struct {
+    baseURL string
+    client  *http.Client
+
+    mu       sync.Mutex
+    payments map[string]*payment
+    byKey    map[string]*payment                      // платежи по ключу идемпотентности
+    refunds  map[string]*domainPayment.RefundResponse // возвраты по ключу идемпотентности
+    methods  map[string]bool                          // сохраненные способы оплаты; после перезапуска списания по ним отклоняются
+}
+
+func NewPaymentRepository(cfg config.SandboxConfig) *PaymentRepository {
+    return &PaymentRepository{
+        baseURL:  cfg.BaseURL,
+        client:   &http.Client{Timeout: 10 * time.Second},
+        payments: make(map[string]*payment),
+        byKey:    make(map[string]*payment),
+        refunds:  make(map[string]*domainPayment.RefundResponse),
+        methods:  make(map[string]bool),
+    }
+}
+
+func (r *PaymentRepository) Name() string {
+    return ProviderName
+}
+
+func (r *PaymentRepository) CreatePayment(ctx context.Context, request *domainPayment.PaymentRequest) (*domainPayment.PaymentResponse, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    // Повтор запроса с тем же ключом возвращает уже созданный платеж, как у ЮKassa
+    if request.IdempotenceKey != "" {
+        if p, ok := r.byKey[request.IdempotenceKey]; ok {
+            resp := p.response
+            return &resp, nil
+        }
+    }
+
+    id := newID()
+    p := &payment{
+        response: domainPayment.PaymentResponse{
+            ID:          id,
+            Status:      domainPayment.StatusPending,
+            Amount:      domainPayment.Amount{Value: fmt.Sprintf("%.2f", request.Amount), Currency: request.Currency},
+            Description:  request.Description,
+            Confirmation: r.confirmation(request.ConfirmationType, id),
+            Metadata:     request.Metadata,
+            CreatedAt:    time.Now(),
+        },
+        capture:   request.Capture,
+        save:      request.SavePaymentMethod,
+        method:    request.PaymentMethodType,
+        returnURL: request.ReturnURL,
+    }
+
+    r.payments[id] = p
+    if request.IdempotenceKey != "" {
+        r.byKey[request.IdempotenceKey] = p
+    }
+
+    resp := p.response
+    return &resp, nil
+}
+
+// SupportsConfirmation - тестовый провайдер принимает все сценарии, чтобы их
+// можно было проверить без ЮKassa
+func (r *PaymentRepository) SupportsConfirmation(confirmation domainPayment.ConfirmationType, method string) bool {
+    return domainPayment.ValidateConfirmation(confirmation, method) == nil
+}
+
+// confirmation ведет на тестовую страницу оплаты при любом сценарии: QR-код
+// содержит ее адрес, а токен виджета - ID платежа (виджет ЮKassa с ним не
+// работает, фронтенд может открыть страницу /sandbox/payment/<токен>)
+func (r *PaymentRepository) confirmation(confirmation domainPayment.ConfirmationType, id string) domainPayment.Confirmation {
+    pageURL := r.baseURL + "/sandbox/payment/" + id
+
+    switch confirmation {
+    case domainPayment.ConfirmationEmbedded:
+        return domainPayment.Confirmation{Type: string(confirmation), ConfirmationToken: id}
+    case domainPayment.ConfirmationQR:
+        return domainPayment.Confirmation{Type: string(confirmation), ConfirmationData: pageURL}
+    case domainPayment.ConfirmationMobileApplication:
+        return domainPayment.Confirmation{Type: string(confirmation), ConfirmationURL: pageURL}
+    }
+    return domainPayment.Confirmation{Type: string(domainPayment.ConfirmationRedirect), ConfirmationURL: pageURL}
+}
+
+func (r *PaymentRepository) GetPaymentStatus(ctx context.Context, paymentID string) (*domainPayment.PaymentResponse, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    p, ok := r.payments[paymentID]
+    if !ok {
+        return nil, fmt.Errorf("%w: %s", ErrPaymentNotFound, paymentID)
+    }
+
+    resp := p.response
+    return &resp, nil
+}
+
+func (r *PaymentRepository) CancelPayment(ctx context.Context, paymentID string) error {
+    resp, err := r.cancel(paymentID, domainPayment.CancellationDetails{Party: "merchant", Reason: "canceled_by_merchant"},
+        domainPayment.StatusPending, domainPayment.StatusWaitingForCapture)
+    if err != nil {
+        return err
+    }
+
+    r.notify(domainPayment.EventPaymentCanceled, resp)
+    return nil
+}
+
+func (r *PaymentRepository) CapturePayment(ctx context.Context, request *domainPayment.CaptureRequest) (*domainPayment.PaymentResponse, error) {
+    r.mu.Lock()
+    p, ok := r.payments[request.PaymentID]
+    if !ok {
+        r.mu.Unlock()
+        return nil, fmt.Errorf("%w: %s", ErrPaymentNotFound, request.PaymentID)
+    }
+    if p.response.Status != domainPayment.StatusWaitingForCapture {
+        r.mu.Unlock()
+        return nil, fmt.Errorf("%w: %s", ErrInvalidState, p.response.Status)
+    }
+    p.response.Status = domainPayment.StatusSucceeded
+    p.response.Amount = domainPayment.Amount{Value: fmt.Sprintf("%.2f", request.Amount), Currency: request.Currency}
+    p.response.ExpiresAt = nil
+    resp := p.response
+    r.mu.Unlock()
+
+    r.notify(domainPayment.EventPaymentSucceeded, &resp)
+    return &resp, nil
+}
+
+func (r *PaymentRepository) Refund(ctx context.Context, request *domainPayment.RefundRequest) (*domainPayment.RefundResponse, error) {
+    p, err := r.GetPaymentStatus(ctx, request.PaymentID)
+    if err != nil {
+        return nil, err
+    }
+    if p.Status != domainPayment.StatusSucceeded {
+        return nil, fmt.Errorf("%w: %s", ErrInvalidState, p.Status)
+    }
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if request.IdempotenceKey != "" {
+        if refund, ok := r.refunds[request.IdempotenceKey]; ok {
+            return refund, nil
+        }
+    }
+
+    refund := &domainPayment.RefundResponse{
+        ID:          newID(),
+        PaymentID:   request.PaymentID,
+        Status:      domainPayment.StatusSucceeded,
+        Amount:      domainPayment.Amount{Value: fmt.Sprintf("%.2f", request.Amount), Currency: request.Currency},
+        Description: request.Description,
+        CreatedAt:   time.Now(),
+    }
+    if request.IdempotenceKey != "" {
+        r.refunds[request.IdempotenceKey] = refund
+    }
+
+    r.send(notification{Event: domainPayment.EventRefundSucceeded, Refund: refund})
+    return refund, nil
+}
+
+// CreateRecurringPayment без сохраненного способа создает обычный платеж с
+// подтверждением на тестовой странице. Списание по сохраненному способу
+// проходит сразу; по неизвестному способу (например, сохраненному до
+// перезапуска) отклоняется, так можно проверить повторные попытки.
+func (r *PaymentRepository) CreateRecurringPayment(ctx context.Context, request *domainPayment.PaymentRequest) (*domainPayment.PaymentResponse, error) {
+    if request.PaymentMethodID == "" {
+        return r.CreatePayment(ctx, request)
+    }
+
+    r.mu.Lock()
+    if request.IdempotenceKey != "" {
+        if p, ok := r.byKey[request.IdempotenceKey]; ok {
+            resp := p.response
+            r.mu.Unlock()
+            return &resp, nil
+        }
+    }
+
+    id := newID()
+    p := &payment{
+        response: domainPayment.PaymentResponse{
+            ID:          id,
+            Status:      domainPayment.StatusSucceeded,
+            Paid:        true,
+            Amount:      domainPayment.Amount{Value: fmt.Sprintf("%.2f", request.Amount), Currency: request.Currency},
+            Description: request.Description,
+            Metadata:    request.Metadata,
+            CreatedAt:   time.Now(),
+            PaymentMethod: &domainPayment.PaymentMethod{
+                Type:  "bank_card",
+                ID:    request.PaymentMethodID,
+                Saved: true,
+            },
+        },
+        capture: true,
+    }
+    event := domainPayment.EventPaymentSucceeded
+    if !r.methods[request.PaymentMethodID] {
+        event = domainPayment.EventPaymentCanceled
+        p.response.Status = domainPayment.StatusCanceled
+        p.response.Paid = false
+        p.response.CancellationDetails = &domainPayment.CancellationDetails{Party: "yoo_money", Reason: "permission_revoked"}
+    }
+
+    r.payments[id] = p
+    if request.IdempotenceKey != "" {
+        r.byKey[request.IdempotenceKey] = p
+    }
+    resp := p.response
+    r.mu.Unlock()
+
+    r.notify(event, &resp)
+    return &resp, nil
+}
+
+// CreateReceipt сразу регистрирует чек по успешному платежу, как это делает
+// ЮKassa, чтобы чек полного расчета можно было проверить локально
+func (r *PaymentRepository) CreateReceipt(ctx context.Context, request *domainPayment.ReceiptRequest) (*domainPayment.ReceiptResponse, error) {
+    // Чек без платежа - расчет при получении заказа
+    if request.PaymentID != "" {
+        p, err := r.GetPaymentStatus(ctx, request.PaymentID)
+        if err != nil {
+            return nil, err
+        }
+        if p.Status != domainPayment.StatusSucceeded {
+            return nil, fmt.Errorf("%w: %s", ErrInvalidState, p.Status)
+        }
+    }
+
+    logger.Info("Sandbox: чек зарегистрирован",
+        zap.String("payment_id", request.PaymentID),
+        zap.String("type", request.Type),
+        zap.Int("items", len(request.Items)))
+
+    return &domainPayment.ReceiptResponse{
+        ID:        newID(),
+        Type:      request.Type,
+        PaymentID: request.PaymentID,
+        Status:    "succeeded",
+    }, nil
+}
+
+// Page возвращает данные для страницы подтверждения
+func (r *PaymentRepository) Page(paymentID string) (*domainPayment.PaymentResponse, error) {
+    // Платежи хранятся в памяти, контекст не нужен
+    return r.GetPaymentStatus(context.Background(), paymentID)
+}
+
+// Succeed имитирует успешную оплату покупателем: одностадийный платеж
+// становится succeeded, двухстадийный - waiting_for_capture.
+// Возвращает адрес, на который нужно вернуть покупателя.
+func (r *PaymentRepository) Succeed(paymentID string) (string, error) {
+    r.mu.Lock()
+    p, ok := r.payments[paymentID]
+    if !ok {
+        r.mu.Unlock()
+        return "", fmt.Errorf("%w: %s", ErrPaymentNotFound, paymentID)
+    }
+    if p.response.Status != domainPayment.StatusPending {
+        r.mu.Unlock()
+        return "", fmt.Errorf("%w: %s", ErrInvalidState, p.response.Status)
+    }
+
+    if p.save {
+        methodID := newID()
+        r.methods[methodID] = true
+        p.response.PaymentMethod = &domainPayment.PaymentMethod{
+            Type:  "bank_card",
+            ID:    methodID,
+            Saved: true,
+            Title: "Тестовая карта *4242",
+        }
+    } else if p.method != "" {
+        p.response.PaymentMethod = &domainPayment.PaymentMethod{Type: p.method, ID: newID()}
+    }
+
+    event := domainPayment.EventPaymentSucceeded
+    if p.capture {
+        p.response.Status = domainPayment.StatusSucceeded
+    } else {
+        event = domainPayment.EventPaymentWaitingForCapture
+        expiresAt := time.Now().Add(holdPeriod)
+        p.response.Status = domainPayment.StatusWaitingForCapture
+        p.response.ExpiresAt = &expiresAt
+    }
+    resp := p.response
+    returnURL := p.returnURL
+    r.mu.Unlock()
+
+    r.notify(event, &resp)
+    return returnURL, nil
+}
+
+// Fail имитирует отказ в оплате. Возвращает адрес возврата покупателя.
+func (r *PaymentRepository) Fail(paymentID string) (string, error) {
+    resp, err := r.cancel(paymentID, domainPayment.CancellationDetails{Party: "payment_network", Reason: "general_decline"},
+        domainPayment.StatusPending)
+    if err != nil {
+        return "", err
+    }
+
+    r.notify(domainPayment.EventPaymentCanceled, resp)
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    return r.payments[paymentID].returnURL, nil
+}
+
+// transition переводит платеж в статус to, если текущий статус входит в from
+func (r *PaymentRepository) transition(paymentID string, to domainPayment.Status, from ...domainPayment.Status) (*domainPayment.PaymentResponse, error) {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+
+    p, ok := r.payments[paymentID]
+    if !ok {
+        return nil, fmt.Errorf("%w: %s", ErrPaymentNotFound, paymentID)
+    }
+
+    allowed := false
+    for _, status := range from {
+        if p.response.Status == status {
+            allowed = true
+            break
+        }
+    }
+    if !allowed {
+        return nil, fmt.Errorf("%w: %s", ErrInvalidState, p.response.Status)
+    }
+
+    p.response.Status = to
+    p.response.ExpiresAt = nil
+    resp := p.response
+    return &resp, nil
+}
+
+// cancel отменяет платеж и запоминает причину отмены
+func (r *PaymentRepository) cancel(paymentID string, details domainPayment.CancellationDetails, from ...domainPayment.Status) (*domainPayment.PaymentResponse, error) {
+    resp, err := r.transition(paymentID, domainPayment.StatusCanceled, from...)
+    if err != nil {
+        return nil, err
+    }
+
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    r.payments[paymentID].response.CancellationDetails = &details
+    resp.CancellationDetails = &details
+    return resp, nil
+}
+
+func (r *PaymentRepository) notify(event domainPayment.EventType, resp *domainPayment.PaymentResponse) {
+    r.send(notification{Event: event, Payment: resp})
+}
+
+// send отправляет уведомление на вебхук приложения асинхронно, как это
+// делает настоящая платежная система
+func (r *PaymentRepository) send(n notification) {
+    body, err := json.Marshal(n)
+    if err != nil {
+        logger.Error("Sandbox: failed to marshal webhook", zap.Error(err))
+        return
+    }
+
+    go func() {
+        resp, err := r.client.Post(r.baseURL+"/webhook/payment/"+ProviderName, "application/json", bytes.NewReader(body))
+        if err != nil {
+            logger.Error("Sandbox: failed to send webhook",
+                zap.String("event", string(n.Event)),
+                zap.Error(err))
+            return
+        }
+        resp.Body.Close()
+
+        logger.Info("Sandbox: webhook sent",
+            zap.String("event", string(n.Event)),
+            zap.Int("status", resp.StatusCode))
+    }()
+}
+
+func newID() string {
+    b := make([]byte, 12)
+    rand.Read(b)
+    return "sandbox-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,36 @@
+package sandbox
+
+import (
+    domainPayment "backend/internal/domain/payment"
+    "encoding/json"
+    "fmt"
+)
+
+// notification - уведомление тестового провайдера
+type notification struct {
+    Event   domainPayment.EventType        `json:"event"`
+    Payment *domainPayment.PaymentResponse `json:"payment,omitempty"`
+    Refund  *domainPayment.RefundResponse  `json:"refund,omitempty"`
+}
+
+// ParseWebhook разбирает уведомление. Уведомления не подписаны: тестовый
+// провайдер не должен быть включен на боевом сервере.
+func (r *PaymentRepository) ParseWebhook(body []byte) (*domainPayment.Event, error) {
+    var n notification
+    if err := json.Unmarshal(body, &n); err != nil {
+        return nil, fmt.Errorf("invalid webhook body: %w", err)
+    }
+
+    switch {
+    case n.Payment != nil:
+        return &domainPayment.Event{Type: n.Event, PaymentID: n.Payment.ID, Payment: n.Payment}, nil
+    case n.Refund != nil:
+        return &domainPayment.Event{Type: n.Event, PaymentID: n.Refund.PaymentID, Refund: n.Refund}, nil
+    }
+
+    return nil, nil
+}
+
+func (r *PaymentRepository) WebhookAck() (string, []byte) {
+    return "application/json; charset=utf-8", []byte(`{"status":"ok"}`)
+}
@@ -0,0 +1,509 @@
+package tinkoff
+
+import (
+    "backend/config"
+    domainPayment "backend/internal/domain/payment"
+    "backend/pkg/logger"
+    "bytes"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "math"
+    "net/http"
+    "sort"
+    "strconv"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+// ProviderName - идентификатор Т-Кассы в конфигурации и заказах
+const ProviderName = "tinkoff"
+
+// holdPeriod - сколько банк держит холд до автоматической отмены
+const holdPeriod = 7 * 24 * time.Hour
+
+// maxDescriptionLength - ограничение API на длину описания платежа
+const maxDescriptionLength = 140
+
+// PaymentRepository работает с API интернет-эквайринга Т-Кассы (v2)
+type PaymentRepository struct {
+    terminalKey     string
+    password        string
+    taxation        string
+    notificationURL string
+    baseURL         string
+    client          *http.Client
+}
+
+func NewPaymentRepository(cfg config.TinkoffConfig) *PaymentRepository {
+    return &PaymentRepository{
+        terminalKey:     cfg.TerminalKey,
+        password:        cfg.Password,
+        taxation:        cfg.Taxation,
+        notificationURL: cfg.NotificationURL,
+        baseURL:         "https://securepay.tinkoff.ru/v2",
+        client:          &http.Client{Timeout: 30 * time.Second},
+    }
+}
+
+func (r *PaymentRepository) Name() string {
+    return ProviderName
+}
+
+// response - общие поля ответов API
+type response struct {
+    Success    bool        `json:"Success"`
+    ErrorCode  string      `json:"ErrorCode"`
+    Message    string      `json:"Message"`
+    Details    string      `json:"Details"`
+    Status     string      `json:"Status"`
+    PaymentID  json.Number `json:"PaymentId"`
+    OrderID    string      `json:"OrderId"`
+    Amount     int64       `json:"Amount"`
+    PaymentURL string      `json:"PaymentURL"`
+    NewAmount  int64       `json:"NewAmount"`
+    // Payments - платежи заказа в ответе CheckOrder
+    Payments []orderPayment `json:"Payments"`
+}
+
+// orderPayment - платеж в ответе CheckOrder
+type orderPayment struct {
+    PaymentID json.Number `json:"PaymentId"`
+    Amount    int64       `json:"Amount"`
+    Status    string      `json:"Status"`
+}
+
+type receipt struct {
+    Email    string        `json:"Email,omitempty"`
+    Phone    string        `json:"Phone,omitempty"`
+    Taxation string        `json:"Taxation"`
+    Items    []receiptItem `json:"Items"`
+}
+
+type receiptItem struct {
+    Name          string  `json:"Name"`
+    Price         int64   `json:"Price"`
+    Quantity      float64 `json:"Quantity"`
+    Amount        int64   `json:"Amount"`
+    Tax           string  `json:"Tax"`
+    PaymentMethod string  `json:"PaymentMethod,omitempty"`
+    PaymentObject string  `json:"PaymentObject,omitempty"`
+    // MeasurementUnit - единица измерения по ФФД 1.2: шт, г, кг
+    MeasurementUnit string `json:"MeasurementUnit,omitempty"`
+}
+
+func (r *PaymentRepository) CreatePayment(ctx context.Context, request *domainPayment.PaymentRequest) (*domainPayment.PaymentResponse, error) {
+    // Ключа идемпотентности у Т-Кассы нет: повторный Init по тому же заказу
+    // создал бы второй платеж. Поэтому сначала проверяются платежи заказа.
+    if request.IdempotenceKey != "" {
+        existing, err := r.existingPayment(ctx, request)
+        if err != nil {
+            return nil, err
+        }
+        if existing != nil {
+            return existing, nil
+        }
+    }
+
+    payType := "O"
+    if !request.Capture {
+        payType = "T"
+    }
+
+    params := map[string]interface{}{
+        "Amount":      toKopecks(request.Amount),
+        "OrderId":     strconv.Itoa(request.OrderID),
+        "Description": truncate(request.Description, maxDescriptionLength),
+        "PayType":     payType,
+        "SuccessURL":  request.ReturnURL,
+        "FailURL":     request.ReturnURL,
+        "DATA": map[string]string{
+            "Email": request.Email,
+            "Phone": request.Phone,
+        },
+    }
+    if r.notificationURL != "" {
+        params["NotificationURL"] = r.notificationURL
+    }
+    if len(request.ReceiptItems) > 0 {
+        rec, err := r.buildReceipt(request.Email, request.Phone, request.ReceiptItems)
+        if err != nil {
+            return nil, err
+        }
+        params["Receipt"] = rec
+    }
+
+    var resp response
+    if err := r.call(ctx, "Init", params, &resp); err != nil {
+        return nil, err
+    }
+
+    return &domainPayment.PaymentResponse{
+        ID:          resp.PaymentID.String(),
+        Status:      mapStatus(resp.Status),
+        Amount:      fromKopecks(resp.Amount),
+        Description: request.Description,
+        Confirmation: domainPayment.Confirmation{
+            Type:            "redirect",
+            ConfirmationURL: resp.PaymentURL,
+        },
+        Metadata:  request.Metadata,
+        CreatedAt: time.Now(),
+    }, nil
+}
+
+// existingPayment ищет платежи, уже созданные по заказу (например, когда
+// ответ на Init не дошел). Оплаченный или захолдированный платеж
+// возвращается как есть. Ссылку на оплату незавершенного платежа API не
+// отдает - такой платеж отменяется, чтобы после нового Init у заказа был
+// один платеж к оплате. Если платежей нет, возвращает nil.
+func (r *PaymentRepository) existingPayment(ctx context.Context, request *domainPayment.PaymentRequest) (*domainPayment.PaymentResponse, error) {
+    var resp response
+    ok, err := r.send(ctx, "CheckOrder", map[string]interface{}{"OrderId": strconv.Itoa(request.OrderID)}, &resp)
+    if err != nil {
+        return nil, err
+    }
+    if !ok {
+        // Заказ Т-Кассе неизвестен - платежей по нему нет
+        return nil, nil
+    }
+
+    for _, p := range resp.Payments {
+        paymentID := p.PaymentID.String()
+        switch mapStatus(p.Status) {
+        case domainPayment.StatusSucceeded, domainPayment.StatusWaitingForCapture:
+            logger.Warn("Tinkoff payment already exists for order",
+                zap.Int("order_id", request.OrderID),
+                zap.String("payment_id", paymentID),
+                zap.String("status", p.Status))
+            return &domainPayment.PaymentResponse{
+                ID:          paymentID,
+                Status:      mapStatus(p.Status),
+                Amount:      fromKopecks(p.Amount),
+                Description: request.Description,
+                Metadata:    request.Metadata,
+                CreatedAt:   time.Now(),
+            }, nil
+
+        case domainPayment.StatusPending:
+            if err := r.CancelPayment(ctx, paymentID); err != nil {
+                // Покупатель, возможно, оплачивает его прямо сейчас - второй
+                // платеж не создаем, запрос можно повторить позже
+                return nil, fmt.Errorf("failed to cancel previous payment %s: %w: %v",
+                    paymentID, domainPayment.ErrProviderUnavailable, err)
+            }
+            logger.Warn("Previous Tinkoff payment for order canceled",
+                zap.Int("order_id", request.OrderID),
+                zap.String("payment_id", paymentID))
+        }
+    }
+
+    return nil, nil
+}
+
+func (r *PaymentRepository) GetPaymentStatus(ctx context.Context, paymentID string) (*domainPayment.PaymentResponse, error) {
+    var resp response
+    if err := r.call(ctx, "GetState", map[string]interface{}{"PaymentId": paymentID}, &resp); err != nil {
+        return nil, err
+    }
+
+    return &domainPayment.PaymentResponse{
+        ID:                  paymentID,
+        Status:              mapStatus(resp.Status),
+        Amount:              fromKopecks(resp.Amount),
+        CancellationDetails: cancellationDetails(resp.Status),
+    }, nil
+}
+
+func (r *PaymentRepository) CancelPayment(ctx context.Context, paymentID string) error {
+    var resp response
+    return r.call(ctx, "Cancel", map[string]interface{}{"PaymentId": paymentID}, &resp)
+}
+
+func (r *PaymentRepository) CapturePayment(ctx context.Context, request *domainPayment.CaptureRequest) (*domainPayment.PaymentResponse, error) {
+    params := map[string]interface{}{
+        "PaymentId": request.PaymentID,
+        "Amount":    toKopecks(request.Amount),
+    }
+    if len(request.ReceiptItems) > 0 {
+        rec, err := r.buildReceipt(request.Email, "", request.ReceiptItems)
+        if err != nil {
+            return nil, err
+        }
+        params["Receipt"] = rec
+    }
+
+    var resp response
+    if err := r.call(ctx, "Confirm", params, &resp); err != nil {
+        return nil, err
+    }
+
+    return &domainPayment.PaymentResponse{
+        ID:     request.PaymentID,
+        Status: mapStatus(resp.Status),
+        Amount: domainPayment.Amount{Value: fmt.Sprintf("%.2f", request.Amount), Currency: request.Currency},
+    }, nil
+}
+
+// Refund выполняет возврат через метод Cancel: для списанного платежа он
+// возвращает указанную сумму. Отдельного идентификатора возврата API не выдает.
+func (r *PaymentRepository) Refund(ctx context.Context, request *domainPayment.RefundRequest) (*domainPayment.RefundResponse, error) {
+    params := map[string]interface{}{
+        "PaymentId": request.PaymentID,
+        "Amount":    toKopecks(request.Amount),
+    }
+    if len(request.ReceiptItems) > 0 {
+        rec, err := r.buildReceipt(request.Email, "", request.ReceiptItems)
+        if err != nil {
+            return nil, err
+        }
+        params["Receipt"] = rec
+    }
+
+    var resp response
+    if err := r.call(ctx, "Cancel", params, &resp); err != nil {
+        return nil, err
+    }
+
+    status := domainPayment.StatusPending
+    if resp.Status == "REFUNDED" || resp.Status == "PARTIAL_REFUNDED" {
+        status = domainPayment.StatusSucceeded
+    }
+
+    return &domainPayment.RefundResponse{
+        ID:          refundID(request.PaymentID, resp.NewAmount),
+        PaymentID:   request.PaymentID,
+        Status:      status,
+        Amount:      domainPayment.Amount{Value: fmt.Sprintf("%.2f", request.Amount), Currency: request.Currency},
+        Description: request.Description,
+        CreatedAt:   time.Now(),
+    }, nil
+}
+
+// call подписывает запрос и вызывает метод API. Отказ API (Success: false)
+// возвращается ошибкой.
+func (r *PaymentRepository) call(ctx context.Context, method string, params map[string]interface{}, out *response) error {
+    ok, err := r.send(ctx, method, params, out)
+    if err != nil {
+        return err
+    }
+    if !ok {
+        logger.Error("Tinkoff API error",
+            zap.String("method", method),
+            zap.String("code", out.ErrorCode),
+            zap.String("message", out.Message),
+            zap.String("details", out.Details))
+        return fmt.Errorf("Tinkoff error %s: %s %s", out.ErrorCode, out.Message, out.Details)
+    }
+    return nil
+}
+
+// send подписывает запрос, вызывает метод API и разбирает ответ. Возвращает
+// признак Success из ответа.
+func (r *PaymentRepository) send(ctx context.Context, method string, params map[string]interface{}, out *response) (bool, error) {
+    params["TerminalKey"] = r.terminalKey
+    params["Token"] = r.token(params)
+
+    jsonData, err := json.Marshal(params)
+    if err != nil {
+        return false, fmt.Errorf("failed to marshal %s request: %w", method, err)
+    }
+
+    httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, r.baseURL+"/"+method, bytes.NewBuffer(jsonData))
+    if err != nil {
+        return false, fmt.Errorf("failed to create request: %w", err)
+    }
+    httpReq.Header.Set("Content-Type", "application/json")
+
+    resp, err := r.client.Do(httpReq)
+    if err != nil {
+        return false, fmt.Errorf("failed to send request: %w: %v", domainPayment.ErrProviderUnavailable, err)
+    }
+    defer resp.Body.Close()
+
+    body, err := io.ReadAll(resp.Body)
+    if err != nil {
+        return false, fmt.Errorf("failed to read response: %w: %v", domainPayment.ErrProviderUnavailable, err)
+    }
+
+    if resp.StatusCode >= http.StatusInternalServerError {
+        return false, fmt.Errorf("Tinkoff error: %w: %s - %s", domainPayment.ErrProviderUnavailable, resp.Status, string(body))
+    }
+    if resp.StatusCode != http.StatusOK {
+        return false, fmt.Errorf("Tinkoff error: %s - %s", resp.Status, string(body))
+    }
+
+    if err := json.Unmarshal(body, out); err != nil {
+        return false, fmt.Errorf("failed to parse response: %w", err)
+    }
+
+    return out.Success, nil
+}
+
+// token подписывает запрос: значения параметров верхнего уровня (кроме
+// вложенных объектов) вместе с паролем сортируются по ключу, склеиваются
+// и хэшируются SHA-256
+func (r *PaymentRepository) token(params map[string]interface{}) string {
+    values := map[string]string{"Password": r.password}
+    for key, value := range params {
+        if key == "Token" {
+            continue
+        }
+        switch v := value.(type) {
+        case string:
+            values[key] = v
+        case bool:
+            values[key] = strconv.FormatBool(v)
+        case int64:
+            values[key] = strconv.FormatInt(v, 10)
+        case int:
+            values[key] = strconv.Itoa(v)
+        case json.Number:
+            values[key] = v.String()
+        case float64:
+            values[key] = strconv.FormatFloat(v, 'f', -1, 64)
+        }
+    }
+
+    keys := make([]string, 0, len(values))
+    for key := range values {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    var buf bytes.Buffer
+    for _, key := range keys {
+        buf.WriteString(values[key])
+    }
+
+    sum := sha256.Sum256(buf.Bytes())
+    return hex.EncodeToString(sum[:])
+}
+
+func (r *PaymentRepository) buildReceipt(email, phone string, items []domainPayment.ReceiptItem) (*receipt, error) {
+    rec := &receipt{
+        Email:    email,
+        Phone:    phone,
+        Taxation: r.taxation,
+        Items:    make([]receiptItem, 0, len(items)),
+    }
+
+    for _, item := range items {
+        quantity, err := strconv.ParseFloat(item.Quantity, 64)
+        if err != nil {
+            return nil, fmt.Errorf("invalid receipt quantity %q: %w", item.Quantity, err)
+        }
+        price, err := strconv.ParseFloat(item.Amount.Value, 64)
+        if err != nil {
+            return nil, fmt.Errorf("invalid receipt price %q: %w", item.Amount.Value, err)
+        }
+
+        rec.Items = append(rec.Items, receiptItem{
+            Name:          truncate(item.Description, 128),
+            Price:         toKopecks(price),
+            Quantity:      quantity,
+            // Сумма позиции - цена в копейках на количество в тысячных, как у кассы
+            Amount:        (toKopecks(price)*int64(math.Round(quantity*1000)) + 500) / 1000,
+            Tax:           taxByVatCode(item.VatCode),
+            PaymentMethod: item.PaymentMode,
+            PaymentObject: item.PaymentSubject,
+
+            MeasurementUnit: measurementUnits[item.Measure],
+        })
+    }
+
+    return rec, nil
+}
+
+// measurementUnits переводит меру количества чека в единицу измерения Т-Кассы
+var measurementUnits = map[string]string{
+    domainPayment.MeasurePiece:    "шт",
+    domainPayment.MeasureGram:     "г",
+    domainPayment.MeasureKilogram: "кг",
+}
+
+// taxByVatCode переводит код НДС ЮKassa, используемый в чеках магазина, в ставку Т-Кассы
+func taxByVatCode(vatCode string) string {
+    switch vatCode {
+    case "2":
+        return "vat0"
+    case "3":
+        return "vat10"
+    case "4":
+        return "vat20"
+    case "5":
+        return "vat110"
+    case "6":
+        return "vat120"
+    case "7":
+        return "vat5"
+    case "8":
+        return "vat7"
+    case "9":
+        return "vat105"
+    case "10":
+        return "vat107"
+    case "11":
+        return "vat22"
+    case "12":
+        return "vat122"
+    default:
+        return "none"
+    }
+}
+
+// mapStatus переводит статус Т-Кассы в общий статус платежа
+func mapStatus(status string) domainPayment.Status {
+    switch status {
+    case "AUTHORIZED":
+        return domainPayment.StatusWaitingForCapture
+    case "CONFIRMED", "PARTIAL_REFUNDED", "REFUNDED":
+        return domainPayment.StatusSucceeded
+    case "CANCELED", "REVERSED", "REJECTED", "DEADLINE_EXPIRED", "AUTH_FAIL":
+        return domainPayment.StatusCanceled
+    default:
+        return domainPayment.StatusPending
+    }
+}
+
+// cancellationDetails переводит статус отмены Т-Кассы в причину отмены в
+// терминах ЮKassa, по которой строится письмо покупателю
+func cancellationDetails(status string) *domainPayment.CancellationDetails {
+    switch status {
+    case "CANCELED", "REVERSED":
+        return &domainPayment.CancellationDetails{Party: "merchant", Reason: "canceled_by_merchant"}
+    case "DEADLINE_EXPIRED":
+        return &domainPayment.CancellationDetails{Party: "merchant", Reason: "expired_on_confirmation"}
+    case "REJECTED":
+        return &domainPayment.CancellationDetails{Party: "payment_network", Reason: "general_decline"}
+    case "AUTH_FAIL":
+        return &domainPayment.CancellationDetails{Party: "payment_network", Reason: "3d_secure_failed"}
+    }
+    return nil
+}
+
+// refundID строит идентификатор возврата: остаток после возврата
+// уменьшается с каждым возвратом, поэтому пара уникальна
+func refundID(paymentID string, newAmount int64) string {
+    return fmt.Sprintf("%s-%d", paymentID, newAmount)
+}
+
+func toKopecks(value float64) int64 {
+    return int64(math.Round(value * 100))
+}
+
+func fromKopecks(value int64) domainPayment.Amount {
+    return domainPayment.Amount{Value: fmt.Sprintf("%.2f", float64(value)/100), Currency: "RUB"}
+}
+
+func truncate(s string, limit int) string {
+    runes := []rune(s)
+    if len(runes) <= limit {
+        return s
+    }
+    return string(runes[:limit])
+}
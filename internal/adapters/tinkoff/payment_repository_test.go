@@ -0,0 +1,239 @@
+package tinkoff
+
+import (
+    "backend/config"
+    domainPayment "backend/internal/domain/payment"
+    "backend/pkg/logger"
+    "context"
+    "crypto/sha256"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "strings"
+    "sync"
+    "testing"
+)
+
+func TestMain(m *testing.M) {
+    // logger.Init создает каталог логов относительно рабочего каталога -
+    // инициализируем его во временном, чтобы не мусорить в репозитории
+    dir, err := os.MkdirTemp("", "tinkoff-test")
+    if err != nil {
+        panic(err)
+    }
+    work := filepath.Join(dir, "work")
+    if err := os.Mkdir(work, 0755); err != nil {
+        panic(err)
+    }
+    wd, err := os.Getwd()
+    if err != nil {
+        panic(err)
+    }
+    if err := os.Chdir(work); err != nil {
+        panic(err)
+    }
+    logger.Init("error")
+    if err := os.Chdir(wd); err != nil {
+        panic(err)
+    }
+
+    code := m.Run()
+    os.RemoveAll(dir)
+    os.Exit(code)
+}
+
+func sha256Hex(s string) string {
+    sum := sha256.Sum256([]byte(s))
+    return hex.EncodeToString(sum[:])
+}
+
+// Пример подписи запроса Init из документации Т-Кассы
+func TestTokenDocumentedExample(t *testing.T) {
+    r := NewPaymentRepository(config.TinkoffConfig{TerminalKey: "MerchantTerminalKey", Password: "usaf8fw8fsw21g"})
+
+    params := map[string]interface{}{
+        "TerminalKey": "MerchantTerminalKey",
+        "Amount":      int64(19200),
+        "OrderId":     "21090",
+        "Description": "Подарочная карта на 1000 рублей",
+        // Вложенные объекты в подписи не участвуют
+        "DATA": map[string]string{"Phone": "+71234567890", "Email": "a@test.com"},
+        "Receipt": &receipt{
+            Email:    "a@test.ru",
+            Taxation: "osn",
+            Items:    []receiptItem{{Name: "Наименование товара 1", Price: 10000, Quantity: 1, Amount: 10000, Tax: "vat10"}},
+        },
+    }
+
+    const want = "0024a00af7c350a3a67ca168ce06502aa72772456662e38696d48b56ee9c97d9"
+    if got := r.token(params); got != want {
+        t.Errorf("token = %s, want %s", got, want)
+    }
+}
+
+func TestTokenFormatsValues(t *testing.T) {
+    r := NewPaymentRepository(config.TinkoffConfig{Password: "secret"})
+
+    tests := []struct {
+        name  string
+        value interface{}
+        want  string
+    }{
+        {"строка", "abc", "abc"},
+        {"bool", true, "true"},
+        {"int", 42, "42"},
+        {"int64", int64(19200), "19200"},
+        {"json.Number без потери точности", json.Number("9007199254740993"), "9007199254740993"},
+        {"float64", 1.5, "1.5"},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := r.token(map[string]interface{}{"Value": tt.value, "Token": "ignored"})
+            // Ключи по алфавиту: Password, Value; Token не подписывается
+            if want := sha256Hex("secret" + tt.want); got != want {
+                t.Errorf("token = %s, want %s", got, want)
+            }
+        })
+    }
+}
+
+// stubAPI - тестовый API Т-Кассы: отвечает по имени метода и запоминает вызовы
+type stubAPI struct {
+    server  *httptest.Server
+    respond map[string]string
+
+    mu      sync.Mutex
+    methods []string
+}
+
+func newStubAPI(t *testing.T, respond map[string]string) (*stubAPI, *PaymentRepository) {
+    api := &stubAPI{respond: respond}
+    api.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+        io.Copy(io.Discard, req.Body)
+        method := strings.TrimPrefix(req.URL.Path, "/")
+
+        api.mu.Lock()
+        api.methods = append(api.methods, method)
+        api.mu.Unlock()
+
+        body, ok := api.respond[method]
+        if !ok {
+            http.Error(w, "unexpected method", http.StatusNotFound)
+            return
+        }
+        io.WriteString(w, body)
+    }))
+    t.Cleanup(api.server.Close)
+
+    r := NewPaymentRepository(config.TinkoffConfig{TerminalKey: "TestTerminal", Password: "secret"})
+    r.baseURL = api.server.URL
+    return api, r
+}
+
+func (a *stubAPI) calls() string {
+    a.mu.Lock()
+    defer a.mu.Unlock()
+    return strings.Join(a.methods, ",")
+}
+
+const initResponse = `{"Success":true,"ErrorCode":"0","Status":"NEW","PaymentId":"200","Amount":19200,"PaymentURL":"https://pay/200"}`
+
+func TestCreatePaymentChecksOrderPayments(t *testing.T) {
+    tests := []struct {
+        name       string
+        checkOrder string
+        cancel     string
+        wantCalls  string
+        wantID     string
+        wantStatus domainPayment.Status
+        wantErr    error
+    }{
+        {
+            name:       "заказ неизвестен",
+            checkOrder: `{"Success":false,"ErrorCode":"7","Message":"Заказ не найден"}`,
+            wantCalls:  "CheckOrder,Init",
+            wantID:     "200",
+            wantStatus: domainPayment.StatusPending,
+        },
+        {
+            name:       "платеж уже оплачен",
+            checkOrder: `{"Success":true,"Payments":[{"PaymentId":"100","Amount":19200,"Status":"CONFIRMED"}]}`,
+            wantCalls:  "CheckOrder",
+            wantID:     "100",
+            wantStatus: domainPayment.StatusSucceeded,
+        },
+        {
+            name:       "отмененный платеж не мешает",
+            checkOrder: `{"Success":true,"Payments":[{"PaymentId":"100","Amount":19200,"Status":"CANCELED"}]}`,
+            wantCalls:  "CheckOrder,Init",
+            wantID:     "200",
+            wantStatus: domainPayment.StatusPending,
+        },
+        {
+            name:       "неоплаченный платеж отменяется",
+            checkOrder: `{"Success":true,"Payments":[{"PaymentId":"100","Amount":19200,"Status":"NEW"}]}`,
+            cancel:     `{"Success":true,"Status":"CANCELED"}`,
+            wantCalls:  "CheckOrder,Cancel,Init",
+            wantID:     "200",
+            wantStatus: domainPayment.StatusPending,
+        },
+        {
+            name:       "неоплаченный платеж не отменился",
+            checkOrder: `{"Success":true,"Payments":[{"PaymentId":"100","Amount":19200,"Status":"AUTHORIZING"}]}`,
+            cancel:     `{"Success":false,"ErrorCode":"9999","Message":"Неверный статус"}`,
+            wantCalls:  "CheckOrder,Cancel",
+            wantErr:    domainPayment.ErrProviderUnavailable,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            respond := map[string]string{"CheckOrder": tt.checkOrder, "Init": initResponse}
+            if tt.cancel != "" {
+                respond["Cancel"] = tt.cancel
+            }
+            api, r := newStubAPI(t, respond)
+
+            resp, err := r.CreatePayment(context.Background(), &domainPayment.PaymentRequest{
+                Amount:         192,
+                Currency:       "RUB",
+                OrderID:        21090,
+                Capture:        true,
+                IdempotenceKey: "order-21090",
+            })
+
+            if calls := api.calls(); calls != tt.wantCalls {
+                t.Errorf("calls = %s, want %s", calls, tt.wantCalls)
+            }
+            if tt.wantErr != nil {
+                if !errors.Is(err, tt.wantErr) {
+                    t.Fatalf("err = %v, want %v", err, tt.wantErr)
+                }
+                return
+            }
+            if err != nil {
+                t.Fatalf("CreatePayment: %v", err)
+            }
+            if resp.ID != tt.wantID || resp.Status != tt.wantStatus {
+                t.Errorf("payment = %s %s, want %s %s", resp.ID, resp.Status, tt.wantID, tt.wantStatus)
+            }
+        })
+    }
+}
+
+func TestCreatePaymentWithoutKeySkipsCheck(t *testing.T) {
+    api, r := newStubAPI(t, map[string]string{"Init": initResponse})
+
+    if _, err := r.CreatePayment(context.Background(), &domainPayment.PaymentRequest{Amount: 192, OrderID: 1}); err != nil {
+        t.Fatalf("CreatePayment: %v", err)
+    }
+    if calls := api.calls(); calls != "Init" {
+        t.Errorf("calls = %s, want Init", calls)
+    }
+}
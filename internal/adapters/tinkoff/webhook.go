@@ -0,0 +1,92 @@
+package tinkoff
+
+import (
+    domainPayment "backend/internal/domain/payment"
+    "bytes"
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "time"
+)
+
+// ErrInvalidToken возвращается, если подпись уведомления не совпала
+var ErrInvalidToken = errors.New("invalid notification token")
+
+// notification - уведомление Т-Кассы о смене статуса платежа
+type notification struct {
+    TerminalKey string      `json:"TerminalKey"`
+    OrderID     string      `json:"OrderId"`
+    Success     bool        `json:"Success"`
+    Status      string      `json:"Status"`
+    PaymentID   json.Number `json:"PaymentId"`
+    Amount      int64       `json:"Amount"`
+    Token       string      `json:"Token"`
+}
+
+// ParseWebhook проверяет подпись уведомления и переводит его в общее событие.
+// Статусы, для которых нет события, возвращают nil.
+func (r *PaymentRepository) ParseWebhook(body []byte) (*domainPayment.Event, error) {
+    var raw map[string]interface{}
+    decoder := json.NewDecoder(bytes.NewReader(body))
+    decoder.UseNumber()
+    if err := decoder.Decode(&raw); err != nil {
+        return nil, fmt.Errorf("invalid webhook body: %w", err)
+    }
+
+    var n notification
+    if err := json.Unmarshal(body, &n); err != nil {
+        return nil, fmt.Errorf("invalid webhook body: %w", err)
+    }
+    if n.TerminalKey != r.terminalKey {
+        return nil, fmt.Errorf("%w: unknown terminal", ErrInvalidToken)
+    }
+    if subtle.ConstantTimeCompare([]byte(r.token(raw)), []byte(n.Token)) != 1 {
+        return nil, ErrInvalidToken
+    }
+
+    paymentID := n.PaymentID.String()
+    payment := &domainPayment.PaymentResponse{
+        ID:                  paymentID,
+        Status:              mapStatus(n.Status),
+        Amount:              fromKopecks(n.Amount),
+        CancellationDetails: cancellationDetails(n.Status),
+    }
+
+    switch n.Status {
+    case "AUTHORIZED":
+        expiresAt := time.Now().Add(holdPeriod)
+        payment.ExpiresAt = &expiresAt
+        return &domainPayment.Event{Type: domainPayment.EventPaymentWaitingForCapture, PaymentID: paymentID, Payment: payment}, nil
+
+    case "CONFIRMED":
+        return &domainPayment.Event{Type: domainPayment.EventPaymentSucceeded, PaymentID: paymentID, Payment: payment}, nil
+
+    case "CANCELED", "REVERSED", "REJECTED", "DEADLINE_EXPIRED", "AUTH_FAIL":
+        return &domainPayment.Event{Type: domainPayment.EventPaymentCanceled, PaymentID: paymentID, Payment: payment}, nil
+
+    case "REFUNDED", "PARTIAL_REFUNDED":
+        // В уведомлении о возврате Amount - сумма платежа после возврата, как
+        // NewAmount в ответе Cancel: идентификатор возврата строится по ней
+        // одинаково, а сумма возврата рассчитывается по заказу
+        remaining := fromKopecks(n.Amount)
+        return &domainPayment.Event{
+            Type:      domainPayment.EventRefundSucceeded,
+            PaymentID: paymentID,
+            Refund: &domainPayment.RefundResponse{
+                ID:        refundID(paymentID, n.Amount),
+                PaymentID: paymentID,
+                Status:    domainPayment.StatusSucceeded,
+                Remaining: &remaining,
+                CreatedAt: time.Now(),
+            },
+        }, nil
+    }
+
+    return nil, nil
+}
+
+// WebhookAck - Т-Касса повторяет уведомление, пока не получит ответ "OK"
+func (r *PaymentRepository) WebhookAck() (string, []byte) {
+    return "text/plain; charset=utf-8", []byte("OK")
+}
@@ -0,0 +1,82 @@
+package tinkoff
+
+import (
+    "backend/config"
+    domainPayment "backend/internal/domain/payment"
+    "encoding/json"
+    "errors"
+    "strconv"
+    "strings"
+    "testing"
+)
+
+// signedNotification собирает уведомление с подписью, посчитанной по
+// правилам Т-Кассы вручную: значения верхнего уровня с паролем по алфавиту
+// ключей, вложенный объект Data не подписывается
+func signedNotification(status string, amount int64) map[string]interface{} {
+    return map[string]interface{}{
+        "TerminalKey": "TestTerminal",
+        "OrderId":     "21090",
+        "Success":     true,
+        "Status":      status,
+        "PaymentId":   json.Number("9007199254740993"),
+        "ErrorCode":   "0",
+        "Amount":      amount,
+        "Pan":         "430000******0777",
+        "Data":        map[string]string{"Source": "cards"},
+        "Token": sha256Hex(strings.Join([]string{
+            strconv.FormatInt(amount, 10), "0", "21090", "430000******0777", "secret",
+            "9007199254740993", status, "true", "TestTerminal",
+        }, "")),
+    }
+}
+
+func TestParseWebhook(t *testing.T) {
+    r := NewPaymentRepository(config.TinkoffConfig{TerminalKey: "TestTerminal", Password: "secret"})
+
+    body, _ := json.Marshal(signedNotification("CONFIRMED", 19200))
+    event, err := r.ParseWebhook(body)
+    if err != nil {
+        t.Fatalf("ParseWebhook: %v", err)
+    }
+    if event.Type != domainPayment.EventPaymentSucceeded {
+        t.Errorf("event type = %s", event.Type)
+    }
+    if event.PaymentID != "9007199254740993" {
+        t.Errorf("payment id = %s", event.PaymentID)
+    }
+    if event.Payment.Amount.Value != "192.00" {
+        t.Errorf("amount = %s", event.Payment.Amount.Value)
+    }
+
+    refund, _ := json.Marshal(signedNotification("PARTIAL_REFUNDED", 9200))
+    event, err = r.ParseWebhook(refund)
+    if err != nil {
+        t.Fatalf("ParseWebhook refund: %v", err)
+    }
+    if event.Type != domainPayment.EventRefundSucceeded || event.Refund.Remaining.Value != "92.00" {
+        t.Errorf("refund event = %s, remaining %+v", event.Type, event.Refund.Remaining)
+    }
+}
+
+func TestParseWebhookRejectsForgery(t *testing.T) {
+    r := NewPaymentRepository(config.TinkoffConfig{TerminalKey: "TestTerminal", Password: "secret"})
+
+    tampered := signedNotification("CONFIRMED", 19200)
+    tampered["Amount"] = int64(100)
+
+    unknownTerminal := signedNotification("CONFIRMED", 19200)
+    unknownTerminal["TerminalKey"] = "Other"
+
+    for name, n := range map[string]map[string]interface{}{
+        "измененная сумма": tampered,
+        "чужой терминал":   unknownTerminal,
+    } {
+        t.Run(name, func(t *testing.T) {
+            body, _ := json.Marshal(n)
+            if _, err := r.ParseWebhook(body); !errors.Is(err, ErrInvalidToken) {
+                t.Errorf("err = %v, want ErrInvalidToken", err)
+            }
+        })
+    }
+}
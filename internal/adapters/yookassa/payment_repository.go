@@ -1,166 +1,306 @@
 package yookassa
 
 import (
-    "bytes"
-    "encoding/base64"
-    "encoding/json"
+    "context"
+    "errors"
     "fmt"
-    "io"
-    "net/http"
     "time"
     "math/rand"
+    "backend/config"
     domainPayment "backend/internal/domain/payment"
     "backend/pkg/logger"
+    yookassaAPI "backend/pkg/yookassa"
     "go.uber.org/zap"
 )
 
+// ProviderName - идентификатор ЮKassa в конфигурации и заказах
+const ProviderName = "yookassa"
+
 type PaymentRepository struct {
-    shopID    string
-    secretKey string
-    baseURL   string
+    client *yookassaAPI.Client
 }
 
-func NewPaymentRepository(shopID, secretKey string) *PaymentRepository {
+func NewPaymentRepository(shopID, secretKey string, cfg config.YooKassaConfig) *PaymentRepository {
     return &PaymentRepository{
-        shopID:    shopID,
-        secretKey: secretKey,
-        baseURL:   "https://api.yookassa.ru/v3",
-    }
-}
-
-func (r *PaymentRepository) CreatePayment(request *domainPayment.PaymentRequest) (*domainPayment.PaymentResponse, error) {
-    amountValue := fmt.Sprintf("%.2f", request.Amount)
-
-    paymentData := map[string]interface{}{
-        "amount": map[string]string{
-            "value":    amountValue,
-            "currency": request.Currency,
-        },
-        "capture": true,
-        "confirmation": map[string]string{
-            "type":       "redirect",
-            "return_url": request.ReturnURL,
-        },
-        "description": request.Description,
-        "metadata":    request.Metadata,
-    }
-
-    // ДОБАВЛЯЕМ ЧЕК 54-ФЗ ИЗ ОТДЕЛЬНОГО ПОЛЯ
-    if len(request.ReceiptItems) > 0 {
-        paymentData["receipt"] = map[string]interface{}{
-            "customer": map[string]string{
-                "email": request.Email,
-            },
-            "items": request.ReceiptItems,
-        }
+        client: yookassaAPI.NewClient(yookassaAPI.Config{
+            ShopID:           shopID,
+            SecretKey:        secretKey,
+            Timeout:          time.Duration(cfg.Timeout) * time.Second,
+            ConnectTimeout:   time.Duration(cfg.ConnectTimeout) * time.Second,
+            MaxRetries:       cfg.MaxRetries,
+            RetryMaxDelay:    time.Duration(cfg.RetryMaxDelay) * time.Second,
+            BreakerThreshold: cfg.BreakerThreshold,
+            BreakerCooldown:  time.Duration(cfg.BreakerCooldown) * time.Second,
+        }),
+    }
+}
+
+func (r *PaymentRepository) Name() string {
+    return ProviderName
+}
+
+func (r *PaymentRepository) CreatePayment(ctx context.Context, request *domainPayment.PaymentRequest) (*domainPayment.PaymentResponse, error) {
+    req := &yookassaAPI.CreatePaymentRequest{
+        Amount:       toAmount(request.Amount, request.Currency),
+        Capture:      request.Capture,
+        Confirmation: toConfirmation(request.ConfirmationType, request.ReturnURL),
+        Description:  request.Description,
+        Metadata:    request.Metadata,
+        // ЧЕК 54-ФЗ ИЗ ОТДЕЛЬНОГО ПОЛЯ
+        Receipt: toReceipt(request.Email, request.ReceiptItems),
+
+        SavePaymentMethod: request.SavePaymentMethod,
+        PaymentMethodID:   request.PaymentMethodID,
+    }
+    // Списание по сохраненному способу проходит без участия покупателя
+    if request.PaymentMethodID != "" {
+        req.Confirmation = nil
+    }
+    if request.PaymentMethodType != "" {
+        req.PaymentMethodData = &yookassaAPI.PaymentMethodData{Type: request.PaymentMethodType}
     }
 
-    jsonData, err := json.Marshal(paymentData)
+    payment, err := r.client.CreatePayment(ctx, req, request.IdempotenceKey)
     if err != nil {
-        return nil, fmt.Errorf("failed to marshal payment data: %w", err)
+        return nil, apiError("create payment", err)
     }
 
-    // Логируем запрос для отладки
-    logger.Debug("Sending request to YooKassa", 
-        zap.String("request", string(jsonData)))
+    return toPaymentResponse(payment), nil
+}
 
-    httpReq, err := http.NewRequest(
-        "POST", 
-        r.baseURL+"/payments", 
-        bytes.NewBuffer(jsonData),
-    )
-    if err != nil {
-        return nil, fmt.Errorf("failed to create request: %w", err)
+// SupportsConfirmation - ЮKassa поддерживает все сценарии подтверждения и
+// выбор способа оплаты на сайте
+func (r *PaymentRepository) SupportsConfirmation(confirmation domainPayment.ConfirmationType, method string) bool {
+    return domainPayment.ValidateConfirmation(confirmation, method) == nil
+}
+
+// toConfirmation формирует сценарий подтверждения. Виджет и QR-код
+// показываются на сайте магазина, поэтому return_url им не нужен.
+func toConfirmation(confirmation domainPayment.ConfirmationType, returnURL string) *yookassaAPI.Confirmation {
+    switch confirmation {
+    case domainPayment.ConfirmationEmbedded:
+        return &yookassaAPI.Confirmation{Type: yookassaAPI.ConfirmationEmbedded}
+    case domainPayment.ConfirmationQR:
+        return &yookassaAPI.Confirmation{Type: yookassaAPI.ConfirmationQR}
+    case domainPayment.ConfirmationMobileApplication:
+        return &yookassaAPI.Confirmation{Type: yookassaAPI.ConfirmationMobileApplication, ReturnURL: returnURL}
     }
+    return &yookassaAPI.Confirmation{Type: yookassaAPI.ConfirmationRedirect, ReturnURL: returnURL}
+}
 
-    auth := base64.StdEncoding.EncodeToString([]byte(r.shopID + ":" + r.secretKey))
-    httpReq.Header.Set("Authorization", "Basic "+auth)
-    httpReq.Header.Set("Content-Type", "application/json")
-    httpReq.Header.Set("Idempotence-Key", fmt.Sprintf("%d", time.Now().UnixNano()))
+// CreateRecurringPayment создает первый платеж подписки с сохранением способа
+// оплаты или автоплатеж по сохраненному способу
+func (r *PaymentRepository) CreateRecurringPayment(ctx context.Context, request *domainPayment.PaymentRequest) (*domainPayment.PaymentResponse, error) {
+    return r.CreatePayment(ctx, request)
+}
 
-    client := &http.Client{}
-    resp, err := client.Do(httpReq)
+func (r *PaymentRepository) GetPaymentStatus(ctx context.Context, paymentID string) (*domainPayment.PaymentResponse, error) {
+    payment, err := r.client.GetPayment(ctx, paymentID)
     if err != nil {
-        return nil, fmt.Errorf("failed to send request: %w", err)
+        return nil, apiError("get payment", err)
     }
-    defer resp.Body.Close()
 
-    body, _ := io.ReadAll(resp.Body)
+    return toPaymentResponse(payment), nil
+}
 
-    if resp.StatusCode != http.StatusOK {
-        logger.Error("YooKassa API error", 
-            zap.String("status", resp.Status), 
-            zap.String("response", string(body)))
-        return nil, fmt.Errorf("YooKassa error: %s - %s", resp.Status, string(body))
+func (r *PaymentRepository) CapturePayment(ctx context.Context, request *domainPayment.CaptureRequest) (*domainPayment.PaymentResponse, error) {
+    amount := toAmount(request.Amount, request.Currency)
+    req := &yookassaAPI.CapturePaymentRequest{
+        Amount: &amount,
+        // Чек передается заново: списываемая сумма может отличаться от холда
+        Receipt: toReceipt(request.Email, request.ReceiptItems),
     }
 
-    var response domainPayment.PaymentResponse
-    if err := json.Unmarshal(body, &response); err != nil {
-        return nil, fmt.Errorf("failed to parse response: %w", err)
+    payment, err := r.client.CapturePayment(ctx, request.PaymentID, req, "")
+    if err != nil {
+        return nil, apiError("capture payment", err)
     }
 
-    return &response, nil
+    return toPaymentResponse(payment), nil
+}
+
+func (r *PaymentRepository) CancelPayment(ctx context.Context, paymentID string) error {
+    if _, err := r.client.CancelPayment(ctx, paymentID, ""); err != nil {
+        return apiError("cancel payment", err)
+    }
+    return nil
 }
 
-func (r *PaymentRepository) GetPaymentStatus(paymentID string) (*domainPayment.PaymentResponse, error) {
-    httpReq, err := http.NewRequest("GET", r.baseURL+"/payments/"+paymentID, nil)
+func (r *PaymentRepository) Refund(ctx context.Context, request *domainPayment.RefundRequest) (*domainPayment.RefundResponse, error) {
+    req := &yookassaAPI.CreateRefundRequest{
+        PaymentID:   request.PaymentID,
+        Amount:      toAmount(request.Amount, request.Currency),
+        Description: request.Description,
+        // ЧЕК ВОЗВРАТА 54-ФЗ
+        Receipt: toReceipt(request.Email, request.ReceiptItems),
+    }
+
+    refund, err := r.client.CreateRefund(ctx, req, request.IdempotenceKey)
     if err != nil {
-        return nil, fmt.Errorf("failed to create request: %w", err)
+        return nil, apiError("create refund", err)
     }
 
-    auth := base64.StdEncoding.EncodeToString([]byte(r.shopID + ":" + r.secretKey))
-    httpReq.Header.Set("Authorization", "Basic "+auth)
+    return toRefundResponse(refund), nil
+}
 
-    client := &http.Client{}
-    resp, err := client.Do(httpReq)
+// CreateReceipt регистрирует отдельный чек по платежу (например, чек зачета
+// предоплаты после передачи товара). Чек отправляется покупателю на email.
+// Расчет наличными ЮKassa не регистрирует: такой чек пробивает касса курьера
+// или пункта выдачи.
+func (r *PaymentRepository) CreateReceipt(ctx context.Context, request *domainPayment.ReceiptRequest) (*domainPayment.ReceiptResponse, error) {
+    settlements := make([]yookassaAPI.Settlement, len(request.Settlements))
+    for i, s := range request.Settlements {
+        if s.Type == domainPayment.SettlementCash {
+            return nil, fmt.Errorf("%w: ЮKassa не регистрирует чеки расчета наличными", domainPayment.ErrReceiptsNotSupported)
+        }
+        settlements[i] = yookassaAPI.Settlement{
+            Type:   s.Type,
+            Amount: yookassaAPI.Amount{Value: s.Amount.Value, Currency: s.Amount.Currency},
+        }
+    }
+
+    req := &yookassaAPI.CreateReceiptRequest{
+        Type:        request.Type,
+        PaymentID:   request.PaymentID,
+        Customer:    yookassaAPI.Customer{Email: request.Email},
+        Items:       toReceiptItems(request.Items),
+        Settlements: settlements,
+        Send:        true,
+    }
+
+    receipt, err := r.client.CreateReceipt(ctx, req, request.IdempotenceKey)
     if err != nil {
-        return nil, fmt.Errorf("failed to send request: %w", err)
+        return nil, apiError("create receipt", err)
     }
-    defer resp.Body.Close()
 
-    body, _ := io.ReadAll(resp.Body)
+    return &domainPayment.ReceiptResponse{
+        ID:        receipt.ID,
+        Type:      receipt.Type,
+        PaymentID: receipt.PaymentID,
+        Status:    receipt.Status,
+    }, nil
+}
 
-    if resp.StatusCode != http.StatusOK {
-        logger.Error("YooKassa API error", 
-            zap.String("status", resp.Status), 
-            zap.String("response", string(body)))
-        return nil, fmt.Errorf("YooKassa error: %s - %s", resp.Status, string(body))
+// apiError логирует ошибку API и приводит ее к ошибкам домена. Сбои сети и
+// ответы 5xx помечаются как недоступность провайдера.
+func apiError(op string, err error) error {
+    var apiErr *yookassaAPI.APIError
+    if errors.As(err, &apiErr) {
+        logger.Error("YooKassa API error",
+            zap.String("operation", op),
+            zap.Int("status", apiErr.StatusCode),
+            zap.String("code", apiErr.Code),
+            zap.String("parameter", apiErr.Parameter),
+            zap.String("description", apiErr.Description))
+    } else {
+        logger.Error("YooKassa request failed", zap.String("operation", op), zap.Error(err))
     }
 
-    var response domainPayment.PaymentResponse
-    if err := json.Unmarshal(body, &response); err != nil {
-        return nil, fmt.Errorf("failed to parse response: %w", err)
+    if errors.Is(err, yookassaAPI.ErrUnavailable) {
+        return fmt.Errorf("%s: %w: %w", op, domainPayment.ErrProviderUnavailable, err)
     }
+    return fmt.Errorf("%s: %w", op, err)
+}
 
-    return &response, nil
+func toAmount(value float64, currency string) yookassaAPI.Amount {
+    return yookassaAPI.Amount{
+        Value:    fmt.Sprintf("%.2f", value),
+        Currency: currency,
+    }
 }
 
-func (r *PaymentRepository) CancelPayment(paymentID string) error {
-    httpReq, err := http.NewRequest("POST", r.baseURL+"/payments/"+paymentID+"/cancel", nil)
-    if err != nil {
-        return fmt.Errorf("failed to create request: %w", err)
+// toReceipt формирует чек 54-ФЗ; без позиций чек не передается
+func toReceipt(email string, items []domainPayment.ReceiptItem) *yookassaAPI.Receipt {
+    if len(items) == 0 {
+        return nil
     }
 
-    auth := base64.StdEncoding.EncodeToString([]byte(r.shopID + ":" + r.secretKey))
-    httpReq.Header.Set("Authorization", "Basic "+auth)
-    httpReq.Header.Set("Idempotence-Key", fmt.Sprintf("%d", time.Now().UnixNano()))
+    return &yookassaAPI.Receipt{
+        Customer: yookassaAPI.Customer{Email: email},
+        Items:    toReceiptItems(items),
+    }
+}
 
-    client := &http.Client{}
-    resp, err := client.Do(httpReq)
-    if err != nil {
-        return fmt.Errorf("failed to send request: %w", err)
+func toReceiptItems(items []domainPayment.ReceiptItem) []yookassaAPI.ReceiptItem {
+    receiptItems := make([]yookassaAPI.ReceiptItem, len(items))
+    for i, item := range items {
+        receiptItems[i] = yookassaAPI.ReceiptItem{
+            Description:    item.Description,
+            Quantity:       item.Quantity,
+            Amount:         yookassaAPI.Amount{Value: item.Amount.Value, Currency: item.Amount.Currency},
+            VatCode:        item.VatCode,
+            PaymentMode:    item.PaymentMode,
+            PaymentSubject: item.PaymentSubject,
+            Measure:        item.Measure,
+            MarkMode:       item.MarkMode,
+        }
+        if item.MarkCodeInfo != nil {
+            receiptItems[i].MarkCodeInfo = &yookassaAPI.MarkCodeInfo{Gs1m: item.MarkCodeInfo.Gs1m}
+        }
     }
-    defer resp.Body.Close()
+    return receiptItems
+}
+
+func toPaymentResponse(p *yookassaAPI.Payment) *domainPayment.PaymentResponse {
+    resp := &domainPayment.PaymentResponse{
+        ID:          p.ID,
+        Provider:    ProviderName,
+        Status:      domainPayment.Status(p.Status),
+        Paid:        p.Paid,
+        Amount:      domainPayment.Amount{Value: p.Amount.Value, Currency: p.Amount.Currency},
+        Description: p.Description,
+        Metadata:    p.Metadata,
+        CreatedAt:   p.CreatedAt,
+        CapturedAt:  p.CapturedAt,
+        ExpiresAt:   p.ExpiresAt,
 
-    if resp.StatusCode != http.StatusOK {
-        body, _ := io.ReadAll(resp.Body)
-        logger.Error("YooKassa API error", 
-            zap.String("status", resp.Status), 
-            zap.String("response", string(body)))
-        return fmt.Errorf("YooKassa error: %s - %s", resp.Status, string(body))
+        ReceiptRegistration: p.ReceiptRegistration,
     }
 
-    return nil
+    if p.Confirmation != nil {
+        resp.Confirmation = domainPayment.Confirmation{
+            Type:              p.Confirmation.Type,
+            ConfirmationURL:   p.Confirmation.ConfirmationURL,
+            ConfirmationToken: p.Confirmation.ConfirmationToken,
+            ConfirmationData:  p.Confirmation.ConfirmationData,
+        }
+    }
+    if p.CancellationDetails != nil {
+        resp.CancellationDetails = &domainPayment.CancellationDetails{
+            Party:  p.CancellationDetails.Party,
+            Reason: p.CancellationDetails.Reason,
+        }
+    }
+    if p.PaymentMethod != nil {
+        resp.PaymentMethod = &domainPayment.PaymentMethod{
+            Type:  p.PaymentMethod.Type,
+            ID:    p.PaymentMethod.ID,
+            Saved: p.PaymentMethod.Saved,
+            Title: p.PaymentMethod.Title,
+        }
+        if card := p.PaymentMethod.Card; card != nil {
+            resp.PaymentMethod.Card = &domainPayment.Card{
+                First6:      card.First6,
+                Last4:       card.Last4,
+                ExpiryMonth: card.ExpiryMonth,
+                ExpiryYear:  card.ExpiryYear,
+                CardType:    card.CardType,
+            }
+        }
+    }
+
+    return resp
+}
+
+func toRefundResponse(r *yookassaAPI.Refund) *domainPayment.RefundResponse {
+    return &domainPayment.RefundResponse{
+        ID:          r.ID,
+        PaymentID:   r.PaymentID,
+        Status:      domainPayment.Status(r.Status),
+        Amount:      domainPayment.Amount{Value: r.Amount.Value, Currency: r.Amount.Currency},
+        Description: r.Description,
+        CreatedAt:   r.CreatedAt,
+    }
 }
 
 func generateOrderID() string {
@@ -170,4 +310,4 @@ func generateOrderID() string {
         b[i] = charset[rand.Intn(len(charset))]
     }
     return fmt.Sprintf("ORDER-%d-%s", time.Now().Unix(), string(b))
-}
\ No newline at end of file
+}
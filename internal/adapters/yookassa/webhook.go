@@ -0,0 +1,67 @@
+package yookassa
+
+import (
+    domainPayment "backend/internal/domain/payment"
+    yookassaAPI "backend/pkg/yookassa"
+    "encoding/json"
+    "fmt"
+)
+
+// notification - уведомление ЮKassa: тип события и объект платежа или возврата
+type notification struct {
+    Type   string          `json:"type"`
+    Event  string          `json:"event"`
+    Object json.RawMessage `json:"object"`
+}
+
+// ParseWebhook разбирает уведомление ЮKassa. Подлинность уведомления
+// проверяется по IP-адресу отправителя на уровне HTTP-обработчика.
+func (r *PaymentRepository) ParseWebhook(body []byte) (*domainPayment.Event, error) {
+    var n notification
+    if err := json.Unmarshal(body, &n); err != nil {
+        return nil, fmt.Errorf("invalid webhook body: %w", err)
+    }
+
+    eventType := domainPayment.EventType(n.Event)
+    switch eventType {
+    case domainPayment.EventPaymentSucceeded,
+        domainPayment.EventPaymentWaitingForCapture,
+        domainPayment.EventPaymentCanceled:
+        var payment yookassaAPI.Payment
+        if err := json.Unmarshal(n.Object, &payment); err != nil {
+            return nil, fmt.Errorf("invalid payment object: %w", err)
+        }
+        return &domainPayment.Event{
+            Type:      eventType,
+            PaymentID: payment.ID,
+            Payment:   toPaymentResponse(&payment),
+        }, nil
+
+    case domainPayment.EventRefundSucceeded:
+        var refund yookassaAPI.Refund
+        if err := json.Unmarshal(n.Object, &refund); err != nil {
+            return nil, fmt.Errorf("invalid refund object: %w", err)
+        }
+        return &domainPayment.Event{
+            Type:      eventType,
+            PaymentID: refund.PaymentID,
+            Refund:    toRefundResponse(&refund),
+        }, nil
+
+    case domainPayment.EventPayoutSucceeded, domainPayment.EventPayoutCanceled:
+        var payout domainPayment.PayoutResponse
+        if err := json.Unmarshal(n.Object, &payout); err != nil {
+            return nil, fmt.Errorf("invalid payout object: %w", err)
+        }
+        return &domainPayment.Event{
+            Type:   eventType,
+            Payout: &payout,
+        }, nil
+    }
+
+    return nil, nil
+}
+
+func (r *PaymentRepository) WebhookAck() (string, []byte) {
+    return "application/json; charset=utf-8", []byte(`{"status":"ok"}`)
+}
@@ -0,0 +1,229 @@
+package capture
+
+import (
+    "backend/config"
+    appCertificate "backend/internal/app/certificate"
+    appLoyalty "backend/internal/app/loyalty"
+    appOrder "backend/internal/app/order"
+    appPayment "backend/internal/app/payment"
+    "backend/internal/domain/order"
+    domainPayment "backend/internal/domain/payment"
+    "backend/pkg/logger"
+    "context"
+    "fmt"
+    "math"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+// Service управляет двухстадийными платежами: списание, отмена холда
+// и автоматическая отмена холдов, которые вот-вот истекут
+type Service struct {
+    orderService       *appOrder.Service
+    paymentService     *appPayment.Service
+    certificateService *appCertificate.Service
+    loyaltyService     *appLoyalty.Service
+    cfg                config.PaymentConfig
+}
+
+func NewService(orderService *appOrder.Service, paymentService *appPayment.Service, certificateService *appCertificate.Service, loyaltyService *appLoyalty.Service, cfg config.PaymentConfig) *Service {
+    return &Service{
+        orderService:       orderService,
+        paymentService:     paymentService,
+        certificateService: certificateService,
+        loyaltyService:     loyaltyService,
+        cfg:                cfg,
+    }
+}
+
+// Capture списывает холд по заказу. Если items не пусто, списываются только
+// перечисленные позиции (например, то, что есть в наличии), остаток холда
+// возвращается покупателю. Заказ, часть которого оплачена сертификатом,
+// списывается только целиком.
+func (s *Service) Capture(ctx context.Context, orderID int, items []order.ItemQuantity) (*order.Order, error) {
+    o, err := s.holdOrder(orderID)
+    if err != nil {
+        return nil, err
+    }
+    if o.CertificateAmount > 0 && len(items) > 0 {
+        return nil, fmt.Errorf("%w: заказ частично оплачен сертификатом, списать можно только целиком", order.ErrInvalidCapture)
+    }
+
+    captured := o.Items
+    if len(items) > 0 {
+        // Повторы одного товара в запросе складываются, иначе каждый прошел
+        // бы проверку отдельно и списано было бы больше заказанного
+        merged := make([]order.ItemQuantity, 0, len(items))
+        positions := make(map[int]int)
+        for _, r := range items {
+            if i, ok := positions[r.ProductID]; ok {
+                merged[i].Quantity += r.Quantity
+                continue
+            }
+            positions[r.ProductID] = len(merged)
+            merged = append(merged, r)
+        }
+
+        captured = make([]order.Item, 0, len(merged))
+        for _, requested := range merged {
+            item, ok := findItem(o.Items, requested.ProductID)
+            if !ok {
+                return nil, fmt.Errorf("%w: товара %d нет в заказе", order.ErrInvalidCapture, requested.ProductID)
+            }
+            quantity := order.RoundQuantity(requested.Quantity)
+            if quantity > item.Quantity {
+                return nil, fmt.Errorf("%w: для товара %d можно списать не больше %g",
+                    order.ErrInvalidCapture, requested.ProductID, item.Quantity)
+            }
+            item.Quantity = quantity
+            captured = append(captured, item)
+        }
+    }
+
+    itemsTotal := 0.0
+    for _, item := range captured {
+        itemsTotal += item.Total()
+    }
+    amount := roundAmount(itemsTotal + o.DeliveryCost)
+
+    if itemsTotal <= 0 {
+        return nil, fmt.Errorf("%w: нечего списывать, отмените холд", order.ErrInvalidCapture)
+    }
+    if amount > o.Amount+0.005 {
+        return nil, fmt.Errorf("%w: сумма списания больше холда", order.ErrInvalidCapture)
+    }
+
+    receiptItems := s.paymentService.BuildReceiptItems(captured, o.DeliveryCost, o.Currency)
+    if o.CertificateAmount > 0 {
+        amount = o.AmountDue()
+        receiptItems = s.paymentService.BuildPartialPrepaymentItems(captured, o.DeliveryCost, o.Currency, amount)
+    }
+
+    resp, err := s.paymentService.CapturePayment(ctx, o.Provider, &domainPayment.CaptureRequest{
+        PaymentID:    o.PaymentID,
+        Amount:       amount,
+        Currency:     o.Currency,
+        Email:        o.Email,
+        ReceiptItems: receiptItems,
+    })
+    if err != nil {
+        return nil, fmt.Errorf("ошибка списания в платежной системе: %w", err)
+    }
+
+    if len(items) > 0 {
+        if err := s.orderService.UpdateItems(o.ID, captured, itemsTotal, amount); err != nil {
+            logger.Error("Холд списан, но состав заказа не обновлен",
+                zap.Int("order_id", o.ID),
+                zap.Float64("amount", amount),
+                zap.Error(err))
+        }
+    }
+
+    if resp.Status == domainPayment.StatusSucceeded {
+        if _, _, err := s.orderService.MarkPaid(o.PaymentID); err != nil {
+            logger.Error("Ошибка отметки заказа оплаченным", zap.Int("order_id", o.ID), zap.Error(err))
+        }
+    }
+
+    logger.Info("Холд по заказу списан",
+        zap.Int("order_id", o.ID),
+        zap.String("payment_id", o.PaymentID),
+        zap.Float64("amount", amount),
+        zap.Float64("hold_amount", o.Amount))
+
+    return s.orderService.GetByID(o.ID)
+}
+
+// Void отменяет холд - деньги возвращаются покупателю
+func (s *Service) Void(ctx context.Context, orderID int) (*order.Order, error) {
+    o, err := s.holdOrder(orderID)
+    if err != nil {
+        return nil, err
+    }
+
+    if err := s.void(ctx, o); err != nil {
+        return nil, err
+    }
+
+    return s.orderService.GetByID(o.ID)
+}
+
+// Run периодически отменяет холды, срок которых истекает в пределах
+// cfg.AutoVoidMargin: если ЮKassa отменит их сама, заказ зависнет
+func (s *Service) Run(ctx context.Context) {
+    ticker := time.NewTicker(time.Duration(s.cfg.AutoVoidInterval) * time.Second)
+    defer ticker.Stop()
+
+    for {
+        s.voidExpiring(ctx)
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (s *Service) voidExpiring(ctx context.Context) {
+    deadline := time.Now().Add(time.Duration(s.cfg.AutoVoidMargin) * time.Second)
+
+    orders, err := s.orderService.GetExpiringHolds(deadline)
+    if err != nil {
+        logger.Error("Ошибка поиска истекающих холдов", zap.Error(err))
+        return
+    }
+
+    for _, o := range orders {
+        if err := s.void(ctx, o); err != nil {
+            logger.Error("Ошибка автоматической отмены холда",
+                zap.Int("order_id", o.ID),
+                zap.Error(err))
+            continue
+        }
+        logger.Warn("Холд отменен автоматически: менеджер не подтвердил заказ вовремя",
+            zap.Int("order_id", o.ID),
+            zap.Timep("hold_expires_at", o.HoldExpiresAt))
+    }
+}
+
+func (s *Service) void(ctx context.Context, o *order.Order) error {
+    if err := s.paymentService.CancelPayment(ctx, o.Provider, o.PaymentID); err != nil {
+        return fmt.Errorf("ошибка отмены холда в платежной системе: %w", err)
+    }
+
+    if err := s.orderService.Cancel(o.ID); err != nil {
+        return err
+    }
+    if err := s.certificateService.Release(o.ID); err != nil {
+        return err
+    }
+    return s.loyaltyService.Restore(o)
+}
+
+func (s *Service) holdOrder(orderID int) (*order.Order, error) {
+    o, err := s.orderService.GetByID(orderID)
+    if err != nil {
+        return nil, err
+    }
+
+    if o.Status != order.StatusWaitingForCapture {
+        return nil, fmt.Errorf("%w: заказ в статусе %s", order.ErrInvalidCapture, o.Status)
+    }
+
+    return o, nil
+}
+
+func findItem(items []order.Item, productID int) (order.Item, bool) {
+    for _, item := range items {
+        if item.ProductID == productID {
+            return item, true
+        }
+    }
+    return order.Item{}, false
+}
+
+func roundAmount(amount float64) float64 {
+    return math.Round(amount*100) / 100
+}
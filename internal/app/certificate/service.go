@@ -0,0 +1,278 @@
+package certificate
+
+import (
+    "backend/config"
+    appOrder "backend/internal/app/order"
+    "backend/internal/domain/certificate"
+    "backend/internal/domain/order"
+    "backend/pkg/logger"
+    "backend/pkg/smtp_sender"
+    "backend/pkg/templates"
+    "fmt"
+    "math"
+    "strconv"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+// Service ведет подарочные сертификаты. Сертификат продается как товар: после
+// оплаты заказа на каждую купленную единицу выпускается код с номиналом,
+// равным цене товара, и отправляется покупателю. Кодом можно оплатить часть
+// или весь следующий заказ; сумма резервируется с остатка при оформлении
+// заказа, списывается окончательно после оплаты и возвращается на остаток,
+// если заказ отменен.
+type Service struct {
+    repo         certificate.CertificateRepository
+    orderService *appOrder.Service
+    cfg          config.GiftCertificatesConfig
+    managerEmail string
+}
+
+func NewService(repo certificate.CertificateRepository, orderService *appOrder.Service, cfg config.GiftCertificatesConfig, managerEmail string) *Service {
+    return &Service{
+        repo:         repo,
+        orderService: orderService,
+        cfg:          cfg,
+        managerEmail: managerEmail,
+    }
+}
+
+// GetByCode возвращает сертификат по коду, введенному покупателем
+func (s *Service) GetByCode(code string) (*certificate.Certificate, error) {
+    return s.repo.GetByCode(certificate.NormalizeCode(code))
+}
+
+// GetWithRedemptions возвращает сертификат и историю списаний с него
+func (s *Service) GetWithRedemptions(code string) (*certificate.Certificate, []*certificate.Redemption, error) {
+    c, err := s.GetByCode(code)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    redemptions, err := s.repo.GetRedemptions(c.ID)
+    if err != nil {
+        return nil, nil, err
+    }
+    return c, redemptions, nil
+}
+
+// Redeem резервирует остаток сертификата в счет сохраненного заказа: с
+// сертификата снимается не больше суммы заказа. Оплаченная сертификатом
+// часть записывается в o.CertificateAmount.
+func (s *Service) Redeem(code string, o *order.Order) (*certificate.Redemption, error) {
+    redemption, err := s.repo.Redeem(certificate.NormalizeCode(code), o.ID, o.Currency, o.AmountDue(), time.Now())
+    if err != nil {
+        return nil, err
+    }
+
+    o.CertificateAmount = math.Round((o.CertificateAmount+redemption.Amount)*100) / 100
+
+    logger.Info("Сертификат применен к заказу",
+        zap.Int("order_id", o.ID),
+        zap.Int("certificate_id", redemption.CertificateID),
+        zap.Float64("amount", redemption.Amount))
+    return redemption, nil
+}
+
+// Release возвращает на остаток сертификатов суммы, зарезервированные под
+// заказ, который так и не был оплачен
+func (s *Service) Release(orderID int) error {
+    released, err := s.repo.Release(orderID)
+    if err != nil {
+        return err
+    }
+
+    if released > 0 {
+        logger.Info("Резерв сертификата возвращен на остаток",
+            zap.Int("order_id", orderID),
+            zap.Float64("amount", released))
+    }
+    return nil
+}
+
+// HandlePaid применяется к оплаченному заказу: окончательно списывает
+// зарезервированные суммы и выпускает сертификаты, купленные в заказе.
+// Повторный вызов ничего не меняет.
+func (s *Service) HandlePaid(o *order.Order) error {
+    if o.CertificateAmount > 0 {
+        if err := s.repo.Apply(o.ID); err != nil {
+            return err
+        }
+    }
+
+    var expiresAt *time.Time
+    if s.cfg.ValidityDays > 0 {
+        t := time.Now().AddDate(0, 0, s.cfg.ValidityDays)
+        expiresAt = &t
+    }
+
+    var certs []*certificate.Certificate
+    for _, item := range o.Items {
+        if !item.GiftCertificate {
+            continue
+        }
+        for i := 0; i < int(math.Round(item.Quantity)); i++ {
+            code, err := certificate.NewCode()
+            if err != nil {
+                return fmt.Errorf("ошибка генерации кода сертификата: %w", err)
+            }
+            certs = append(certs, &certificate.Certificate{
+                Code:      code,
+                ProductID: item.ProductID,
+                Amount:    item.Price,
+                Balance:   item.Price,
+                Currency:  o.Currency,
+                Email:     o.Email,
+                Status:    certificate.StatusActive,
+                ExpiresAt: expiresAt,
+            })
+        }
+    }
+    if len(certs) == 0 {
+        return nil
+    }
+
+    created, err := s.repo.Create(o.ID, certs)
+    if err != nil {
+        return err
+    }
+    if !created {
+        return nil
+    }
+
+    logger.Info("Выпущены подарочные сертификаты",
+        zap.Int("order_id", o.ID),
+        zap.Int("count", len(certs)))
+
+    for _, c := range certs {
+        data := templates.GiftCertificateData{
+            CustomerName: o.CustomerName,
+            Email:        c.Email,
+            Code:         c.Code,
+            Amount:       fmt.Sprintf("%.2f", c.Amount),
+            Currency:     c.Currency,
+        }
+        if c.ExpiresAt != nil {
+            data.ExpiresAt = c.ExpiresAt.Format("02.01.2006")
+        }
+        go func() {
+            if err := smtp_sender.SendGiftCertificateEmail(data); err != nil {
+                logger.Error("Failed to send gift certificate email",
+                    zap.Int("order_id", o.ID),
+                    zap.Error(err))
+            }
+        }()
+    }
+    return nil
+}
+
+// PayOrder завершает заказ, который целиком оплачен сертификатом: платеж не
+// создается, заказ сразу отмечается оплаченным и покупатель с менеджером
+// получают обычные письма о заказе
+func (s *Service) PayOrder(o *order.Order) (*order.Order, error) {
+    paid, err := s.orderService.MarkPaidByCertificate(o.ID)
+    if err != nil {
+        return nil, err
+    }
+    if err := s.HandlePaid(paid); err != nil {
+        return nil, err
+    }
+
+    logger.Info("Заказ оплачен сертификатом",
+        zap.Int("order_id", paid.ID),
+        zap.Float64("amount", paid.Amount))
+
+    data := orderData(paid)
+    go func() {
+        if err := smtp_sender.SendOrderEmails(data, s.managerEmail); err != nil {
+            logger.Error("Failed to send order emails",
+                zap.Int("order_id", paid.ID),
+                zap.Error(err))
+        }
+    }()
+
+    return paid, nil
+}
+
+// CheckRefund проверяет, что купленные в заказе сертификаты можно вернуть:
+// на каждую возвращаемую единицу должен быть целый, еще не потраченный
+// сертификат
+func (s *Service) CheckRefund(orderID int, items []order.Item) error {
+    certs, err := s.repo.GetByOrderID(orderID)
+    if err != nil {
+        return err
+    }
+
+    unspent := make(map[int]int)
+    for _, c := range certs {
+        if c.Status == certificate.StatusActive && c.Balance == c.Amount {
+            unspent[c.ProductID]++
+        }
+    }
+
+    for _, item := range items {
+        if !item.GiftCertificate {
+            continue
+        }
+        if count := int(math.Round(item.Quantity)); unspent[item.ProductID] < count {
+            return fmt.Errorf("%w: сертификатов товара %d, которые не начали тратить, %d из %d",
+                order.ErrInvalidRefund, item.ProductID, unspent[item.ProductID], count)
+        }
+    }
+    return nil
+}
+
+// CancelRefunded отменяет сертификаты, деньги за которые возвращены
+func (s *Service) CancelRefunded(orderID int, items []order.Item) error {
+    for _, item := range items {
+        if !item.GiftCertificate {
+            continue
+        }
+
+        count := int(math.Round(item.Quantity))
+        canceled, err := s.repo.Cancel(orderID, item.ProductID, count)
+        if err != nil {
+            return err
+        }
+        if canceled < count {
+            return fmt.Errorf("отменено %d сертификатов товара %d из %d", canceled, item.ProductID, count)
+        }
+
+        logger.Info("Сертификаты отменены после возврата",
+            zap.Int("order_id", orderID),
+            zap.Int("product_id", item.ProductID),
+            zap.Int("count", canceled))
+    }
+    return nil
+}
+
+// orderData формирует данные писем о заказе, оплаченном сертификатом
+func orderData(o *order.Order) templates.OrderData {
+    cartItems := make([]templates.CartItem, len(o.Items))
+    for i, item := range o.Items {
+        cartItems[i] = templates.CartItem{
+            ProductID:       item.ProductID,
+            Quantity:        item.Quantity,
+            Price:           item.Price,
+            Name:            item.Name,
+            Unit:            item.Unit,
+            GiftCertificate: item.GiftCertificate,
+        }
+    }
+
+    return templates.OrderData{
+        CustomerName:      o.CustomerName,
+        Email:             o.Email,
+        Phone:             o.Phone,
+        DeliveryType:      o.DeliveryType,
+        DeliveryAddress:   o.DeliveryAddress,
+        Comment:           o.Comment,
+        PaymentID:         strconv.Itoa(o.ID),
+        Amount:            fmt.Sprintf("%.2f", o.Amount),
+        Currency:          o.Currency,
+        CartItems:         cartItems,
+        CertificateAmount: o.CertificateAmount,
+        BonusSpent:        o.BonusAmount,
+    }
+}
@@ -0,0 +1,218 @@
+package feed
+
+import (
+	"backend/config"
+	appProduct "backend/internal/app/product"
+	"backend/internal/domain/product"
+	"backend/pkg/logger"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// ymlCurrencyRUB - код рубля в YML (Маркет использует RUR, а не RUB)
+const ymlCurrencyRUB = "RUR"
+
+// Service формирует YML-фид каталога для Яндекс.Маркета и кэширует его
+type Service struct {
+	productService *appProduct.Service
+	cfg            config.FeedConfig
+	frontendURL    string
+
+	mu      sync.Mutex
+	yml     document
+	sitemap document
+}
+
+// document - закэшированный сгенерированный файл
+type document struct {
+	data        []byte
+	generatedAt time.Time
+}
+
+func NewService(productService *appProduct.Service, cfg config.FeedConfig, frontendURL string) *Service {
+	return &Service{
+		productService: productService,
+		cfg:            cfg,
+		frontendURL:    strings.TrimRight(frontendURL, "/"),
+	}
+}
+
+// GetYML возвращает фид Яндекс.Маркета из кэша или формирует его заново
+func (s *Service) GetYML() ([]byte, time.Time, error) {
+	return s.get(&s.yml, s.generateYML)
+}
+
+// GetSitemap возвращает sitemap.xml из кэша или формирует его заново
+func (s *Service) GetSitemap() ([]byte, time.Time, error) {
+	return s.get(&s.sitemap, s.generateSitemap)
+}
+
+// get отдает документ из кэша или формирует его заново, если кэш устарел.
+// Если сформировать новый документ не удалось, отдается последний удачный.
+func (s *Service) get(doc *document, generate func() ([]byte, error)) ([]byte, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ttl := time.Duration(s.cfg.CacheTTL) * time.Second
+	if doc.data != nil && time.Since(doc.generatedAt) < ttl {
+		return doc.data, doc.generatedAt, nil
+	}
+
+	data, err := generate()
+	if err != nil {
+		if doc.data != nil {
+			logger.Error("Ошибка формирования документа, отдаем кэш",
+				zap.Time("generated_at", doc.generatedAt),
+				zap.Error(err))
+			return doc.data, doc.generatedAt, nil
+		}
+		return nil, time.Time{}, err
+	}
+
+	doc.data = data
+	doc.generatedAt = time.Now()
+	return doc.data, doc.generatedAt, nil
+}
+
+func (s *Service) generateYML() ([]byte, error) {
+	categories, err := s.productService.GetCategories()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения категорий: %w", err)
+	}
+
+	products, err := s.productService.GetAllProducts()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения товаров: %w", err)
+	}
+
+	catalog := ymlCatalog{
+		Date: time.Now().Format(ymlDateLayout),
+		Shop: ymlShop{
+			Name:       s.cfg.ShopName,
+			Company:    s.cfg.Company,
+			URL:        s.frontendURL,
+			Currencies: []ymlCurrency{{ID: ymlCurrencyRUB, Rate: "1"}},
+		},
+	}
+
+	for _, c := range categories {
+		catalog.Shop.Categories = append(catalog.Shop.Categories, ymlCategory{
+			ID:       c.ID,
+			ParentID: c.ParentID,
+			Name:     c.Name,
+		})
+	}
+
+	for _, p := range products {
+		if p.CategoryID == 0 {
+			logger.Warn("Товар без категории пропущен в YML-фиде", zap.Int("product_id", p.ID))
+			continue
+		}
+		catalog.Shop.Offers = append(catalog.Shop.Offers, s.buildOffer(p))
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(catalog); err != nil {
+		return nil, fmt.Errorf("ошибка сериализации YML: %w", err)
+	}
+
+	if err := validate(buf.Bytes()); err != nil {
+		return nil, fmt.Errorf("YML-фид не прошел проверку: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (s *Service) buildOffer(p *product.Product) ymlOffer {
+	offer := ymlOffer{
+		ID:          p.ID,
+		Available:   p.Available(),
+		Name:        p.Title,
+		URL:         s.productURL(p),
+		Price:       formatPrice(p.FinalPrice()),
+		CurrencyID:  ymlCurrencyRUB,
+		CategoryID:  p.CategoryID,
+		Description: p.Description,
+	}
+
+	// Старая цена указывается только при действующей скидке
+	if p.Discount > 0 {
+		offer.OldPrice = formatPrice(p.Price)
+	}
+
+	if p.Image != "" {
+		offer.Picture = s.absoluteURL(p.Image)
+	}
+
+	return offer
+}
+
+// productURL возвращает адрес карточки товара на фронтенде
+func (s *Service) productURL(p *product.Product) string {
+	if p.Slug != "" {
+		return fmt.Sprintf("%s/product/%s", s.frontendURL, url.PathEscape(p.Slug))
+	}
+	return fmt.Sprintf("%s/product/%d", s.frontendURL, p.ID)
+}
+
+// absoluteURL дополняет относительный путь до полного адреса на фронтенде
+func (s *Service) absoluteURL(path string) string {
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	return s.frontendURL + "/" + strings.TrimLeft(path, "/")
+}
+
+func formatPrice(price float64) string {
+	return fmt.Sprintf("%.2f", price)
+}
+
+// validate проверяет, что фид является корректным XML и ссылки между
+// предложениями и категориями не нарушены
+func validate(data []byte) error {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		if _, err := decoder.Token(); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return fmt.Errorf("некорректный XML: %w", err)
+		}
+	}
+
+	var catalog ymlCatalog
+	if err := xml.Unmarshal(data, &catalog); err != nil {
+		return fmt.Errorf("ошибка разбора YML: %w", err)
+	}
+
+	if catalog.Shop.Name == "" || catalog.Shop.Company == "" || catalog.Shop.URL == "" {
+		return fmt.Errorf("не заполнены name, company или url магазина")
+	}
+
+	categoryIDs := make(map[int]bool, len(catalog.Shop.Categories))
+	for _, c := range catalog.Shop.Categories {
+		categoryIDs[c.ID] = true
+	}
+
+	for _, offer := range catalog.Shop.Offers {
+		if offer.Name == "" || offer.URL == "" || offer.Price == "" {
+			return fmt.Errorf("у предложения %d не заполнены обязательные поля", offer.ID)
+		}
+		if !categoryIDs[offer.CategoryID] {
+			return fmt.Errorf("предложение %d ссылается на несуществующую категорию %d", offer.ID, offer.CategoryID)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package feed
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+)
+
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// sitemapDateLayout - формат lastmod (W3C Datetime, только дата)
+const sitemapDateLayout = "2006-01-02"
+
+type urlSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod,omitempty"`
+	ChangeFreq string `xml:"changefreq,omitempty"`
+	Priority   string `xml:"priority,omitempty"`
+}
+
+func (s *Service) generateSitemap() ([]byte, error) {
+	// slug синхронизируются при запуске сервиса; публичный GET базу не меняет
+	categories, err := s.productService.GetCategories()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения категорий: %w", err)
+	}
+
+	products, err := s.productService.GetAllProducts()
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения товаров: %w", err)
+	}
+
+	set := urlSet{Xmlns: sitemapNamespace}
+	set.URLs = append(set.URLs, sitemapURL{
+		Loc:        s.frontendURL + "/",
+		ChangeFreq: "daily",
+		Priority:   "1.0",
+	})
+
+	for _, c := range categories {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:        fmt.Sprintf("%s/catalog/%s", s.frontendURL, url.PathEscape(c.Slug)),
+			ChangeFreq: "weekly",
+			Priority:   "0.8",
+		})
+	}
+
+	for _, p := range products {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:        s.productURL(p),
+			LastMod:    p.CreatedAt.Format(sitemapDateLayout),
+			ChangeFreq: "weekly",
+			Priority:   "0.6",
+		})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(set); err != nil {
+		return nil, fmt.Errorf("ошибка сериализации sitemap: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,46 @@
+package feed
+
+import "encoding/xml"
+
+// ymlDateLayout - формат даты генерации фида по спецификации YML
+const ymlDateLayout = "2006-01-02T15:04-07:00"
+
+// ymlCatalog - корневой элемент фида Яндекс.Маркета
+type ymlCatalog struct {
+	XMLName xml.Name `xml:"yml_catalog"`
+	Date    string   `xml:"date,attr"`
+	Shop    ymlShop  `xml:"shop"`
+}
+
+type ymlShop struct {
+	Name       string        `xml:"name"`
+	Company    string        `xml:"company"`
+	URL        string        `xml:"url"`
+	Currencies []ymlCurrency `xml:"currencies>currency"`
+	Categories []ymlCategory `xml:"categories>category"`
+	Offers     []ymlOffer    `xml:"offers>offer"`
+}
+
+type ymlCurrency struct {
+	ID   string `xml:"id,attr"`
+	Rate string `xml:"rate,attr"`
+}
+
+type ymlCategory struct {
+	ID       int    `xml:"id,attr"`
+	ParentID int    `xml:"parentId,attr,omitempty"`
+	Name     string `xml:",chardata"`
+}
+
+type ymlOffer struct {
+	ID          int    `xml:"id,attr"`
+	Available   bool   `xml:"available,attr"`
+	Name        string `xml:"name"`
+	URL         string `xml:"url"`
+	Price       string `xml:"price"`
+	OldPrice    string `xml:"oldprice,omitempty"`
+	CurrencyID  string `xml:"currencyId"`
+	CategoryID  int    `xml:"categoryId"`
+	Picture     string `xml:"picture,omitempty"`
+	Description string `xml:"description,omitempty"`
+}
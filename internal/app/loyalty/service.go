@@ -0,0 +1,312 @@
+package loyalty
+
+import (
+    "backend/config"
+    "backend/internal/domain/loyalty"
+    "backend/internal/domain/order"
+    "backend/pkg/logger"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "math"
+    "strings"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+// Service ведет бонусную программу. За оплаченный заказ покупателю
+// начисляется процент от суммы товаров, оплаченной деньгами; бонусами можно
+// оплатить часть следующего заказа. Начисления сгорают через заданный срок,
+// каждое изменение баланса записывается в журнал. Счет привязан к email
+// заказов, а посмотреть и потратить бонусы можно по секретной ссылке из писем.
+type Service struct {
+    repo        loyalty.LoyaltyRepository
+    cfg         config.LoyaltyConfig
+    frontendURL string
+}
+
+func NewService(repo loyalty.LoyaltyRepository, cfg config.LoyaltyConfig, frontendURL string) *Service {
+    return &Service{
+        repo:        repo,
+        cfg:         cfg,
+        frontendURL: strings.TrimRight(frontendURL, "/"),
+    }
+}
+
+// GetHistory возвращает счет по ссылке покупателя и операции с бонусами,
+// начиная с последних
+func (s *Service) GetHistory(token string, limit, offset int) (*loyalty.Account, []*loyalty.Entry, error) {
+    account, err := s.repo.GetByToken(token)
+    if err != nil {
+        return nil, nil, err
+    }
+
+    entries, err := s.repo.GetEntries(account.ID, limit, offset)
+    if err != nil {
+        return nil, nil, err
+    }
+    return account, entries, nil
+}
+
+// Discount проверяет, что со счета по ссылке token можно списать points
+// бонусов в счет товаров items, и снижает цены товаров на эту сумму.
+// Возвращает счет, позиции с новыми ценами и фактическую скидку, которую
+// нужно списать после сохранения заказа.
+func (s *Service) Discount(token string, items []order.Item, points float64) (*loyalty.Account, []order.Item, float64, error) {
+    if !s.cfg.Enabled {
+        return nil, nil, 0, fmt.Errorf("%w: бонусная программа отключена", loyalty.ErrInvalidSpend)
+    }
+
+    account, err := s.repo.GetByToken(token)
+    if err != nil {
+        return nil, nil, 0, err
+    }
+
+    goodsTotal := 0.0
+    for _, item := range order.Goods(items) {
+        goodsTotal += item.Total()
+    }
+    if max := loyalty.MaxSpend(goodsTotal, account.Balance, s.cfg.MaxSpendPercent); points > max+0.005 {
+        return nil, nil, 0, fmt.Errorf("%w: к этому заказу можно списать не больше %.2f", loyalty.ErrInvalidSpend, max)
+    }
+
+    discounted, applied := order.ApplyDiscount(items, points)
+    if applied <= 0 {
+        return nil, nil, 0, fmt.Errorf("%w: скидка меньше копейки", loyalty.ErrInvalidSpend)
+    }
+    return account, discounted, applied, nil
+}
+
+// Spend списывает со счета бонусы, учтенные в ценах сохраненного заказа
+func (s *Service) Spend(account *loyalty.Account, o *order.Order) error {
+    entry := &loyalty.Entry{
+        AccountID: account.ID,
+        Kind:      loyalty.KindSpend,
+        Amount:    o.BonusAmount,
+        OrderID:   o.ID,
+        Reference: fmt.Sprintf("order:%d", o.ID),
+    }
+    if _, err := s.repo.Debit(entry, false, time.Now()); err != nil {
+        return err
+    }
+
+    logger.Info("Бонусы списаны в счет заказа",
+        zap.Int("order_id", o.ID),
+        zap.Int("account_id", account.ID),
+        zap.Float64("amount", o.BonusAmount))
+    return nil
+}
+
+// Restore возвращает на счет бонусы, списанные в счет заказа, который так и
+// не был оплачен. Возвращенные бонусы сгорают в срок, как новое начисление.
+func (s *Service) Restore(o *order.Order) error {
+    if o.BonusAmount <= 0 {
+        return nil
+    }
+    return s.restoreSpent(o.ID, 1, fmt.Sprintf("cancel:%d", o.ID))
+}
+
+// Earning - начисление бонусов за заказ для писем покупателю
+type Earning struct {
+    Earned  float64
+    Balance float64
+    URL     string
+}
+
+// Earn начисляет бонусы за оплаченный заказ на счет покупателя с email
+// заказа, создавая счет при первом начислении. Бонусы начисляются с суммы
+// товаров, оплаченной деньгами: доставка, подарочные сертификаты и часть,
+// оплаченная сертификатом, не учитываются. Повторный вызов ничего не
+// начисляет. Возвращает nil, если у покупателя нет счета.
+func (s *Service) Earn(o *order.Order) (*Earning, error) {
+    goodsTotal := 0.0
+    for _, item := range order.Goods(o.Items) {
+        goodsTotal += item.Total()
+    }
+    earned := 0.0
+    if s.cfg.Enabled {
+        earned = loyalty.Earned(math.Min(goodsTotal, o.AmountDue()), s.cfg.EarnPercent)
+    }
+
+    if earned <= 0 {
+        account, err := s.repo.GetByEmail(o.Email)
+        if errors.Is(err, loyalty.ErrNotFound) {
+            return nil, nil
+        }
+        if err != nil {
+            return nil, err
+        }
+        return &Earning{Balance: account.Balance, URL: s.accountURL(account)}, nil
+    }
+
+    token, err := newToken()
+    if err != nil {
+        return nil, err
+    }
+    account, err := s.repo.GetOrCreateAccount(o.Email, token)
+    if err != nil {
+        return nil, err
+    }
+
+    credited, err := s.repo.Credit(&loyalty.Entry{
+        AccountID: account.ID,
+        Kind:      loyalty.KindEarn,
+        Amount:    earned,
+        OrderID:   o.ID,
+        Reference: fmt.Sprintf("order:%d", o.ID),
+        ExpiresAt: s.expiresAt(),
+    })
+    if err != nil {
+        return nil, err
+    }
+    if credited {
+        account.Balance = math.Round((account.Balance+earned)*100) / 100
+        logger.Info("Начислены бонусы за заказ",
+            zap.Int("order_id", o.ID),
+            zap.Int("account_id", account.ID),
+            zap.Float64("amount", earned))
+    }
+
+    return &Earning{Earned: earned, Balance: account.Balance, URL: s.accountURL(account)}, nil
+}
+
+// HandleRefund пересчитывает бонусы после возврата денег по заказу: доля
+// начисленных за заказ бонусов, равная доле возвращенной суммы, списывается
+// (не больше остатка на счете), такая же доля списанных в счет заказа
+// бонусов возвращается на счет. Повтор для того же возврата ничего не меняет.
+func (s *Service) HandleRefund(o *order.Order, refundID string, amount float64) error {
+    if o.AmountDue() <= 0 || amount <= 0 {
+        return nil
+    }
+    ratio := math.Min(amount/o.AmountDue(), 1)
+    reference := fmt.Sprintf("refund:%s", refundID)
+
+    entries, err := s.repo.GetOrderEntries(o.ID)
+    if err != nil {
+        return err
+    }
+    earned := make(map[int]float64)
+    for _, e := range entries {
+        if e.Kind == loyalty.KindEarn {
+            earned[e.AccountID] += e.Amount
+        }
+    }
+
+    for accountID, total := range earned {
+        revoke := math.Round(total*ratio*100) / 100
+        if revoke <= 0 {
+            continue
+        }
+        entry := &loyalty.Entry{
+            AccountID: accountID,
+            Kind:      loyalty.KindRevoke,
+            Amount:    revoke,
+            OrderID:   o.ID,
+            Reference: reference,
+        }
+        // Потраченные бонусы не отнять - списывается сколько есть на счете
+        if _, err := s.repo.Debit(entry, true, time.Now()); err != nil {
+            return err
+        }
+    }
+
+    return s.restoreSpent(o.ID, ratio, reference)
+}
+
+// restoreSpent возвращает на счета долю ratio бонусов, списанных в счет
+// заказа, за вычетом уже возвращенных
+func (s *Service) restoreSpent(orderID int, ratio float64, reference string) error {
+    entries, err := s.repo.GetOrderEntries(orderID)
+    if err != nil {
+        return err
+    }
+
+    spent := make(map[int]float64)
+    restored := make(map[int]float64)
+    for _, e := range entries {
+        switch e.Kind {
+        case loyalty.KindSpend:
+            spent[e.AccountID] -= e.Amount
+        case loyalty.KindRestore:
+            restored[e.AccountID] += e.Amount
+        }
+    }
+
+    for accountID, total := range spent {
+        amount := math.Min(math.Round(total*ratio*100)/100, math.Round((total-restored[accountID])*100)/100)
+        if amount <= 0 {
+            continue
+        }
+        credited, err := s.repo.Credit(&loyalty.Entry{
+            AccountID: accountID,
+            Kind:      loyalty.KindRestore,
+            Amount:    amount,
+            OrderID:   orderID,
+            Reference: reference,
+            ExpiresAt: s.expiresAt(),
+        })
+        if err != nil {
+            return err
+        }
+        if credited {
+            logger.Info("Бонусы возвращены на счет",
+                zap.Int("order_id", orderID),
+                zap.Int("account_id", accountID),
+                zap.Float64("amount", amount))
+        }
+    }
+    return nil
+}
+
+// Run периодически списывает сгоревшие бонусы
+func (s *Service) Run(ctx context.Context) {
+    ticker := time.NewTicker(time.Duration(s.cfg.ExpireInterval) * time.Second)
+    defer ticker.Stop()
+
+    for {
+        s.expire()
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (s *Service) expire() {
+    expired, err := s.repo.Expire(time.Now())
+    if err != nil {
+        logger.Error("Ошибка списания сгоревших бонусов", zap.Error(err))
+        return
+    }
+    if expired > 0 {
+        logger.Info("Списаны сгоревшие бонусы", zap.Int("lots", expired))
+    }
+}
+
+// expiresAt возвращает срок сгорания нового начисления; nil - не сгорает
+func (s *Service) expiresAt() *time.Time {
+    if s.cfg.ValidityDays <= 0 {
+        return nil
+    }
+    t := time.Now().AddDate(0, 0, s.cfg.ValidityDays)
+    return &t
+}
+
+// accountURL - ссылка на страницу бонусов на сайте
+func (s *Service) accountURL(account *loyalty.Account) string {
+    return fmt.Sprintf("%s/bonus/%s", s.frontendURL, account.Token)
+}
+
+// newToken генерирует секрет ссылки на бонусный счет
+func newToken() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", fmt.Errorf("ошибка генерации токена бонусного счета: %w", err)
+    }
+    return hex.EncodeToString(b), nil
+}
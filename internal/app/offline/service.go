@@ -0,0 +1,146 @@
+package offline
+
+import (
+    appCertificate "backend/internal/app/certificate"
+    appLoyalty "backend/internal/app/loyalty"
+    appOrder "backend/internal/app/order"
+    appReceipt "backend/internal/app/receipt"
+    "backend/internal/domain/order"
+    "backend/pkg/logger"
+    "backend/pkg/smtp_sender"
+    "backend/pkg/templates"
+    "context"
+    "fmt"
+    "strconv"
+
+    "go.uber.org/zap"
+)
+
+// Service ведет заказы с оплатой при получении: наличными или картой курьеру
+// либо в пункте выдачи. Заказ создается без платежа, менеджер получает письмо
+// о неоплаченном заказе и отмечает оплату, когда покупатель заплатил. Тогда же
+// заказ считается переданным и оформляется чек полного расчета.
+type Service struct {
+    orderService       *appOrder.Service
+    receiptService     *appReceipt.Service
+    certificateService *appCertificate.Service
+    loyaltyService     *appLoyalty.Service
+    managerEmail       string
+}
+
+func NewService(orderService *appOrder.Service, receiptService *appReceipt.Service, certificateService *appCertificate.Service, loyaltyService *appLoyalty.Service, managerEmail string) *Service {
+    return &Service{
+        orderService:       orderService,
+        receiptService:     receiptService,
+        certificateService: certificateService,
+        loyaltyService:     loyaltyService,
+        managerEmail:       managerEmail,
+    }
+}
+
+// PlaceOrder сохраняет заказ с оплатой при получении и отправляет менеджеру
+// письмо с пометкой «не оплачен»
+func (s *Service) PlaceOrder(o *order.Order) error {
+    if err := s.orderService.CreateOffline(o); err != nil {
+        return err
+    }
+
+    logger.Info("Создан заказ с оплатой при получении",
+        zap.Int("order_id", o.ID),
+        zap.String("delivery_type", o.DeliveryType),
+        zap.Float64("amount", o.Amount))
+
+    data := orderData(o)
+    go func() {
+        if err := smtp_sender.SendOrderToManager(data, s.managerEmail); err != nil {
+            logger.Error("Failed to send unpaid order email",
+                zap.Int("order_id", o.ID),
+                zap.Error(err))
+        }
+    }()
+
+    return nil
+}
+
+// RecordPayment отмечает, что покупатель заплатил при получении, отмечает
+// заказ переданным, выпускает купленные сертификаты, начисляет бонусы и
+// отправляет чек полного расчета. Чек расчета наличными пробивает касса
+// курьера или пункта выдачи - он только записывается в историю заказа. Если
+// чек отправить не удалось, оплата остается отмеченной, а запрос можно
+// повторить - повтор только дооформит чек.
+func (s *Service) RecordPayment(ctx context.Context, orderID int, method order.OfflineMethod) (*order.Order, error) {
+    o, marked, err := s.orderService.MarkPaidOffline(orderID, method)
+    if err != nil {
+        return nil, err
+    }
+    if marked {
+        logger.Info("Отмечена оплата при получении",
+            zap.Int("order_id", o.ID),
+            zap.String("method", string(method)))
+    }
+
+    // Оплата при получении означает, что заказ уже у покупателя
+    if o.FulfillmentStatus == "" {
+        status := order.FulfillmentPickedUp
+        if o.DeliveryType == "delivery" {
+            status = order.FulfillmentDelivered
+        }
+        if o, err = s.orderService.Fulfill(o.ID, status); err != nil {
+            return nil, err
+        }
+    }
+
+    // Купленные сертификаты выпускаются, а бонусы начисляются после оплаты,
+    // не дожидаясь чека: оба вызова повторяемы
+    if err := s.certificateService.HandlePaid(o); err != nil {
+        return nil, err
+    }
+    if _, err := s.loyaltyService.Earn(o); err != nil {
+        return nil, err
+    }
+    if _, err := s.receiptService.IssueOfflinePayment(ctx, o); err != nil {
+        return nil, err
+    }
+    return o, nil
+}
+
+// Cancel отменяет неоплаченный заказ, например если покупатель отказался от
+// него у курьера. Товары возвращаются в остатки.
+func (s *Service) Cancel(orderID int) (*order.Order, error) {
+    o, err := s.orderService.CancelOffline(orderID)
+    if err != nil {
+        return nil, err
+    }
+
+    logger.Info("Заказ с оплатой при получении отменен", zap.Int("order_id", o.ID))
+    return o, nil
+}
+
+// orderData формирует данные письма менеджеру о неоплаченном заказе
+func orderData(o *order.Order) templates.OrderData {
+    cartItems := make([]templates.CartItem, len(o.Items))
+    for i, item := range o.Items {
+        cartItems[i] = templates.CartItem{
+            ProductID:       item.ProductID,
+            Quantity:        item.Quantity,
+            Price:           item.Price,
+            Name:            item.Name,
+            Unit:            item.Unit,
+            GiftCertificate: item.GiftCertificate,
+        }
+    }
+
+    return templates.OrderData{
+        CustomerName:    o.CustomerName,
+        Email:           o.Email,
+        Phone:           o.Phone,
+        DeliveryType:    o.DeliveryType,
+        DeliveryAddress: o.DeliveryAddress,
+        Comment:         o.Comment,
+        PaymentID:       strconv.Itoa(o.ID),
+        Amount:          fmt.Sprintf("%.2f", o.Amount),
+        Currency:        o.Currency,
+        CartItems:       cartItems,
+        Unpaid:          true,
+    }
+}
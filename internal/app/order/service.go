@@ -0,0 +1,343 @@
+package order
+
+import (
+    "backend/internal/domain/order"
+    domainPayment "backend/internal/domain/payment"
+    "fmt"
+    "time"
+)
+
+// Service содержит бизнес-логику работы с заказами
+type Service struct {
+    repo order.OrderRepository
+}
+
+func NewService(repo order.OrderRepository) *Service {
+    return &Service{repo: repo}
+}
+
+// Create сохраняет новый заказ в статусе ожидания оплаты
+func (s *Service) Create(o *order.Order) error {
+    o.Status = order.StatusPending
+    return s.repo.Create(o)
+}
+
+// CreateOffline сохраняет заказ с оплатой при получении. Платеж не
+// создается: заказ ждет, пока менеджер отметит оплату.
+func (s *Service) CreateOffline(o *order.Order) error {
+    o.Provider = order.ProviderOffline
+    return s.Create(o)
+}
+
+func (s *Service) GetByID(id int) (*order.Order, error) {
+    return s.repo.GetByID(id)
+}
+
+func (s *Service) GetByPaymentID(paymentID string) (*order.Order, error) {
+    return s.repo.GetByPaymentID(paymentID)
+}
+
+func (s *Service) GetByStatus(status order.Status, limit, offset int) ([]*order.Order, error) {
+    return s.repo.GetByStatus(status, limit, offset)
+}
+
+func (s *Service) GetExpiringHolds(before time.Time) ([]*order.Order, error) {
+    return s.repo.GetExpiringHolds(before)
+}
+
+func (s *Service) GetPendingPayments(from, to time.Time) ([]*order.Order, error) {
+    return s.repo.GetPendingPayments(from, to)
+}
+
+func (s *Service) GetStalePending(before time.Time) ([]*order.Order, error) {
+    return s.repo.GetStalePending(before)
+}
+
+// Expire отменяет заказ, не оплаченный за срок жизни платежа, и возвращает
+// его товары в остатки. Возвращает false, если заказ уже не ждет оплаты.
+func (s *Service) Expire(id int) (bool, error) {
+    o, err := s.repo.GetByID(id)
+    if err != nil {
+        return false, err
+    }
+    if o.Status != order.StatusPending {
+        return false, nil
+    }
+    return s.repo.Cancel(id)
+}
+
+// AttachPayment связывает заказ с созданным платежом и провайдером, через которого он проведен
+func (s *Service) AttachPayment(id int, provider, paymentID string) error {
+    return s.repo.AttachPayment(id, provider, paymentID)
+}
+
+// Cancel отменяет неоплаченный заказ и возвращает его товары в остатки.
+// Оплаченные и уже отмененные заказы не меняются.
+func (s *Service) Cancel(id int) error {
+    _, err := s.repo.Cancel(id)
+    return err
+}
+
+// MarkPaid отмечает заказ оплаченным, если он ждет оплаты или списания холда.
+// Иначе заказ не меняется: возвращается его текущее состояние и false.
+// Вызывающий проверяет статус - отмененный заказ мог быть оплачен позже отмены.
+func (s *Service) MarkPaid(paymentID string) (*order.Order, bool, error) {
+    o, err := s.repo.GetByPaymentID(paymentID)
+    if err != nil {
+        return nil, false, err
+    }
+
+    now := time.Now()
+    changed, err := s.repo.MarkPaid(o.ID, now)
+    if err != nil {
+        return nil, false, err
+    }
+    if !changed {
+        // Статус мог измениться между чтением и обновлением
+        o, err = s.repo.GetByID(o.ID)
+        if err != nil {
+            return nil, false, err
+        }
+        return o, false, nil
+    }
+
+    o.Status = order.StatusPaid
+    o.PaidAt = &now
+    return o, true, nil
+}
+
+// MarkPaidByCertificate отмечает оплаченным заказ, который целиком оплачен
+// подарочным сертификатом и поэтому создан без платежа
+func (s *Service) MarkPaidByCertificate(id int) (*order.Order, error) {
+    o, err := s.repo.GetByID(id)
+    if err != nil {
+        return nil, err
+    }
+    if o.Status != order.StatusPending || o.PaymentID != "" || o.AmountDue() > 0 {
+        return nil, fmt.Errorf("заказ %d не оплачен сертификатом целиком", id)
+    }
+
+    now := time.Now()
+    changed, err := s.repo.MarkPaid(o.ID, now)
+    if err != nil {
+        return nil, err
+    }
+    if !changed {
+        return nil, fmt.Errorf("заказ %d уже оплачен или отменен", id)
+    }
+
+    o.Status = order.StatusPaid
+    o.PaidAt = &now
+    return o, nil
+}
+
+// MarkPaidOffline отмечает оплату при получении. Повторная отметка тем же
+// способом ничего не делает и возвращает false.
+func (s *Service) MarkPaidOffline(id int, method order.OfflineMethod) (*order.Order, bool, error) {
+    if !method.Valid() {
+        return nil, false, fmt.Errorf("%w: неизвестный способ оплаты %q", order.ErrInvalidOfflinePayment, method)
+    }
+
+    o, err := s.repo.GetByID(id)
+    if err != nil {
+        return nil, false, err
+    }
+    if !o.Offline() {
+        return nil, false, fmt.Errorf("%w: заказ оплачивается онлайн", order.ErrInvalidOfflinePayment)
+    }
+    if o.OfflineMethod == method {
+        return o, false, nil
+    }
+    if o.Status != order.StatusPending {
+        return nil, false, fmt.Errorf("%w: заказ в статусе %s", order.ErrInvalidOfflinePayment, o.Status)
+    }
+
+    now := time.Now()
+    updated, err := s.repo.MarkPaidOffline(id, method, now)
+    if err != nil {
+        return nil, false, err
+    }
+    if !updated {
+        return nil, false, fmt.Errorf("%w: заказ уже оплачен или отменен", order.ErrInvalidOfflinePayment)
+    }
+
+    o.Status = order.StatusPaid
+    o.PaidAt = &now
+    o.OfflineMethod = method
+    return o, true, nil
+}
+
+// CancelOffline отменяет неоплаченный заказ с оплатой при получении, например
+// когда покупатель отказался от заказа у курьера
+func (s *Service) CancelOffline(id int) (*order.Order, error) {
+    o, err := s.repo.GetByID(id)
+    if err != nil {
+        return nil, err
+    }
+    if !o.Offline() {
+        return nil, fmt.Errorf("%w: заказ оплачивается онлайн", order.ErrInvalidOfflinePayment)
+    }
+
+    canceled, err := s.repo.Cancel(id)
+    if err != nil {
+        return nil, err
+    }
+    if !canceled {
+        return nil, fmt.Errorf("%w: заказ в статусе %s", order.ErrInvalidOfflinePayment, o.Status)
+    }
+
+    o.Status = order.StatusCanceled
+    return o, nil
+}
+
+// MarkCanceled отменяет заказ после отмены платежа. Меняются только заказы,
+// которые еще не оплачены; второе значение сообщает, был ли заказ отменен.
+func (s *Service) MarkCanceled(paymentID string) (*order.Order, bool, error) {
+    o, err := s.repo.GetByPaymentID(paymentID)
+    if err != nil {
+        return nil, false, err
+    }
+
+    canceled, err := s.repo.Cancel(o.ID)
+    if err != nil {
+        return nil, false, err
+    }
+
+    if canceled {
+        o.Status = order.StatusCanceled
+    }
+    return o, canceled, nil
+}
+
+// MarkWaitingForCapture отмечает, что деньги по заказу захолдированы.
+// Уже оплаченные или отмененные заказы не меняются.
+func (s *Service) MarkWaitingForCapture(paymentID string, holdExpiresAt *time.Time) (*order.Order, error) {
+    o, err := s.repo.GetByPaymentID(paymentID)
+    if err != nil {
+        return nil, err
+    }
+
+    if o.Status != order.StatusPending {
+        return o, nil
+    }
+
+    if err := s.repo.SetWaitingForCapture(o.ID, holdExpiresAt); err != nil {
+        return nil, err
+    }
+
+    o.Status = order.StatusWaitingForCapture
+    o.HoldExpiresAt = holdExpiresAt
+    return o, nil
+}
+
+func (s *Service) UpdateItems(id int, items []order.Item, itemsTotal, amount float64) error {
+    return s.repo.UpdateItems(id, items, itemsTotal, amount)
+}
+
+// HasPaidProduct проверяет, покупал ли клиент товар в оплаченном заказе
+func (s *Service) HasPaidProduct(email string, productID int) (bool, error) {
+    return s.repo.HasPaidProduct(email, productID)
+}
+
+// UpdateStatus меняет статус заказа
+func (s *Service) UpdateStatus(id int, status order.Status) error {
+    return s.repo.UpdateStatus(id, status)
+}
+
+func (s *Service) AddRefund(r *order.Refund) error {
+    return s.repo.AddRefund(r)
+}
+
+func (s *Service) GetRefunds(orderID int) ([]*order.Refund, error) {
+    return s.repo.GetRefunds(orderID)
+}
+
+// ConfirmRefund отмечает возврат успешным по уведомлению платежной системы и
+// пересчитывает статус заказа по сумме всех возвратов
+func (s *Service) ConfirmRefund(r *order.Refund) (*order.Order, bool, error) {
+    created, err := s.repo.ConfirmRefund(r)
+    if err != nil {
+        return nil, false, err
+    }
+
+    o, err := s.repo.GetByID(r.OrderID)
+    if err != nil {
+        return nil, false, err
+    }
+
+    refunds, err := s.repo.GetRefunds(o.ID)
+    if err != nil {
+        return nil, false, err
+    }
+
+    refundedTotal := 0.0
+    for _, refund := range refunds {
+        if refund.Status == string(domainPayment.StatusCanceled) {
+            continue
+        }
+        refundedTotal += refund.Amount
+    }
+
+    status := order.StatusPartiallyRefunded
+    if refundedTotal >= o.AmountDue()-0.005 {
+        status = order.StatusRefunded
+    }
+    if o.Status != status {
+        if err := s.repo.UpdateStatus(o.ID, status); err != nil {
+            return nil, false, err
+        }
+        o.Status = status
+    }
+
+    return o, created, nil
+}
+
+// AddMarkingCodes сохраняет коды маркировки, отсканированные при сборке заказа
+func (s *Service) AddMarkingCodes(orderID int, codes []order.MarkingCode) error {
+    return s.repo.AddMarkingCodes(orderID, codes)
+}
+
+func (s *Service) GetMarkingCodes(orderID int) ([]*order.MarkingCode, error) {
+    return s.repo.GetMarkingCodes(orderID)
+}
+
+// Fulfill отмечает оплаченный заказ переданным покупателю. Повторная отметка
+// с тем же статусом ничего не меняет.
+func (s *Service) Fulfill(id int, status order.FulfillmentStatus) (*order.Order, error) {
+    if !status.Valid() {
+        return nil, fmt.Errorf("%w: неизвестный статус передачи %q", order.ErrInvalidFulfillment, status)
+    }
+
+    o, err := s.repo.GetByID(id)
+    if err != nil {
+        return nil, err
+    }
+    if o.FulfillmentStatus == status {
+        return o, nil
+    }
+    if o.FulfillmentStatus != "" {
+        return nil, fmt.Errorf("%w: заказ уже в статусе %s", order.ErrInvalidFulfillment, o.FulfillmentStatus)
+    }
+
+    now := time.Now()
+    updated, err := s.repo.SetFulfillment(id, status, now)
+    if err != nil {
+        return nil, err
+    }
+    if !updated {
+        return nil, fmt.Errorf("%w: заказ в статусе %s", order.ErrInvalidFulfillment, o.Status)
+    }
+
+    o.FulfillmentStatus = status
+    o.FulfilledAt = &now
+    return o, nil
+}
+
+// AddReceipt сохраняет чек в истории заказа
+func (s *Service) AddReceipt(r *order.Receipt) (bool, error) {
+    return s.repo.AddReceipt(r)
+}
+
+func (s *Service) GetReceipts(orderID int) ([]*order.Receipt, error) {
+    return s.repo.GetReceipts(orderID)
+}
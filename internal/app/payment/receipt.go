@@ -0,0 +1,210 @@
+package payment
+
+import (
+    "backend/internal/domain/order"
+    domainPayment "backend/internal/domain/payment"
+    "backend/internal/domain/product"
+    "encoding/base64"
+    "fmt"
+    "math"
+    "strconv"
+)
+
+// BuildReceiptItems формирует позиции чека 54-ФЗ по позициям заказа.
+// Доставка добавляется отдельной позицией-услугой, если deliveryCost > 0.
+// Ставка НДС и предмет расчета берутся из позиции, а если в ней не заданы -
+// из настроек магазина (payment.receipt).
+//
+// Коды маркировки становятся известны только при сборке, поэтому заказ с
+// маркированным товаром оплачивается как предоплата, а полный расчет
+// оформляется отдельным чеком после отгрузки (BuildSettlementItems).
+func (s *Service) BuildReceiptItems(items []order.Item, deliveryCost float64, currency string) []domainPayment.ReceiptItem {
+    return s.buildReceiptItems(items, deliveryCost, currency, s.ReceiptPaymentMode(items), nil)
+}
+
+// ReceiptPaymentMode возвращает способ расчета за товары в чеке оплаты заказа.
+// Если это предоплата, после передачи товара нужен чек полного расчета.
+// Подарочный сертификат всегда продается авансом; заказ из одних сертификатов
+// оплачивается авансом целиком.
+func (s *Service) ReceiptPaymentMode(items []order.Item) string {
+    goods := order.Goods(items)
+    if len(goods) == 0 {
+        return domainPayment.PaymentModeAdvance
+    }
+    if HasMarkedItems(goods) {
+        return domainPayment.PaymentModeFullPrepayment
+    }
+    return s.cfg.Receipt.PaymentMode
+}
+
+// BuildSettlementItems формирует позиции чека полного расчета после передачи
+// товара. Маркированный товар разбивается на единицы, каждой передается ее
+// код из codes (коды по ID товара).
+func (s *Service) BuildSettlementItems(items []order.Item, deliveryCost float64, currency string, codes map[int][]string) []domainPayment.ReceiptItem {
+    return s.buildReceiptItems(items, deliveryCost, currency, domainPayment.PaymentModeFullPayment, codes)
+}
+
+// HasMarkedItems сообщает, есть ли в заказе маркированный товар
+func HasMarkedItems(items []order.Item) bool {
+    for _, item := range items {
+        if item.Marked {
+            return true
+        }
+    }
+    return false
+}
+
+func (s *Service) buildReceiptItems(items []order.Item, deliveryCost float64, currency, mode string, codes map[int][]string) []domainPayment.ReceiptItem {
+    defaults := s.cfg.Receipt
+    prepayment := domainPayment.IsPrepayment(mode)
+    receiptItems := make([]domainPayment.ReceiptItem, 0, len(items)+1)
+
+    vat := func(code int) string {
+        if prepayment {
+            code = domainPayment.PrepaymentVatCode(code)
+        }
+        return strconv.Itoa(code)
+    }
+
+    for _, item := range items {
+        vatCode := item.VatCode
+        if vatCode == 0 {
+            vatCode = defaults.VatCode
+        }
+        paymentSubject := item.PaymentSubject
+        if paymentSubject == "" {
+            paymentSubject = defaults.PaymentSubject
+        }
+
+        line := domainPayment.ReceiptItem{
+            Description:    item.Name,
+            Quantity:       formatQuantity(item.Quantity),
+            Amount:         domainPayment.Amount{Value: fmt.Sprintf("%.2f", item.Price), Currency: currency},
+            VatCode:        vat(vatCode),
+            PaymentMode:    mode,
+            PaymentSubject: paymentSubject,
+            Measure:        measure(item.Unit),
+        }
+
+        // Продажа сертификата - аванс: что на него купят, еще неизвестно
+        if item.GiftCertificate {
+            line.PaymentMode = domainPayment.PaymentModeAdvance
+            line.PaymentSubject = domainPayment.PaymentSubjectPayment
+            line.VatCode = strconv.Itoa(domainPayment.PrepaymentVatCode(vatCode))
+        }
+
+        if !item.Marked || codes == nil {
+            receiptItems = append(receiptItems, line)
+            continue
+        }
+
+        // Одна позиция на единицу товара со своим кодом
+        line.Quantity = "1"
+        line.MarkMode = "0"
+        itemCodes := codes[item.ProductID]
+        units := int(math.Round(item.Quantity)) // маркированный товар - штучный
+        for i := 0; i < units && i < len(itemCodes); i++ {
+            unit := line
+            unit.MarkCodeInfo = &domainPayment.MarkCodeInfo{Gs1m: base64.StdEncoding.EncodeToString([]byte(itemCodes[i]))}
+            receiptItems = append(receiptItems, unit)
+        }
+    }
+
+    if deliveryCost > 0 {
+        receiptItems = append(receiptItems, domainPayment.ReceiptItem{
+            Description:    "Доставка",
+            Quantity:       "1",
+            Amount:         domainPayment.Amount{Value: fmt.Sprintf("%.2f", deliveryCost), Currency: currency},
+            VatCode:        vat(defaults.DeliveryVatCode),
+            PaymentMode:    mode,
+            PaymentSubject: defaults.DeliveryPaymentSubject, // Услуга, а не товар
+            Measure:        domainPayment.MeasurePiece,
+        })
+    }
+
+    return receiptItems
+}
+
+// BuildPartialPrepaymentItems формирует чек оплаты заказа, часть которого
+// оплачена подарочным сертификатом. Сертификат при продаже уже пробит авансом,
+// поэтому в чек попадает только внесенная сейчас сумма paid: она
+// распределяется по позициям пропорционально их стоимости как частичная
+// предоплата. Полный расчет с зачетом аванса и предоплаты оформляется чеком
+// при передаче товара. Каждая позиция записывается одной штукой на свою долю
+// суммы - цена единицы с количеством не сошлась бы с долей до копейки.
+func (s *Service) BuildPartialPrepaymentItems(items []order.Item, deliveryCost float64, currency string, paid float64) []domainPayment.ReceiptItem {
+    lines := s.buildReceiptItems(items, deliveryCost, currency, domainPayment.PaymentModePartialPrepayment, nil)
+
+    totals := make([]int64, len(lines))
+    var total int64
+    for i, item := range items {
+        totals[i] = int64(math.Round(item.Total() * 100))
+        if item.Quantity != 1 || measure(item.Unit) != domainPayment.MeasurePiece {
+            lines[i].Description = fmt.Sprintf("%s, %s %s", item.Name,
+                formatQuantity(item.Quantity), product.Unit(item.Unit).Title())
+        }
+    }
+    if len(lines) > len(items) {
+        totals[len(items)] = int64(math.Round(deliveryCost * 100))
+    }
+    for _, t := range totals {
+        total += t
+    }
+
+    // Доли в копейках; остаток от округления - последней позиции с запасом
+    due := int64(math.Round(paid * 100))
+    shares := make([]int64, len(lines))
+    var allocated int64
+    for i, t := range totals {
+        if total > 0 {
+            shares[i] = t * due / total
+        }
+        allocated += shares[i]
+    }
+    for i := len(shares) - 1; i >= 0 && allocated < due; i-- {
+        add := totals[i] - shares[i]
+        if add > due-allocated {
+            add = due - allocated
+        }
+        shares[i] += add
+        allocated += add
+    }
+
+    receiptItems := make([]domainPayment.ReceiptItem, 0, len(lines))
+    for i, line := range lines {
+        if shares[i] <= 0 {
+            continue
+        }
+        line.Quantity = "1"
+        line.Measure = domainPayment.MeasurePiece
+        line.Amount.Value = fmt.Sprintf("%.2f", float64(shares[i])/100)
+        receiptItems = append(receiptItems, line)
+    }
+    return receiptItems
+}
+
+// formatQuantity записывает количество для чека: до тысячных, без лишних нулей
+func formatQuantity(quantity float64) string {
+    return strconv.FormatFloat(order.RoundQuantity(quantity), 'f', -1, 64)
+}
+
+// measure переводит единицу измерения товара в меру количества чека
+func measure(unit string) string {
+    switch product.Unit(unit) {
+    case product.UnitGram:
+        return domainPayment.MeasureGram
+    case product.UnitKilogram:
+        return domainPayment.MeasureKilogram
+    }
+    return domainPayment.MeasurePiece
+}
+
+// ValidateReceiptConfig проверяет, что из настроек чеков по умолчанию
+// получаются допустимые позиции. Вызывается при запуске.
+func (s *Service) ValidateReceiptConfig() error {
+    items := s.BuildReceiptItems([]order.Item{{Name: "товар", Quantity: 1}}, 1, "RUB")
+    if err := domainPayment.ValidateReceipt(items); err != nil {
+        return fmt.Errorf("payment.receipt: %w", err)
+    }
+    return nil
+}
@@ -0,0 +1,112 @@
+package payment
+
+import (
+    "backend/config"
+    "backend/internal/domain/order"
+    domainPayment "backend/internal/domain/payment"
+    "math"
+    "strconv"
+    "testing"
+)
+
+func TestBuildPartialPrepaymentItems(t *testing.T) {
+    s := NewService(nil, nil, config.PaymentConfig{Receipt: config.ReceiptConfig{
+        VatCode:                1,
+        PaymentMode:            domainPayment.PaymentModeFullPayment,
+        PaymentSubject:         "commodity",
+        DeliveryVatCode:        1,
+        DeliveryPaymentSubject: "service",
+    }})
+
+    items := []order.Item{
+        {ProductID: 1, Quantity: 1, Price: 1000, Name: "Мед"},
+        {ProductID: 2, Quantity: 0.35, Price: 459.90, Name: "Орехи", Unit: "kg"},
+    }
+
+    tests := []struct {
+        name         string
+        items        []order.Item
+        deliveryCost float64
+        paid         float64
+        wantAmounts  []string
+    }{
+        {
+            name:         "доли пропорциональны, остаток - последней позиции",
+            items:        items,
+            deliveryCost: 300,
+            paid:         500,
+            wantAmounts:  []string{"342.23", "55.09", "102.68"},
+        },
+        {
+            name:         "оплачено все",
+            items:        items,
+            deliveryCost: 300,
+            paid:         1460.97,
+            wantAmounts:  []string{"1000.00", "160.97", "300.00"},
+        },
+        {
+            name:        "без доставки",
+            items:       items,
+            paid:        0.03,
+            wantAmounts: []string{"0.02", "0.01"},
+        },
+        {
+            name:         "позиции без доли не попадают в чек",
+            items:        items,
+            deliveryCost: 300,
+            paid:         0.01,
+            wantAmounts:  []string{"0.01"},
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := s.BuildPartialPrepaymentItems(tt.items, tt.deliveryCost, "RUB", tt.paid)
+
+            if len(got) != len(tt.wantAmounts) {
+                t.Fatalf("got %d receipt items, want %d: %+v", len(got), len(tt.wantAmounts), got)
+            }
+
+            var sum int64
+            for i, line := range got {
+                if line.Amount.Value != tt.wantAmounts[i] {
+                    t.Errorf("item %d amount = %s, want %s", i, line.Amount.Value, tt.wantAmounts[i])
+                }
+                if line.Quantity != "1" || line.Measure != domainPayment.MeasurePiece {
+                    t.Errorf("item %d quantity = %s %s, want 1 piece", i, line.Quantity, line.Measure)
+                }
+                if line.PaymentMode != domainPayment.PaymentModePartialPrepayment {
+                    t.Errorf("item %d payment mode = %s", i, line.PaymentMode)
+                }
+
+                value, err := strconv.ParseFloat(line.Amount.Value, 64)
+                if err != nil {
+                    t.Fatalf("item %d amount %q: %v", i, line.Amount.Value, err)
+                }
+                sum += int64(math.Round(value * 100))
+            }
+
+            // Сумма чека должна совпасть с платежом до копейки
+            if due := int64(math.Round(tt.paid * 100)); sum != due {
+                t.Errorf("receipt total = %d kopecks, paid %d", sum, due)
+            }
+        })
+    }
+}
+
+func TestBuildPartialPrepaymentItemsDescribesQuantity(t *testing.T) {
+    s := NewService(nil, nil, config.PaymentConfig{Receipt: config.ReceiptConfig{VatCode: 1}})
+
+    got := s.BuildPartialPrepaymentItems([]order.Item{
+        {ProductID: 1, Quantity: 1, Price: 1000, Name: "Мед"},
+        {ProductID: 2, Quantity: 0.35, Price: 459.90, Name: "Орехи", Unit: "kg"},
+    }, 0, "RUB", 100)
+
+    // Позиция записывается одной штукой, поэтому количество - в названии
+    if got[0].Description != "Мед" {
+        t.Errorf("piece item description = %q", got[0].Description)
+    }
+    if want := "Орехи, 0.35 кг"; got[1].Description != want {
+        t.Errorf("weighed item description = %q, want %q", got[1].Description, want)
+    }
+}
@@ -1,28 +1,341 @@
 package payment
 
 import (
+    "backend/config"
     domainPayment "backend/internal/domain/payment"
+    "backend/pkg/logger"
+    "context"
+    "errors"
+    "fmt"
+
+    "go.uber.org/zap"
 )
 
 type Service struct {
-    repo domainPayment.PaymentRepository // Используем интерфейс из domain
+    providers       map[string]domainPayment.Provider
+    idempotencyRepo domainPayment.IdempotencyRepository
+    cfg             config.PaymentConfig
 }
 
-// NewService теперь принимает репозиторий
-func NewService(repo domainPayment.PaymentRepository) *Service {
+// NewService принимает все настроенные платежные провайдеры. Провайдер по
+// умолчанию и резервные берутся из конфигурации.
+func NewService(providers []domainPayment.Provider, idempotencyRepo domainPayment.IdempotencyRepository, cfg config.PaymentConfig) *Service {
+    byName := make(map[string]domainPayment.Provider, len(providers))
+    for _, p := range providers {
+        byName[p.Name()] = p
+    }
+
     return &Service{
-        repo: repo,
+        providers:       byName,
+        idempotencyRepo: idempotencyRepo,
+        cfg:             cfg,
+    }
+}
+
+// DefaultProvider - имя провайдера по умолчанию
+func (s *Service) DefaultProvider() string {
+    return s.cfg.Provider
+}
+
+// HasProvider сообщает, настроен ли провайдер
+func (s *Service) HasProvider(name string) bool {
+    _, ok := s.providers[name]
+    return ok
+}
+
+// Selectable сообщает, может ли покупатель сам выбрать провайдера name:
+// это провайдер по умолчанию или подключенный провайдер из
+// cfg.SelectableProviders
+func (s *Service) Selectable(name string) bool {
+    if name == s.cfg.Provider {
+        return true
+    }
+    if !s.HasProvider(name) {
+        return false
+    }
+    for _, allowed := range s.cfg.SelectableProviders {
+        if allowed == name {
+            return true
+        }
+    }
+    return false
+}
+
+// CreatePayment создает платеж у выбранного провайдера (или у провайдера по
+// умолчанию). Если провайдер недоступен, платеж создается у резервных по
+// порядку из конфигурации. При двухстадийной схеме деньги только холдируются
+// и списываются после подтверждения менеджером.
+func (s *Service) CreatePayment(ctx context.Context, req *domainPayment.PaymentRequest) (*domainPayment.PaymentResponse, error) {
+    req.Capture = !s.cfg.TwoStage
+
+    // Чек с недопустимым сочетанием признаков касса все равно отклонит
+    if err := domainPayment.ValidateReceipt(req.ReceiptItems); err != nil {
+        return nil, err
+    }
+
+    primary := req.Provider
+    if primary == "" {
+        primary = s.cfg.Provider
+    }
+    if !s.HasProvider(primary) {
+        return nil, fmt.Errorf("%w: %s", domainPayment.ErrUnknownProvider, primary)
+    }
+
+    if err := domainPayment.ValidateConfirmation(req.ConfirmationType, req.PaymentMethodType); err != nil {
+        return nil, err
+    }
+    if !supportsConfirmation(s.providers[primary], req) {
+        return nil, fmt.Errorf("%w: %s", domainPayment.ErrConfirmationNotSupported, primary)
+    }
+
+    // Резервный провайдер подходит, только если умеет тот же сценарий
+    // подтверждения: фронтенд уже готов показать виджет или QR-код
+    candidates := []string{primary}
+    for _, name := range s.cfg.FallbackProviders {
+        if name != primary && s.HasProvider(name) && supportsConfirmation(s.providers[name], req) {
+            candidates = append(candidates, name)
+        }
+    }
+
+    var lastErr error
+    for _, name := range candidates {
+        resp, err := s.providers[name].CreatePayment(ctx, req)
+        if err == nil {
+            resp.Provider = name
+            if name != primary {
+                logger.Warn("Платеж создан у резервного провайдера",
+                    zap.String("primary", primary),
+                    zap.String("provider", name),
+                    zap.String("payment_id", resp.ID))
+            }
+            return resp, nil
+        }
+
+        lastErr = err
+        if !errors.Is(err, domainPayment.ErrProviderUnavailable) || ctx.Err() != nil {
+            return nil, err
+        }
+        logger.Error("Платежный провайдер недоступен",
+            zap.String("provider", name),
+            zap.Error(err))
+    }
+
+    return nil, lastErr
+}
+
+// supportsConfirmation сообщает, примет ли провайдер платеж с выбранным
+// сценарием подтверждения и способом оплаты
+func supportsConfirmation(p domainPayment.Provider, req *domainPayment.PaymentRequest) bool {
+    confirmation := req.ConfirmationType
+    if confirmation == "" {
+        confirmation = domainPayment.ConfirmationRedirect
+    }
+    if confirmation == domainPayment.ConfirmationRedirect && req.PaymentMethodType == "" {
+        return true
+    }
+
+    supporter, ok := p.(domainPayment.ConfirmationSupporter)
+    return ok && supporter.SupportsConfirmation(confirmation, req.PaymentMethodType)
+}
+
+func (s *Service) GetPaymentStatus(ctx context.Context, provider, paymentID string) (*domainPayment.PaymentResponse, error) {
+    p, err := s.provider(provider)
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := p.GetPaymentStatus(ctx, paymentID)
+    if err != nil {
+        return nil, err
+    }
+    resp.Provider = p.Name()
+    return resp, nil
+}
+
+func (s *Service) CancelPayment(ctx context.Context, provider, paymentID string) error {
+    p, err := s.provider(provider)
+    if err != nil {
+        return err
+    }
+    return p.CancelPayment(ctx, paymentID)
+}
+
+func (s *Service) CapturePayment(ctx context.Context, provider string, req *domainPayment.CaptureRequest) (*domainPayment.PaymentResponse, error) {
+    p, err := s.provider(provider)
+    if err != nil {
+        return nil, err
+    }
+    if err := domainPayment.ValidateReceipt(req.ReceiptItems); err != nil {
+        return nil, err
+    }
+
+    resp, err := p.CapturePayment(ctx, req)
+    if err != nil {
+        return nil, err
     }
+    resp.Provider = p.Name()
+    return resp, nil
 }
 
-func (s *Service) CreatePayment(req *domainPayment.PaymentRequest) (*domainPayment.PaymentResponse, error) {
-    return s.repo.CreatePayment(req)
+func (s *Service) Refund(ctx context.Context, provider string, req *domainPayment.RefundRequest) (*domainPayment.RefundResponse, error) {
+    p, err := s.provider(provider)
+    if err != nil {
+        return nil, err
+    }
+    if err := domainPayment.ValidateReceipt(req.ReceiptItems); err != nil {
+        return nil, err
+    }
+    return p.Refund(ctx, req)
+}
+
+// CreateReceipt регистрирует отдельный чек у провайдера, через которого
+// проведен платеж. Провайдеры без отдельных чеков возвращают ErrReceiptsNotSupported.
+func (s *Service) CreateReceipt(ctx context.Context, provider string, req *domainPayment.ReceiptRequest) (*domainPayment.ReceiptResponse, error) {
+    p, err := s.provider(provider)
+    if err != nil {
+        return nil, err
+    }
+    issuer, ok := p.(domainPayment.ReceiptIssuer)
+    if !ok {
+        return nil, fmt.Errorf("%w: %s", domainPayment.ErrReceiptsNotSupported, p.Name())
+    }
+    if err := domainPayment.ValidateReceipt(req.Items); err != nil {
+        return nil, err
+    }
+    return issuer.CreateReceipt(ctx, req)
+}
+
+// CreateRecurringPayment создает платеж подписки: первый - с сохранением
+// способа оплаты, следующие - по сохраненному способу. Сохраненный способ
+// принадлежит провайдеру, поэтому резервные провайдеры не используются, а
+// деньги списываются сразу, без холда.
+func (s *Service) CreateRecurringPayment(ctx context.Context, provider string, req *domainPayment.PaymentRequest) (*domainPayment.PaymentResponse, error) {
+    if provider == "" {
+        provider = s.cfg.Provider
+    }
+    p, err := s.provider(provider)
+    if err != nil {
+        return nil, err
+    }
+    payer, ok := p.(domainPayment.RecurringPayer)
+    if !ok {
+        return nil, fmt.Errorf("%w: %s", domainPayment.ErrRecurringNotSupported, p.Name())
+    }
+    if err := domainPayment.ValidateReceipt(req.ReceiptItems); err != nil {
+        return nil, err
+    }
+
+    req.Capture = true
+    resp, err := payer.CreateRecurringPayment(ctx, req)
+    if err != nil {
+        return nil, err
+    }
+    resp.Provider = p.Name()
+    return resp, nil
+}
+
+// SupportsRecurring сообщает, умеет ли провайдер повторные списания
+// (пусто - провайдер по умолчанию)
+func (s *Service) SupportsRecurring(provider string) bool {
+    if provider == "" {
+        provider = s.cfg.Provider
+    }
+    p, err := s.provider(provider)
+    if err != nil {
+        return false
+    }
+    _, ok := p.(domainPayment.RecurringPayer)
+    return ok
 }
 
-func (s *Service) GetPaymentStatus(paymentID string) (*domainPayment.PaymentResponse, error) {
-    return s.repo.GetPaymentStatus(paymentID)
+// ParseWebhook разбирает уведомление провайдера в нормализованное событие
+func (s *Service) ParseWebhook(provider string, body []byte) (*domainPayment.Event, error) {
+    p, err := s.provider(provider)
+    if err != nil {
+        return nil, err
+    }
+
+    event, err := p.ParseWebhook(body)
+    if err != nil || event == nil {
+        return event, err
+    }
+    // Выплаты магазин не проводит, пока они не включены в конфигурации
+    if event.Payout != nil && !s.cfg.PayoutsEnabled {
+        return nil, nil
+    }
+    event.Provider = p.Name()
+    if event.Payment != nil {
+        event.Payment.Provider = p.Name()
+    }
+    return event, nil
 }
 
-func (s *Service) CancelPayment(paymentID string) error {
-    return s.repo.CancelPayment(paymentID)
-}
\ No newline at end of file
+// WebhookAck возвращает ответ, который провайдер ожидает на уведомление
+func (s *Service) WebhookAck(provider string) (string, []byte, error) {
+    p, err := s.provider(provider)
+    if err != nil {
+        return "", nil, err
+    }
+    contentType, body := p.WebhookAck()
+    return contentType, body, nil
+}
+
+// provider возвращает провайдера по имени; пустое имя - провайдер по умолчанию
+// (платежи, созданные до появления нескольких провайдеров)
+func (s *Service) provider(name string) (domainPayment.Provider, error) {
+    if name == "" {
+        name = s.cfg.Provider
+    }
+
+    p, ok := s.providers[name]
+    if !ok {
+        return nil, fmt.Errorf("%w: %s", domainPayment.ErrUnknownProvider, name)
+    }
+    return p, nil
+}
+
+// BeginIdempotent занимает ключ идемпотентности покупателя scope. Если по
+// ключу уже создан платеж с тем же запросом, возвращает запись с Completed
+// для повтора ответа. Иначе ключ занят этим вызовом, а OrderID в записи -
+// заказ предыдущей неудачной попытки (0 - заказа еще нет).
+func (s *Service) BeginIdempotent(scope, key, requestHash string) (*domainPayment.IdempotencyRecord, error) {
+    rec, reserved, err := s.idempotencyRepo.Reserve(scope, key, requestHash)
+    if err != nil {
+        return nil, err
+    }
+    if reserved {
+        return rec, nil
+    }
+
+    if rec.RequestHash != requestHash {
+        return nil, domainPayment.ErrIdempotencyKeyReused
+    }
+    if !rec.Completed {
+        return nil, domainPayment.ErrIdempotencyInProgress
+    }
+
+    return rec, nil
+}
+
+// AttachIdempotentOrder запоминает заказ, созданный по ключу, чтобы повтор
+// запроса продолжил его
+func (s *Service) AttachIdempotentOrder(scope, key string, orderID int) error {
+    return s.idempotencyRepo.AttachOrder(scope, key, orderID)
+}
+
+// CompleteIdempotent сохраняет ответ для повторов запроса с этим ключом
+func (s *Service) CompleteIdempotent(scope, key, paymentID string, response []byte) error {
+    return s.idempotencyRepo.Complete(scope, key, paymentID, response)
+}
+
+// ReleaseIdempotent освобождает ключ, чтобы клиент мог повторить неудавшийся запрос
+func (s *Service) ReleaseIdempotent(scope, key string) error {
+    return s.idempotencyRepo.Release(scope, key)
+}
+
+// OrderIdempotenceKey - ключ идемпотентности платежной системы для платежа
+// по заказу: повторное создание платежа по тому же заказу (например, после
+// таймаута) вернет уже созданный платеж, а не спишет деньги второй раз
+func OrderIdempotenceKey(orderID int) string {
+    return fmt.Sprintf("order-%d", orderID)
+}
@@ -0,0 +1,677 @@
+package paymentevent
+
+import (
+    appCertificate "backend/internal/app/certificate"
+    appLoyalty "backend/internal/app/loyalty"
+    appOrder "backend/internal/app/order"
+    appPayment "backend/internal/app/payment"
+    appReceipt "backend/internal/app/receipt"
+    appSubscription "backend/internal/app/subscription"
+    "backend/internal/domain/order"
+    domainPayment "backend/internal/domain/payment"
+    "backend/pkg/logger"
+    "backend/pkg/smtp_sender"
+    "backend/pkg/templates"
+    "context"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "math"
+    "strconv"
+
+    "go.uber.org/zap"
+)
+
+// Service применяет события платежной системы к заказам. События приходят из
+// вебхуков и из сверки статусов и сохраняются во входящих: каждое событие
+// обрабатывается один раз, сколько бы раз оно ни пришло.
+type Service struct {
+    orderService        *appOrder.Service
+    paymentService      *appPayment.Service
+    receiptService      *appReceipt.Service
+    subscriptionService *appSubscription.Service
+    certificateService  *appCertificate.Service
+    loyaltyService      *appLoyalty.Service
+    inbox               domainPayment.InboxRepository
+    managerEmail        string
+}
+
+func NewService(orderService *appOrder.Service, paymentService *appPayment.Service, receiptService *appReceipt.Service, subscriptionService *appSubscription.Service, certificateService *appCertificate.Service, loyaltyService *appLoyalty.Service, inbox domainPayment.InboxRepository, managerEmail string) *Service {
+    return &Service{
+        orderService:        orderService,
+        paymentService:      paymentService,
+        receiptService:      receiptService,
+        subscriptionService: subscriptionService,
+        certificateService:  certificateService,
+        loyaltyService:      loyaltyService,
+        inbox:               inbox,
+        managerEmail:        managerEmail,
+    }
+}
+
+// Receive сохраняет событие во входящих и обрабатывает его, если оно еще не
+// обработано. Возвращает true, если событие обработано этим вызовом.
+// rawBody - тело уведомления как пришло (пусто для событий сверки).
+func (s *Service) Receive(ctx context.Context, event *domainPayment.Event, rawBody []byte, source string) (bool, error) {
+    payload, err := json.Marshal(event)
+    if err != nil {
+        return false, fmt.Errorf("failed to marshal event: %w", err)
+    }
+
+    rec := &domainPayment.InboxEvent{
+        Provider:  event.Provider,
+        EventType: event.Type,
+        ObjectID:  event.ObjectID(),
+        Source:    source,
+        Payload:   payload,
+        RawBody:   string(rawBody),
+    }
+    created, err := s.inbox.Save(rec)
+    if err != nil {
+        return false, err
+    }
+    if !created && rec.Status == domainPayment.InboxProcessed {
+        logger.Info("Duplicate payment event skipped",
+            zap.Int("inbox_id", rec.ID),
+            zap.String("event", string(event.Type)),
+            zap.String("object_id", rec.ObjectID),
+            zap.String("source", source))
+        return false, nil
+    }
+
+    return s.process(ctx, rec.ID, event)
+}
+
+// GetInboxEvents возвращает входящие события со статусом status
+func (s *Service) GetInboxEvents(status domainPayment.InboxStatus, limit, offset int) ([]*domainPayment.InboxEvent, error) {
+    return s.inbox.GetByStatus(status, limit, offset)
+}
+
+func (s *Service) GetInboxEvent(id int) (*domainPayment.InboxEvent, error) {
+    return s.inbox.GetByID(id)
+}
+
+// Retry повторно обрабатывает событие, которое завершилось ошибкой или было
+// отклонено. Возвращает событие с новым статусом.
+func (s *Service) Retry(ctx context.Context, id int) (*domainPayment.InboxEvent, error) {
+    rec, err := s.inbox.GetByID(id)
+    if err != nil {
+        return nil, err
+    }
+    if rec.Status == domainPayment.InboxProcessed {
+        return nil, fmt.Errorf("%w: id %d", domainPayment.ErrInboxEventProcessed, id)
+    }
+
+    var event domainPayment.Event
+    if err := json.Unmarshal(rec.Payload, &event); err != nil {
+        return nil, fmt.Errorf("failed to parse stored event %d: %w", id, err)
+    }
+
+    if _, err := s.process(ctx, rec.ID, &event); err != nil {
+        logger.Warn("Payment event retry failed", zap.Int("inbox_id", id), zap.Error(err))
+    }
+
+    return s.inbox.GetByID(id)
+}
+
+// process захватывает событие, проверяет его по API провайдера и применяет к заказу
+func (s *Service) process(ctx context.Context, inboxID int, event *domainPayment.Event) (bool, error) {
+    claimed, err := s.inbox.Claim(inboxID)
+    if err != nil {
+        return false, err
+    }
+    if !claimed {
+        // Событие уже обработано или обрабатывается параллельным запросом
+        return false, nil
+    }
+
+    verified, err := s.Verify(ctx, event)
+    if err == nil {
+        err = s.Handle(verified)
+    }
+    if err != nil {
+        status := domainPayment.InboxFailed
+        if errors.Is(err, domainPayment.ErrEventMismatch) {
+            status = domainPayment.InboxRejected
+        }
+        if markErr := s.inbox.MarkFailed(inboxID, status, err.Error()); markErr != nil {
+            logger.Error("Failed to save payment event status", zap.Int("inbox_id", inboxID), zap.Error(markErr))
+        }
+        return false, err
+    }
+
+    if err := s.inbox.MarkProcessed(inboxID); err != nil {
+        logger.Error("Failed to save payment event status", zap.Int("inbox_id", inboxID), zap.Error(err))
+    }
+    return true, nil
+}
+
+// eventStatus - статус платежа, который должен быть в API провайдера для события
+var eventStatus = map[domainPayment.EventType]domainPayment.Status{
+    domainPayment.EventPaymentSucceeded:         domainPayment.StatusSucceeded,
+    domainPayment.EventPaymentWaitingForCapture: domainPayment.StatusWaitingForCapture,
+    domainPayment.EventPaymentCanceled:          domainPayment.StatusCanceled,
+}
+
+// Verify проверяет уведомление о платеже по данным API провайдера: статус
+// платежа должен соответствовать событию, а сумма и валюта - сохраненному
+// заказу. Возвращает событие с данными платежа из API, а не из тела
+// уведомления. При расхождении возвращает ErrEventMismatch.
+func (s *Service) Verify(ctx context.Context, event *domainPayment.Event) (*domainPayment.Event, error) {
+    if event.Type == domainPayment.EventRefundSucceeded && event.Refund != nil {
+        return s.verifyRefund(ctx, event)
+    }
+
+    expected, ok := eventStatus[event.Type]
+    if !ok || event.Payment == nil {
+        return event, nil
+    }
+
+    payment, err := s.paymentService.GetPaymentStatus(ctx, event.Provider, event.PaymentID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch payment %s: %w", event.PaymentID, err)
+    }
+
+    if payment.ID != event.PaymentID {
+        return nil, fmt.Errorf("%w: payment id %s, in API %s", domainPayment.ErrEventMismatch, event.PaymentID, payment.ID)
+    }
+    if payment.Status != expected {
+        return nil, fmt.Errorf("%w: event %s, payment status %s", domainPayment.ErrEventMismatch, event.Type, payment.Status)
+    }
+
+    o, err := s.orderService.GetByPaymentID(payment.ID)
+    unattached := false
+    if errors.Is(err, order.ErrNotFound) {
+        // Если платежная система не ответила на создание платежа, платеж
+        // не привязан к заказу - заказ находится по orderId из metadata
+        o, err = s.unattachedOrder(payment)
+        unattached = err == nil
+    }
+    switch {
+    case errors.Is(err, order.ErrNotFound):
+        // Платеж, созданный до появления таблицы заказов: сверять не с чем,
+        // данные для писем берутся из metadata, полученной из API
+    case err != nil:
+        return nil, fmt.Errorf("failed to get order for payment %s: %w", payment.ID, err)
+    default:
+        amount, err := strconv.ParseFloat(payment.Amount.Value, 64)
+        if err != nil {
+            return nil, fmt.Errorf("%w: invalid amount %q", domainPayment.ErrEventMismatch, payment.Amount.Value)
+        }
+        // Часть заказа, оплаченная сертификатом, в платеж не входит
+        if math.Abs(amount-o.AmountDue()) > 0.005 {
+            return nil, fmt.Errorf("%w: amount %.2f, order %d amount due %.2f",
+                domainPayment.ErrEventMismatch, amount, o.ID, o.AmountDue())
+        }
+        if payment.Amount.Currency != o.Currency {
+            return nil, fmt.Errorf("%w: currency %s, order %d currency %s",
+                domainPayment.ErrEventMismatch, payment.Amount.Currency, o.ID, o.Currency)
+        }
+        if unattached {
+            if err := s.orderService.AttachPayment(o.ID, payment.Provider, payment.ID); err != nil {
+                return nil, fmt.Errorf("failed to attach payment %s to order %d: %w", payment.ID, o.ID, err)
+            }
+            logger.Warn("Платеж привязан к заказу по metadata",
+                zap.Int("order_id", o.ID),
+                zap.String("payment_id", payment.ID))
+        }
+    }
+
+    // Не все провайдеры возвращают срок холда при запросе статуса
+    if payment.ExpiresAt == nil {
+        payment.ExpiresAt = event.Payment.ExpiresAt
+    }
+
+    verified := *event
+    verified.Payment = payment
+    return &verified, nil
+}
+
+// unattachedOrder возвращает ожидающий оплаты заказ без платежа, номер
+// которого указан в metadata платежа. Иначе возвращает order.ErrNotFound.
+func (s *Service) unattachedOrder(payment *domainPayment.PaymentResponse) (*order.Order, error) {
+    var orderID int
+    switch v := payment.Metadata["orderId"].(type) {
+    case string:
+        orderID, _ = strconv.Atoi(v)
+    case float64:
+        orderID = int(v)
+    }
+    if orderID == 0 {
+        return nil, order.ErrNotFound
+    }
+
+    o, err := s.orderService.GetByID(orderID)
+    if err != nil {
+        return nil, err
+    }
+    if o.PaymentID != "" || o.Status != order.StatusPending {
+        return nil, order.ErrNotFound
+    }
+    return o, nil
+}
+
+// verifyRefund проверяет уведомление о возврате: платеж должен быть в API
+// провайдера и принадлежать заказу, сумма возврата - не больше суммы платежа,
+// валюта - совпадать с заказом
+func (s *Service) verifyRefund(ctx context.Context, event *domainPayment.Event) (*domainPayment.Event, error) {
+    refund := event.Refund
+    if refund.Status != domainPayment.StatusSucceeded {
+        return nil, fmt.Errorf("%w: event %s, refund status %s", domainPayment.ErrEventMismatch, event.Type, refund.Status)
+    }
+
+    payment, err := s.paymentService.GetPaymentStatus(ctx, event.Provider, refund.PaymentID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to fetch payment %s: %w", refund.PaymentID, err)
+    }
+    if payment.ID != refund.PaymentID {
+        return nil, fmt.Errorf("%w: payment id %s, in API %s", domainPayment.ErrEventMismatch, refund.PaymentID, payment.ID)
+    }
+    // Возврат возможен только по проведенному платежу
+    if payment.Status != domainPayment.StatusSucceeded {
+        return nil, fmt.Errorf("%w: refund for payment in status %s", domainPayment.ErrEventMismatch, payment.Status)
+    }
+
+    o, err := s.orderService.GetByPaymentID(payment.ID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get order for payment %s: %w", payment.ID, err)
+    }
+
+    refund, err = s.resolveRefundAmount(o, refund)
+    if err != nil {
+        return nil, err
+    }
+
+    amount, err := strconv.ParseFloat(refund.Amount.Value, 64)
+    if err != nil {
+        return nil, fmt.Errorf("%w: invalid refund amount %q", domainPayment.ErrEventMismatch, refund.Amount.Value)
+    }
+    if amount <= 0 {
+        return nil, fmt.Errorf("%w: refund amount %.2f", domainPayment.ErrEventMismatch, amount)
+    }
+    if amount > o.AmountDue()+0.005 {
+        return nil, fmt.Errorf("%w: refund amount %.2f, order %d amount due %.2f",
+            domainPayment.ErrEventMismatch, amount, o.ID, o.AmountDue())
+    }
+    if refund.Amount.Currency != o.Currency {
+        return nil, fmt.Errorf("%w: refund currency %s, order %d currency %s",
+            domainPayment.ErrEventMismatch, refund.Amount.Currency, o.ID, o.Currency)
+    }
+
+    verified := *event
+    verified.Payment = payment
+    verified.Refund = refund
+    return &verified, nil
+}
+
+// resolveRefundAmount заполняет сумму возврата, если провайдер сообщил только
+// остаток платежа: для уже сохраненного возврата берется его сумма, для
+// нового - оплаченное за вычетом остатка и других возвратов
+func (s *Service) resolveRefundAmount(o *order.Order, refund *domainPayment.RefundResponse) (*domainPayment.RefundResponse, error) {
+    if refund.Remaining == nil {
+        return refund, nil
+    }
+
+    remaining, err := strconv.ParseFloat(refund.Remaining.Value, 64)
+    if err != nil {
+        return nil, fmt.Errorf("%w: invalid remaining amount %q", domainPayment.ErrEventMismatch, refund.Remaining.Value)
+    }
+
+    refunds, err := s.orderService.GetRefunds(o.ID)
+    if err != nil {
+        return nil, fmt.Errorf("failed to get refunds for order %d: %w", o.ID, err)
+    }
+
+    amount := o.AmountDue() - remaining
+    for _, r := range refunds {
+        if r.RefundID == refund.ID {
+            amount = r.Amount
+            break
+        }
+        if r.Status == string(domainPayment.StatusCanceled) {
+            continue
+        }
+        amount -= r.Amount
+    }
+
+    resolved := *refund
+    resolved.Amount = domainPayment.Amount{
+        Value:    fmt.Sprintf("%.2f", math.Round(amount*100)/100),
+        Currency: refund.Remaining.Currency,
+    }
+    return &resolved, nil
+}
+
+// Handle обрабатывает событие. Неизвестные типы событий игнорируются.
+func (s *Service) Handle(event *domainPayment.Event) error {
+    switch event.Type {
+    case domainPayment.EventPaymentSucceeded:
+        return s.handleSucceeded(event.Payment)
+    case domainPayment.EventPaymentWaitingForCapture:
+        return s.handleWaitingForCapture(event.Payment)
+    case domainPayment.EventPaymentCanceled:
+        return s.handleCanceled(event.Payment)
+    case domainPayment.EventRefundSucceeded:
+        return s.handleRefundSucceeded(event.Refund, event.Payment)
+    case domainPayment.EventPayoutSucceeded, domainPayment.EventPayoutCanceled:
+        return s.handlePayout(event.Type, event.Payout)
+    }
+    return nil
+}
+
+func (s *Service) handleSucceeded(payment *domainPayment.PaymentResponse) error {
+    paymentID := payment.ID
+
+    // Отмечаем заказ оплаченным. Платежи, созданные до появления таблицы
+    // заказов, в ней отсутствуют - для них данные берутся из metadata.
+    o, _, err := s.orderService.MarkPaid(paymentID)
+    if err != nil && !errors.Is(err, order.ErrNotFound) {
+        return fmt.Errorf("failed to mark order as paid: %w", err)
+    }
+
+    // Платеж прошел после отмены заказа: товары уже вернулись в остатки,
+    // сертификат и бонусы - покупателю. Обычные шаги после оплаты не
+    // выполняются, деньги возвращает менеджер.
+    if o != nil && o.Status == order.StatusCanceled {
+        s.handlePaidAfterCancel(o, payment)
+        return nil
+    }
+
+    if o != nil {
+        // Чек оплаты регистрируется вместе с платежом - фиксируем его в истории
+        if err := s.receiptService.RecordPayment(o, payment); err != nil {
+            return fmt.Errorf("failed to record payment receipt: %w", err)
+        }
+        // Списываем зарезервированный сертификат и выпускаем купленные
+        if err := s.certificateService.HandlePaid(o); err != nil {
+            return fmt.Errorf("failed to handle gift certificates: %w", err)
+        }
+    }
+
+    // Начисляем бонусы за заказ; повтор события второй раз не начислит
+    var earning *appLoyalty.Earning
+    if o != nil {
+        if earning, err = s.loyaltyService.Earn(o); err != nil {
+            return fmt.Errorf("failed to earn bonus points: %w", err)
+        }
+    }
+
+    // Оплата периода подписки продлевает ее и сохраняет способ оплаты
+    if _, err := s.subscriptionService.HandlePayment(payment); err != nil {
+        return fmt.Errorf("failed to renew subscription: %w", err)
+    }
+
+    var data templates.OrderData
+    if o != nil {
+        data = orderDataFromOrder(o, payment)
+        if earning != nil {
+            data.BonusEarned = earning.Earned
+            data.BonusBalance = earning.Balance
+            data.BonusURL = earning.URL
+        }
+    } else {
+        var ok bool
+        data, ok = orderDataFromMetadata(payment)
+        if !ok {
+            return fmt.Errorf("invalid metadata format in payment %s", paymentID)
+        }
+    }
+
+    // Отправляем письма в горутине (асинхронно)
+    go func() {
+        err := smtp_sender.SendOrderEmails(data, s.managerEmail)
+        if err != nil {
+            logger.Error("Failed to send order emails",
+                zap.Error(err),
+                zap.String("client_email", data.Email),
+                zap.String("payment_id", paymentID))
+        } else {
+            logger.Info("Order emails sent successfully",
+                zap.String("client_email", data.Email),
+                zap.String("payment_id", paymentID))
+        }
+    }()
+
+    return nil
+}
+
+// handlePaidAfterCancel сообщает менеджеру об оплате отмененного заказа
+func (s *Service) handlePaidAfterCancel(o *order.Order, payment *domainPayment.PaymentResponse) {
+    logger.Error("Payment succeeded for canceled order",
+        zap.Int("order_id", o.ID),
+        zap.String("payment_id", payment.ID),
+        zap.String("amount", payment.Amount.Value))
+
+    subject := fmt.Sprintf("Оплачен отмененный заказ №%d", o.ID)
+    body := fmt.Sprintf("Платеж %s на сумму %s %s прошел после отмены заказа №%d (%s). "+
+        "Товары возвращены в остатки, сертификат и бонусы - покупателю. "+
+        "Верните платеж в личном кабинете платежной системы или оформите заказ заново.",
+        payment.ID, payment.Amount.Value, payment.Amount.Currency, o.ID, o.Email)
+
+    go func() {
+        if err := smtp_sender.SendEmail(s.managerEmail, subject, body, false); err != nil {
+            logger.Error("Failed to send paid after cancel email", zap.Error(err), zap.Int("order_id", o.ID))
+        }
+    }()
+}
+
+// handleWaitingForCapture отмечает, что деньги захолдированы и заказ ждет
+// подтверждения менеджером
+func (s *Service) handleWaitingForCapture(payment *domainPayment.PaymentResponse) error {
+    o, err := s.orderService.MarkWaitingForCapture(payment.ID, payment.ExpiresAt)
+    if err != nil {
+        return fmt.Errorf("failed to mark order as waiting for capture: %w", err)
+    }
+
+    logger.Info("Payment is waiting for capture",
+        zap.Int("order_id", o.ID),
+        zap.String("payment_id", payment.ID),
+        zap.Timep("hold_expires_at", payment.ExpiresAt))
+    return nil
+}
+
+// handleCanceled отменяет заказ, который так и не был оплачен
+func (s *Service) handleCanceled(payment *domainPayment.PaymentResponse) error {
+    o, canceled, err := s.orderService.MarkCanceled(payment.ID)
+    if err != nil {
+        if errors.Is(err, order.ErrNotFound) {
+            return nil
+        }
+        return fmt.Errorf("failed to cancel order: %w", err)
+    }
+    if canceled {
+        if err := s.certificateService.Release(o.ID); err != nil {
+            return fmt.Errorf("failed to release gift certificate: %w", err)
+        }
+        if err := s.loyaltyService.Restore(o); err != nil {
+            return fmt.Errorf("failed to restore bonus points: %w", err)
+        }
+    }
+
+    // Неудачное автосписание: подписка уходит на повтор или отменяется,
+    // письмо покупателю отправляет сервис подписок
+    notified, err := s.subscriptionService.HandlePayment(payment)
+    if err != nil {
+        return fmt.Errorf("failed to update subscription: %w", err)
+    }
+
+    if !canceled || notified {
+        return nil
+    }
+
+    reason := ""
+    if payment.CancellationDetails != nil {
+        reason = payment.CancellationDetails.Reason
+    }
+    logger.Info("Payment canceled, order canceled",
+        zap.Int("order_id", o.ID),
+        zap.String("payment_id", payment.ID),
+        zap.String("reason", reason))
+
+    data := orderDataFromOrder(o, payment)
+    go func() {
+        if err := smtp_sender.SendCancellationEmail(data, reason); err != nil {
+            logger.Error("Failed to send cancellation email",
+                zap.Error(err),
+                zap.String("client_email", data.Email),
+                zap.String("payment_id", payment.ID))
+        }
+    }()
+    return nil
+}
+
+// handleRefundSucceeded отмечает возврат успешным и пересчитывает статус
+// заказа. Возврат, оформленный в личном кабинете платежной системы, в заказе
+// еще не записан - он сохраняется по уведомлению.
+func (s *Service) handleRefundSucceeded(refund *domainPayment.RefundResponse, payment *domainPayment.PaymentResponse) error {
+    o, err := s.orderService.GetByPaymentID(refund.PaymentID)
+    if err != nil {
+        return fmt.Errorf("failed to get order for payment %s: %w", refund.PaymentID, err)
+    }
+
+    amount, err := strconv.ParseFloat(refund.Amount.Value, 64)
+    if err != nil {
+        return fmt.Errorf("invalid refund amount %q: %w", refund.Amount.Value, err)
+    }
+
+    confirmed := &order.Refund{
+        OrderID:  o.ID,
+        RefundID: refund.ID,
+        Amount:   amount,
+        Reason:   "Возврат оформлен в личном кабинете платежной системы",
+        Status:   string(domainPayment.StatusSucceeded),
+    }
+    o, created, err := s.orderService.ConfirmRefund(confirmed)
+    if err != nil {
+        return fmt.Errorf("failed to confirm refund: %w", err)
+    }
+
+    // Пересчитываем бонусы пропорционально возвращенной сумме; для возврата,
+    // оформленного через API, берется сохраненная сумма
+    if err := s.loyaltyService.HandleRefund(o, refund.ID, confirmed.Amount); err != nil {
+        return fmt.Errorf("failed to update bonus points: %w", err)
+    }
+
+    logger.Info("Refund succeeded",
+        zap.Int("order_id", o.ID),
+        zap.String("refund_id", refund.ID),
+        zap.String("amount", refund.Amount.Value),
+        zap.Bool("external", created),
+        zap.String("order_status", string(o.Status)))
+
+    data := orderDataFromOrder(o, payment)
+    go func() {
+        if err := smtp_sender.SendRefundEmail(data, refund.Amount.Value); err != nil {
+            logger.Error("Failed to send refund email",
+                zap.Error(err),
+                zap.String("client_email", data.Email),
+                zap.String("refund_id", refund.ID))
+        }
+    }()
+    return nil
+}
+
+// handlePayout сообщает менеджеру о проведенной или отмененной выплате.
+// С заказами выплаты не связаны.
+func (s *Service) handlePayout(eventType domainPayment.EventType, payout *domainPayment.PayoutResponse) error {
+    if payout == nil {
+        return nil
+    }
+
+    logger.Info("Payout event",
+        zap.String("event", string(eventType)),
+        zap.String("payout_id", payout.ID),
+        zap.String("amount", payout.Amount.Value))
+
+    subject := "Выплата проведена"
+    body := fmt.Sprintf("Выплата %s на сумму %s %s проведена.", payout.ID, payout.Amount.Value, payout.Amount.Currency)
+    if eventType == domainPayment.EventPayoutCanceled {
+        subject = "Выплата отменена"
+        reason := ""
+        if payout.CancellationDetails != nil {
+            reason = payout.CancellationDetails.Reason
+        }
+        body = fmt.Sprintf("Выплата %s на сумму %s %s отменена. Причина: %s.",
+            payout.ID, payout.Amount.Value, payout.Amount.Currency, reason)
+    }
+
+    go func() {
+        if err := smtp_sender.SendEmail(s.managerEmail, subject, body, false); err != nil {
+            logger.Error("Failed to send payout email", zap.Error(err), zap.String("payout_id", payout.ID))
+        }
+    }()
+    return nil
+}
+
+// orderDataFromOrder формирует данные письма по сохраненному заказу
+func orderDataFromOrder(o *order.Order, payment *domainPayment.PaymentResponse) templates.OrderData {
+    cartItems := make([]templates.CartItem, len(o.Items))
+    for i, item := range o.Items {
+        cartItems[i] = templates.CartItem{
+            ProductID:       item.ProductID,
+            Quantity:        item.Quantity,
+            Price:           item.Price,
+            Name:            item.Name,
+            Unit:            item.Unit,
+            GiftCertificate: item.GiftCertificate,
+        }
+    }
+
+    return templates.OrderData{
+        CustomerName:      o.CustomerName,
+        Email:             o.Email,
+        Phone:             o.Phone,
+        DeliveryType:      o.DeliveryType,
+        DeliveryAddress:   o.DeliveryAddress,
+        Comment:           o.Comment,
+        PaymentID:         payment.ID,
+        Amount:            fmt.Sprintf("%.2f", o.Amount),
+        Currency:          o.Currency,
+        Description:       payment.Description,
+        CartItems:         cartItems,
+        CertificateAmount: o.CertificateAmount,
+        BonusSpent:        o.BonusAmount,
+    }
+}
+
+// orderDataFromMetadata формирует данные письма по metadata платежа
+// (для платежей, созданных до появления таблицы заказов)
+func orderDataFromMetadata(payment *domainPayment.PaymentResponse) (templates.OrderData, bool) {
+    metadata := payment.Metadata
+    if metadata == nil {
+        return templates.OrderData{}, false
+    }
+
+    // БЕЗОПАСНОЕ ИЗВЛЕЧЕНИЕ ДАННЫХ
+    email, _ := metadata["email"].(string)
+    customerName, _ := metadata["customerName"].(string)
+    phone, _ := metadata["phone"].(string)
+    deliveryType, _ := metadata["deliveryType"].(string)
+    deliveryAddress, _ := metadata["deliveryAddress"].(string)
+    comment, _ := metadata["comment"].(string)
+    cartItemsJSON, _ := metadata["cartItems"].(string)
+
+    // Парсим JSON с товарами
+    var cartItems []templates.CartItem
+    if cartItemsJSON != "" {
+        if err := json.Unmarshal([]byte(cartItemsJSON), &cartItems); err != nil {
+            logger.Error("Failed to parse cart items", zap.Error(err))
+            // Продолжаем обработку даже если не удалось распарсить товары
+            cartItems = []templates.CartItem{}
+        }
+    }
+
+    return templates.OrderData{
+        CustomerName:    customerName,
+        Email:           email,
+        Phone:           phone,
+        DeliveryType:    deliveryType,
+        DeliveryAddress: deliveryAddress,
+        Comment:         comment,
+        PaymentID:       payment.ID,
+        Amount:          payment.Amount.Value,
+        Currency:        payment.Amount.Currency,
+        Description:     payment.Description,
+        CartItems:       cartItems,
+    }, true
+}
@@ -3,7 +3,12 @@ package product
 import 
 (
 	"backend/internal/domain/product"
-	// "errors"
+	"backend/pkg/logger"
+	"backend/pkg/slug"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
 )
 
 // Service содержит бизнес-логику работы с пользователями.
@@ -19,10 +24,113 @@ func (s *Service) GetAllProducts() ([]*product.Product, error) {
     return s.repo.GetAll()
 }
 
+// FindProducts возвращает товары каталога, подходящие под фильтр
+func (s *Service) FindProducts(filter product.Filter) ([]*product.Product, error) {
+    for _, c := range filter.Certifications {
+        if !c.Valid() {
+            return nil, fmt.Errorf("%w: неизвестный сертификат %q", product.ErrInvalidFilter, c)
+        }
+    }
+    for _, a := range filter.ExcludeAllergens {
+        if !a.Valid() {
+            return nil, fmt.Errorf("%w: неизвестный аллерген %q", product.ErrInvalidFilter, a)
+        }
+    }
+
+    return s.repo.Find(filter)
+}
+
 func (s *Service) GetByIdProducts(id int) (*product.Product, error) {
     return s.repo.GetByID(id)
 }
 
 func (s *Service) GetProductByID(id int) (*product.Product, error) {
     return s.repo.GetByID(id)
-}
\ No newline at end of file
+}
+
+// GetCategories возвращает категории каталога с заполненными slug
+func (s *Service) GetCategories() ([]*product.Category, error) {
+    categories, err := s.repo.GetCategories()
+    if err != nil {
+        return nil, err
+    }
+
+    for _, c := range categories {
+        c.Slug = slug.Make(c.Name)
+        if c.Slug == "" {
+            c.Slug = fmt.Sprintf("category-%d", c.ID)
+        }
+    }
+
+    return categories, nil
+}
+
+// GetBySlug возвращает товар по slug. Если slug устарел, возвращается
+// актуальный slug товара, и product == nil - вызывающий код делает редирект.
+func (s *Service) GetBySlug(productSlug string) (p *product.Product, redirectSlug string, err error) {
+    p, err = s.repo.GetBySlug(productSlug)
+    if err == nil {
+        return p, "", nil
+    }
+    if !errors.Is(err, product.ErrNotFound) {
+        return nil, "", err
+    }
+
+    redirectSlug, err = s.repo.GetSlugRedirect(productSlug)
+    if err != nil {
+        return nil, "", err
+    }
+
+    return nil, redirectSlug, nil
+}
+
+// SyncSlugs назначает slug товарам без него и тем, у которых изменилось
+// название. Старый slug сохраняется в истории для редиректа.
+func (s *Service) SyncSlugs() error {
+    products, err := s.repo.GetAll()
+    if err != nil {
+        return err
+    }
+
+    for _, p := range products {
+        base := slug.Make(p.Title)
+        if base == "" {
+            base = fmt.Sprintf("product-%d", p.ID)
+        }
+
+        if p.Slug != "" && slug.HasBase(p.Slug, base) {
+            continue
+        }
+
+        newSlug, err := s.uniqueSlug(base, p.ID)
+        if err != nil {
+            return err
+        }
+
+        if err := s.repo.UpdateSlug(p.ID, newSlug, p.Slug); err != nil {
+            return err
+        }
+
+        logger.Info("Товару назначен новый slug",
+            zap.Int("product_id", p.ID),
+            zap.String("old_slug", p.Slug),
+            zap.String("new_slug", newSlug))
+    }
+
+    return nil
+}
+
+// uniqueSlug подбирает свободный slug, добавляя числовой суффикс при совпадении
+func (s *Service) uniqueSlug(base string, productID int) (string, error) {
+    candidate := base
+    for i := 2; ; i++ {
+        taken, err := s.repo.IsSlugTaken(candidate, productID)
+        if err != nil {
+            return "", err
+        }
+        if !taken {
+            return candidate, nil
+        }
+        candidate = fmt.Sprintf("%s-%d", base, i)
+    }
+}
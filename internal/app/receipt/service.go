@@ -0,0 +1,421 @@
+package receipt
+
+import (
+    appOrder "backend/internal/app/order"
+    appPayment "backend/internal/app/payment"
+    "backend/internal/domain/order"
+    domainPayment "backend/internal/domain/payment"
+    "backend/pkg/logger"
+    "context"
+    "errors"
+    "fmt"
+    "math"
+    "strings"
+
+    "go.uber.org/zap"
+)
+
+// Service ведет чеки 54-ФЗ по заказу. При онлайн-оплате до передачи товара
+// пробивается чек предоплаты, а когда заказ доставлен или получен в пункте
+// выдачи - чек полного расчета, которым предоплата зачитывается. В чек полного
+// расчета попадают коды маркировки, отсканированные при сборке. Подарочные
+// сертификаты продаются авансом и в чек полного расчета не попадают, а
+// потраченный сертификат зачитывается в нем вместе с предоплатой.
+type Service struct {
+    orderService   *appOrder.Service
+    paymentService *appPayment.Service
+}
+
+func NewService(orderService *appOrder.Service, paymentService *appPayment.Service) *Service {
+    return &Service{
+        orderService:   orderService,
+        paymentService: paymentService,
+    }
+}
+
+// RecordPayment сохраняет в истории заказа чек, зарегистрированный вместе с
+// платежом. Повторный вызов ничего не меняет.
+func (s *Service) RecordPayment(o *order.Order, payment *domainPayment.PaymentResponse) error {
+    kind := order.ReceiptPayment
+    // Часть заказа, оплаченная сертификатом, - всегда частичная предоплата
+    if o.CertificateAmount > 0 || domainPayment.IsPrepayment(s.paymentService.ReceiptPaymentMode(o.Items)) {
+        kind = order.ReceiptPrepayment
+    }
+
+    receipt := &order.Receipt{
+        OrderID: o.ID,
+        Kind:    kind,
+        Amount:  o.AmountDue(),
+        Status:  payment.ReceiptRegistration,
+    }
+    created, err := s.orderService.AddReceipt(receipt)
+    if err != nil {
+        return err
+    }
+
+    if created {
+        logger.Info("Чек оплаты добавлен в историю заказа",
+            zap.Int("order_id", o.ID),
+            zap.String("kind", string(kind)))
+    }
+    return nil
+}
+
+// Fulfill отмечает заказ переданным покупателю и, если при оплате была
+// предоплата, отправляет чек полного расчета. Если чек отправить не удалось,
+// заказ остается переданным, а запрос можно повторить.
+func (s *Service) Fulfill(ctx context.Context, orderID int, status order.FulfillmentStatus) (*order.Order, error) {
+    o, err := s.orderService.Fulfill(orderID, status)
+    if err != nil {
+        return nil, err
+    }
+
+    logger.Info("Заказ передан покупателю",
+        zap.Int("order_id", o.ID),
+        zap.String("fulfillment_status", string(status)))
+
+    receipts, err := s.orderService.GetReceipts(o.ID)
+    if err != nil {
+        return nil, err
+    }
+    if !s.settlementRequired(o, receipts) {
+        return o, nil
+    }
+
+    if _, err := s.issueSettlement(ctx, o); err != nil {
+        return nil, err
+    }
+    return o, nil
+}
+
+// GetReceipts возвращает историю чеков заказа
+func (s *Service) GetReceipts(orderID int) ([]*order.Receipt, error) {
+    if _, err := s.orderService.GetByID(orderID); err != nil {
+        return nil, err
+    }
+    return s.orderService.GetReceipts(orderID)
+}
+
+// AddMarkingCodes проверяет и сохраняет коды маркировки заказа. Код
+// принимается только для маркированного товара из заказа, и кодов товара не
+// может быть больше, чем единиц в заказе. Повторно отсканированный код
+// пропускается. Возвращает все коды заказа.
+func (s *Service) AddMarkingCodes(orderID int, codes []order.MarkingCode) ([]*order.MarkingCode, error) {
+    o, err := s.orderService.GetByID(orderID)
+    if err != nil {
+        return nil, err
+    }
+    if o.Status != order.StatusPaid && o.Status != order.StatusPartiallyRefunded {
+        return nil, fmt.Errorf("%w: заказ в статусе %s", order.ErrInvalidMarkingCode, o.Status)
+    }
+
+    existing, err := s.orderService.GetMarkingCodes(orderID)
+    if err != nil {
+        return nil, err
+    }
+
+    quantities := markedQuantities(o.Items)
+    seen := make(map[string]bool, len(existing))
+    counts := make(map[int]int)
+    for _, code := range existing {
+        seen[code.Code] = true
+        counts[code.ProductID]++
+    }
+
+    added := make([]order.MarkingCode, 0, len(codes))
+    for _, code := range codes {
+        code.Code = strings.TrimSpace(code.Code)
+        if code.Code == "" {
+            return nil, fmt.Errorf("%w: пустой код", order.ErrInvalidMarkingCode)
+        }
+        if seen[code.Code] {
+            continue
+        }
+        quantity, ok := quantities[code.ProductID]
+        if !ok {
+            return nil, fmt.Errorf("%w: товар %d не требует маркировки или отсутствует в заказе",
+                order.ErrInvalidMarkingCode, code.ProductID)
+        }
+        if counts[code.ProductID] >= quantity {
+            return nil, fmt.Errorf("%w: для товара %d уже есть коды на все %d шт.",
+                order.ErrInvalidMarkingCode, code.ProductID, quantity)
+        }
+
+        seen[code.Code] = true
+        counts[code.ProductID]++
+        added = append(added, code)
+    }
+
+    if len(added) > 0 {
+        if err := s.orderService.AddMarkingCodes(orderID, added); err != nil {
+            return nil, err
+        }
+    }
+
+    return s.orderService.GetMarkingCodes(orderID)
+}
+
+// GetMarkingCodes возвращает коды маркировки заказа
+func (s *Service) GetMarkingCodes(orderID int) ([]*order.MarkingCode, error) {
+    if _, err := s.orderService.GetByID(orderID); err != nil {
+        return nil, err
+    }
+    return s.orderService.GetMarkingCodes(orderID)
+}
+
+// IssueSettlement повторно отправляет чек полного расчета по переданному
+// заказу, если при передаче его отправить не удалось
+func (s *Service) IssueSettlement(ctx context.Context, orderID int) (*order.Receipt, error) {
+    o, err := s.orderService.GetByID(orderID)
+    if err != nil {
+        return nil, err
+    }
+    if o.FulfillmentStatus == "" {
+        return nil, fmt.Errorf("%w: заказ еще не передан покупателю", order.ErrSettlementNotAllowed)
+    }
+
+    receipts, err := s.orderService.GetReceipts(o.ID)
+    if err != nil {
+        return nil, err
+    }
+    if order.Settled(receipts) {
+        return nil, fmt.Errorf("%w: чек уже оформлен", order.ErrSettlementNotAllowed)
+    }
+    if !s.settlementRequired(o, receipts) {
+        return nil, fmt.Errorf("%w: полный расчет уже отражен в чеке оплаты", order.ErrSettlementNotAllowed)
+    }
+
+    return s.issueSettlement(ctx, o)
+}
+
+// settlementRequired сообщает, что при оплате был пробит чек предоплаты и
+// он еще не зачтен. Для заказов, оплаченных до появления истории чеков,
+// способ расчета определяется по текущим настройкам. При оплате при получении
+// предоплаты нет: сразу оформляется чек полного расчета.
+func (s *Service) settlementRequired(o *order.Order, receipts []*order.Receipt) bool {
+    if o.Offline() || len(order.Goods(o.Items)) == 0 {
+        return false
+    }
+    // Сертификат зачитывается только чеком полного расчета
+    if o.CertificateAmount > 0 {
+        return !order.Settled(receipts)
+    }
+    for _, r := range receipts {
+        switch r.Kind {
+        case order.ReceiptSettlement, order.ReceiptPayment:
+            return false
+        case order.ReceiptPrepayment:
+            return !order.Settled(receipts)
+        }
+    }
+    return domainPayment.IsPrepayment(s.paymentService.ReceiptPaymentMode(o.Items))
+}
+
+// IssueOfflinePayment отправляет чек полного расчета по заказу, оплаченному
+// при получении, через провайдера по умолчанию. Если провайдер такой чек не
+// регистрирует (ЮKassa и наличные), чек записывается в историю со статусом
+// manual - его пробивает касса курьера или пункта выдачи. Если чек уже
+// оформлен, возвращает nil.
+func (s *Service) IssueOfflinePayment(ctx context.Context, o *order.Order) (*order.Receipt, error) {
+    if !o.OfflineMethod.Valid() {
+        return nil, fmt.Errorf("%w: оплата при получении не отмечена", order.ErrSettlementNotAllowed)
+    }
+
+    receipts, err := s.orderService.GetReceipts(o.ID)
+    if err != nil {
+        return nil, err
+    }
+    for _, r := range receipts {
+        if r.Kind == order.ReceiptPayment {
+            return nil, nil
+        }
+    }
+
+    settlementType := domainPayment.SettlementCashless
+    if o.OfflineMethod == order.OfflineCash {
+        settlementType = domainPayment.SettlementCash
+    }
+    return s.issueFullPayment(ctx, o, fullPayment{
+        kind:           order.ReceiptPayment,
+        settlementType: settlementType,
+        idempotenceKey: fmt.Sprintf("offline-payment-%d", o.ID),
+        manual:         true,
+    })
+}
+
+// issueSettlement отправляет чек полного расчета, которым зачитывается
+// предоплата, внесенная онлайн
+func (s *Service) issueSettlement(ctx context.Context, o *order.Order) (*order.Receipt, error) {
+    return s.issueFullPayment(ctx, o, fullPayment{
+        provider:       o.Provider,
+        paymentID:      o.PaymentID,
+        kind:           order.ReceiptSettlement,
+        settlementType: domainPayment.SettlementPrepayment,
+        idempotenceKey: fmt.Sprintf("settlement-%d", o.ID),
+    })
+}
+
+// fullPayment - параметры чека полного расчета. Пустой provider - провайдер
+// по умолчанию; paymentID пуст, если платеж прошел мимо платежной системы.
+// manual - чек, который провайдер не регистрирует, можно пробить на кассе.
+type fullPayment struct {
+    provider       string
+    paymentID      string
+    kind           order.ReceiptKind
+    settlementType string
+    idempotenceKey string
+    manual         bool
+}
+
+// issueFullPayment отправляет чек полного расчета на то, что осталось в заказе
+// после возвратов, и сохраняет его в истории заказа
+func (s *Service) issueFullPayment(ctx context.Context, o *order.Order, p fullPayment) (*order.Receipt, error) {
+    if o.Status != order.StatusPaid && o.Status != order.StatusPartiallyRefunded {
+        return nil, fmt.Errorf("%w: заказ в статусе %s", order.ErrSettlementNotAllowed, o.Status)
+    }
+
+    items, deliveryCost, err := s.remainingItems(o)
+    if err != nil {
+        return nil, err
+    }
+    items = order.Goods(items)
+
+    amount := deliveryCost
+    for _, item := range items {
+        amount += item.Total()
+    }
+    amount = roundAmount(amount)
+    if amount <= 0 {
+        return nil, fmt.Errorf("%w: заказ возвращен полностью", order.ErrSettlementNotAllowed)
+    }
+
+    markingCodes, err := s.orderService.GetMarkingCodes(o.ID)
+    if err != nil {
+        return nil, err
+    }
+    codes := make(map[int][]string)
+    for _, code := range markingCodes {
+        codes[code.ProductID] = append(codes[code.ProductID], code.Code)
+    }
+    for productID, quantity := range markedQuantities(items) {
+        if len(codes[productID]) < quantity {
+            return nil, fmt.Errorf("%w: для товара %d отсканировано %d кодов из %d",
+                order.ErrSettlementNotAllowed, productID, len(codes[productID]), quantity)
+        }
+    }
+
+    resp, err := s.paymentService.CreateReceipt(ctx, p.provider, &domainPayment.ReceiptRequest{
+        Type:      domainPayment.ReceiptTypePayment,
+        PaymentID: p.paymentID,
+        Email:     o.Email,
+        Items:     s.paymentService.BuildSettlementItems(items, deliveryCost, o.Currency, codes),
+        Settlements: []domainPayment.Settlement{{
+            Type:   p.settlementType,
+            Amount: domainPayment.Amount{Value: fmt.Sprintf("%.2f", amount), Currency: o.Currency},
+        }},
+        // Повторный запрос в течение суток не создаст второй чек
+        IdempotenceKey: p.idempotenceKey,
+    })
+    if p.manual && errors.Is(err, domainPayment.ErrReceiptsNotSupported) {
+        return s.recordManual(o, p.kind, amount)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("ошибка отправки чека полного расчета: %w", err)
+    }
+
+    receipt := &order.Receipt{
+        OrderID:   o.ID,
+        Kind:      p.kind,
+        ReceiptID: resp.ID,
+        Amount:    amount,
+        Status:    resp.Status,
+    }
+    if _, err := s.orderService.AddReceipt(receipt); err != nil {
+        // Чек уже отправлен - фиксируем в логе, чтобы менеджер мог восстановить запись
+        logger.Error("Чек полного расчета отправлен, но не сохранен в истории заказа",
+            zap.Int("order_id", o.ID),
+            zap.String("receipt_id", resp.ID),
+            zap.Error(err))
+    }
+
+    logger.Info("Отправлен чек полного расчета",
+        zap.Int("order_id", o.ID),
+        zap.String("kind", string(p.kind)),
+        zap.String("receipt_id", resp.ID),
+        zap.Float64("amount", amount),
+        zap.String("status", resp.Status))
+
+    return receipt, nil
+}
+
+// recordManual сохраняет в истории заказа чек, который пробивается на кассе
+// курьера или пункта выдачи, а не через платежную систему
+func (s *Service) recordManual(o *order.Order, kind order.ReceiptKind, amount float64) (*order.Receipt, error) {
+    receipt := &order.Receipt{
+        OrderID: o.ID,
+        Kind:    kind,
+        Amount:  amount,
+        Status:  order.ReceiptStatusManual,
+    }
+    if _, err := s.orderService.AddReceipt(receipt); err != nil {
+        return nil, err
+    }
+
+    logger.Warn("Чек полного расчета нужно пробить на кассе вручную",
+        zap.Int("order_id", o.ID),
+        zap.String("kind", string(kind)),
+        zap.Float64("amount", amount),
+        zap.String("offline_method", string(o.OfflineMethod)))
+    return receipt, nil
+}
+
+// remainingItems возвращает позиции заказа и стоимость доставки за вычетом
+// возвратов (кроме отмененных)
+func (s *Service) remainingItems(o *order.Order) ([]order.Item, float64, error) {
+    refunds, err := s.orderService.GetRefunds(o.ID)
+    if err != nil {
+        return nil, 0, err
+    }
+
+    refundedQty := make(map[int]float64)
+    deliveryRefunded := false
+    for _, r := range refunds {
+        if r.Status == string(domainPayment.StatusCanceled) {
+            continue
+        }
+        for _, item := range r.Items {
+            refundedQty[item.ProductID] += item.Quantity
+        }
+        deliveryRefunded = deliveryRefunded || r.IncludeDelivery
+    }
+
+    items := make([]order.Item, 0, len(o.Items))
+    for _, item := range o.Items {
+        item.Quantity = order.RoundQuantity(item.Quantity - refundedQty[item.ProductID])
+        if item.Quantity > 0 {
+            items = append(items, item)
+        }
+    }
+
+    deliveryCost := roundAmount(o.DeliveryCost)
+    if deliveryRefunded {
+        deliveryCost = 0
+    }
+    return items, deliveryCost, nil
+}
+
+// markedQuantities возвращает количество маркированных единиц по ID товара.
+// Маркированный товар штучный.
+func markedQuantities(items []order.Item) map[int]int {
+    quantities := make(map[int]int)
+    for _, item := range items {
+        if item.Marked {
+            quantities[item.ProductID] += int(math.Round(item.Quantity))
+        }
+    }
+    return quantities
+}
+
+func roundAmount(amount float64) float64 {
+    return math.Round(amount*100) / 100
+}
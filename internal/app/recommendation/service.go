@@ -0,0 +1,178 @@
+package recommendation
+
+import (
+    "backend/config"
+    appProduct "backend/internal/app/product"
+    "backend/internal/domain/product"
+    "backend/internal/domain/recommendation"
+    "backend/pkg/logger"
+    "context"
+    "sort"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+// Service рассчитывает рекомендации «С этим товаром покупают»
+type Service struct {
+    repo           recommendation.RecommendationRepository
+    productService *appProduct.Service
+    cfg            config.RecommendationsConfig
+}
+
+func NewService(repo recommendation.RecommendationRepository, productService *appProduct.Service, cfg config.RecommendationsConfig) *Service {
+    return &Service{
+        repo:           repo,
+        productService: productService,
+        cfg:            cfg,
+    }
+}
+
+// Run периодически пересчитывает рекомендации, пока не отменен контекст
+func (s *Service) Run(ctx context.Context) {
+    interval := time.Duration(s.cfg.Interval) * time.Second
+    ticker := time.NewTicker(interval)
+    defer ticker.Stop()
+
+    for {
+        if err := s.Recompute(); err != nil {
+            logger.Error("Ошибка пересчета рекомендаций", zap.Error(err))
+        }
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+// Recompute считает, как часто товары встречаются вместе в оплаченных заказах,
+// и сохраняет для каждого товара самые частые пары
+func (s *Service) Recompute() error {
+    started := time.Now()
+
+    baskets, err := s.repo.PaidOrderBaskets()
+    if err != nil {
+        return err
+    }
+
+    pairs := make(map[int]map[int]int)
+    for _, basket := range baskets {
+        unique := uniqueIDs(basket)
+        for _, a := range unique {
+            for _, b := range unique {
+                if a == b {
+                    continue
+                }
+                if pairs[a] == nil {
+                    pairs[a] = make(map[int]int)
+                }
+                pairs[a][b]++
+            }
+        }
+    }
+
+    related := make(map[int][]recommendation.Related, len(pairs))
+    for productID, counts := range pairs {
+        items := make([]recommendation.Related, 0, len(counts))
+        for relatedID, score := range counts {
+            if score < s.cfg.MinScore {
+                continue
+            }
+            items = append(items, recommendation.Related{ProductID: relatedID, Score: score})
+        }
+
+        sort.Slice(items, func(i, j int) bool {
+            if items[i].Score != items[j].Score {
+                return items[i].Score > items[j].Score
+            }
+            return items[i].ProductID < items[j].ProductID
+        })
+        if len(items) > s.cfg.MaxRelated {
+            items = items[:s.cfg.MaxRelated]
+        }
+        if len(items) > 0 {
+            related[productID] = items
+        }
+    }
+
+    if err := s.repo.ReplaceRelated(related); err != nil {
+        return err
+    }
+
+    logger.Info("Рекомендации пересчитаны",
+        zap.Int("orders", len(baskets)),
+        zap.Int("products", len(related)),
+        zap.Duration("duration", time.Since(started)))
+
+    return nil
+}
+
+// GetRelated возвращает товары, которые покупают вместе с данным. Если данных
+// по заказам недостаточно, список дополняется товарами из той же категории.
+func (s *Service) GetRelated(productID, limit int) ([]*product.Product, error) {
+    source, err := s.productService.GetProductByID(productID)
+    if err != nil {
+        return nil, err
+    }
+
+    related, err := s.repo.GetRelated(productID, limit)
+    if err != nil {
+        return nil, err
+    }
+
+    result := make([]*product.Product, 0, limit)
+    seen := map[int]bool{productID: true}
+
+    for _, item := range related {
+        p, err := s.productService.GetProductByID(item.ProductID)
+        if err != nil {
+            logger.Warn("Рекомендованный товар не найден",
+                zap.Int("product_id", item.ProductID),
+                zap.Error(err))
+            continue
+        }
+        seen[p.ID] = true
+        result = append(result, p)
+    }
+
+    if len(result) >= limit || source.CategoryID == 0 {
+        return result, nil
+    }
+
+    sameCategory, err := s.productService.FindProducts(product.Filter{CategoryID: source.CategoryID})
+    if err != nil {
+        return nil, err
+    }
+
+    // Товары в наличии показываем первыми
+    sort.SliceStable(sameCategory, func(i, j int) bool {
+        return sameCategory[i].Available() && !sameCategory[j].Available()
+    })
+
+    for _, p := range sameCategory {
+        if len(result) >= limit {
+            break
+        }
+        if seen[p.ID] {
+            continue
+        }
+        seen[p.ID] = true
+        result = append(result, p)
+    }
+
+    return result, nil
+}
+
+func uniqueIDs(ids []int) []int {
+    seen := make(map[int]bool, len(ids))
+    unique := make([]int, 0, len(ids))
+    for _, id := range ids {
+        if !seen[id] {
+            seen[id] = true
+            unique = append(unique, id)
+        }
+    }
+    return unique
+}
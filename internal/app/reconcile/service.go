@@ -0,0 +1,211 @@
+package reconcile
+
+import (
+    "backend/config"
+    appCertificate "backend/internal/app/certificate"
+    appLoyalty "backend/internal/app/loyalty"
+    appOrder "backend/internal/app/order"
+    appPayment "backend/internal/app/payment"
+    appPaymentEvent "backend/internal/app/paymentevent"
+    "backend/internal/domain/order"
+    domainPayment "backend/internal/domain/payment"
+    "backend/pkg/logger"
+    "context"
+    "expvar"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+// metrics - счетчики сверки, доступны на /api/v1/admin/metrics
+var metrics = expvar.NewMap("payment_reconcile")
+
+// Service сверяет статусы платежей, по которым не пришел вебхук: заказы,
+// зависшие в pending, опрашиваются в платежной системе и обрабатываются так же,
+// как уведомления.
+type Service struct {
+    orderService       *appOrder.Service
+    paymentService     *appPayment.Service
+    eventService       *appPaymentEvent.Service
+    certificateService *appCertificate.Service
+    loyaltyService     *appLoyalty.Service
+    cfg                config.PaymentConfig
+}
+
+func NewService(orderService *appOrder.Service, paymentService *appPayment.Service, eventService *appPaymentEvent.Service, certificateService *appCertificate.Service, loyaltyService *appLoyalty.Service, cfg config.PaymentConfig) *Service {
+    return &Service{
+        orderService:       orderService,
+        paymentService:     paymentService,
+        eventService:       eventService,
+        certificateService: certificateService,
+        loyaltyService:     loyaltyService,
+        cfg:                cfg,
+    }
+}
+
+// Run периодически сверяет платежи заказов, созданных не раньше
+// cfg.ReconcileMaxAge и не позже cfg.ReconcileDelay назад. Заказы старше
+// срока жизни неоплаченного платежа опрашиваются последний раз и
+// отменяются, если так и не оплачены: товары, резерв сертификата и
+// списанные бонусы возвращаются.
+func (s *Service) Run(ctx context.Context) {
+    ticker := time.NewTicker(time.Duration(s.cfg.ReconcileInterval) * time.Second)
+    defer ticker.Stop()
+
+    for {
+        s.reconcile(ctx)
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (s *Service) reconcile(ctx context.Context) {
+    now := time.Now()
+    from := now.Add(-time.Duration(s.cfg.ReconcileMaxAge) * time.Second)
+    to := now.Add(-time.Duration(s.cfg.ReconcileDelay) * time.Second)
+
+    orders, err := s.orderService.GetPendingPayments(from, to)
+    if err != nil {
+        logger.Error("Ошибка поиска неоплаченных заказов", zap.Error(err))
+        return
+    }
+
+    for _, o := range orders {
+        metrics.Add("checked", 1)
+
+        if _, err := s.reconcileOrder(ctx, o); err != nil {
+            metrics.Add("errors", 1)
+            logger.Error("Ошибка сверки статуса платежа",
+                zap.Int("order_id", o.ID),
+                zap.String("payment_id", o.PaymentID),
+                zap.Error(err))
+        }
+    }
+
+    s.expire(ctx, from)
+}
+
+// expire отменяет заказы, созданные раньше before и так и не оплаченные.
+// Заказ с платежом перед отменой сверяется последний раз, а неоплаченный
+// платеж отменяется у провайдера: ссылка на оплату может жить дольше окна
+// сверки (у Т-Банка - сутки). Заказ без платежа (платежная система не
+// ответила, а покупатель не повторил запрос) просто отменяется.
+func (s *Service) expire(ctx context.Context, before time.Time) {
+    orders, err := s.orderService.GetStalePending(before)
+    if err != nil {
+        logger.Error("Ошибка поиска просроченных заказов", zap.Error(err))
+        return
+    }
+
+    for _, o := range orders {
+        if o.PaymentID != "" {
+            metrics.Add("checked", 1)
+            status, err := s.reconcileOrder(ctx, o)
+            if err != nil {
+                // Статус платежа неизвестен - отменять заказ нельзя,
+                // попробуем на следующем проходе
+                metrics.Add("errors", 1)
+                logger.Error("Ошибка сверки статуса платежа",
+                    zap.Int("order_id", o.ID),
+                    zap.String("payment_id", o.PaymentID),
+                    zap.Error(err))
+                continue
+            }
+
+            if status == domainPayment.StatusPending {
+                if err := s.paymentService.CancelPayment(ctx, o.Provider, o.PaymentID); err != nil {
+                    // Пока платеж не отменен, покупатель может его оплатить -
+                    // заказ остается ждать оплаты до следующего прохода
+                    metrics.Add("errors", 1)
+                    logger.Error("Ошибка отмены платежа просроченного заказа",
+                        zap.Int("order_id", o.ID),
+                        zap.String("payment_id", o.PaymentID),
+                        zap.Error(err))
+                    continue
+                }
+            }
+        }
+
+        if err := s.expireOrder(o); err != nil {
+            metrics.Add("errors", 1)
+            logger.Error("Ошибка отмены просроченного заказа",
+                zap.Int("order_id", o.ID),
+                zap.String("payment_id", o.PaymentID),
+                zap.Error(err))
+        }
+    }
+}
+
+func (s *Service) expireOrder(o *order.Order) error {
+    canceled, err := s.orderService.Expire(o.ID)
+    if err != nil {
+        return err
+    }
+    if !canceled {
+        // Последняя сверка нашла оплату или отмену
+        return nil
+    }
+
+    if err := s.certificateService.Release(o.ID); err != nil {
+        return err
+    }
+    if err := s.loyaltyService.Restore(o); err != nil {
+        return err
+    }
+
+    metrics.Add("expired", 1)
+    logger.Warn("Заказ отменен: не оплачен за срок жизни платежа",
+        zap.Int("order_id", o.ID),
+        zap.String("payment_id", o.PaymentID),
+        zap.Time("created_at", o.CreatedAt))
+    return nil
+}
+
+// reconcileOrder применяет к заказу статус платежа из API провайдера и
+// возвращает этот статус
+func (s *Service) reconcileOrder(ctx context.Context, o *order.Order) (domainPayment.Status, error) {
+    payment, err := s.paymentService.GetPaymentStatus(ctx, o.Provider, o.PaymentID)
+    if err != nil {
+        return "", err
+    }
+
+    var eventType domainPayment.EventType
+    switch payment.Status {
+    case domainPayment.StatusSucceeded:
+        eventType = domainPayment.EventPaymentSucceeded
+    case domainPayment.StatusWaitingForCapture:
+        eventType = domainPayment.EventPaymentWaitingForCapture
+    case domainPayment.StatusCanceled:
+        eventType = domainPayment.EventPaymentCanceled
+    default:
+        // Покупатель еще не оплатил
+        return payment.Status, nil
+    }
+
+    // Событие проходит через входящие: если вебхук все-таки придет,
+    // он будет распознан как повтор и письма не уйдут второй раз
+    processed, err := s.eventService.Receive(ctx, &domainPayment.Event{
+        Type:      eventType,
+        Provider:  payment.Provider,
+        PaymentID: payment.ID,
+        Payment:   payment,
+    }, nil, domainPayment.SourceReconcile)
+    if err != nil {
+        return "", err
+    }
+    if !processed {
+        return payment.Status, nil
+    }
+
+    metrics.Add("recovered", 1)
+    metrics.Add("recovered_"+string(payment.Status), 1)
+    logger.Warn("Статус платежа восстановлен сверкой: вебхук не был обработан",
+        zap.Int("order_id", o.ID),
+        zap.String("payment_id", o.PaymentID),
+        zap.String("status", string(payment.Status)))
+    return payment.Status, nil
+}
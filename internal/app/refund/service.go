@@ -0,0 +1,280 @@
+package refund
+
+import (
+    appCertificate "backend/internal/app/certificate"
+    appLoyalty "backend/internal/app/loyalty"
+    appOrder "backend/internal/app/order"
+    appPayment "backend/internal/app/payment"
+    "backend/internal/domain/order"
+    domainPayment "backend/internal/domain/payment"
+    "backend/pkg/logger"
+    "context"
+    "fmt"
+    "math"
+    "sync"
+
+    "go.uber.org/zap"
+)
+
+// Request - запрос менеджера на возврат. Пустой список позиций без доставки
+// означает полный возврат всего, что еще не возвращено.
+type Request struct {
+    OrderID         int
+    Items           []order.ItemQuantity
+    IncludeDelivery bool
+    Reason          string
+}
+
+// Service оформляет возвраты по заказам через платежную систему
+type Service struct {
+    orderService       *appOrder.Service
+    paymentService     *appPayment.Service
+    certificateService *appCertificate.Service
+    loyaltyService     *appLoyalty.Service
+
+    // mu не дает параллельным возвратам по одному заказу превысить оплаченное
+    mu sync.Mutex
+}
+
+func NewService(orderService *appOrder.Service, paymentService *appPayment.Service, certificateService *appCertificate.Service, loyaltyService *appLoyalty.Service) *Service {
+    return &Service{
+        orderService:       orderService,
+        paymentService:     paymentService,
+        certificateService: certificateService,
+        loyaltyService:     loyaltyService,
+    }
+}
+
+// Refund возвращает деньги за позиции заказа с чеком возврата и сохраняет возврат в заказе
+func (s *Service) Refund(ctx context.Context, req Request) (*order.Refund, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    o, err := s.orderService.GetByID(req.OrderID)
+    if err != nil {
+        return nil, err
+    }
+
+    if o.Status != order.StatusPaid && o.Status != order.StatusPartiallyRefunded {
+        return nil, fmt.Errorf("%w: заказ в статусе %s", order.ErrInvalidRefund, o.Status)
+    }
+    if o.PaymentID == "" {
+        return nil, fmt.Errorf("%w: у заказа нет платежа", order.ErrInvalidRefund)
+    }
+
+    previous, err := s.orderService.GetRefunds(o.ID)
+    if err != nil {
+        return nil, err
+    }
+
+    refundedQty := make(map[int]float64)
+    deliveryRefunded := false
+    refundedTotal := 0.0
+    for _, r := range previous {
+        // Отмененный возврат денег не вернул - позиции можно вернуть снова
+        if r.Status == string(domainPayment.StatusCanceled) {
+            continue
+        }
+        for _, item := range r.Items {
+            refundedQty[item.ProductID] += item.Quantity
+        }
+        deliveryRefunded = deliveryRefunded || r.IncludeDelivery
+        refundedTotal += r.Amount
+    }
+
+    items := req.Items
+    includeDelivery := req.IncludeDelivery
+    if len(items) == 0 && !includeDelivery {
+        for _, item := range o.Items {
+            if remaining := order.RoundQuantity(item.Quantity - refundedQty[item.ProductID]); remaining > 0 {
+                items = append(items, order.ItemQuantity{ProductID: item.ProductID, Quantity: remaining})
+            }
+        }
+        includeDelivery = o.DeliveryCost > 0 && !deliveryRefunded
+    }
+
+    refund := &order.Refund{
+        OrderID:         o.ID,
+        IncludeDelivery: includeDelivery,
+        Reason:          req.Reason,
+    }
+
+    for _, requested := range items {
+        ordered, ok := findItem(o.Items, requested.ProductID)
+        if !ok {
+            return nil, fmt.Errorf("%w: товара %d нет в заказе", order.ErrInvalidRefund, requested.ProductID)
+        }
+
+        quantity := order.RoundQuantity(requested.Quantity)
+        remaining := order.RoundQuantity(ordered.Quantity - refundedQty[requested.ProductID])
+        if quantity > remaining {
+            return nil, fmt.Errorf("%w: для товара %d можно вернуть не больше %g",
+                order.ErrInvalidRefund, requested.ProductID, remaining)
+        }
+        refundedQty[requested.ProductID] += quantity
+
+        item := ordered
+        item.Quantity = quantity
+        refund.Items = append(refund.Items, item)
+        refund.Amount += item.Total()
+    }
+
+    deliveryCost := 0.0
+    if includeDelivery {
+        if deliveryRefunded {
+            return nil, fmt.Errorf("%w: доставка уже возвращена", order.ErrInvalidRefund)
+        }
+        deliveryCost = roundAmount(o.DeliveryCost)
+        refund.Amount += deliveryCost
+    }
+
+    // Оплаченное сертификатом деньгами не возвращается: возврат ограничен
+    // суммой платежа
+    paid := o.AmountDue()
+    refund.Amount = roundAmount(refund.Amount)
+    if o.CertificateAmount > 0 {
+        refund.Amount = math.Min(refund.Amount, roundAmount(paid-refundedTotal))
+    }
+    if refund.Amount <= 0 {
+        return nil, fmt.Errorf("%w: нечего возвращать", order.ErrInvalidRefund)
+    }
+    if refundedTotal+refund.Amount > paid+0.005 {
+        return nil, fmt.Errorf("%w: сумма возвратов превышает сумму заказа", order.ErrInvalidRefund)
+    }
+
+    // Вернуть деньги за сертификат можно, только пока его не начали тратить
+    if err := s.certificateService.CheckRefund(o.ID, refund.Items); err != nil {
+        return nil, err
+    }
+
+    receiptItems, err := s.refundReceiptItems(o, refund.Items, deliveryCost, refund.Amount)
+    if err != nil {
+        return nil, err
+    }
+
+    resp, err := s.paymentService.Refund(ctx, o.Provider, &domainPayment.RefundRequest{
+        PaymentID:    o.PaymentID,
+        Amount:       refund.Amount,
+        Currency:     o.Currency,
+        Description:  fmt.Sprintf("Возврат по заказу №%d", o.ID),
+        Email:        o.Email,
+        ReceiptItems: receiptItems,
+        // Ключ зависит от уже сохраненных возвратов и суммы: повтор после
+        // таймаута совпадет с первым запросом, следующий возврат - нет
+        IdempotenceKey: fmt.Sprintf("refund-%d-%d-%.2f", o.ID, len(previous), refund.Amount),
+    })
+    if err != nil {
+        return nil, fmt.Errorf("ошибка возврата в платежной системе: %w", err)
+    }
+
+    refund.RefundID = resp.ID
+    refund.Status = string(resp.Status)
+    if err := s.orderService.AddRefund(refund); err != nil {
+        // Деньги уже возвращены - фиксируем в логе, чтобы менеджер мог восстановить запись
+        logger.Error("Возврат проведен, но не сохранен в заказе",
+            zap.Int("order_id", o.ID),
+            zap.String("refund_id", resp.ID),
+            zap.Float64("amount", refund.Amount),
+            zap.Error(err))
+        return nil, err
+    }
+
+    if err := s.certificateService.CancelRefunded(o.ID, refund.Items); err != nil {
+        logger.Error("Возврат проведен, но сертификаты не отменены",
+            zap.Int("order_id", o.ID),
+            zap.String("refund_id", refund.RefundID),
+            zap.Error(err))
+    }
+
+    // Если платежная система не пришлет уведомление о возврате, бонусы
+    // пересчитываются здесь; повтор по уведомлению ничего не изменит
+    if resp.Status == domainPayment.StatusSucceeded {
+        if err := s.loyaltyService.HandleRefund(o, refund.RefundID, refund.Amount); err != nil {
+            logger.Error("Возврат проведен, но бонусы не пересчитаны",
+                zap.Int("order_id", o.ID),
+                zap.String("refund_id", refund.RefundID),
+                zap.Error(err))
+        }
+    }
+
+    if _, err := s.orderService.AddReceipt(&order.Receipt{
+        OrderID:  o.ID,
+        Kind:     order.ReceiptRefund,
+        RefundID: refund.RefundID,
+        Amount:   refund.Amount,
+    }); err != nil {
+        logger.Error("Ошибка сохранения чека возврата в истории заказа",
+            zap.Int("order_id", o.ID),
+            zap.String("refund_id", refund.RefundID),
+            zap.Error(err))
+    }
+
+    status := order.StatusPartiallyRefunded
+    if refundedTotal+refund.Amount >= paid-0.005 {
+        status = order.StatusRefunded
+    }
+    if err := s.orderService.UpdateStatus(o.ID, status); err != nil {
+        logger.Error("Ошибка обновления статуса заказа после возврата",
+            zap.Int("order_id", o.ID),
+            zap.Error(err))
+    }
+
+    logger.Info("Оформлен возврат по заказу",
+        zap.Int("order_id", o.ID),
+        zap.String("refund_id", refund.RefundID),
+        zap.Float64("amount", refund.Amount),
+        zap.String("order_status", string(status)))
+
+    return refund, nil
+}
+
+// GetRefunds возвращает историю возвратов по заказу
+func (s *Service) GetRefunds(orderID int) ([]*order.Refund, error) {
+    if _, err := s.orderService.GetByID(orderID); err != nil {
+        return nil, err
+    }
+    return s.orderService.GetRefunds(orderID)
+}
+
+// refundReceiptItems формирует позиции чека возврата. До передачи товара
+// возвращается предоплата, после чека полного расчета - полный расчет, и
+// маркированные единицы передаются с кодами. По заказу, часть которого
+// оплачена сертификатом, возвращается только внесенная деньгами сумма amount,
+// распределенная по позициям как в чеке оплаты.
+func (s *Service) refundReceiptItems(o *order.Order, items []order.Item, deliveryCost, amount float64) ([]domainPayment.ReceiptItem, error) {
+    if o.CertificateAmount > 0 {
+        return s.paymentService.BuildPartialPrepaymentItems(items, deliveryCost, o.Currency, amount), nil
+    }
+
+    receipts, err := s.orderService.GetReceipts(o.ID)
+    if err != nil {
+        return nil, err
+    }
+    if !order.Settled(receipts) {
+        return s.paymentService.BuildReceiptItems(items, deliveryCost, o.Currency), nil
+    }
+
+    markingCodes, err := s.orderService.GetMarkingCodes(o.ID)
+    if err != nil {
+        return nil, err
+    }
+    codes := make(map[int][]string)
+    for _, code := range markingCodes {
+        codes[code.ProductID] = append(codes[code.ProductID], code.Code)
+    }
+
+    return s.paymentService.BuildSettlementItems(items, deliveryCost, o.Currency, codes), nil
+}
+
+func findItem(items []order.Item, productID int) (order.Item, bool) {
+    for _, item := range items {
+        if item.ProductID == productID {
+            return item, true
+        }
+    }
+    return order.Item{}, false
+}
+
+func roundAmount(amount float64) float64 {
+    return math.Round(amount*100) / 100
+}
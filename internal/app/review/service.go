@@ -0,0 +1,117 @@
+package review
+
+import (
+    appOrder "backend/internal/app/order"
+    appProduct "backend/internal/app/product"
+    "backend/internal/domain/review"
+    "backend/pkg/logger"
+    "fmt"
+    "net/url"
+    "strings"
+
+    "go.uber.org/zap"
+)
+
+// Service содержит бизнес-логику отзывов и их модерации
+type Service struct {
+    repo           review.ReviewRepository
+    productService *appProduct.Service
+    orderService   *appOrder.Service
+}
+
+func NewService(repo review.ReviewRepository, productService *appProduct.Service, orderService *appOrder.Service) *Service {
+    return &Service{
+        repo:           repo,
+        productService: productService,
+        orderService:   orderService,
+    }
+}
+
+// Submit проверяет отзыв и ставит его в очередь модерации
+func (s *Service) Submit(rv *review.Review) error {
+    rv.AuthorName = strings.TrimSpace(rv.AuthorName)
+    rv.Text = strings.TrimSpace(rv.Text)
+
+    if rv.Rating < review.MinRating || rv.Rating > review.MaxRating {
+        return fmt.Errorf("%w: оценка должна быть от %d до %d", review.ErrInvalid, review.MinRating, review.MaxRating)
+    }
+    if rv.AuthorName == "" {
+        return fmt.Errorf("%w: не указано имя", review.ErrInvalid)
+    }
+    if len([]rune(rv.Text)) > review.MaxTextLength {
+        return fmt.Errorf("%w: текст длиннее %d символов", review.ErrInvalid, review.MaxTextLength)
+    }
+    if len(rv.Photos) > review.MaxPhotos {
+        return fmt.Errorf("%w: не больше %d фотографий", review.ErrInvalid, review.MaxPhotos)
+    }
+    for _, photo := range rv.Photos {
+        u, err := url.Parse(photo)
+        if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+            return fmt.Errorf("%w: некорректная ссылка на фото %q", review.ErrInvalid, photo)
+        }
+    }
+    if rv.Photos == nil {
+        rv.Photos = []string{}
+    }
+
+    if _, err := s.productService.GetProductByID(rv.ProductID); err != nil {
+        return err
+    }
+
+    verified, err := s.orderService.HasPaidProduct(rv.Email, rv.ProductID)
+    if err != nil {
+        // Отзыв принимаем в любом случае, просто без отметки о покупке
+        logger.Error("Ошибка проверки покупки для отзыва",
+            zap.Int("product_id", rv.ProductID),
+            zap.Error(err))
+    }
+    rv.VerifiedPurchase = verified
+    rv.Status = review.StatusPending
+
+    return s.repo.Create(rv)
+}
+
+// GetPublished возвращает одобренные отзывы о товаре
+func (s *Service) GetPublished(productID, limit, offset int) ([]*review.Review, error) {
+    reviews, err := s.repo.GetByProduct(productID, review.StatusApproved, limit, offset)
+    if err != nil {
+        return nil, err
+    }
+
+    for _, rv := range reviews {
+        rv.Email = ""
+        rv.ModeratorComment = ""
+    }
+
+    return reviews, nil
+}
+
+// GetForModeration возвращает отзывы с указанным статусом для менеджеров
+func (s *Service) GetForModeration(status review.Status, limit, offset int) ([]*review.Review, error) {
+    if !status.Valid() {
+        return nil, fmt.Errorf("%w: неизвестный статус %q", review.ErrInvalid, status)
+    }
+    return s.repo.GetByStatus(status, limit, offset)
+}
+
+// Approve публикует отзыв
+func (s *Service) Approve(id int, comment string) (*review.Review, error) {
+    return s.moderate(id, review.StatusApproved, comment)
+}
+
+// Reject отклоняет отзыв (или снимает ранее опубликованный)
+func (s *Service) Reject(id int, comment string) (*review.Review, error) {
+    return s.moderate(id, review.StatusRejected, comment)
+}
+
+func (s *Service) moderate(id int, status review.Status, comment string) (*review.Review, error) {
+    if err := s.repo.Moderate(id, status, strings.TrimSpace(comment)); err != nil {
+        return nil, err
+    }
+
+    logger.Info("Отзыв прошел модерацию",
+        zap.Int("review_id", id),
+        zap.String("status", string(status)))
+
+    return s.repo.GetByID(id)
+}
@@ -0,0 +1,545 @@
+package subscription
+
+import (
+    "backend/config"
+    appOrder "backend/internal/app/order"
+    appPayment "backend/internal/app/payment"
+    "backend/internal/domain/order"
+    domainPayment "backend/internal/domain/payment"
+    "backend/internal/domain/subscription"
+    "backend/pkg/logger"
+    "backend/pkg/smtp_sender"
+    "backend/pkg/templates"
+    "context"
+    "crypto/rand"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "strings"
+    "sync"
+    "time"
+
+    "go.uber.org/zap"
+)
+
+// dueBatch - сколько подписок списывать за один запуск планировщика
+const dueBatch = 100
+
+// Service управляет подписками: первая оплата с сохранением способа оплаты,
+// автосписания по расписанию, повторы после неудачных списаний с письмами
+// покупателю, пауза и отмена. По каждому списанию создается обычный заказ.
+type Service struct {
+    repo           subscription.SubscriptionRepository
+    orderService   *appOrder.Service
+    paymentService *appPayment.Service
+    cfg            config.SubscriptionsConfig
+    frontendURL    string
+
+    // mu не дает планировщику и покупателю одновременно менять одну подписку
+    mu sync.Mutex
+}
+
+func NewService(repo subscription.SubscriptionRepository, orderService *appOrder.Service, paymentService *appPayment.Service, cfg config.SubscriptionsConfig, frontendURL string) *Service {
+    return &Service{
+        repo:           repo,
+        orderService:   orderService,
+        paymentService: paymentService,
+        cfg:            cfg,
+        frontendURL:    strings.TrimRight(frontendURL, "/"),
+    }
+}
+
+func (s *Service) GetPlans(activeOnly bool) ([]*subscription.Plan, error) {
+    return s.repo.GetPlans(activeOnly)
+}
+
+// Subscribe оформляет подписку и создает первый платеж с сохранением способа
+// оплаты. Подписка становится активной после успешной оплаты; покупателя
+// нужно перенаправить на confirmation_url платежа.
+func (s *Service) Subscribe(ctx context.Context, sub *subscription.Subscription, returnURL string) (*domainPayment.PaymentResponse, error) {
+    plan, err := s.repo.GetPlan(sub.PlanID)
+    if errors.Is(err, subscription.ErrNotFound) || (err == nil && !plan.Active) {
+        return nil, fmt.Errorf("%w: тариф %d", subscription.ErrPlanUnavailable, sub.PlanID)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    if sub.Provider == "" {
+        sub.Provider = s.paymentService.DefaultProvider()
+    }
+    if !s.paymentService.Selectable(sub.Provider) {
+        return nil, fmt.Errorf("%w: %s", domainPayment.ErrUnknownProvider, sub.Provider)
+    }
+    if !s.paymentService.SupportsRecurring(sub.Provider) {
+        return nil, fmt.Errorf("%w: %s", domainPayment.ErrRecurringNotSupported, sub.Provider)
+    }
+
+    token, err := newToken()
+    if err != nil {
+        return nil, err
+    }
+    sub.Token = token
+    sub.Status = subscription.StatusPending
+    if err := s.repo.Create(sub); err != nil {
+        return nil, err
+    }
+
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    resp, err := s.charge(ctx, sub, plan, subscription.InitiatorCustomer, returnURL)
+    if err != nil {
+        // Платеж не создан - подписка не начнется, покупатель оформит ее заново
+        if cancelErr := sub.Cancel(time.Now(), subscription.CancelFirstPaymentFail); cancelErr == nil {
+            if updateErr := s.repo.Update(sub); updateErr != nil {
+                logger.Error("Failed to cancel subscription", zap.Int("subscription_id", sub.ID), zap.Error(updateErr))
+            }
+        }
+        return nil, err
+    }
+    return resp, nil
+}
+
+// GetByToken возвращает подписку с тарифом по ссылке покупателя
+func (s *Service) GetByToken(token string) (*subscription.Subscription, error) {
+    sub, err := s.repo.GetByToken(token)
+    if err != nil {
+        return nil, err
+    }
+    if sub.Plan, err = s.repo.GetPlan(sub.PlanID); err != nil {
+        return nil, err
+    }
+    return sub, nil
+}
+
+func (s *Service) GetByID(id int) (*subscription.Subscription, error) {
+    sub, err := s.repo.GetByID(id)
+    if err != nil {
+        return nil, err
+    }
+    if sub.Plan, err = s.repo.GetPlan(sub.PlanID); err != nil {
+        return nil, err
+    }
+    return sub, nil
+}
+
+// GetByStatus возвращает подписки со статусом status (пусто - все)
+func (s *Service) GetByStatus(status subscription.Status, limit, offset int) ([]*subscription.Subscription, error) {
+    return s.repo.GetByStatus(status, limit, offset)
+}
+
+func (s *Service) GetCharges(subscriptionID int) ([]*subscription.Charge, error) {
+    return s.repo.GetCharges(subscriptionID)
+}
+
+// Pause приостанавливает подписку по ссылке покупателя
+func (s *Service) Pause(token string) (*subscription.Subscription, error) {
+    return s.update(token, func(sub *subscription.Subscription, now time.Time) error {
+        return sub.Pause(now)
+    })
+}
+
+// Resume возобновляет подписку по ссылке покупателя
+func (s *Service) Resume(token string) (*subscription.Subscription, error) {
+    return s.update(token, func(sub *subscription.Subscription, now time.Time) error {
+        return sub.Resume(now)
+    })
+}
+
+// Cancel отменяет подписку по ссылке покупателя. Уже созданные заказы
+// не отменяются.
+func (s *Service) Cancel(token string) (*subscription.Subscription, error) {
+    return s.update(token, func(sub *subscription.Subscription, now time.Time) error {
+        return sub.Cancel(now, subscription.CancelByCustomer)
+    })
+}
+
+// CancelByManager отменяет подписку из админки
+func (s *Service) CancelByManager(id int) (*subscription.Subscription, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    sub, err := s.GetByID(id)
+    if err != nil {
+        return nil, err
+    }
+    if err := sub.Cancel(time.Now(), subscription.CancelByManager); err != nil {
+        return nil, err
+    }
+    if err := s.repo.Update(sub); err != nil {
+        return nil, err
+    }
+
+    logger.Info("Subscription canceled by manager", zap.Int("subscription_id", sub.ID))
+    return sub, nil
+}
+
+// Pay создает платеж за просроченный период с участием покупателя - например,
+// чтобы оплатить другой картой. Новая карта сохраняется для следующих списаний.
+func (s *Service) Pay(ctx context.Context, token, returnURL string) (*domainPayment.PaymentResponse, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    sub, err := s.GetByToken(token)
+    if err != nil {
+        return nil, err
+    }
+    if sub.Status != subscription.StatusPastDue {
+        return nil, fmt.Errorf("%w: оплата не просрочена", subscription.ErrInvalidTransition)
+    }
+
+    charges, err := s.repo.GetCharges(sub.ID)
+    if err != nil {
+        return nil, err
+    }
+    for _, c := range charges {
+        if c.Status == subscription.ChargePending {
+            return nil, fmt.Errorf("%w: списание уже выполняется", subscription.ErrInvalidTransition)
+        }
+    }
+
+    return s.charge(ctx, sub, sub.Plan, subscription.InitiatorCustomer, returnURL)
+}
+
+// Run периодически списывает оплату по подпискам, у которых наступила дата
+// следующего списания
+func (s *Service) Run(ctx context.Context) {
+    ticker := time.NewTicker(time.Duration(s.cfg.Interval) * time.Second)
+    defer ticker.Stop()
+
+    for {
+        s.chargeDue(ctx)
+
+        select {
+        case <-ctx.Done():
+            return
+        case <-ticker.C:
+        }
+    }
+}
+
+func (s *Service) chargeDue(ctx context.Context) {
+    due, err := s.repo.GetDue(time.Now(), dueBatch)
+    if err != nil {
+        logger.Error("Ошибка поиска подписок к списанию", zap.Error(err))
+        return
+    }
+
+    for _, sub := range due {
+        if err := s.chargeScheduled(ctx, sub.ID); err != nil {
+            // Списание не создано: при сбое связи повторим при следующем
+            // запуске, отказ платежной системы уже ушел в расписание повторов
+            logger.Error("Ошибка автосписания по подписке",
+                zap.Int("subscription_id", sub.ID),
+                zap.Error(err))
+        }
+    }
+}
+
+// chargeScheduled создает автосписание по сохраненному способу оплаты.
+// Результат приходит уведомлением платежной системы и обрабатывается в HandlePayment.
+func (s *Service) chargeScheduled(ctx context.Context, id int) error {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    // Подписку могли приостановить или отменить после выборки
+    sub, err := s.GetByID(id)
+    if err != nil {
+        return err
+    }
+    if (sub.Status != subscription.StatusActive && sub.Status != subscription.StatusPastDue) ||
+        sub.NextChargeAt == nil || sub.NextChargeAt.After(time.Now()) {
+        return nil
+    }
+
+    resp, err := s.charge(ctx, sub, sub.Plan, subscription.InitiatorMerchant, "")
+    if err != nil {
+        return err
+    }
+
+    logger.Info("Subscription charge created",
+        zap.Int("subscription_id", sub.ID),
+        zap.String("payment_id", resp.ID),
+        zap.String("status", string(resp.Status)),
+        zap.Int("attempt", sub.FailedAttempts+1))
+    return nil
+}
+
+// charge создает заказ на период подписки и платеж по нему. Покупатель
+// подтверждает платеж сам и сохраняет способ оплаты; автосписание идет по
+// сохраненному способу без участия покупателя. Вызывается под s.mu.
+func (s *Service) charge(ctx context.Context, sub *subscription.Subscription, plan *subscription.Plan, initiator subscription.ChargeInitiator, returnURL string) (*domainPayment.PaymentResponse, error) {
+    // Цена тарифа включает доставку: отдельной строки доставки в заказе нет
+    items := []order.Item{{
+        Quantity: 1,
+        Price:    plan.Price,
+        Name:     fmt.Sprintf("Подписка «%s»", plan.Name),
+    }}
+    o := &order.Order{
+        Email:           sub.Email,
+        Phone:           sub.Phone,
+        CustomerName:    sub.CustomerName,
+        DeliveryType:    "delivery",
+        DeliveryAddress: sub.DeliveryAddress,
+        Comment:         fmt.Sprintf("Подписка №%d", sub.ID),
+        Items:           items,
+        ItemsTotal:      plan.Price,
+        Amount:          plan.Price,
+        Currency:        plan.Currency,
+    }
+    if err := s.orderService.Create(o); err != nil {
+        return nil, err
+    }
+
+    // Номера заказа в запросе нет: при повторе автосписания с тем же ключом
+    // идемпотентности тело запроса должно совпадать
+    req := &domainPayment.PaymentRequest{
+        Amount:       plan.Price,
+        Description:  fmt.Sprintf("Подписка «%s» №%d", plan.Name, sub.ID),
+        Currency:     plan.Currency,
+        ReturnURL:    returnURL,
+        Email:        sub.Email,
+        Phone:        sub.Phone,
+        Metadata:     map[string]interface{}{"subscriptionId": sub.ID},
+        ReceiptItems: s.paymentService.BuildReceiptItems(items, 0, plan.Currency),
+        OrderID:      o.ID,
+        Provider:     sub.Provider,
+    }
+    if initiator == subscription.InitiatorCustomer {
+        req.SavePaymentMethod = true
+    } else {
+        req.PaymentMethodID = sub.PaymentMethodID
+        // Одно списание на дату и попытку, даже если процесс упадет после запроса
+        req.IdempotenceKey = fmt.Sprintf("subscription-%d-%d-%d", sub.ID, sub.NextChargeAt.Unix(), sub.FailedAttempts)
+    }
+
+    resp, err := s.paymentService.CreateRecurringPayment(ctx, sub.Provider, req)
+    if err != nil {
+        if cancelErr := s.orderService.Cancel(o.ID); cancelErr != nil {
+            logger.Error("Failed to cancel order", zap.Int("order_id", o.ID), zap.Error(cancelErr))
+        }
+        // Отказ платежной системы (ошибка запроса, отозванный способ оплаты)
+        // повтором с той же датой не исправить: автосписание уходит в
+        // расписание повторов, иначе каждый запуск создавал бы новый заказ
+        if initiator == subscription.InitiatorMerchant &&
+            !errors.Is(err, domainPayment.ErrProviderUnavailable) && ctx.Err() == nil {
+            if _, failErr := s.handleFailed(sub, "general_decline", time.Now()); failErr != nil {
+                logger.Error("Failed to schedule subscription retry",
+                    zap.Int("subscription_id", sub.ID),
+                    zap.Error(failErr))
+            }
+        }
+        return nil, err
+    }
+
+    if err := s.orderService.AttachPayment(o.ID, resp.Provider, resp.ID); err != nil {
+        return nil, err
+    }
+    if err := s.repo.AddCharge(&subscription.Charge{
+        SubscriptionID: sub.ID,
+        OrderID:        o.ID,
+        PaymentID:      resp.ID,
+        Initiator:      initiator,
+        Amount:         plan.Price,
+        Status:         subscription.ChargePending,
+    }); err != nil {
+        return nil, err
+    }
+
+    // Автосписание обычно завершается сразу: итог применяется по ответу, не
+    // дожидаясь уведомления. Уведомление потом будет распознано как повтор.
+    if _, err := s.applyPayment(resp); err != nil {
+        logger.Error("Failed to apply subscription payment result",
+            zap.Int("subscription_id", sub.ID),
+            zap.String("payment_id", resp.ID),
+            zap.Error(err))
+    }
+
+    return resp, nil
+}
+
+// HandlePayment применяет к подписке итог платежа. Возвращает true, если
+// покупателю уже отправлено письмо о неудачном списании и общее письмо об
+// отмене платежа не нужно. Платежи не по подпискам пропускаются.
+func (s *Service) HandlePayment(payment *domainPayment.PaymentResponse) (bool, error) {
+    // Списание ищется под s.mu: charge сохраняет его под той же блокировкой,
+    // и уведомление, пришедшее раньше ответа на создание платежа, дождется записи
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    return s.applyPayment(payment)
+}
+
+// applyPayment - HandlePayment под s.mu. Незавершенные статусы пропускаются.
+func (s *Service) applyPayment(payment *domainPayment.PaymentResponse) (bool, error) {
+    var status string
+    switch payment.Status {
+    case domainPayment.StatusSucceeded:
+        status = subscription.ChargeSucceeded
+    case domainPayment.StatusCanceled:
+        status = subscription.ChargeCanceled
+    default:
+        return false, nil
+    }
+
+    charge, err := s.repo.GetChargeByPaymentID(payment.ID)
+    if errors.Is(err, subscription.ErrNotFound) {
+        return false, nil
+    }
+    if err != nil {
+        return false, err
+    }
+
+    reason := ""
+    if payment.CancellationDetails != nil {
+        reason = payment.CancellationDetails.Reason
+    }
+
+    completed, err := s.repo.CompleteCharge(payment.ID, status, reason)
+    if err != nil {
+        return false, err
+    }
+    if !completed {
+        // Повторное уведомление: итог списания уже применен
+        return charge.Initiator == subscription.InitiatorMerchant, nil
+    }
+
+    sub, err := s.GetByID(charge.SubscriptionID)
+    if err != nil {
+        return false, err
+    }
+    now := time.Now()
+
+    if status == subscription.ChargeSucceeded {
+        return false, s.handleSucceeded(sub, payment, now)
+    }
+
+    if charge.Initiator == subscription.InitiatorCustomer {
+        // Первая оплата не прошла - подписка не начинается. При оплате
+        // просроченного периода другой картой расписание повторов не меняется.
+        // Покупатель получит общее письмо об отмене платежа.
+        if sub.Status == subscription.StatusPending {
+            if err := sub.Cancel(now, subscription.CancelFirstPaymentFail); err != nil {
+                return false, err
+            }
+            return false, s.repo.Update(sub)
+        }
+        return false, nil
+    }
+
+    return s.handleFailed(sub, reason, now)
+}
+
+func (s *Service) handleSucceeded(sub *subscription.Subscription, payment *domainPayment.PaymentResponse, now time.Time) error {
+    methodID, title := "", ""
+    if m := payment.PaymentMethod; m != nil && m.Saved {
+        methodID, title = m.ID, m.Title
+    }
+
+    if err := sub.Activate(sub.Plan.Interval, now, methodID, title); err != nil {
+        // Деньги получены, заказ оплачен и будет собран - нужно разобраться вручную
+        logger.Error("Subscription payment succeeded but subscription was not renewed",
+            zap.Int("subscription_id", sub.ID),
+            zap.String("payment_id", payment.ID),
+            zap.String("status", string(sub.Status)),
+            zap.Error(err))
+        return nil
+    }
+    if err := s.repo.Update(sub); err != nil {
+        return err
+    }
+
+    logger.Info("Subscription renewed",
+        zap.Int("subscription_id", sub.ID),
+        zap.String("payment_id", payment.ID),
+        zap.Timep("next_charge_at", sub.NextChargeAt))
+    return nil
+}
+
+// handleFailed планирует повторное автосписание или отменяет подписку, если
+// повторов не осталось, и сообщает об этом покупателю
+func (s *Service) handleFailed(sub *subscription.Subscription, reason string, now time.Time) (bool, error) {
+    // Подписку приостановили или отменили, пока шло списание - повторять не нужно
+    if sub.Status != subscription.StatusActive && sub.Status != subscription.StatusPastDue {
+        return false, nil
+    }
+
+    var retryAt *time.Time
+    // Отозванное разрешение на списание повтором не исправить
+    if sub.FailedAttempts < len(s.cfg.RetryDelays) && reason != "permission_revoked" {
+        at := now.Add(time.Duration(s.cfg.RetryDelays[sub.FailedAttempts]) * time.Second)
+        retryAt = &at
+    }
+    sub.Fail(now, retryAt)
+    if err := s.repo.Update(sub); err != nil {
+        return false, err
+    }
+
+    logger.Warn("Subscription charge failed",
+        zap.Int("subscription_id", sub.ID),
+        zap.String("reason", reason),
+        zap.Int("failed_attempts", sub.FailedAttempts),
+        zap.String("status", string(sub.Status)))
+
+    data := templates.SubscriptionData{
+        CustomerName: sub.CustomerName,
+        Email:        sub.Email,
+        PlanName:     sub.Plan.Name,
+        Amount:       fmt.Sprintf("%.2f", sub.Plan.Price),
+        Currency:     sub.Plan.Currency,
+        ManageURL:    s.manageURL(sub),
+    }
+    go func() {
+        var err error
+        if retryAt != nil {
+            err = smtp_sender.SendSubscriptionPaymentFailedEmail(data, reason, retryAt.Format("02.01.2006"))
+        } else {
+            err = smtp_sender.SendSubscriptionCanceledEmail(data, reason)
+        }
+        if err != nil {
+            logger.Error("Failed to send subscription email",
+                zap.Error(err),
+                zap.Int("subscription_id", sub.ID),
+                zap.String("client_email", data.Email))
+        }
+    }()
+
+    return true, nil
+}
+
+// update меняет подписку по ссылке покупателя
+func (s *Service) update(token string, change func(sub *subscription.Subscription, now time.Time) error) (*subscription.Subscription, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+
+    sub, err := s.GetByToken(token)
+    if err != nil {
+        return nil, err
+    }
+    if err := change(sub, time.Now()); err != nil {
+        return nil, err
+    }
+    if err := s.repo.Update(sub); err != nil {
+        return nil, err
+    }
+
+    logger.Info("Subscription updated by customer",
+        zap.Int("subscription_id", sub.ID),
+        zap.String("status", string(sub.Status)))
+    return sub, nil
+}
+
+// manageURL - ссылка на страницу управления подпиской на сайте
+func (s *Service) manageURL(sub *subscription.Subscription) string {
+    return fmt.Sprintf("%s/subscription/%s", s.frontendURL, sub.Token)
+}
+
+// newToken генерирует секрет ссылки на подписку
+func newToken() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", fmt.Errorf("ошибка генерации токена подписки: %w", err)
+    }
+    return hex.EncodeToString(b), nil
+}
@@ -4,5 +4,5 @@ type Basket struct {
     ID          int       `json:"id"`
 	ProductID int `json:"product_id"`
 	UID int `json:"uid"`
-	Quantity int `json:"quantity"`
+	Quantity float64 `json:"quantity"`
 }
\ No newline at end of file
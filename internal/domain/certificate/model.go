@@ -0,0 +1,103 @@
+package certificate
+
+import (
+    "crypto/rand"
+    "errors"
+    "fmt"
+    "math/big"
+    "strings"
+    "time"
+)
+
+var (
+    // ErrNotFound возвращается, когда сертификат не найден
+    ErrNotFound = errors.New("сертификат не найден")
+    // ErrUnavailable возвращается, когда сертификатом нельзя оплатить заказ:
+    // он отменен, истек, израсходован или в другой валюте
+    ErrUnavailable = errors.New("сертификат недоступен")
+)
+
+// Status - статус сертификата
+type Status string
+
+const (
+    StatusActive   Status = "active"   // можно тратить, пока есть остаток
+    StatusCanceled Status = "canceled" // покупка сертификата возвращена
+)
+
+// Certificate - подарочный сертификат, купленный как товар. Amount - номинал,
+// Balance - сколько осталось потратить.
+type Certificate struct {
+    ID        int        `json:"id"`
+    Code      string     `json:"code"`
+    OrderID   int        `json:"order_id"`   // заказ, в котором сертификат куплен
+    ProductID int        `json:"product_id"` // товар-сертификат
+    Amount    float64    `json:"amount"`
+    Balance   float64    `json:"balance"`
+    Currency  string     `json:"currency"`
+    Email     string     `json:"email"`
+    Status    Status     `json:"status"`
+    CreatedAt time.Time  `json:"created_at"`
+    ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Available проверяет, что сертификатом можно оплатить заказ в валюте currency
+func (c *Certificate) Available(currency string, now time.Time) error {
+    switch {
+    case c.Status != StatusActive:
+        return fmt.Errorf("%w: сертификат отменен", ErrUnavailable)
+    case c.ExpiresAt != nil && !now.Before(*c.ExpiresAt):
+        return fmt.Errorf("%w: срок действия сертификата истек", ErrUnavailable)
+    case c.Balance <= 0:
+        return fmt.Errorf("%w: сертификат израсходован", ErrUnavailable)
+    case c.Currency != currency:
+        return fmt.Errorf("%w: сертификат в другой валюте", ErrUnavailable)
+    }
+    return nil
+}
+
+// RedemptionStatus - статус списания с сертификата
+type RedemptionStatus string
+
+const (
+    RedemptionHeld     RedemptionStatus = "held"     // остаток зарезервирован под неоплаченный заказ
+    RedemptionApplied  RedemptionStatus = "applied"  // заказ оплачен, списание окончательное
+    RedemptionReleased RedemptionStatus = "released" // заказ отменен, сумма вернулась на остаток
+)
+
+// Redemption - списание остатка сертификата в счет заказа. Сумма снимается с
+// остатка сразу при оформлении заказа, чтобы один остаток не потратили дважды.
+type Redemption struct {
+    ID            int              `json:"id"`
+    CertificateID int              `json:"certificate_id"`
+    OrderID       int              `json:"order_id"`
+    Amount        float64          `json:"amount"`
+    Status        RedemptionStatus `json:"status"`
+    CreatedAt     time.Time        `json:"created_at"`
+}
+
+// codeAlphabet - символы кода без похожих друг на друга (0/O, 1/I/L)
+const codeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// NewCode генерирует код сертификата вида GC-XXXX-XXXX-XXXX
+func NewCode() (string, error) {
+    var b strings.Builder
+    b.WriteString("GC")
+    max := big.NewInt(int64(len(codeAlphabet)))
+    for i := 0; i < 12; i++ {
+        if i%4 == 0 {
+            b.WriteByte('-')
+        }
+        n, err := rand.Int(rand.Reader, max)
+        if err != nil {
+            return "", err
+        }
+        b.WriteByte(codeAlphabet[n.Int64()])
+    }
+    return b.String(), nil
+}
+
+// NormalizeCode приводит введенный покупателем код к виду, в котором он хранится
+func NormalizeCode(code string) string {
+    return strings.ToUpper(strings.TrimSpace(code))
+}
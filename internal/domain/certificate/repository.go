@@ -0,0 +1,25 @@
+package certificate
+
+import "time"
+
+// CertificateRepository определяет контракт для работы с хранилищем сертификатов
+type CertificateRepository interface {
+    // Create сохраняет выпущенные сертификаты заказа. Если сертификаты по
+    // заказу уже выпущены, ничего не сохраняет и возвращает false.
+    Create(orderID int, certs []*Certificate) (bool, error)
+    GetByCode(code string) (*Certificate, error)
+    GetByOrderID(orderID int) ([]*Certificate, error)
+    // Cancel отменяет неизрасходованные сертификаты товара productID из заказа
+    // orderID (не больше count). Возвращает, сколько отменено.
+    Cancel(orderID, productID, count int) (int, error)
+
+    // Redeem резервирует до limit с остатка сертификата под заказ и
+    // прибавляет зарезервированное к сумме заказа, оплаченной сертификатом.
+    // Возвращает ErrUnavailable, если сертификат тратить нельзя.
+    Redeem(code string, orderID int, currency string, limit float64, now time.Time) (*Redemption, error)
+    // Release возвращает на остаток суммы, зарезервированные под заказ
+    Release(orderID int) (float64, error)
+    // Apply делает зарезервированные под оплаченный заказ суммы окончательными
+    Apply(orderID int) error
+    GetRedemptions(certificateID int) ([]*Redemption, error)
+}
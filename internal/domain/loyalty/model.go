@@ -0,0 +1,75 @@
+package loyalty
+
+import (
+    "errors"
+    "math"
+    "time"
+)
+
+var (
+    // ErrNotFound возвращается, когда бонусный счет не найден
+    ErrNotFound = errors.New("бонусный счет не найден")
+    // ErrInsufficientPoints возвращается, когда на счете меньше бонусов, чем
+    // покупатель хочет списать
+    ErrInsufficientPoints = errors.New("недостаточно бонусов")
+    // ErrInvalidSpend возвращается, когда бонусами нельзя оплатить заказ
+    ErrInvalidSpend = errors.New("нельзя списать бонусы")
+)
+
+// Account - бонусный счет покупателя. Счет привязан к email заказов, а
+// посмотреть и потратить бонусы можно по секретной ссылке с Token.
+// Один бонус - одна единица валюты заказа.
+type Account struct {
+    ID        int       `json:"-"`
+    Email     string    `json:"email"`
+    Token     string    `json:"-"`
+    Balance   float64   `json:"balance"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// EntryKind - вид операции в журнале бонусов
+type EntryKind string
+
+const (
+    KindEarn    EntryKind = "earn"    // начисление за оплаченный заказ
+    KindSpend   EntryKind = "spend"   // списание в счет заказа
+    KindRestore EntryKind = "restore" // возврат списанных бонусов: заказ отменен или возвращен
+    KindRevoke  EntryKind = "revoke"  // отмена начисления за возвращенный заказ
+    KindExpire  EntryKind = "expire"  // сгорание по сроку
+)
+
+// Credit сообщает, что операция увеличивает баланс
+func (k EntryKind) Credit() bool {
+    return k == KindEarn || k == KindRestore
+}
+
+// Entry - запись журнала бонусов. Amount положителен для начислений и
+// отрицателен для списаний. У начислений Remaining - сколько из них еще не
+// потрачено и не сгорело; тратятся и сгорают в первую очередь начисления с
+// ближайшим сроком.
+type Entry struct {
+    ID        int        `json:"id"`
+    AccountID int        `json:"-"`
+    Kind      EntryKind  `json:"kind"`
+    Amount    float64    `json:"amount"`
+    Remaining float64    `json:"-"`
+    OrderID   int        `json:"order_id,omitempty"`
+    Reference string     `json:"-"` // повтор операции с той же ссылкой не меняет баланс
+    ExpiresAt *time.Time `json:"expires_at,omitempty"`
+    CreatedAt time.Time  `json:"created_at"`
+}
+
+// MaxSpend возвращает, сколько бонусов можно списать в счет товаров на сумму
+// goodsTotal: не больше maxPercent процентов суммы и не больше баланса
+func MaxSpend(goodsTotal, balance, maxPercent float64) float64 {
+    limit := math.Floor(goodsTotal*maxPercent) / 100
+    return math.Min(limit, balance)
+}
+
+// Earned возвращает, сколько бонусов начислить за оплату base деньгами
+func Earned(base, percent float64) float64 {
+    if base <= 0 || percent <= 0 {
+        return 0
+    }
+    return math.Floor(base*percent) / 100
+}
@@ -0,0 +1,27 @@
+package loyalty
+
+import "time"
+
+// LoyaltyRepository определяет контракт для работы с хранилищем бонусов
+type LoyaltyRepository interface {
+    // GetOrCreateAccount возвращает счет покупателя с email, создавая его с
+    // токеном token, если счета еще нет
+    GetOrCreateAccount(email, token string) (*Account, error)
+    GetByEmail(email string) (*Account, error)
+    GetByToken(token string) (*Account, error)
+    GetEntries(accountID, limit, offset int) ([]*Entry, error)
+    // GetOrderEntries возвращает операции по заказу
+    GetOrderEntries(orderID int) ([]*Entry, error)
+
+    // Credit начисляет e.Amount бонусов на счет. Если операция с тем же видом
+    // и ссылкой уже есть, ничего не меняет и возвращает false.
+    Credit(e *Entry) (bool, error)
+    // Debit списывает e.Amount бонусов с начислений с ближайшим сроком и
+    // записывает списание с отрицательной суммой. Если бонусов меньше, при
+    // partial списывает сколько есть, иначе возвращает ErrInsufficientPoints.
+    // Повтор с той же ссылкой ничего не меняет и возвращает false.
+    Debit(e *Entry, partial bool, now time.Time) (bool, error)
+    // Expire списывает остатки начислений со сроком до now. Возвращает,
+    // сколько начислений сгорело.
+    Expire(now time.Time) (int, error)
+}
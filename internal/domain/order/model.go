@@ -0,0 +1,257 @@
+package order
+
+import (
+    "errors"
+    "math"
+    "time"
+)
+
+var (
+    // ErrNotFound возвращается, когда заказ не найден
+    ErrNotFound = errors.New("заказ не найден")
+    // ErrInvalidRefund возвращается, когда возврат невозможен или превышает оплаченное
+    ErrInvalidRefund = errors.New("некорректный возврат")
+    // ErrInvalidCapture возвращается, когда холд нельзя списать или отменить
+    ErrInvalidCapture = errors.New("некорректное списание")
+    // ErrInvalidMarkingCode возвращается, когда код маркировки не подходит к заказу
+    ErrInvalidMarkingCode = errors.New("некорректный код маркировки")
+    // ErrSettlementNotAllowed возвращается, когда чек полного расчета оформить нельзя
+    ErrSettlementNotAllowed = errors.New("чек полного расчета невозможен")
+    // ErrInvalidFulfillment возвращается, когда заказ нельзя отметить переданным покупателю
+    ErrInvalidFulfillment = errors.New("некорректная передача заказа")
+    // ErrInvalidOfflinePayment возвращается, когда оплату при получении нельзя отметить
+    ErrInvalidOfflinePayment = errors.New("некорректная оплата при получении")
+)
+
+// ProviderOffline - заказ оплачивается курьеру или в пункте выдачи, без
+// платежной системы. Платежа у такого заказа нет, оплату отмечает менеджер.
+const ProviderOffline = "offline"
+
+// OfflineMethod - чем покупатель заплатил при получении
+type OfflineMethod string
+
+const (
+    OfflineCash OfflineMethod = "cash" // наличными
+    OfflineCard OfflineMethod = "card" // картой через терминал курьера или пункта выдачи
+)
+
+// Valid сообщает, что способ оплаты известен
+func (m OfflineMethod) Valid() bool {
+    return m == OfflineCash || m == OfflineCard
+}
+
+// Status - статус заказа
+type Status string
+
+const (
+    StatusPending           Status = "pending"             // платеж создан, ожидаем оплату
+    StatusWaitingForCapture Status = "waiting_for_capture" // деньги захолдированы, ждем подтверждения менеджера
+    StatusPaid              Status = "paid"                // оплата подтверждена
+    StatusCanceled          Status = "canceled"            // платеж отменен или не создан
+
+    StatusPartiallyRefunded Status = "partially_refunded" // часть суммы возвращена
+    StatusRefunded          Status = "refunded"           // сумма возвращена полностью
+)
+
+// FulfillmentStatus - как заказ передан покупателю. Не меняет статус оплаты:
+// переданный заказ остается оплаченным и по нему можно оформить возврат.
+type FulfillmentStatus string
+
+const (
+    FulfillmentDelivered FulfillmentStatus = "delivered" // доставлен курьером
+    FulfillmentPickedUp  FulfillmentStatus = "picked_up" // получен в пункте выдачи
+)
+
+// Valid сообщает, что статус передачи известен
+func (s FulfillmentStatus) Valid() bool {
+    return s == FulfillmentDelivered || s == FulfillmentPickedUp
+}
+
+// Item - позиция заказа. JSON-теги совпадают с форматом cartItems в metadata платежа.
+type Item struct {
+    ProductID int     `json:"productId"`
+    Quantity  float64 `json:"quantity"` // для весового товара - дробное, до тысячных
+    Price     float64 `json:"price"`    // за единицу измерения
+    Name      string  `json:"name"`
+    // Unit - единица измерения товара (pcs, g, kg); пусто - штуки
+    Unit string `json:"unit,omitempty"`
+    // Налоговые признаки товара на момент заказа; пусто - по умолчанию магазина
+    VatCode        int    `json:"vatCode,omitempty"`
+    PaymentSubject string `json:"paymentSubject,omitempty"`
+    // Marked - на каждую единицу нужен код маркировки в чеке
+    Marked bool `json:"marked,omitempty"`
+    // GiftCertificate - позиция - подарочный сертификат, а не товар
+    GiftCertificate bool `json:"giftCertificate,omitempty"`
+}
+
+// Total возвращает стоимость позиции
+func (i Item) Total() float64 {
+    return LineTotal(i.Price, i.Quantity)
+}
+
+// LineTotal возвращает стоимость количества quantity по цене price так же, как
+// ее считает касса: цена в копейках умножается на количество в тысячных и
+// округляется до копейки. Вычисление в целых числах не дает ошибок округления
+// вроде 459.90 * 0.35 = 160.96499...
+func LineTotal(price, quantity float64) float64 {
+    kopecks := int64(math.Round(price * 100))
+    milli := int64(math.Round(quantity * 1000))
+    return float64((kopecks*milli+500)/1000) / 100
+}
+
+// RoundQuantity округляет количество до тысячных
+func RoundQuantity(quantity float64) float64 {
+    return math.Round(quantity*1000) / 1000
+}
+
+// Goods возвращает позиции с товарами - без подарочных сертификатов.
+// Сертификат не доставляется и не передается покупателю как товар.
+func Goods(items []Item) []Item {
+    goods := make([]Item, 0, len(items))
+    for _, item := range items {
+        if !item.GiftCertificate {
+            goods = append(goods, item)
+        }
+    }
+    return goods
+}
+
+// ApplyDiscount снижает цены товаров (без подарочных сертификатов)
+// пропорционально, чтобы их сумма уменьшилась не больше чем на discount.
+// Скидка на единицу округляется вниз до копейки, поэтому фактическая скидка,
+// которую возвращает функция, может быть немного меньше запрошенной.
+func ApplyDiscount(items []Item, discount float64) ([]Item, float64) {
+    goodsTotal := 0.0
+    for _, item := range Goods(items) {
+        goodsTotal += item.Total()
+    }
+    if discount <= 0 || goodsTotal <= 0 {
+        return items, 0
+    }
+    ratio := math.Min(discount/goodsTotal, 1)
+
+    discounted := make([]Item, len(items))
+    applied := 0.0
+    for i, item := range items {
+        discounted[i] = item
+        if item.GiftCertificate {
+            continue
+        }
+        // Считаем в копейках: math.Floor(1.13*100) дал бы 112, и при скидке
+        // на всю сумму у товара осталась бы цена в копейку
+        kopecks := math.Round(item.Price * 100)
+        perUnit := math.Floor(kopecks*ratio + 1e-9)
+        discounted[i].Price = (kopecks - perUnit) / 100
+        applied += item.Total() - discounted[i].Total()
+    }
+    return discounted, math.Round(applied*100) / 100
+}
+
+// ItemQuantity - ссылка на позицию заказа с количеством (для возвратов и частичного списания)
+type ItemQuantity struct {
+    ProductID int     `json:"productId" binding:"required"`
+    Quantity  float64 `json:"quantity" binding:"required,gt=0"`
+}
+
+// Order - заказ покупателя
+type Order struct {
+    ID              int        `json:"id"`
+    PaymentID       string     `json:"payment_id,omitempty"`
+    Provider        string     `json:"provider,omitempty"`
+    Email           string     `json:"email"`
+    Phone           string     `json:"phone"`
+    CustomerName    string     `json:"customer_name"`
+    DeliveryType    string     `json:"delivery_type"`
+    DeliveryAddress string     `json:"delivery_address"`
+    Comment         string     `json:"comment"`
+    Items           []Item     `json:"items"`
+    ItemsTotal      float64    `json:"items_total"`
+    DeliveryCost    float64    `json:"delivery_cost"`
+    Amount          float64    `json:"amount"`
+    Currency        string     `json:"currency"`
+    Status          Status     `json:"status"`
+    CreatedAt       time.Time  `json:"created_at"`
+    PaidAt          *time.Time `json:"paid_at,omitempty"`
+    HoldExpiresAt   *time.Time `json:"hold_expires_at,omitempty"`
+    // FulfillmentStatus - пусто, пока заказ не передан покупателю
+    FulfillmentStatus FulfillmentStatus `json:"fulfillment_status,omitempty"`
+    FulfilledAt       *time.Time        `json:"fulfilled_at,omitempty"`
+    // OfflineMethod - способ оплаты при получении; пусто, пока оплата не отмечена
+    OfflineMethod OfflineMethod `json:"offline_method,omitempty"`
+    // CertificateAmount - часть Amount, оплаченная подарочным сертификатом
+    CertificateAmount float64 `json:"certificate_amount,omitempty"`
+    // BonusAmount - списанные в счет заказа бонусы; скидка уже учтена в ценах
+    // позиций и в Amount
+    BonusAmount float64 `json:"bonus_amount,omitempty"`
+}
+
+// AmountDue возвращает сумму, которую покупатель платит деньгами, - без
+// части, оплаченной сертификатом
+func (o *Order) AmountDue() float64 {
+    return math.Round((o.Amount-o.CertificateAmount)*100) / 100
+}
+
+// Offline сообщает, что заказ оплачивается при получении
+func (o *Order) Offline() bool {
+    return o.Provider == ProviderOffline
+}
+
+// Refund - возврат по заказу. Items содержит возвращаемые позиции с ценой на момент покупки.
+type Refund struct {
+    ID              int       `json:"id"`
+    OrderID         int       `json:"order_id"`
+    RefundID        string    `json:"refund_id"`
+    Amount          float64   `json:"amount"`
+    Items           []Item    `json:"items"`
+    IncludeDelivery bool      `json:"include_delivery"`
+    Reason          string    `json:"reason,omitempty"`
+    Status          string    `json:"status"`
+    CreatedAt       time.Time `json:"created_at"`
+}
+
+// MarkingCode - код маркировки DataMatrix одной единицы товара в заказе
+type MarkingCode struct {
+    ID        int       `json:"id"`
+    OrderID   int       `json:"order_id"`
+    ProductID int       `json:"productId" binding:"required"`
+    Code      string    `json:"code" binding:"required"`
+    CreatedAt time.Time `json:"created_at"`
+}
+
+// ReceiptKind - назначение чека в истории заказа
+type ReceiptKind string
+
+const (
+    ReceiptPrepayment ReceiptKind = "prepayment" // чек предоплаты при оплате
+    ReceiptPayment    ReceiptKind = "payment"    // чек полного расчета при оплате
+    ReceiptSettlement ReceiptKind = "settlement" // чек зачета предоплаты при передаче товара
+    ReceiptRefund     ReceiptKind = "refund"     // чек возврата
+)
+
+// Receipt - чек 54-ФЗ в истории заказа. ReceiptID есть только у чеков,
+// созданных отдельно от платежа (зачет предоплаты); чек оплаты и чек
+// возврата платежная система регистрирует вместе с операцией.
+type Receipt struct {
+    ID        int         `json:"id"`
+    OrderID   int         `json:"order_id"`
+    Kind      ReceiptKind `json:"kind"`
+    ReceiptID string      `json:"receipt_id,omitempty"`
+    RefundID  string      `json:"refund_id,omitempty"`
+    Amount    float64     `json:"amount"`
+    Status    string      `json:"status,omitempty"` // pending, succeeded, canceled, manual; пусто - неизвестен
+    CreatedAt time.Time   `json:"created_at"`
+}
+
+// ReceiptStatusManual - чек не регистрируется через платежную систему и
+// пробивается на кассе курьера или пункта выдачи (расчет наличными)
+const ReceiptStatusManual = "manual"
+
+// Settled сообщает, что по заказу оформлен чек зачета предоплаты
+func Settled(receipts []*Receipt) bool {
+    for _, r := range receipts {
+        if r.Kind == ReceiptSettlement {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,112 @@
+package order
+
+import "testing"
+
+func TestLineTotal(t *testing.T) {
+    tests := []struct {
+        name     string
+        price    float64
+        quantity float64
+        want     float64
+    }{
+        {"штучный товар", 99.99, 3, 299.97},
+        {"половина копейки округляется вверх", 459.90, 0.35, 160.97},
+        {"граммы", 12.34, 0.5, 6.17},
+        {"дробное количество без остатка", 250, 1.5, 375},
+        {"меньше копейки", 0.10, 0.001, 0},
+        {"количество с погрешностью float", 100, 0.1 + 0.2, 30},
+        {"нулевое количество", 459.90, 0, 0},
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := LineTotal(tt.price, tt.quantity); got != tt.want {
+                t.Errorf("LineTotal(%v, %v) = %v, want %v", tt.price, tt.quantity, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestApplyDiscount(t *testing.T) {
+    tests := []struct {
+        name        string
+        items       []Item
+        discount    float64
+        wantPrices  []float64
+        wantApplied float64
+    }{
+        {
+            name:        "без скидки",
+            items:       []Item{{ProductID: 1, Quantity: 2, Price: 100}},
+            discount:    0,
+            wantPrices:  []float64{100},
+            wantApplied: 0,
+        },
+        {
+            name:        "пропорционально стоимости",
+            items:       []Item{{ProductID: 1, Quantity: 1, Price: 1000}, {ProductID: 2, Quantity: 2, Price: 500}},
+            discount:    200,
+            wantPrices:  []float64{900, 450},
+            wantApplied: 200,
+        },
+        {
+            name:        "скидка на единицу округляется вниз",
+            items:       []Item{{ProductID: 1, Quantity: 0.35, Price: 459.90}, {ProductID: 2, Quantity: 1, Price: 100}},
+            discount:    50,
+            wantPrices:  []float64{371.79, 80.85},
+            wantApplied: 49.99,
+        },
+        {
+            name:        "сертификат не дешевеет",
+            items:       []Item{{ProductID: 1, Quantity: 1, Price: 1000}, {ProductID: 2, Quantity: 1, Price: 500, GiftCertificate: true}},
+            discount:    100,
+            wantPrices:  []float64{900, 500},
+            wantApplied: 100,
+        },
+        {
+            name:        "скидка больше суммы товаров",
+            items:       []Item{{ProductID: 1, Quantity: 2, Price: 1.13}, {ProductID: 2, Quantity: 0.35, Price: 459.90}},
+            discount:    10000,
+            wantPrices:  []float64{0, 0},
+            wantApplied: 163.23,
+        },
+        {
+            name:        "только сертификаты",
+            items:       []Item{{ProductID: 1, Quantity: 1, Price: 500, GiftCertificate: true}},
+            discount:    100,
+            wantPrices:  []float64{500},
+            wantApplied: 0,
+        },
+    }
+
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            discounted, applied := ApplyDiscount(tt.items, tt.discount)
+
+            if applied != tt.wantApplied {
+                t.Errorf("applied = %v, want %v", applied, tt.wantApplied)
+            }
+            if applied > tt.discount {
+                t.Errorf("applied %v exceeds requested discount %v", applied, tt.discount)
+            }
+            if len(discounted) != len(tt.wantPrices) {
+                t.Fatalf("got %d items, want %d", len(discounted), len(tt.wantPrices))
+            }
+            before, after := 0.0, 0.0
+            for i, item := range discounted {
+                if item.Price != tt.wantPrices[i] {
+                    t.Errorf("item %d price = %v, want %v", i, item.Price, tt.wantPrices[i])
+                }
+                if item.Price < 0 {
+                    t.Errorf("item %d price is negative: %v", i, item.Price)
+                }
+                before += tt.items[i].Total()
+                after += item.Total()
+            }
+            // Скидка, которую вернула функция, - ровно разница сумм позиций
+            if diff := LineTotal(before-after, 1); diff != applied {
+                t.Errorf("items total decreased by %v, applied = %v", diff, applied)
+            }
+        })
+    }
+}
@@ -0,0 +1,56 @@
+package order
+
+import "time"
+
+// OrderRepository определяет контракт для работы с хранилищем заказов
+type OrderRepository interface {
+    // Create сохраняет заказ и списывает остатки товаров под него
+    Create(o *Order) error
+    GetByID(id int) (*Order, error)
+    GetByPaymentID(paymentID string) (*Order, error)
+    GetByStatus(status Status, limit, offset int) ([]*Order, error)
+    // GetExpiringHolds возвращает заказы с холдом, который истекает раньше before
+    GetExpiringHolds(before time.Time) ([]*Order, error)
+    // GetPendingPayments возвращает заказы с созданным, но не оплаченным
+    // платежом, созданные в интервале [from, to)
+    GetPendingPayments(from, to time.Time) ([]*Order, error)
+    // GetStalePending возвращает неоплаченные заказы (с платежом или без),
+    // созданные раньше before. Заказы с оплатой при получении не входят.
+    GetStalePending(before time.Time) ([]*Order, error)
+    AttachPayment(id int, provider, paymentID string) error
+    UpdateStatus(id int, status Status) error
+    // Cancel отменяет неоплаченный заказ и возвращает его товары в остатки.
+    // Возвращает false, если заказ уже оплачен или отменен.
+    Cancel(id int) (bool, error)
+    // MarkPaid отмечает заказ оплаченным, если он ждет оплаты или списания
+    // холда. Возвращает false, если заказ уже оплачен, возвращен или отменен.
+    MarkPaid(id int, paidAt time.Time) (bool, error)
+    // MarkPaidOffline отмечает оплаченным заказ с оплатой при получении.
+    // Возвращает false, если заказ не ожидает оплаты.
+    MarkPaidOffline(id int, method OfflineMethod, paidAt time.Time) (bool, error)
+    SetWaitingForCapture(id int, holdExpiresAt *time.Time) error
+    // UpdateItems меняет состав и суммы заказа (например, при частичном списании холда).
+    // Исключенные из заказа количества возвращаются в остатки.
+    UpdateItems(id int, items []Item, itemsTotal, amount float64) error
+    // HasPaidProduct проверяет, покупал ли клиент с этим email товар в оплаченном
+    // заказе, в том числе частично возвращенном
+    HasPaidProduct(email string, productID int) (bool, error)
+    // AddRefund сохраняет возврат, оформленный менеджером. Если возврат уже
+    // записан по уведомлению платежной системы, запись дополняется позициями.
+    AddRefund(r *Refund) error
+    // ConfirmRefund отмечает возврат успешным по уведомлению платежной системы.
+    // Неизвестный возврат (оформлен в личном кабинете) сохраняется; created == true.
+    ConfirmRefund(r *Refund) (created bool, err error)
+    GetRefunds(orderID int) ([]*Refund, error)
+    // AddMarkingCodes сохраняет коды маркировки заказа. Код, уже привязанный
+    // к другому заказу, отклоняется с ErrInvalidMarkingCode.
+    AddMarkingCodes(orderID int, codes []MarkingCode) error
+    GetMarkingCodes(orderID int) ([]*MarkingCode, error)
+    // SetFulfillment отмечает оплаченный заказ переданным покупателю.
+    // Возвращает false, если заказ уже передан или не оплачен.
+    SetFulfillment(id int, status FulfillmentStatus, fulfilledAt time.Time) (bool, error)
+    // AddReceipt сохраняет чек в истории заказа. Повторный чек оплаты или
+    // зачета предоплаты не сохраняется; created == false.
+    AddReceipt(r *Receipt) (created bool, err error)
+    GetReceipts(orderID int) ([]*Receipt, error)
+}
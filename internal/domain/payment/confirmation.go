@@ -0,0 +1,83 @@
+package payment
+
+import (
+    "errors"
+    "fmt"
+)
+
+// ErrInvalidConfirmation возвращается при неизвестном сценарии подтверждения,
+// способе оплаты или их недопустимом сочетании
+var ErrInvalidConfirmation = errors.New("некорректный способ подтверждения платежа")
+
+// ErrConfirmationNotSupported возвращается, если провайдер не поддерживает
+// выбранный сценарий подтверждения или способ оплаты
+var ErrConfirmationNotSupported = errors.New("провайдер не поддерживает выбранный способ оплаты")
+
+// ConfirmationType - сценарий, в котором покупатель подтверждает платеж
+type ConfirmationType string
+
+const (
+    ConfirmationRedirect          ConfirmationType = "redirect"           // переход на страницу платежной системы (confirmation_url)
+    ConfirmationEmbedded          ConfirmationType = "embedded"           // виджет ЮKassa на странице магазина (confirmation_token)
+    ConfirmationQR                ConfirmationType = "qr"                 // QR-код для оплаты с телефона (confirmation_data)
+    ConfirmationMobileApplication ConfirmationType = "mobile_application" // переход в приложение банка (confirmation_url)
+)
+
+// Способы оплаты (payment_method_data.type), которые покупатель может выбрать заранее
+const (
+    MethodBankCard = "bank_card"
+    MethodSBP      = "sbp"
+    MethodSberPay  = "sberbank"
+    MethodTPay     = "tinkoff_bank"
+    MethodYooMoney = "yoo_money"
+)
+
+var knownMethods = map[string]bool{
+    MethodBankCard: true,
+    MethodSBP:      true,
+    MethodSberPay:  true,
+    MethodTPay:     true,
+    MethodYooMoney: true,
+}
+
+// appMethods - способы оплаты через приложение банка: только для них есть
+// сценарии qr и mobile_application
+var appMethods = map[string]bool{
+    MethodSBP:     true,
+    MethodSberPay: true,
+    MethodTPay:    true,
+}
+
+// NeedsReturnURL сообщает, что после подтверждения покупатель возвращается
+// на сайт магазина по return_url
+func (t ConfirmationType) NeedsReturnURL() bool {
+    return t == ConfirmationRedirect || t == ConfirmationMobileApplication
+}
+
+// ValidateConfirmation проверяет сценарий подтверждения и способ оплаты.
+// Пустой сценарий - redirect, пустой способ - покупатель выберет его сам.
+// QR-код и переход в приложение возможны только для СБП, SberPay и T-Pay,
+// а виджет сам показывает доступные способы.
+func ValidateConfirmation(confirmation ConfirmationType, method string) error {
+    if method != "" && !knownMethods[method] {
+        return fmt.Errorf("%w: неизвестный способ оплаты %q", ErrInvalidConfirmation, method)
+    }
+
+    switch confirmation {
+    case "", ConfirmationRedirect:
+        return nil
+    case ConfirmationEmbedded:
+        if method != "" {
+            return fmt.Errorf("%w: способ оплаты выбирается в виджете", ErrInvalidConfirmation)
+        }
+        return nil
+    case ConfirmationQR, ConfirmationMobileApplication:
+        if !appMethods[method] {
+            return fmt.Errorf("%w: сценарий %s доступен для способов %s, %s, %s",
+                ErrInvalidConfirmation, confirmation, MethodSBP, MethodSberPay, MethodTPay)
+        }
+        return nil
+    }
+
+    return fmt.Errorf("%w: неизвестный сценарий %q", ErrInvalidConfirmation, confirmation)
+}
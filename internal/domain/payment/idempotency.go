@@ -0,0 +1,41 @@
+package payment
+
+import (
+    "errors"
+    "time"
+)
+
+var (
+    // ErrIdempotencyKeyReused - ключ уже использован с другим телом запроса
+    ErrIdempotencyKeyReused = errors.New("ключ идемпотентности использован с другим запросом")
+    // ErrIdempotencyInProgress - запрос с этим ключом еще обрабатывается
+    ErrIdempotencyInProgress = errors.New("запрос с этим ключом идемпотентности еще обрабатывается")
+)
+
+// IdempotencyRecord - сохраненный результат создания платежа по ключу клиента.
+// Ключи действуют в пределах Scope - покупателя, отправившего запрос.
+type IdempotencyRecord struct {
+    Scope       string
+    Key         string
+    RequestHash string
+    Completed   bool
+    OrderID     int // заказ, созданный по ключу; 0 - заказа еще нет
+    PaymentID   string
+    Response    []byte // JSON ответа, который получил клиент
+    CreatedAt   time.Time
+}
+
+// IdempotencyRepository хранит ключи идемпотентности создания платежей
+type IdempotencyRepository interface {
+    // Reserve занимает ключ: новый, брошенный или после неудачной попытки с
+    // тем же запросом. При успехе reserved == true, а в записи - заказ
+    // предыдущей попытки. Если ключ занят, возвращает существующую запись и reserved == false.
+    Reserve(scope, key, requestHash string) (rec *IdempotencyRecord, reserved bool, err error)
+    // AttachOrder запоминает заказ, созданный по ключу
+    AttachOrder(scope, key string, orderID int) error
+    // Complete сохраняет ответ, который будет повторно отдаваться по этому ключу
+    Complete(scope, key, paymentID string, response []byte) error
+    // Release освобождает ключ, если платеж создать не удалось. Ключ с
+    // заказом остается за ним: повтор продолжит тот же заказ.
+    Release(scope, key string) error
+}
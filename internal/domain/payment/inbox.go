@@ -0,0 +1,63 @@
+package payment
+
+import (
+    "encoding/json"
+    "errors"
+    "time"
+)
+
+var (
+    // ErrInboxEventNotFound - событие отсутствует во входящих
+    ErrInboxEventNotFound = errors.New("событие не найдено")
+    // ErrInboxEventProcessed - событие уже обработано, повторный запуск не нужен
+    ErrInboxEventProcessed = errors.New("событие уже обработано")
+)
+
+// InboxStatus - статус обработки входящего события
+type InboxStatus string
+
+const (
+    InboxReceived   InboxStatus = "received"   // сохранено, еще не обрабатывалось
+    InboxProcessing InboxStatus = "processing" // обрабатывается
+    InboxProcessed  InboxStatus = "processed"  // обработано
+    InboxFailed     InboxStatus = "failed"     // ошибка обработки, можно повторить
+    InboxRejected   InboxStatus = "rejected"   // не совпало с данными API или заказом
+)
+
+// Источники событий
+const (
+    SourceWebhook   = "webhook"   // уведомление провайдера
+    SourceReconcile = "reconcile" // сверка статуса, вебхук не пришел
+)
+
+// InboxEvent - входящее событие платежной системы. Пара (провайдер, тип
+// события, ID объекта) уникальна: каждое событие обрабатывается один раз,
+// сколько бы раз провайдер его ни повторил.
+type InboxEvent struct {
+    ID          int             `json:"id"`
+    Provider    string          `json:"provider"`
+    EventType   EventType       `json:"event_type"`
+    ObjectID    string          `json:"object_id"`
+    Source      string          `json:"source"`
+    Payload     json.RawMessage `json:"payload"`            // нормализованное событие
+    RawBody     string          `json:"raw_body,omitempty"` // тело уведомления как пришло
+    Status      InboxStatus     `json:"status"`
+    Attempts    int             `json:"attempts"`
+    LastError   string          `json:"last_error,omitempty"`
+    ReceivedAt  time.Time       `json:"received_at"`
+    ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+}
+
+// InboxRepository хранит входящие события
+type InboxRepository interface {
+    // Save сохраняет событие. Если такое событие уже есть, заполняет e
+    // сохраненной записью и возвращает created == false.
+    Save(e *InboxEvent) (created bool, err error)
+    GetByID(id int) (*InboxEvent, error)
+    GetByStatus(status InboxStatus, limit, offset int) ([]*InboxEvent, error)
+    // Claim захватывает событие для обработки. Возвращает false, если событие
+    // уже обработано или обрабатывается другим запросом.
+    Claim(id int) (bool, error)
+    MarkProcessed(id int) error
+    MarkFailed(id int, status InboxStatus, lastError string) error
+}
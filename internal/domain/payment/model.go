@@ -11,7 +11,21 @@ type PaymentRequest struct {
     Email       string                    `json:"email" binding:"required"`
     Phone       string                    `json:"phone" binding:"required"`
     Metadata    map[string]interface{}    `json:"metadata"`
-    ReceiptItems []map[string]interface{} `json:"receipt_items"` // Добавляем поле для чека
+    ReceiptItems []ReceiptItem            `json:"receipt_items"` // позиции чека 54-ФЗ
+    Capture     bool                      `json:"capture"`       // false - двухстадийный платеж с холдированием
+    IdempotenceKey string                 `json:"-"`             // ключ идемпотентности для платежной системы
+    OrderID     int                       `json:"-"`             // номер заказа в магазине
+    Provider    string                    `json:"-"`             // провайдер, выбранный покупателем; пусто - по умолчанию
+    // SavePaymentMethod - сохранить способ оплаты для повторных списаний
+    // (первый платеж подписки). PaymentMethodID - списать по сохраненному
+    // способу без участия покупателя. Учитываются только RecurringPayer.
+    SavePaymentMethod bool   `json:"-"`
+    PaymentMethodID   string `json:"-"`
+    // ConfirmationType - сценарий подтверждения; пусто - redirect.
+    // PaymentMethodType - способ оплаты, выбранный на сайте (sbp, sberbank, ...);
+    // пусто - покупатель выберет его на странице оплаты.
+    ConfirmationType  ConfirmationType `json:"-"`
+    PaymentMethodType string           `json:"-"`
 }
 
 type Receipt struct {
@@ -30,17 +44,73 @@ type ReceiptItem struct {
     VatCode        string         `json:"vat_code"`
     PaymentMode    string         `json:"payment_mode"`
     PaymentSubject string         `json:"payment_subject"`
+    // Measure - мера количества (piece, gram, kilogram)
+    Measure string `json:"measure,omitempty"`
+    // MarkCodeInfo и MarkMode заполняются для маркированного товара:
+    // одна позиция - одна единица со своим кодом
+    MarkCodeInfo *MarkCodeInfo `json:"mark_code_info,omitempty"`
+    MarkMode     string        `json:"mark_mode,omitempty"`
+}
+
+// MarkCodeInfo - код маркировки единицы товара
+type MarkCodeInfo struct {
+    Gs1m string `json:"gs_1m"` // код DataMatrix в base64
 }
 
 // PaymentResponse - ответ от платежной системы
 type PaymentResponse struct {
     ID           string                 `json:"id"`
-    Status       string                 `json:"status"`
+    Provider     string                 `json:"provider"`
+    Status       Status                 `json:"status"`
+    Paid         bool                   `json:"paid"` // деньги получены (списаны или захолдированы)
     Amount       Amount                 `json:"amount"`
     Description  string                 `json:"description"`
     Confirmation Confirmation           `json:"confirmation"`
     Metadata     map[string]interface{} `json:"metadata"`
     CreatedAt    time.Time              `json:"created_at"`
+    CapturedAt   *time.Time             `json:"captured_at,omitempty"`
+    ExpiresAt    *time.Time             `json:"expires_at,omitempty"` // до какого момента можно списать холд
+    // PaymentMethod - чем заплатил покупатель; есть не у всех провайдеров
+    PaymentMethod *PaymentMethod `json:"payment_method,omitempty"`
+    // CancellationDetails - кто и почему отменил платеж (для статуса canceled)
+    CancellationDetails *CancellationDetails `json:"cancellation_details,omitempty"`
+    // ReceiptRegistration - статус регистрации чека платежа; есть не у всех провайдеров
+    ReceiptRegistration string `json:"receipt_registration,omitempty"`
+}
+
+// PaymentMethod - способ оплаты платежа
+type PaymentMethod struct {
+    Type  string `json:"type"` // bank_card, sbp, yoo_money, ...
+    ID    string `json:"id"`
+    Saved bool   `json:"saved"`
+    Title string `json:"title,omitempty"`
+    Card  *Card  `json:"card,omitempty"`
+}
+
+// Card - маскированные данные карты, которой оплачен платеж
+type Card struct {
+    First6      string `json:"first6"`
+    Last4       string `json:"last4"`
+    ExpiryMonth string `json:"expiry_month"`
+    ExpiryYear  string `json:"expiry_year"`
+    CardType    string `json:"card_type"`
+}
+
+// CancellationDetails - причина отмены платежа или выплаты
+type CancellationDetails struct {
+    Party  string `json:"party"`  // инициатор: merchant, yoo_money, payment_network
+    Reason string `json:"reason"` // код причины: expired_on_confirmation, insufficient_funds, ...
+}
+
+// PayoutResponse - выплата магазина (используется, только если выплаты включены)
+type PayoutResponse struct {
+    ID                  string                 `json:"id"`
+    Status              string                 `json:"status"`
+    Amount              Amount                 `json:"amount"`
+    Description         string                 `json:"description"`
+    Metadata            map[string]interface{} `json:"metadata"`
+    CancellationDetails *CancellationDetails   `json:"cancellation_details,omitempty"`
+    CreatedAt           time.Time              `json:"created_at"`
 }
 
 type Amount struct {
@@ -48,9 +118,52 @@ type Amount struct {
     Currency string `json:"currency"`
 }
 
+// Confirmation - данные для подтверждения платежа покупателем. Заполнено
+// поле, соответствующее сценарию: confirmation_url для redirect и
+// mobile_application, confirmation_token для виджета, confirmation_data
+// (содержимое QR-кода) для qr.
 type Confirmation struct {
-    ConfirmationURL string `json:"confirmation_url"`
-    Type            string `json:"type"`
+    ConfirmationURL   string `json:"confirmation_url"`
+    Type              string `json:"type"`
+    ConfirmationToken string `json:"confirmation_token,omitempty"`
+    ConfirmationData  string `json:"confirmation_data,omitempty"`
+}
+
+// RefundRequest - запрос на возврат платежа (полный или частичный)
+type RefundRequest struct {
+    PaymentID    string
+    Amount       float64
+    Currency     string
+    Description  string
+    Email        string        // для чека возврата
+    ReceiptItems []ReceiptItem // позиции чека возврата 54-ФЗ
+    // IdempotenceKey - ключ идемпотентности для платежной системы: повтор
+    // того же возврата после таймаута не вернет деньги второй раз
+    IdempotenceKey string
+}
+
+// RefundResponse - ответ платежной системы на возврат
+type RefundResponse struct {
+    ID          string    `json:"id"`
+    PaymentID   string    `json:"payment_id"`
+    Status      Status    `json:"status"`
+    Amount      Amount    `json:"amount"`
+    Description string    `json:"description"`
+    CreatedAt   time.Time `json:"created_at"`
+    // Remaining - сумма платежа после возврата. Заполняется в уведомлениях
+    // провайдеров, которые сообщают ее вместо суммы возврата (Т-Касса);
+    // Amount тогда пуст и рассчитывается по заказу.
+    Remaining *Amount `json:"remaining,omitempty"`
+}
+
+// CaptureRequest - подтверждение (списание) холдированного платежа.
+// Сумма может быть меньше захолдированной - остаток вернется покупателю.
+type CaptureRequest struct {
+    PaymentID    string
+    Amount       float64
+    Currency     string
+    Email        string
+    ReceiptItems []ReceiptItem // чек на фактически списанную сумму
 }
 
 type ErrorResponse struct {
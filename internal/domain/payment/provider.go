@@ -0,0 +1,94 @@
+package payment
+
+import (
+    "context"
+    "errors"
+)
+
+// ErrProviderUnavailable оборачивает сбои связи с платежной системой
+// (сеть, таймаут, ответ 5xx). По нему сервис переключается на резервного провайдера.
+var ErrProviderUnavailable = errors.New("платежная система временно недоступна")
+
+// ErrUnknownProvider возвращается, когда провайдер не настроен
+var ErrUnknownProvider = errors.New("неизвестный платежный провайдер")
+
+// ErrRecurringNotSupported возвращается, если провайдер не умеет сохранять
+// способ оплаты и списывать по нему
+var ErrRecurringNotSupported = errors.New("провайдер не поддерживает повторные списания")
+
+// ErrEventMismatch возвращается, если уведомление не совпадает с данными
+// платежа в API провайдера или с сохраненным заказом
+var ErrEventMismatch = errors.New("уведомление не совпадает с платежом")
+
+// Status - нормализованный статус платежа, общий для всех провайдеров
+type Status string
+
+const (
+    StatusPending           Status = "pending"
+    StatusWaitingForCapture Status = "waiting_for_capture"
+    StatusSucceeded         Status = "succeeded"
+    StatusCanceled          Status = "canceled"
+)
+
+// EventType - нормализованный тип уведомления от платежной системы
+type EventType string
+
+const (
+    EventPaymentWaitingForCapture EventType = "payment.waiting_for_capture"
+    EventPaymentSucceeded         EventType = "payment.succeeded"
+    EventPaymentCanceled          EventType = "payment.canceled"
+    EventRefundSucceeded          EventType = "refund.succeeded"
+    EventPayoutSucceeded          EventType = "payout.succeeded"
+    EventPayoutCanceled           EventType = "payout.canceled"
+)
+
+// Event - уведомление платежной системы, приведенное к общему виду
+type Event struct {
+    Type      EventType `json:"type"`
+    Provider  string    `json:"provider"`
+    PaymentID string    `json:"payment_id"`
+    // Payment заполнен для событий платежа. Metadata есть не у всех провайдеров -
+    // данные заказа нужно брать из хранилища заказов.
+    Payment *PaymentResponse `json:"payment,omitempty"`
+    // Refund заполнен для событий возврата
+    Refund *RefundResponse `json:"refund,omitempty"`
+    // Payout заполнен для событий выплаты
+    Payout *PayoutResponse `json:"payout,omitempty"`
+}
+
+// ObjectID - идентификатор объекта события (платежа, возврата или выплаты)
+func (e *Event) ObjectID() string {
+    switch {
+    case e.Refund != nil:
+        return e.Refund.ID
+    case e.Payout != nil:
+        return e.Payout.ID
+    }
+    return e.PaymentID
+}
+
+// Provider - платежная система: операции с платежами и разбор ее уведомлений
+type Provider interface {
+    PaymentRepository
+    // Name - идентификатор провайдера в конфигурации и в заказах
+    Name() string
+    // ParseWebhook проверяет и разбирает тело уведомления. Для неизвестных
+    // событий возвращает nil без ошибки.
+    ParseWebhook(body []byte) (*Event, error)
+    // WebhookAck - ответ, который провайдер ожидает на принятое уведомление
+    WebhookAck() (contentType string, body []byte)
+}
+
+// RecurringPayer - провайдер, который умеет сохранять способ оплаты при первом
+// платеже (SavePaymentMethod) и списывать по нему без участия покупателя
+// (PaymentMethodID)
+type RecurringPayer interface {
+    CreateRecurringPayment(ctx context.Context, request *PaymentRequest) (*PaymentResponse, error)
+}
+
+// ConfirmationSupporter - провайдер, который кроме перехода на страницу оплаты
+// умеет другие сценарии подтверждения и выбор способа оплаты на сайте.
+// Остальные провайдеры принимают только redirect без способа оплаты.
+type ConfirmationSupporter interface {
+    SupportsConfirmation(confirmation ConfirmationType, method string) bool
+}
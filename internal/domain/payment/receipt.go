@@ -0,0 +1,226 @@
+package payment
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "strconv"
+)
+
+// ErrInvalidReceipt возвращается, если позиция чека 54-ФЗ содержит
+// недопустимую ставку НДС, признак способа или предмета расчета либо их
+// недопустимое сочетание
+var ErrInvalidReceipt = errors.New("некорректная позиция чека")
+
+// ErrReceiptsNotSupported возвращается, если провайдер не умеет формировать
+// отдельные чеки (например, чек зачета предоплаты)
+var ErrReceiptsNotSupported = errors.New("провайдер не поддерживает отдельные чеки")
+
+// Коды ставок НДС в чеках (vat_code ЮKassa)
+const (
+    VatNone   = 1  // без НДС
+    Vat0      = 2  // 0%
+    Vat10     = 3  // 10%
+    Vat20     = 4  // 20%
+    Vat10_110 = 5  // расчетная 10/110
+    Vat20_120 = 6  // расчетная 20/120
+    Vat5      = 7  // 5% (УСН)
+    Vat7      = 8  // 7% (УСН)
+    Vat5_105  = 9  // расчетная 5/105
+    Vat7_107  = 10 // расчетная 7/107
+    Vat22     = 11 // 22%
+    Vat22_122 = 12 // расчетная 22/122
+)
+
+// Признаки способа расчета (payment_mode)
+const (
+    PaymentModeFullPrepayment    = "full_prepayment"
+    PaymentModePartialPrepayment = "partial_prepayment"
+    PaymentModeAdvance           = "advance"
+    PaymentModeFullPayment       = "full_payment"
+    PaymentModePartialPayment    = "partial_payment"
+    PaymentModeCredit            = "credit"
+    PaymentModeCreditPayment     = "credit_payment"
+)
+
+// Признаки предмета расчета (payment_subject), которые встречаются в чеках магазина
+const (
+    PaymentSubjectCommodity = "commodity"
+    PaymentSubjectExcise    = "excise"
+    PaymentSubjectJob       = "job"
+    PaymentSubjectService   = "service"
+    PaymentSubjectPayment   = "payment"
+    PaymentSubjectComposite = "composite"
+    PaymentSubjectAnother   = "another"
+)
+
+// Меры количества предмета расчета (measure), в которых продает магазин
+const (
+    MeasurePiece    = "piece"
+    MeasureGram     = "gram"
+    MeasureKilogram = "kilogram"
+)
+
+var measures = map[string]bool{
+    MeasurePiece:    true,
+    MeasureGram:     true,
+    MeasureKilogram: true,
+}
+
+var paymentModes = map[string]bool{
+    PaymentModeFullPrepayment:    true,
+    PaymentModePartialPrepayment: true,
+    PaymentModeAdvance:           true,
+    PaymentModeFullPayment:       true,
+    PaymentModePartialPayment:    true,
+    PaymentModeCredit:            true,
+    PaymentModeCreditPayment:     true,
+}
+
+var paymentSubjects = map[string]bool{
+    PaymentSubjectCommodity: true,
+    PaymentSubjectExcise:    true,
+    PaymentSubjectJob:       true,
+    PaymentSubjectService:   true,
+    PaymentSubjectPayment:   true,
+    PaymentSubjectComposite: true,
+    PaymentSubjectAnother:   true,
+}
+
+// IsPrepayment сообщает, что расчет - предоплата или аванс
+func IsPrepayment(mode string) bool {
+    return mode == PaymentModeFullPrepayment || mode == PaymentModePartialPrepayment || mode == PaymentModeAdvance
+}
+
+// isCalculatedVat сообщает, что ставка расчетная (10/110, 20/120, ...).
+// Расчетные ставки применяются только к предоплате.
+func isCalculatedVat(code int) bool {
+    switch code {
+    case Vat10_110, Vat20_120, Vat5_105, Vat7_107, Vat22_122:
+        return true
+    }
+    return false
+}
+
+// ValidateVatCode проверяет код ставки НДС
+func ValidateVatCode(code int) error {
+    if code < VatNone || code > Vat22_122 {
+        return fmt.Errorf("%w: неизвестный код ставки НДС %d", ErrInvalidReceipt, code)
+    }
+    return nil
+}
+
+// ValidatePaymentSubject проверяет признак предмета расчета
+func ValidatePaymentSubject(subject string) error {
+    if !paymentSubjects[subject] {
+        return fmt.Errorf("%w: неизвестный предмет расчета %q", ErrInvalidReceipt, subject)
+    }
+    return nil
+}
+
+// ValidateReceiptItem проверяет, что ставка НДС, способ и предмет расчета
+// позиции допустимы и сочетаются друг с другом
+func ValidateReceiptItem(item ReceiptItem) error {
+    vatCode, err := strconv.Atoi(item.VatCode)
+    if err != nil {
+        return fmt.Errorf("%w: %q: некорректный код ставки НДС %q", ErrInvalidReceipt, item.Description, item.VatCode)
+    }
+    if err := ValidateVatCode(vatCode); err != nil {
+        return fmt.Errorf("%q: %w", item.Description, err)
+    }
+    if !paymentModes[item.PaymentMode] {
+        return fmt.Errorf("%w: %q: неизвестный способ расчета %q", ErrInvalidReceipt, item.Description, item.PaymentMode)
+    }
+    if err := ValidatePaymentSubject(item.PaymentSubject); err != nil {
+        return fmt.Errorf("%q: %w", item.Description, err)
+    }
+    if item.Measure != "" && !measures[item.Measure] {
+        return fmt.Errorf("%w: %q: неизвестная мера количества %q", ErrInvalidReceipt, item.Description, item.Measure)
+    }
+    if quantity, err := strconv.ParseFloat(item.Quantity, 64); err != nil || quantity <= 0 {
+        return fmt.Errorf("%w: %q: некорректное количество %q", ErrInvalidReceipt, item.Description, item.Quantity)
+    }
+
+    prepayment := IsPrepayment(item.PaymentMode)
+    switch {
+    case isCalculatedVat(vatCode) && !prepayment:
+        return fmt.Errorf("%w: %q: расчетная ставка НДС допустима только при предоплате", ErrInvalidReceipt, item.Description)
+    case prepayment && vatCode != VatNone && vatCode != Vat0 && !isCalculatedVat(vatCode):
+        return fmt.Errorf("%w: %q: при предоплате применяется расчетная ставка НДС", ErrInvalidReceipt, item.Description)
+    case item.PaymentMode == PaymentModeAdvance && item.PaymentSubject != PaymentSubjectPayment:
+        return fmt.Errorf("%w: %q: аванс оформляется с предметом расчета %q", ErrInvalidReceipt, item.Description, PaymentSubjectPayment)
+    case item.MarkCodeInfo != nil && (item.MarkMode != "0" || item.Quantity != "1" || item.Measure != MeasurePiece):
+        return fmt.Errorf("%w: %q: код маркировки указывается на одну штуку с mark_mode 0", ErrInvalidReceipt, item.Description)
+    }
+    return nil
+}
+
+// ValidateReceipt проверяет все позиции чека
+func ValidateReceipt(items []ReceiptItem) error {
+    for _, item := range items {
+        if err := ValidateReceiptItem(item); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// Тип отдельного чека
+const (
+    ReceiptTypePayment = "payment" // чек прихода
+    ReceiptTypeRefund  = "refund"  // чек возврата прихода
+)
+
+// Тип расчета в отдельном чеке
+const (
+    SettlementCashless   = "cashless"   // безналичными, в том числе картой через терминал
+    SettlementPrepayment = "prepayment" // зачет предоплаты
+    SettlementCash       = "cash"       // наличными; ЮKassa такие чеки не регистрирует
+)
+
+// Settlement - расчет, который закрывает чек (например, зачет предоплаты)
+type Settlement struct {
+    Type   string `json:"type"` // cashless, prepayment, cash, postpayment, consideration
+    Amount Amount `json:"amount"`
+}
+
+// ReceiptRequest - отдельный чек по уже проведенному платежу
+type ReceiptRequest struct {
+    Type           string
+    PaymentID      string
+    Email          string
+    Items          []ReceiptItem
+    Settlements    []Settlement
+    IdempotenceKey string
+}
+
+// ReceiptResponse - чек, зарегистрированный платежной системой
+type ReceiptResponse struct {
+    ID        string `json:"id"`
+    Type      string `json:"type"`
+    PaymentID string `json:"payment_id"`
+    Status    string `json:"status"` // pending, succeeded, canceled
+}
+
+// ReceiptIssuer - провайдер, который умеет формировать отдельные чеки
+type ReceiptIssuer interface {
+    CreateReceipt(ctx context.Context, request *ReceiptRequest) (*ReceiptResponse, error)
+}
+
+// PrepaymentVatCode возвращает расчетную ставку НДС, которая применяется к
+// предоплате по товару со ставкой code
+func PrepaymentVatCode(code int) int {
+    switch code {
+    case Vat10:
+        return Vat10_110
+    case Vat20:
+        return Vat20_120
+    case Vat5:
+        return Vat5_105
+    case Vat7:
+        return Vat7_107
+    case Vat22:
+        return Vat22_122
+    }
+    return code
+}
@@ -1,8 +1,14 @@
 package payment
 
+import "context"
+
 // PaymentRepository определяет контракт для работы с платежами
 type PaymentRepository interface {
-    CreatePayment(request *PaymentRequest) (*PaymentResponse, error)
-    GetPaymentStatus(paymentID string) (*PaymentResponse, error)
-    CancelPayment(paymentID string) error
+    CreatePayment(ctx context.Context, request *PaymentRequest) (*PaymentResponse, error)
+    GetPaymentStatus(ctx context.Context, paymentID string) (*PaymentResponse, error)
+    CancelPayment(ctx context.Context, paymentID string) error
+    // CapturePayment списывает холдированный платеж целиком или частично
+    CapturePayment(ctx context.Context, request *CaptureRequest) (*PaymentResponse, error)
+    // Refund возвращает покупателю всю сумму платежа или ее часть
+    Refund(ctx context.Context, request *RefundRequest) (*RefundResponse, error)
 }
\ No newline at end of file
@@ -0,0 +1,85 @@
+package product
+
+// Attributes - характеристики товара для здорового питания
+type Attributes struct {
+    Composition    string          `json:"composition,omitempty"`
+    Nutrition      *Nutrition      `json:"nutrition,omitempty"`
+    Allergens      []Allergen      `json:"allergens"`
+    Certifications []Certification `json:"certifications"`
+    ShelfLifeDays  int             `json:"shelf_life_days,omitempty"`
+}
+
+// Nutrition - пищевая ценность на 100 г продукта
+type Nutrition struct {
+    Kcal    float64 `json:"kcal"`
+    Protein float64 `json:"protein"`
+    Fat     float64 `json:"fat"`
+    Carbs   float64 `json:"carbs"`
+}
+
+// Allergen - аллерген из перечня ТР ТС 022/2011
+type Allergen string
+
+const (
+    AllergenGluten    Allergen = "gluten"
+    AllergenNuts      Allergen = "nuts"
+    AllergenPeanuts   Allergen = "peanuts"
+    AllergenMilk      Allergen = "milk"
+    AllergenEggs      Allergen = "eggs"
+    AllergenSoy       Allergen = "soy"
+    AllergenFish      Allergen = "fish"
+    AllergenShellfish Allergen = "shellfish"
+    AllergenSesame    Allergen = "sesame"
+    AllergenCelery    Allergen = "celery"
+    AllergenMustard   Allergen = "mustard"
+    AllergenSulphites Allergen = "sulphites"
+    AllergenLupin     Allergen = "lupin"
+)
+
+var allergens = map[Allergen]bool{
+    AllergenGluten: true, AllergenNuts: true, AllergenPeanuts: true,
+    AllergenMilk: true, AllergenEggs: true, AllergenSoy: true,
+    AllergenFish: true, AllergenShellfish: true, AllergenSesame: true,
+    AllergenCelery: true, AllergenMustard: true, AllergenSulphites: true,
+    AllergenLupin: true,
+}
+
+// Valid сообщает, входит ли аллерген в известный перечень
+func (a Allergen) Valid() bool {
+    return allergens[a]
+}
+
+// Certification - сертификат или маркировка товара
+type Certification string
+
+const (
+    CertificationOrganic     Certification = "organic"
+    CertificationVegan       Certification = "vegan"
+    CertificationVegetarian  Certification = "vegetarian"
+    CertificationGlutenFree  Certification = "gluten_free"
+    CertificationLactoseFree Certification = "lactose_free"
+    CertificationSugarFree   Certification = "sugar_free"
+    CertificationHalal       Certification = "halal"
+    CertificationKosher      Certification = "kosher"
+)
+
+var certifications = map[Certification]bool{
+    CertificationOrganic: true, CertificationVegan: true,
+    CertificationVegetarian: true, CertificationGlutenFree: true,
+    CertificationLactoseFree: true, CertificationSugarFree: true,
+    CertificationHalal: true, CertificationKosher: true,
+}
+
+// Valid сообщает, входит ли сертификат в известный перечень
+func (c Certification) Valid() bool {
+    return certifications[c]
+}
+
+// Filter - условия отбора товаров каталога. Пустые поля не ограничивают выборку.
+type Filter struct {
+    CategoryID       int
+    Certifications   []Certification // товар должен иметь все перечисленные
+    ExcludeAllergens []Allergen      // товар не должен содержать ни одного из перечисленных
+    MaxKcal          float64
+    MinProtein       float64
+}
@@ -1,13 +1,111 @@
 package product
 
-import "time"
+import (
+    "errors"
+    "fmt"
+    "math"
+    "time"
+)
+
+var (
+    // ErrNotFound возвращается, когда товар не найден
+    ErrNotFound = errors.New("товар не найден")
+    // ErrInvalidFilter возвращается при некорректных условиях отбора товаров
+    ErrInvalidFilter = errors.New("некорректный фильтр")
+    // ErrInvalidQuantity возвращается, когда количество не кратно шагу товара или меньше минимального
+    ErrInvalidQuantity = errors.New("некорректное количество товара")
+)
+
+// Unit - единица измерения, за которую указана цена товара
+type Unit string
+
+const (
+    UnitPiece    Unit = "pcs" // штуки
+    UnitGram     Unit = "g"   // граммы
+    UnitKilogram Unit = "kg"  // килограммы
+)
+
+// Title возвращает сокращение единицы для покупателя
+func (u Unit) Title() string {
+    switch u {
+    case UnitGram:
+        return "г"
+    case UnitKilogram:
+        return "кг"
+    }
+    return "шт."
+}
 
 type Product struct {
-    ID          int       `json:"id"`
-    Title       string    `json:"title"`
-    Price       float64   `json:"price"`
-    Description string    `json:"description"`
-    Discount    float64   `json:"discount"`
-    Image       string    `json:"image,omitempty"` // omitempty - не показывать если nil
-    CreatedAt   time.Time `json:"created_at"`
-}
\ No newline at end of file
+    ID          int        `json:"id"`
+    Title       string     `json:"title"`
+    Slug        string     `json:"slug"`
+    Price       float64    `json:"price"`
+    Description string     `json:"description"`
+    Discount    float64    `json:"discount"`
+    Image       string     `json:"image,omitempty"` // omitempty - не показывать если nil
+    CategoryID  int        `json:"category_id,omitempty"`
+    Stock       *float64   `json:"stock"` // nil - остаток не ведется
+    Attributes  Attributes `json:"attributes"`
+    // VatCode и PaymentSubject - налоговые признаки для чека 54-ФЗ.
+    // Пусто - берутся значения по умолчанию из настроек магазина.
+    VatCode        int    `json:"vat_code,omitempty"`
+    PaymentSubject string `json:"payment_subject,omitempty"`
+    // Marked - товар подлежит обязательной маркировке «Честный знак»
+    Marked bool `json:"marked"`
+    // GiftCertificate - товар продается как подарочный сертификат номиналом в
+    // цену товара: после оплаты покупатель получает код на email
+    GiftCertificate bool `json:"gift_certificate"`
+    // Unit, QuantityStep и MinQuantity - в чем продается товар: цена за
+    // единицу, количество кратно шагу и не меньше минимального
+    Unit         Unit    `json:"unit"`
+    QuantityStep float64 `json:"quantity_step"`
+    MinQuantity  float64 `json:"min_quantity"`
+    Rating      float64    `json:"rating"`       // средняя оценка по одобренным отзывам
+    ReviewCount int        `json:"review_count"` // количество одобренных отзывов
+    CreatedAt   time.Time  `json:"created_at"`
+}
+
+// FinalPrice возвращает цену с учетом скидки
+func (p *Product) FinalPrice() float64 {
+    if p.Discount > 0 {
+        return p.Price * (1 - p.Discount/100)
+    }
+    return p.Price
+}
+
+// ValidateQuantity проверяет, что товар можно заказать в количестве quantity:
+// не меньше минимального (и шага) и кратно шагу с точностью до тысячных
+func (p *Product) ValidateQuantity(quantity float64) error {
+    step := p.QuantityStep
+    if step <= 0 {
+        step = 1
+    }
+    minimum := math.Max(p.MinQuantity, step)
+
+    milli := math.Round(quantity * 1000)
+    if math.Abs(milli-quantity*1000) > 1e-6 {
+        return fmt.Errorf("%w: %s - не больше трех знаков после запятой", ErrInvalidQuantity, p.Title)
+    }
+    if milli < math.Round(minimum*1000) {
+        return fmt.Errorf("%w: %s - не меньше %g %s", ErrInvalidQuantity, p.Title, minimum, p.Unit.Title())
+    }
+    if int64(milli)%int64(math.Round(step*1000)) != 0 {
+        return fmt.Errorf("%w: %s - кратно %g %s", ErrInvalidQuantity, p.Title, step, p.Unit.Title())
+    }
+    return nil
+}
+
+// Available сообщает, есть ли товар в наличии. Товар без учета остатков
+// считается доступным.
+func (p *Product) Available() bool {
+    return p.Stock == nil || *p.Stock > 0
+}
+
+// Category - категория каталога
+type Category struct {
+    ID       int    `json:"id"`
+    Name     string `json:"name"`
+    Slug     string `json:"slug"`
+    ParentID int    `json:"parent_id,omitempty"`
+}
@@ -3,5 +3,15 @@ package product
 // UserRepository определяет контракт для работы с хранилищем пользователей.
 type ProductRepository interface {
     GetAll() ([]*Product, error)
+    // Find возвращает товары, подходящие под фильтр
+    Find(filter Filter) ([]*Product, error)
     GetByID(id int) (*Product, error)
-}
\ No newline at end of file
+    GetCategories() ([]*Category, error)
+    GetBySlug(slug string) (*Product, error)
+    // GetSlugRedirect возвращает актуальный slug товара по его старому slug
+    GetSlugRedirect(oldSlug string) (string, error)
+    // IsSlugTaken проверяет, занят ли slug другим товаром (в том числе в истории)
+    IsSlugTaken(slug string, productID int) (bool, error)
+    // UpdateSlug назначает товару новый slug, сохраняя старый для редиректа
+    UpdateSlug(productID int, newSlug, oldSlug string) error
+}
@@ -0,0 +1,7 @@
+package recommendation
+
+// Related - товар, который покупают вместе с исходным
+type Related struct {
+    ProductID int `json:"product_id"`
+    Score     int `json:"score"` // в скольких оплаченных заказах товары встретились вместе
+}
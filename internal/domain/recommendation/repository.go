@@ -0,0 +1,11 @@
+package recommendation
+
+// RecommendationRepository определяет контракт хранилища рекомендаций
+type RecommendationRepository interface {
+    // PaidOrderBaskets возвращает списки товаров из оплаченных заказов, в том
+    // числе частично возвращенных
+    PaidOrderBaskets() ([][]int, error)
+    // ReplaceRelated атомарно заменяет все рассчитанные связи товаров
+    ReplaceRelated(related map[int][]Related) error
+    GetRelated(productID, limit int) ([]Related, error)
+}
@@ -0,0 +1,50 @@
+package review
+
+import (
+    "errors"
+    "time"
+)
+
+var (
+    // ErrNotFound возвращается, когда отзыв не найден
+    ErrNotFound = errors.New("отзыв не найден")
+    // ErrInvalid возвращается, когда отзыв не прошел проверку
+    ErrInvalid = errors.New("некорректный отзыв")
+)
+
+// Status - статус модерации отзыва
+type Status string
+
+const (
+    StatusPending  Status = "pending"
+    StatusApproved Status = "approved"
+    StatusRejected Status = "rejected"
+)
+
+// Valid сообщает, является ли статус допустимым
+func (s Status) Valid() bool {
+    return s == StatusPending || s == StatusApproved || s == StatusRejected
+}
+
+const (
+    MinRating     = 1
+    MaxRating     = 5
+    MaxTextLength = 5000
+    MaxPhotos     = 5
+)
+
+// Review - отзыв покупателя о товаре
+type Review struct {
+    ID               int        `json:"id"`
+    ProductID        int        `json:"product_id"`
+    AuthorName       string     `json:"author_name"`
+    Email            string     `json:"email,omitempty"` // не показывается в публичной выдаче
+    Rating           int        `json:"rating"`
+    Text             string     `json:"text"`
+    Photos           []string   `json:"photos"`
+    VerifiedPurchase bool       `json:"verified_purchase"`
+    Status           Status     `json:"status"`
+    ModeratorComment string     `json:"moderator_comment,omitempty"`
+    CreatedAt        time.Time  `json:"created_at"`
+    ModeratedAt      *time.Time `json:"moderated_at,omitempty"`
+}
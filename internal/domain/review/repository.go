@@ -0,0 +1,12 @@
+package review
+
+// ReviewRepository определяет контракт для работы с хранилищем отзывов
+type ReviewRepository interface {
+    Create(r *Review) error
+    GetByID(id int) (*Review, error)
+    GetByProduct(productID int, status Status, limit, offset int) ([]*Review, error)
+    GetByStatus(status Status, limit, offset int) ([]*Review, error)
+    // Moderate меняет статус отзыва в любом статусе: модератор может и снять
+    // ранее опубликованный отзыв, и вернуть отклоненный
+    Moderate(id int, status Status, comment string) error
+}
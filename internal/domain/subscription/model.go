@@ -0,0 +1,204 @@
+package subscription
+
+import (
+    "errors"
+    "fmt"
+    "time"
+)
+
+var (
+    // ErrNotFound возвращается, когда подписка, тариф или списание не найдены
+    ErrNotFound = errors.New("подписка не найдена")
+    // ErrInvalidTransition возвращается, когда действие недоступно в текущем статусе подписки
+    ErrInvalidTransition = errors.New("действие недоступно для подписки")
+    // ErrPlanUnavailable возвращается, когда тариф не найден или снят с продажи
+    ErrPlanUnavailable = errors.New("тариф подписки недоступен")
+)
+
+// Status - статус подписки
+type Status string
+
+const (
+    StatusPending  Status = "pending"  // ждем первую оплату
+    StatusActive   Status = "active"   // списания по расписанию
+    StatusPastDue  Status = "past_due" // списание не прошло, повторяем
+    StatusPaused   Status = "paused"   // покупатель приостановил, списаний нет
+    StatusCanceled Status = "canceled" // отменена покупателем, менеджером или после неудачных повторов
+)
+
+// Причины отмены подписки
+const (
+    CancelByCustomer       = "customer"
+    CancelByManager        = "manager"
+    CancelPaymentFailed    = "payment_failed"     // все повторные списания не прошли
+    CancelFirstPaymentFail = "first_payment_fail" // первая оплата не прошла
+)
+
+// IntervalUnit - единица периода списаний
+type IntervalUnit string
+
+const (
+    IntervalWeek  IntervalUnit = "week"
+    IntervalMonth IntervalUnit = "month"
+)
+
+// Interval - период между списаниями, например 1 месяц или 2 недели
+type Interval struct {
+    Unit  IntervalUnit `json:"unit"`
+    Count int          `json:"count"`
+}
+
+// Next возвращает дату следующего списания после from
+func (i Interval) Next(from time.Time) time.Time {
+    if i.Unit == IntervalWeek {
+        return from.AddDate(0, 0, 7*i.Count)
+    }
+    return from.AddDate(0, i.Count, 0)
+}
+
+// Plan - тариф подписки: что получает покупатель и сколько платит за период.
+// Цена включает доставку.
+type Plan struct {
+    ID          int       `json:"id"`
+    Name        string    `json:"name"`
+    Description string    `json:"description"`
+    Price       float64   `json:"price"`
+    Currency    string    `json:"currency"`
+    Interval    Interval  `json:"interval"`
+    Active      bool      `json:"active"`
+    CreatedAt   time.Time `json:"created_at"`
+}
+
+// Subscription - подписка покупателя на тариф. Token - секрет для ссылки,
+// по которой покупатель управляет подпиской без входа в аккаунт.
+type Subscription struct {
+    ID              int        `json:"id"`
+    PlanID          int        `json:"plan_id"`
+    Token           string     `json:"-"`
+    Email           string     `json:"email"`
+    Phone           string     `json:"phone"`
+    CustomerName    string     `json:"customer_name"`
+    DeliveryAddress string     `json:"delivery_address"`
+    Status          Status     `json:"status"`
+    Provider        string     `json:"provider"`
+    PaymentMethodID string     `json:"-"`
+    // PaymentMethodTitle - маска карты для покупателя, например «Bank card *4444»
+    PaymentMethodTitle string     `json:"payment_method_title,omitempty"`
+    NextChargeAt       *time.Time `json:"next_charge_at,omitempty"`
+    // FailedAttempts - сколько списаний подряд не прошло
+    FailedAttempts int        `json:"failed_attempts"`
+    CancelReason   string     `json:"cancel_reason,omitempty"`
+    CreatedAt      time.Time  `json:"created_at"`
+    PausedAt       *time.Time `json:"paused_at,omitempty"`
+    CanceledAt     *time.Time `json:"canceled_at,omitempty"`
+
+    Plan *Plan `json:"plan,omitempty"`
+}
+
+// Activate отмечает успешную оплату периода: подписка становится активной,
+// счетчик неудач сбрасывается, следующее списание - через период.
+// methodID и title обновляются, если платеж сохранил новый способ оплаты.
+func (s *Subscription) Activate(interval Interval, paidAt time.Time, methodID, title string) error {
+    if s.Status == StatusCanceled {
+        return fmt.Errorf("%w: подписка отменена", ErrInvalidTransition)
+    }
+    if methodID != "" && methodID != s.PaymentMethodID {
+        s.PaymentMethodID = methodID
+        s.PaymentMethodTitle = title
+    }
+    if s.PaymentMethodID == "" {
+        return fmt.Errorf("%w: способ оплаты не сохранен", ErrInvalidTransition)
+    }
+
+    next := interval.Next(paidAt)
+    s.NextChargeAt = &next
+    s.FailedAttempts = 0
+    // Приостановленная подписка остается на паузе: оплачен уже начатый период
+    if s.Status != StatusPaused {
+        s.Status = StatusActive
+    }
+    return nil
+}
+
+// Fail отмечает неудачное автосписание. Если повторов не осталось
+// (retryAt == nil), подписка отменяется.
+func (s *Subscription) Fail(now time.Time, retryAt *time.Time) {
+    s.FailedAttempts++
+    if retryAt == nil {
+        s.cancel(now, CancelPaymentFailed)
+        return
+    }
+    s.Status = StatusPastDue
+    s.NextChargeAt = retryAt
+}
+
+// Pause приостанавливает активную подписку. Дата следующего списания
+// сохраняется и сдвигается при возобновлении.
+func (s *Subscription) Pause(now time.Time) error {
+    if s.Status != StatusActive {
+        return fmt.Errorf("%w: приостановить можно только активную подписку", ErrInvalidTransition)
+    }
+    s.Status = StatusPaused
+    s.PausedAt = &now
+    return nil
+}
+
+// Resume возобновляет приостановленную подписку. Если дата списания прошла
+// за время паузы, списание произойдет при ближайшем запуске планировщика.
+func (s *Subscription) Resume(now time.Time) error {
+    if s.Status != StatusPaused {
+        return fmt.Errorf("%w: подписка не приостановлена", ErrInvalidTransition)
+    }
+    s.Status = StatusActive
+    s.PausedAt = nil
+    if s.NextChargeAt == nil || s.NextChargeAt.Before(now) {
+        s.NextChargeAt = &now
+    }
+    return nil
+}
+
+// Cancel отменяет подписку. Уже отмененную подписку отменить нельзя.
+func (s *Subscription) Cancel(now time.Time, reason string) error {
+    if s.Status == StatusCanceled {
+        return fmt.Errorf("%w: подписка уже отменена", ErrInvalidTransition)
+    }
+    s.cancel(now, reason)
+    return nil
+}
+
+func (s *Subscription) cancel(now time.Time, reason string) {
+    s.Status = StatusCanceled
+    s.CancelReason = reason
+    s.CanceledAt = &now
+    s.NextChargeAt = nil
+}
+
+// ChargeInitiator - кто инициировал списание
+type ChargeInitiator string
+
+const (
+    InitiatorCustomer ChargeInitiator = "customer" // покупатель подтвердил оплату (первая оплата, оплата другой картой)
+    InitiatorMerchant ChargeInitiator = "merchant" // автосписание по сохраненному способу
+)
+
+// Статусы списания
+const (
+    ChargePending   = "pending"
+    ChargeSucceeded = "succeeded"
+    ChargeCanceled  = "canceled"
+)
+
+// Charge - списание за период подписки. По каждому списанию создается заказ,
+// который дальше проходит обычный путь: оплата, чек, сборка, доставка.
+type Charge struct {
+    ID             int             `json:"id"`
+    SubscriptionID int             `json:"subscription_id"`
+    OrderID        int             `json:"order_id"`
+    PaymentID      string          `json:"payment_id"`
+    Initiator      ChargeInitiator `json:"initiator"`
+    Amount         float64         `json:"amount"`
+    Status         string          `json:"status"`
+    // Reason - причина отказа платежной системы
+    Reason    string    `json:"reason,omitempty"`
+    CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,26 @@
+package subscription
+
+import "time"
+
+// SubscriptionRepository определяет контракт для работы с хранилищем подписок
+type SubscriptionRepository interface {
+    GetPlans(activeOnly bool) ([]*Plan, error)
+    GetPlan(id int) (*Plan, error)
+
+    Create(s *Subscription) error
+    GetByID(id int) (*Subscription, error)
+    GetByToken(token string) (*Subscription, error)
+    GetByStatus(status Status, limit, offset int) ([]*Subscription, error)
+    // GetDue возвращает активные и просроченные подписки, по которым пора
+    // списывать и нет списания в обработке
+    GetDue(now time.Time, limit int) ([]*Subscription, error)
+    // Update сохраняет статус, способ оплаты и расписание списаний
+    Update(s *Subscription) error
+
+    AddCharge(c *Charge) error
+    GetChargeByPaymentID(paymentID string) (*Charge, error)
+    // CompleteCharge переводит списание из pending в status. Возвращает
+    // false, если списание уже завершено (повторное уведомление).
+    CompleteCharge(paymentID, status, reason string) (bool, error)
+    GetCharges(subscriptionID int) ([]*Charge, error)
+}
@@ -0,0 +1,15 @@
+-- Категории каталога и остатки товаров (нужны для фида Яндекс.Маркета).
+-- Остаток NULL - учет не ведется, товар считается доступным: иначе после
+-- миграции весь существующий каталог пропал бы из наличия.
+CREATE TABLE IF NOT EXISTS category (
+    id         SERIAL PRIMARY KEY,
+    name       VARCHAR(255) NOT NULL,
+    parent_id  INTEGER REFERENCES category (id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+ALTER TABLE product
+    ADD COLUMN IF NOT EXISTS category_id INTEGER REFERENCES category (id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS stock INTEGER;
+
+CREATE INDEX IF NOT EXISTS idx_product_category_id ON product (category_id);
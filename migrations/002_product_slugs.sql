@@ -0,0 +1,11 @@
+-- ЧПУ-адреса товаров и история старых адресов для редиректов
+ALTER TABLE product
+    ADD COLUMN IF NOT EXISTS slug VARCHAR(100);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_product_slug ON product (slug);
+
+CREATE TABLE IF NOT EXISTS product_slug_history (
+    slug       VARCHAR(100) PRIMARY KEY,
+    product_id INTEGER NOT NULL REFERENCES product (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,15 @@
+-- Состав, пищевая ценность, аллергены и сертификаты товаров
+CREATE TABLE IF NOT EXISTS product_attributes (
+    product_id      INTEGER PRIMARY KEY REFERENCES product (id) ON DELETE CASCADE,
+    composition     TEXT,
+    kcal            NUMERIC(7, 2),
+    protein         NUMERIC(6, 2),
+    fat             NUMERIC(6, 2),
+    carbs           NUMERIC(6, 2),
+    allergens       TEXT[] NOT NULL DEFAULT '{}',
+    certifications  TEXT[] NOT NULL DEFAULT '{}',
+    shelf_life_days INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS idx_product_attributes_allergens ON product_attributes USING GIN (allergens);
+CREATE INDEX IF NOT EXISTS idx_product_attributes_certifications ON product_attributes USING GIN (certifications);
@@ -0,0 +1,40 @@
+-- Заказы: до этого данные заказа жили только в metadata платежа ЮKassa
+CREATE TABLE IF NOT EXISTS orders (
+    id               SERIAL PRIMARY KEY,
+    payment_id       VARCHAR(64) UNIQUE,
+    email            VARCHAR(255) NOT NULL,
+    phone            VARCHAR(32) NOT NULL,
+    customer_name    VARCHAR(255) NOT NULL,
+    delivery_type    VARCHAR(16) NOT NULL,
+    delivery_address TEXT NOT NULL DEFAULT '',
+    comment          TEXT NOT NULL DEFAULT '',
+    items            JSONB NOT NULL,
+    items_total      NUMERIC(12, 2) NOT NULL,
+    delivery_cost    NUMERIC(12, 2) NOT NULL,
+    amount           NUMERIC(12, 2) NOT NULL,
+    currency         VARCHAR(3) NOT NULL,
+    status           VARCHAR(32) NOT NULL DEFAULT 'pending',
+    created_at       TIMESTAMP NOT NULL DEFAULT NOW(),
+    paid_at          TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_email_status ON orders (LOWER(email), status);
+
+-- Отзывы покупателей с премодерацией
+CREATE TABLE IF NOT EXISTS review (
+    id                SERIAL PRIMARY KEY,
+    product_id        INTEGER NOT NULL REFERENCES product (id) ON DELETE CASCADE,
+    author_name       VARCHAR(255) NOT NULL,
+    email             VARCHAR(255) NOT NULL,
+    rating            SMALLINT NOT NULL CHECK (rating BETWEEN 1 AND 5),
+    text              TEXT NOT NULL DEFAULT '',
+    photos            TEXT[] NOT NULL DEFAULT '{}',
+    verified_purchase BOOLEAN NOT NULL DEFAULT FALSE,
+    status            VARCHAR(16) NOT NULL DEFAULT 'pending',
+    moderator_comment TEXT NOT NULL DEFAULT '',
+    created_at        TIMESTAMP NOT NULL DEFAULT NOW(),
+    moderated_at      TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_review_product_status ON review (product_id, status);
+CREATE INDEX IF NOT EXISTS idx_review_status ON review (status, created_at);
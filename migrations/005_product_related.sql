@@ -0,0 +1,10 @@
+-- «С этим товаром покупают»: пересчитывается фоновой задачей по оплаченным заказам
+CREATE TABLE IF NOT EXISTS product_related (
+    product_id INTEGER NOT NULL REFERENCES product (id) ON DELETE CASCADE,
+    related_id INTEGER NOT NULL REFERENCES product (id) ON DELETE CASCADE,
+    score      INTEGER NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (product_id, related_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_status ON orders (status);
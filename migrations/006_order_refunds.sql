@@ -0,0 +1,14 @@
+-- Возвраты по заказам (полные и частичные)
+CREATE TABLE IF NOT EXISTS order_refunds (
+    id               SERIAL PRIMARY KEY,
+    order_id         INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    refund_id        VARCHAR(64) NOT NULL UNIQUE,
+    amount           NUMERIC(12, 2) NOT NULL,
+    items            JSONB NOT NULL DEFAULT '[]',
+    include_delivery BOOLEAN NOT NULL DEFAULT FALSE,
+    reason           TEXT NOT NULL DEFAULT '',
+    status           VARCHAR(16) NOT NULL,
+    created_at       TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_refunds_order_id ON order_refunds (order_id);
@@ -0,0 +1,6 @@
+-- Двухстадийные платежи: срок, до которого можно списать холд
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS hold_expires_at TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS idx_orders_hold_expires_at ON orders (hold_expires_at)
+    WHERE status = 'waiting_for_capture';
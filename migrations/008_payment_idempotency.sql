@@ -0,0 +1,17 @@
+-- Ключи идемпотентности создания платежа (заголовок Idempotency-Key). Ключи
+-- принадлежат покупателю (email), одинаковые ключи разных покупателей не
+-- пересекаются. Ключ запоминает заказ: повтор запроса после неясного сбоя
+-- создания платежа продолжает тот же заказ, а не оформляет новый. Статус
+-- failed - попытка не удалась, ключ можно повторить.
+CREATE TABLE IF NOT EXISTS payment_idempotency (
+    scope        VARCHAR(255) NOT NULL DEFAULT '',
+    key          VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL,
+    status       VARCHAR(16) NOT NULL DEFAULT 'in_progress',
+    order_id     INTEGER REFERENCES orders (id),
+    payment_id   VARCHAR(64),
+    response     JSONB,
+    created_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at   TIMESTAMP NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (scope, key)
+);
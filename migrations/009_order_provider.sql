@@ -0,0 +1,3 @@
+-- Платежный провайдер, через которого проведен заказ
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS provider VARCHAR(32) NOT NULL DEFAULT 'yookassa';
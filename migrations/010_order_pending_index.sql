@@ -0,0 +1,3 @@
+-- Сверка статусов: поиск заказов, зависших в ожидании оплаты
+CREATE INDEX IF NOT EXISTS idx_orders_pending_created_at ON orders (created_at)
+    WHERE status = 'pending';
@@ -0,0 +1,19 @@
+-- Входящие события платежных систем: каждое уведомление обрабатывается один раз
+CREATE TABLE IF NOT EXISTS payment_inbox (
+    id           SERIAL PRIMARY KEY,
+    provider     VARCHAR(32) NOT NULL,
+    event_type   VARCHAR(64) NOT NULL,
+    object_id    VARCHAR(128) NOT NULL,
+    source       VARCHAR(16) NOT NULL,
+    payload      JSONB NOT NULL,
+    raw_body     TEXT NOT NULL DEFAULT '',
+    status       VARCHAR(16) NOT NULL DEFAULT 'received',
+    attempts     INTEGER NOT NULL DEFAULT 0,
+    last_error   TEXT NOT NULL DEFAULT '',
+    received_at  TIMESTAMP NOT NULL DEFAULT NOW(),
+    claimed_at   TIMESTAMP,
+    processed_at TIMESTAMP,
+    UNIQUE (provider, event_type, object_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_inbox_status ON payment_inbox (status, received_at);
@@ -0,0 +1,5 @@
+-- Налоговые признаки товара для чеков 54-ФЗ. NULL - значение по умолчанию
+-- из настроек магазина (payment.receipt)
+ALTER TABLE product
+    ADD COLUMN IF NOT EXISTS vat_code SMALLINT CHECK (vat_code BETWEEN 1 AND 12),
+    ADD COLUMN IF NOT EXISTS payment_subject VARCHAR(32);
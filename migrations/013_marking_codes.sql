@@ -0,0 +1,14 @@
+-- Обязательная маркировка «Честный знак»: признак товара и коды DataMatrix,
+-- отсканированные при сборке заказа (один код - одна единица товара)
+ALTER TABLE product
+    ADD COLUMN IF NOT EXISTS marked BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE IF NOT EXISTS order_marking_codes (
+    id         SERIAL PRIMARY KEY,
+    order_id   INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    product_id INTEGER NOT NULL,
+    code       TEXT NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_marking_codes_order_id ON order_marking_codes (order_id);
@@ -0,0 +1,23 @@
+-- Передача товара покупателю и история чеков 54-ФЗ по заказу: чек при
+-- оплате (предоплата или полный расчет), чек зачета предоплаты при передаче
+-- товара и чеки возврата
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS fulfillment_status VARCHAR(16),
+    ADD COLUMN IF NOT EXISTS fulfilled_at TIMESTAMP;
+
+CREATE TABLE IF NOT EXISTS order_receipts (
+    id         SERIAL PRIMARY KEY,
+    order_id   INTEGER NOT NULL REFERENCES orders (id) ON DELETE CASCADE,
+    kind       VARCHAR(16) NOT NULL,
+    receipt_id VARCHAR(64),
+    refund_id  VARCHAR(64),
+    amount     NUMERIC(12, 2) NOT NULL,
+    status     VARCHAR(16) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_order_receipts_order_id ON order_receipts (order_id);
+
+-- Чек оплаты и чек зачета предоплаты оформляются по заказу один раз
+CREATE UNIQUE INDEX IF NOT EXISTS idx_order_receipts_once ON order_receipts (order_id, kind)
+    WHERE kind <> 'refund';
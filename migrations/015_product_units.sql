@@ -0,0 +1,20 @@
+-- Весовые товары: единица измерения, шаг и минимальное количество. Цена
+-- указывается за единицу измерения, количество в заказе может быть дробным
+-- (до тысячных), поэтому остатки и корзина тоже хранятся дробными.
+ALTER TABLE product
+    ADD COLUMN IF NOT EXISTS unit VARCHAR(8) NOT NULL DEFAULT 'pcs' CHECK (unit IN ('pcs', 'g', 'kg')),
+    ADD COLUMN IF NOT EXISTS quantity_step NUMERIC(10, 3) NOT NULL DEFAULT 1 CHECK (quantity_step > 0),
+    ADD COLUMN IF NOT EXISTS min_quantity NUMERIC(10, 3) NOT NULL DEFAULT 0 CHECK (min_quantity >= 0),
+    ALTER COLUMN stock TYPE NUMERIC(12, 3);
+
+-- Штучный товар продается целыми единицами
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'product_pcs_step_integer') THEN
+        ALTER TABLE product
+            ADD CONSTRAINT product_pcs_step_integer CHECK (unit <> 'pcs' OR quantity_step = TRUNC(quantity_step));
+    END IF;
+END $$;
+
+ALTER TABLE IF EXISTS baskets
+    ALTER COLUMN quantity TYPE NUMERIC(12, 3);
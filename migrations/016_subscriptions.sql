@@ -0,0 +1,51 @@
+-- Подписки на регулярные наборы: тарифы, подписки покупателей с сохраненным
+-- способом оплаты и списания за каждый период
+CREATE TABLE IF NOT EXISTS subscription_plans (
+    id             SERIAL PRIMARY KEY,
+    name           VARCHAR(255) NOT NULL,
+    description    TEXT NOT NULL DEFAULT '',
+    price          NUMERIC(12, 2) NOT NULL CHECK (price > 0),
+    currency       VARCHAR(3) NOT NULL DEFAULT 'RUB',
+    interval_unit  VARCHAR(8) NOT NULL DEFAULT 'month' CHECK (interval_unit IN ('week', 'month')),
+    interval_count INTEGER NOT NULL DEFAULT 1 CHECK (interval_count > 0),
+    active         BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at     TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS subscriptions (
+    id                   SERIAL PRIMARY KEY,
+    plan_id              INTEGER NOT NULL REFERENCES subscription_plans (id),
+    token                VARCHAR(64) NOT NULL UNIQUE,
+    email                VARCHAR(255) NOT NULL,
+    phone                VARCHAR(32) NOT NULL,
+    customer_name        VARCHAR(255) NOT NULL DEFAULT '',
+    delivery_address     TEXT NOT NULL DEFAULT '',
+    status               VARCHAR(16) NOT NULL DEFAULT 'pending',
+    provider             VARCHAR(32) NOT NULL,
+    payment_method_id    VARCHAR(128) NOT NULL DEFAULT '',
+    payment_method_title VARCHAR(255) NOT NULL DEFAULT '',
+    next_charge_at       TIMESTAMP,
+    failed_attempts      INTEGER NOT NULL DEFAULT 0,
+    cancel_reason        VARCHAR(32) NOT NULL DEFAULT '',
+    created_at           TIMESTAMP NOT NULL DEFAULT NOW(),
+    paused_at            TIMESTAMP,
+    canceled_at          TIMESTAMP
+);
+
+-- Выборка подписок к списанию планировщиком
+CREATE INDEX IF NOT EXISTS idx_subscriptions_due ON subscriptions (next_charge_at)
+    WHERE status IN ('active', 'past_due');
+
+CREATE TABLE IF NOT EXISTS subscription_charges (
+    id              SERIAL PRIMARY KEY,
+    subscription_id INTEGER NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+    order_id        INTEGER NOT NULL REFERENCES orders (id),
+    payment_id      VARCHAR(128) NOT NULL UNIQUE,
+    initiator       VARCHAR(16) NOT NULL,
+    amount          NUMERIC(12, 2) NOT NULL,
+    status          VARCHAR(16) NOT NULL DEFAULT 'pending',
+    reason          VARCHAR(64) NOT NULL DEFAULT '',
+    created_at      TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_subscription_charges_subscription_id ON subscription_charges (subscription_id);
@@ -0,0 +1,4 @@
+-- Оплата при получении: наличными или картой курьеру либо в пункте выдачи.
+-- У таких заказов provider = 'offline' и нет payment_id.
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS offline_method VARCHAR(8);
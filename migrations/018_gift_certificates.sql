@@ -0,0 +1,37 @@
+-- Подарочные сертификаты: товар-сертификат, выпущенные сертификаты с
+-- остатком и списания остатка в счет заказов
+ALTER TABLE product
+    ADD COLUMN IF NOT EXISTS gift_certificate BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Часть суммы заказа, оплаченная сертификатом; платеж создается на остаток
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS certificate_amount NUMERIC(12, 2) NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS gift_certificates (
+    id         SERIAL PRIMARY KEY,
+    code       VARCHAR(32) NOT NULL UNIQUE,
+    order_id   INTEGER NOT NULL REFERENCES orders (id),
+    product_id INTEGER NOT NULL,
+    amount     NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    balance    NUMERIC(12, 2) NOT NULL CHECK (balance >= 0),
+    currency   VARCHAR(3) NOT NULL DEFAULT 'RUB',
+    email      VARCHAR(255) NOT NULL,
+    status     VARCHAR(16) NOT NULL DEFAULT 'active',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_gift_certificates_order_id ON gift_certificates (order_id);
+
+CREATE TABLE IF NOT EXISTS gift_certificate_redemptions (
+    id             SERIAL PRIMARY KEY,
+    certificate_id INTEGER NOT NULL REFERENCES gift_certificates (id),
+    order_id       INTEGER NOT NULL REFERENCES orders (id),
+    amount         NUMERIC(12, 2) NOT NULL CHECK (amount > 0),
+    status         VARCHAR(16) NOT NULL DEFAULT 'held',
+    created_at     TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at     TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_gift_certificate_redemptions_certificate_id ON gift_certificate_redemptions (certificate_id);
+CREATE INDEX IF NOT EXISTS idx_gift_certificate_redemptions_order_id ON gift_certificate_redemptions (order_id);
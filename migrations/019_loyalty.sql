@@ -0,0 +1,33 @@
+-- Бонусная программа: счета покупателей и журнал всех изменений баланса.
+-- Начисления хранят неизрасходованный остаток и срок сгорания.
+CREATE TABLE IF NOT EXISTS loyalty_accounts (
+    id         SERIAL PRIMARY KEY,
+    email      VARCHAR(255) NOT NULL UNIQUE,
+    token      VARCHAR(64) NOT NULL UNIQUE,
+    balance    NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (balance >= 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS loyalty_ledger (
+    id         SERIAL PRIMARY KEY,
+    account_id INTEGER NOT NULL REFERENCES loyalty_accounts (id),
+    kind       VARCHAR(16) NOT NULL CHECK (kind IN ('earn', 'spend', 'restore', 'revoke', 'expire')),
+    amount     NUMERIC(12, 2) NOT NULL, -- со знаком: плюс - начисление, минус - списание
+    remaining  NUMERIC(12, 2) NOT NULL DEFAULT 0 CHECK (remaining >= 0),
+    order_id   INTEGER REFERENCES orders (id),
+    reference  VARCHAR(64) NOT NULL, -- повтор операции с той же ссылкой не меняет баланс
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    UNIQUE (account_id, kind, reference)
+);
+
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_account_id ON loyalty_ledger (account_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_order_id ON loyalty_ledger (order_id);
+
+-- Поиск сгорающих остатков начислений
+CREATE INDEX IF NOT EXISTS idx_loyalty_ledger_expiring ON loyalty_ledger (expires_at)
+    WHERE remaining > 0;
+
+-- Скидка бонусами уже учтена в ценах позиций; здесь - сколько бонусов списано
+ALTER TABLE orders
+    ADD COLUMN IF NOT EXISTS bonus_amount NUMERIC(12, 2) NOT NULL DEFAULT 0;
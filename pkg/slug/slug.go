@@ -0,0 +1,73 @@
+package slug
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxLength ограничивает длину slug, чтобы адреса оставались читаемыми
+const maxLength = 80
+
+// translit - таблица транслитерации кириллицы в латиницу
+var translit = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo",
+	'ж': "zh", 'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m",
+	'н': "n", 'о': "o", 'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u",
+	'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+}
+
+// Make формирует slug из строки: кириллица транслитерируется, все символы
+// кроме латинских букв и цифр заменяются дефисом
+func Make(s string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(s) {
+		if t, ok := translit[r]; ok {
+			if t != "" {
+				b.WriteString(t)
+				dash = false
+			}
+			continue
+		}
+
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+
+	result := strings.Trim(b.String(), "-")
+	if len(result) > maxLength {
+		result = strings.Trim(result[:maxLength], "-")
+	}
+
+	return result
+}
+
+// HasBase сообщает, получен ли slug из base (в том числе с числовым суффиксом
+// вида base-2, который добавляется для уникальности)
+func HasBase(slug, base string) bool {
+	if slug == base {
+		return true
+	}
+
+	suffix, ok := strings.CutPrefix(slug, base+"-")
+	if !ok || suffix == "" {
+		return false
+	}
+
+	for _, r := range suffix {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
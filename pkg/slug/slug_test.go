@@ -0,0 +1,65 @@
+package slug
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"кириллица", "Мёд цветочный", "myod-tsvetochnyy"},
+		{"мягкий и твердый знак", "Подъезд, соль", "podezd-sol"},
+		{"щ, ж, х, ю, я", "Щавель жареный худой юный я", "shchavel-zharenyy-khudoy-yunyy-ya"},
+		{"латиница и цифры", "Omega-3 1000mg", "omega-3-1000mg"},
+		{"повторы разделителей", "  Чай  --  зеленый!!! ", "chay-zelenyy"},
+		{"не латинские буквы отбрасываются", "Café Ωmega", "caf-mega"},
+		{"пустая строка", "", ""},
+		{"только знаки", "!!! ---", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Make(tt.in); got != tt.want {
+				t.Errorf("Make(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMakeTruncates(t *testing.T) {
+	got := Make(strings.Repeat("ab ", 40))
+	if len(got) > maxLength {
+		t.Fatalf("len = %d, want at most %d", len(got), maxLength)
+	}
+	// Обрезка не оставляет дефис на конце
+	if strings.HasSuffix(got, "-") {
+		t.Errorf("Make ends with dash: %q", got)
+	}
+}
+
+func TestHasBase(t *testing.T) {
+	tests := []struct {
+		slug string
+		base string
+		want bool
+	}{
+		{"myod", "myod", true},
+		{"myod-2", "myod", true},
+		{"myod-15", "myod", true},
+		{"myod-", "myod", false},
+		{"myod-lipovyy", "myod", false},
+		{"myod-2a", "myod", false},
+		{"myodovyy", "myod", false},
+		{"chay", "myod", false},
+	}
+
+	for _, tt := range tests {
+		if got := HasBase(tt.slug, tt.base); got != tt.want {
+			t.Errorf("HasBase(%q, %q) = %v, want %v", tt.slug, tt.base, got, tt.want)
+		}
+	}
+}
@@ -116,7 +116,11 @@ func SendOrderToManager(order templates.OrderData, managerEmail string) error {
 	m := gomail.NewMessage()
 	m.SetHeader("From", config.User)
 	m.SetHeader("To", managerEmail)
-	m.SetHeader("Subject", fmt.Sprintf("🎯 Новый заказ #%s", order.PaymentID))
+	subject := fmt.Sprintf("🎯 Новый заказ #%s", order.PaymentID)
+	if order.Unpaid {
+		subject += " (не оплачен)"
+	}
+	m.SetHeader("Subject", subject)
 	m.SetBody("text/html", htmlBody)
 
 	d := createDialer(config)
@@ -142,4 +146,60 @@ func SendOrderEmails(order templates.OrderData, managerEmail string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+// SendCancellationEmail сообщает клиенту об отмене платежа и ее причине
+func SendCancellationEmail(order templates.OrderData, reason string) error {
+	htmlBody := templates.GenerateCancellationHTML(order, reason)
+
+	if err := SendEmail(order.Email, "Оплата заказа не прошла - Vitalis Life", htmlBody, true); err != nil {
+		logger.Error("Ошибка при отправке письма об отмене", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// SendRefundEmail сообщает клиенту о возврате денег
+func SendRefundEmail(order templates.OrderData, refundAmount string) error {
+	htmlBody := templates.GenerateRefundHTML(order, refundAmount)
+
+	if err := SendEmail(order.Email, "Возврат по заказу - Vitalis Life", htmlBody, true); err != nil {
+		logger.Error("Ошибка при отправке письма о возврате", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// SendSubscriptionPaymentFailedEmail сообщает клиенту о неудачном списании по
+// подписке и дате повторной попытки
+func SendSubscriptionPaymentFailedEmail(sub templates.SubscriptionData, reason, retryDate string) error {
+	htmlBody := templates.GenerateSubscriptionPaymentFailedHTML(sub, reason, retryDate)
+
+	if err := SendEmail(sub.Email, "Не удалось оплатить подписку - Vitalis Life", htmlBody, true); err != nil {
+		logger.Error("Ошибка при отправке письма о неудачном списании", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// SendSubscriptionCanceledEmail сообщает клиенту об отмене подписки после
+// неудачных списаний
+func SendSubscriptionCanceledEmail(sub templates.SubscriptionData, reason string) error {
+	htmlBody := templates.GenerateSubscriptionCanceledHTML(sub, reason)
+
+	if err := SendEmail(sub.Email, "Подписка остановлена - Vitalis Life", htmlBody, true); err != nil {
+		logger.Error("Ошибка при отправке письма об отмене подписки", zap.Error(err))
+		return err
+	}
+	return nil
+}
+
+// SendGiftCertificateEmail отправляет покупателю код подарочного сертификата
+func SendGiftCertificateEmail(cert templates.GiftCertificateData) error {
+	htmlBody := templates.GenerateGiftCertificateHTML(cert)
+
+	if err := SendEmail(cert.Email, "Подарочный сертификат - Vitalis Life", htmlBody, true); err != nil {
+		logger.Error("Ошибка при отправке подарочного сертификата", zap.Error(err))
+		return err
+	}
+	return nil
+}
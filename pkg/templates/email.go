@@ -1,6 +1,11 @@
 package templates
 
-import "fmt"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
 
 // calculateDeliveryCost вычисляет стоимость доставки
 func CalculateDeliveryCost(itemsTotal float64, deliveryType string) float64 {
@@ -24,16 +29,63 @@ func CalculateDeliveryCost(itemsTotal float64, deliveryType string) float64 {
 func CalculateItemsTotal(cartItems []CartItem) float64 {
 	total := 0.0
 	for _, item := range cartItems {
-		total += item.Price * float64(item.Quantity)
+		total += item.Total()
+	}
+	return total
+}
+
+// CalculateGoodsTotal вычисляет стоимость товаров без подарочных сертификатов -
+// от нее считается доставка
+func CalculateGoodsTotal(cartItems []CartItem) float64 {
+	total := 0.0
+	for _, item := range cartItems {
+		if !item.GiftCertificate {
+			total += item.Total()
+		}
 	}
 	return total
 }
 
 type CartItem struct {
 	ProductID int     `json:"productId"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
+	Quantity  float64 `json:"quantity"`
+	Price     float64 `json:"price"` // за единицу измерения
 	Name      string  `json:"name"`
+	Unit      string  `json:"unit,omitempty"` // pcs, g, kg; пусто - штуки
+	// GiftCertificate - подарочный сертификат, доставка на него не начисляется
+	GiftCertificate bool `json:"giftCertificate,omitempty"`
+}
+
+// Total возвращает стоимость позиции с округлением до копейки, как в чеке
+func (item CartItem) Total() float64 {
+	kopecks := int64(math.Round(item.Price * 100))
+	milli := int64(math.Round(item.Quantity * 1000))
+	return float64((kopecks*milli+500)/1000) / 100
+}
+
+// QuantityText возвращает количество с единицей измерения: «3 шт.», «0,35 кг»
+func (item CartItem) QuantityText() string {
+	quantity := strconv.FormatFloat(math.Round(item.Quantity*1000)/1000, 'f', -1, 64)
+	return strings.Replace(quantity, ".", ",", 1) + " " + unitTitle(item.Unit)
+}
+
+// PriceText возвращает цену за единицу: «120.00 ₽» для штучного товара,
+// «459.90 ₽/кг» для весового
+func (item CartItem) PriceText() string {
+	if item.Unit == "g" || item.Unit == "kg" {
+		return fmt.Sprintf("%.2f ₽/%s", item.Price, unitTitle(item.Unit))
+	}
+	return fmt.Sprintf("%.2f ₽", item.Price)
+}
+
+func unitTitle(unit string) string {
+	switch unit {
+	case "g":
+		return "г"
+	case "kg":
+		return "кг"
+	}
+	return "шт."
 }
 
 type OrderData struct {
@@ -48,12 +100,24 @@ type OrderData struct {
 	Currency        string
 	Description     string
 	CartItems       []CartItem
+	// Unpaid - заказ оплачивается при получении; PaymentID тогда содержит номер заказа
+	Unpaid bool
+	// CertificateAmount - часть суммы, оплаченная подарочным сертификатом
+	CertificateAmount float64
+	// BonusSpent - скидка бонусами, уже учтенная в ценах товаров
+	BonusSpent float64
+	// BonusEarned и BonusBalance - начислено за заказ и стало на счете;
+	// BonusURL - ссылка на баланс и историю бонусов
+	BonusEarned  float64
+	BonusBalance float64
+	BonusURL     string
 }
 
 // GenerateReceiptHTML генерирует HTML для чека клиента
 func GenerateReceiptHTML(order OrderData) string {
 	itemsTotal := CalculateItemsTotal(order.CartItems)
-	deliveryCost := CalculateDeliveryCost(itemsTotal, order.DeliveryType)
+	// Доставка считается от суммы товаров до скидки бонусами
+	deliveryCost := CalculateDeliveryCost(CalculateGoodsTotal(order.CartItems)+order.BonusSpent, order.DeliveryType)
 	totalAmount := itemsTotal + deliveryCost
 
 	deliveryText := "Самовывоз"
@@ -63,14 +127,13 @@ func GenerateReceiptHTML(order OrderData) string {
 
 	itemsTable := ""
 	for _, item := range order.CartItems {
-		itemTotal := item.Price * float64(item.Quantity)
 		itemsTable += fmt.Sprintf(`
         <tr>
             <td style="padding: 12px; border-bottom: 1px solid #e0e0e0;">%s</td>
-            <td style="padding: 12px; border-bottom: 1px solid #e0e0e0; text-align: center;">%d шт.</td>
-            <td style="padding: 12px; border-bottom: 1px solid #e0e0e0; text-align: right;">%.2f ₽</td>
+            <td style="padding: 12px; border-bottom: 1px solid #e0e0e0; text-align: center;">%s</td>
+            <td style="padding: 12px; border-bottom: 1px solid #e0e0e0; text-align: right;">%s</td>
             <td style="padding: 12px; border-bottom: 1px solid #e0e0e0; text-align: right;">%.2f ₽</td>
-        </tr>`, item.Name, item.Quantity, item.Price, itemTotal)
+        </tr>`, item.Name, item.QuantityText(), item.PriceText(), item.Total())
 	}
 
 	deliveryRow := ""
@@ -94,12 +157,43 @@ func GenerateReceiptHTML(order OrderData) string {
         </tr>`, deliveryText)
 	}
 
+	certificateRow := ""
+	if order.CertificateAmount > 0 {
+		totalAmount -= order.CertificateAmount
+		certificateRow = fmt.Sprintf(`
+        <tr>
+            <td colspan="3" style="padding: 12px; border-bottom: 1px solid #e0e0e0;"><strong>Оплачено сертификатом</strong></td>
+            <td style="padding: 12px; border-bottom: 1px solid #e0e0e0; text-align: right;"><strong>−%.2f ₽</strong></td>
+        </tr>`, order.CertificateAmount)
+	}
+
+	bonusRow := ""
+	if order.BonusSpent > 0 {
+		bonusRow = fmt.Sprintf(`
+        <tr>
+            <td colspan="3" style="padding: 12px; border-bottom: 1px solid #e0e0e0;">Скидка бонусами (учтена в ценах)</td>
+            <td style="padding: 12px; border-bottom: 1px solid #e0e0e0; text-align: right;">%.2f ₽</td>
+        </tr>`, order.BonusSpent)
+	}
+
+	bonusInfo := ""
+	if order.BonusEarned > 0 {
+		bonusInfo = fmt.Sprintf(`
+                <p>Начислено бонусов за заказ: <strong>%.2f</strong>, на счете: <strong>%.2f</strong>.</p>`,
+			order.BonusEarned, order.BonusBalance)
+	}
+	if order.BonusURL != "" {
+		bonusInfo += fmt.Sprintf(`
+                <p><a href="%s">Баланс и история бонусов</a> - по этой ссылке бонусы можно потратить при следующем заказе.</p>`,
+			order.BonusURL)
+	}
+
 	return fmt.Sprintf(`
     <!DOCTYPE html>
     <html>
     <head>
         <meta charset="UTF-8">
-        <style>/* стили остаются такими же */</style>
+        <style>%s</style>
     </head>
     <body>
         <div class="container">
@@ -107,27 +201,44 @@ func GenerateReceiptHTML(order OrderData) string {
                 <h1>Vitalis Life</h1>
                 <h2>Заказ успешно оплачен!</h2>
             </div>
-            
+
             <div class="content">
-                <!-- остальная верстка -->
-                %s
+                <p>Номер платежа: <strong>%s</strong></p>
+                <p>Получатель: %s, %s</p>
+                <p>Способ получения: %s</p>
+                <p>Адрес: %s</p>
+                <p>Комментарий: %s</p>
+
+                <table>
+                    <tr>
+                        <th style="text-align: left;">Товар</th>
+                        <th>Количество</th>
+                        <th style="text-align: right;">Цена</th>
+                        <th style="text-align: right;">Сумма</th>
+                    </tr>
+                    %s
+                    %s
+                    %s
+                    %s
+                    <tr class="total-row">
+                        <td colspan="3" style="text-align: right;"><strong>Итого к оплате:</strong></td>
+                        <td style="text-align: right;"><strong>%.2f ₽</strong></td>
+                    </tr>
+                </table>
                 %s
-                <tr class="total-row">
-                    <td colspan="3" style="text-align: right;"><strong>Итого к оплате:</strong></td>
-                    <td style="text-align: right;"><strong>%.2f ₽</strong></td>
-                </tr>
             </div>
         </div>
     </body>
     </html>
-    `, order.PaymentID, order.CustomerName, order.Phone, deliveryText,
-		order.DeliveryAddress, order.Comment, itemsTable, deliveryRow, totalAmount)
+    `, emailStyles, order.PaymentID, order.CustomerName, order.Phone, deliveryText,
+		order.DeliveryAddress, order.Comment, itemsTable, deliveryRow, bonusRow, certificateRow, totalAmount, bonusInfo)
 }
 
 // GenerateManagerOrderHTML генерирует HTML для уведомления менеджера
 func GenerateManagerOrderHTML(order OrderData) string {
 	itemsTotal := CalculateItemsTotal(order.CartItems)
-	deliveryCost := CalculateDeliveryCost(itemsTotal, order.DeliveryType)
+	// Доставка считается от суммы товаров до скидки бонусами
+	deliveryCost := CalculateDeliveryCost(CalculateGoodsTotal(order.CartItems)+order.BonusSpent, order.DeliveryType)
 	totalAmount := itemsTotal + deliveryCost
 
 	deliveryText := "Самовывоз"
@@ -137,8 +248,22 @@ func GenerateManagerOrderHTML(order OrderData) string {
 
 	itemsList := ""
 	for _, item := range order.CartItems {
-		itemsList += fmt.Sprintf("• %s: %d шт. x %.2f ₽ = %.2f ₽\n",
-			item.Name, item.Quantity, item.Price, item.Price*float64(item.Quantity))
+		itemsList += fmt.Sprintf("• %s: %s x %s = %.2f ₽\n",
+			item.Name, item.QuantityText(), item.PriceText(), item.Total())
+	}
+
+	certificateLine := ""
+	if order.CertificateAmount > 0 {
+		certificateLine = fmt.Sprintf("<p>Оплачено сертификатом: %.2f ₽, к оплате деньгами: %.2f ₽</p>",
+			order.CertificateAmount, totalAmount-order.CertificateAmount)
+	}
+	if order.BonusSpent > 0 {
+		certificateLine += fmt.Sprintf("<p>Списано бонусов: %.2f (скидка учтена в ценах товаров)</p>", order.BonusSpent)
+	}
+
+	heading := fmt.Sprintf("Новый заказ, платеж %s", order.PaymentID)
+	if order.Unpaid {
+		heading = fmt.Sprintf(`Новый заказ №%s <span style="color: #c62828;">НЕ ОПЛАЧЕН</span>, оплата при получении`, order.PaymentID)
 	}
 
 	return fmt.Sprintf(`
@@ -146,15 +271,223 @@ func GenerateManagerOrderHTML(order OrderData) string {
     <html>
     <head>
         <meta charset="UTF-8">
-        <style>/* стили для менеджера */</style>
+        <style>%s</style>
     </head>
     <body>
-        <!-- верстка для менеджера -->
-        %s
-        %.2f
+        <div class="container">
+            <h2>%s</h2>
+            <p>Клиент: %s</p>
+            <p>Телефон: %s</p>
+            <p>Email: %s</p>
+            <p>Способ получения: %s</p>
+            <p>Адрес: %s</p>
+            <p>Комментарий: %s</p>
+            <pre>%s</pre>
+            <p><strong>Итого: %.2f ₽</strong> (товары: %.2f ₽, %s: %.2f ₽)</p>
+            %s
+        </div>
     </body>
     </html>
-    `, order.PaymentID, order.CustomerName, order.Phone, order.Email,
+    `, emailStyles, heading, order.CustomerName, order.Phone, order.Email,
 		deliveryText, order.DeliveryAddress, order.Comment, itemsList,
-		totalAmount, itemsTotal, deliveryText, deliveryCost)
-}
\ No newline at end of file
+		totalAmount, itemsTotal, deliveryText, deliveryCost, certificateLine)
+}
+
+// GenerateCancellationHTML генерирует письмо клиенту об отмене платежа
+func GenerateCancellationHTML(order OrderData, reason string) string {
+	return fmt.Sprintf(`
+    <!DOCTYPE html>
+    <html>
+    <head>
+        <meta charset="UTF-8">
+        <style>%s</style>
+    </head>
+    <body>
+        <div class="container">
+            <div class="header">
+                <h1>Vitalis Life</h1>
+                <h2>Платеж отменен</h2>
+            </div>
+
+            <div class="content">
+                <p>%s, оплата заказа (платеж %s) на сумму %s %s не прошла.</p>
+                <p>Причина: %s</p>
+                <p>Если деньги были заблокированы на карте, банк вернет их в течение нескольких дней. Вы можете оформить заказ заново.</p>
+            </div>
+        </div>
+    </body>
+    </html>
+    `, emailStyles, order.CustomerName, order.PaymentID, order.Amount, order.Currency, CancellationReasonText(reason))
+}
+
+// GenerateRefundHTML генерирует письмо клиенту о возврате денег
+func GenerateRefundHTML(order OrderData, refundAmount string) string {
+	return fmt.Sprintf(`
+    <!DOCTYPE html>
+    <html>
+    <head>
+        <meta charset="UTF-8">
+        <style>%s</style>
+    </head>
+    <body>
+        <div class="container">
+            <div class="header">
+                <h1>Vitalis Life</h1>
+                <h2>Возврат оформлен</h2>
+            </div>
+
+            <div class="content">
+                <p>%s, по заказу (платеж %s) оформлен возврат на сумму <strong>%s %s</strong>.</p>
+                <p>Деньги поступят на карту, с которой был оплачен заказ. Срок зачисления зависит от банка и обычно составляет до 10 дней.</p>
+            </div>
+        </div>
+    </body>
+    </html>
+    `, emailStyles, order.CustomerName, order.PaymentID, refundAmount, order.Currency)
+}
+
+// SubscriptionData - данные подписки для писем покупателю
+type SubscriptionData struct {
+	CustomerName string
+	Email        string
+	PlanName     string
+	Amount       string
+	Currency     string
+	// ManageURL - ссылка на страницу подписки: оплата другой картой, пауза, отмена
+	ManageURL string
+}
+
+// GenerateSubscriptionPaymentFailedHTML генерирует письмо о неудачном
+// списании по подписке с датой следующей попытки
+func GenerateSubscriptionPaymentFailedHTML(sub SubscriptionData, reason, retryDate string) string {
+	return fmt.Sprintf(`
+    <!DOCTYPE html>
+    <html>
+    <head>
+        <meta charset="UTF-8">
+        <style>%s</style>
+    </head>
+    <body>
+        <div class="container">
+            <div class="header">
+                <h1>Vitalis Life</h1>
+                <h2>Не удалось оплатить подписку</h2>
+            </div>
+
+            <div class="content">
+                <p>%s, не удалось списать %s %s за подписку «%s».</p>
+                <p>Причина: %s</p>
+                <p>Мы повторим попытку %s. Чтобы не пропустить набор, пополните карту или <a href="%s">оплатите другой картой</a>.</p>
+            </div>
+        </div>
+    </body>
+    </html>
+    `, emailStyles, sub.CustomerName, sub.Amount, sub.Currency, sub.PlanName,
+		CancellationReasonText(reason), retryDate, sub.ManageURL)
+}
+
+// GenerateSubscriptionCanceledHTML генерирует письмо об отмене подписки после
+// неудачных повторных списаний
+func GenerateSubscriptionCanceledHTML(sub SubscriptionData, reason string) string {
+	return fmt.Sprintf(`
+    <!DOCTYPE html>
+    <html>
+    <head>
+        <meta charset="UTF-8">
+        <style>%s</style>
+    </head>
+    <body>
+        <div class="container">
+            <div class="header">
+                <h1>Vitalis Life</h1>
+                <h2>Подписка остановлена</h2>
+            </div>
+
+            <div class="content">
+                <p>%s, нам так и не удалось списать оплату за подписку «%s», поэтому подписка отменена.</p>
+                <p>Причина: %s</p>
+                <p>Вы можете оформить подписку заново на <a href="%s">странице подписки</a>.</p>
+            </div>
+        </div>
+    </body>
+    </html>
+    `, emailStyles, sub.CustomerName, sub.PlanName, CancellationReasonText(reason), sub.ManageURL)
+}
+
+// cancellationReasons - понятные покупателю причины отмены платежа
+var cancellationReasons = map[string]string{
+	"expired_on_confirmation":       "истекло время на оплату",
+	"expired_on_capture":            "заказ не был подтвержден вовремя",
+	"canceled_by_merchant":          "платеж отменен магазином",
+	"insufficient_funds":            "недостаточно средств на карте",
+	"card_expired":                  "истек срок действия карты",
+	"3d_secure_failed":              "не пройдена проверка 3-D Secure",
+	"call_issuer":                   "банк отклонил платеж, обратитесь в банк",
+	"fraud_suspected":               "платеж заблокирован из-за подозрения в мошенничестве",
+	"general_decline":               "банк отклонил платеж",
+	"payment_method_limit_exceeded": "превышен лимит платежей",
+	"payment_method_restricted":     "операции с этой картой запрещены",
+	"permission_revoked":            "отозвано разрешение на списание",
+	"country_forbidden":             "оплата картой этой страны недоступна",
+	"invalid_card_number":           "неверный номер карты",
+	"invalid_csc":                   "неверный код CVV2/CVC2",
+}
+
+// GiftCertificateData - данные подарочного сертификата для письма покупателю
+type GiftCertificateData struct {
+	CustomerName string
+	Email        string
+	Code         string
+	Amount       string
+	Currency     string
+	ExpiresAt    string // пусто - бессрочный
+}
+
+// GenerateGiftCertificateHTML генерирует письмо с кодом подарочного сертификата
+func GenerateGiftCertificateHTML(cert GiftCertificateData) string {
+	validity := "Сертификат бессрочный."
+	if cert.ExpiresAt != "" {
+		validity = fmt.Sprintf("Сертификат действует до %s.", cert.ExpiresAt)
+	}
+
+	return fmt.Sprintf(`
+    <!DOCTYPE html>
+    <html>
+    <head>
+        <meta charset="UTF-8">
+        <style>%s</style>
+    </head>
+    <body>
+        <div class="container">
+            <div class="header">
+                <h1>Vitalis Life</h1>
+                <h2>Подарочный сертификат на %s %s</h2>
+            </div>
+
+            <div class="content">
+                <p>%s, спасибо за покупку! Код сертификата:</p>
+                <p style="font-size: 24px; letter-spacing: 2px;"><strong>%s</strong></p>
+                <p>Введите код при оформлении заказа - им можно оплатить заказ целиком или частично, остаток сохранится для следующих покупок. %s</p>
+            </div>
+        </div>
+    </body>
+    </html>
+    `, emailStyles, cert.Amount, cert.Currency, cert.CustomerName, cert.Code, validity)
+}
+
+// CancellationReasonText возвращает описание причины отмены платежа
+func CancellationReasonText(reason string) string {
+	if text, ok := cancellationReasons[reason]; ok {
+		return text
+	}
+	return "платеж не был завершен"
+}
+
+// emailStyles - общие стили писем
+const emailStyles = `
+    body { font-family: Arial, sans-serif; color: #333; }
+    .container { max-width: 600px; margin: 0 auto; padding: 20px; }
+    .header { text-align: center; border-bottom: 2px solid #4caf50; margin-bottom: 20px; }
+    table { width: 100%; border-collapse: collapse; }
+    .total-row td { padding: 12px; border-top: 2px solid #333; }
+`
@@ -0,0 +1,82 @@
+package yookassa
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen возвращается без обращения к API, пока ЮKassa считается
+// недоступной после серии сбоев подряд
+var ErrCircuitOpen = fmt.Errorf("%w: запросы приостановлены после серии сбоев", ErrUnavailable)
+
+// breaker - автоматический выключатель. После threshold сбоев подряд запросы
+// отклоняются на cooldown, затем пропускается один пробный запрос: успех
+// возвращает обычный режим, сбой снова размыкает цепь.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow сообщает, можно ли выполнить запрос
+func (b *breaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return ErrCircuitOpen
+	}
+	b.probing = true
+	return nil
+}
+
+// outcome - результат запроса для выключателя
+type outcome int
+
+const (
+	outcomeSuccess outcome = iota
+	outcomeFailure
+	// outcomeUnknown - запрос прерван вызывающим (отмена или дедлайн
+	// контекста): о состоянии API он ничего не говорит
+	outcomeUnknown
+)
+
+// record учитывает результат запроса. Сбоем считается только недоступность
+// API: ошибки в данных запроса (4xx) говорят о том, что API работает.
+// Прерванный запрос не меняет счетчик: если это была проба, следующий
+// запрос станет новой пробой.
+func (b *breaker) record(result outcome) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	switch result {
+	case outcomeSuccess:
+		b.failures = 0
+	case outcomeFailure:
+		b.failures++
+		if b.failures >= b.threshold {
+			b.openUntil = time.Now().Add(b.cooldown)
+		}
+	}
+}
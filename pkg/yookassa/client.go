@@ -0,0 +1,328 @@
+package yookassa
+
+import (
+	"backend/pkg/logger"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultBaseURL - адрес API ЮKassa
+const DefaultBaseURL = "https://api.yookassa.ru/v3"
+
+// maxResponseSize ограничивает размер читаемого ответа API
+const maxResponseSize = 1 << 20
+
+// Config - параметры клиента. Нулевые таймауты заменяются значениями по умолчанию.
+type Config struct {
+	ShopID         string
+	SecretKey      string
+	BaseURL        string
+	Timeout        time.Duration // общее время на одну попытку, включая чтение ответа
+	ConnectTimeout time.Duration // установка TCP-соединения и TLS-рукопожатие
+
+	// MaxRetries - сколько раз повторять запрос при сбое сети, ответе 5xx
+	// или 429. 0 - без повторов.
+	MaxRetries int
+	// RetryBaseDelay - пауза перед первым повтором; дальше она удваивается
+	// и случайно уменьшается до половины, чтобы клиенты не повторяли разом
+	RetryBaseDelay time.Duration
+	// RetryMaxDelay - предельная пауза между попытками. Если API просит
+	// подождать дольше (Retry-After), ошибка возвращается сразу.
+	RetryMaxDelay time.Duration
+
+	// BreakerThreshold - после скольких неудачных запросов подряд перестать
+	// обращаться к API на BreakerCooldown. 0 - выключатель не используется.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// Client - клиент API ЮKassa. Безопасен для конкурентного использования;
+// соединения переиспользуются между запросами.
+type Client struct {
+	shopID     string
+	secretKey  string
+	baseURL    string
+	httpClient *http.Client
+
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	breaker        *breaker
+}
+
+func NewClient(cfg Config) *Client {
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = DefaultBaseURL
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 30 * time.Second
+	}
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = 10 * time.Second
+	}
+	if cfg.RetryBaseDelay <= 0 {
+		cfg.RetryBaseDelay = 200 * time.Millisecond
+	}
+	if cfg.RetryMaxDelay <= 0 {
+		cfg.RetryMaxDelay = 5 * time.Second
+	}
+	if cfg.BreakerCooldown <= 0 {
+		cfg.BreakerCooldown = 30 * time.Second
+	}
+
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   cfg.ConnectTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   cfg.ConnectTimeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          20,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+
+	return &Client{
+		shopID:    cfg.ShopID,
+		secretKey: cfg.SecretKey,
+		baseURL:   cfg.BaseURL,
+		httpClient: &http.Client{
+			Transport: transport,
+			Timeout:   cfg.Timeout,
+		},
+		maxRetries:     cfg.MaxRetries,
+		retryBaseDelay: cfg.RetryBaseDelay,
+		retryMaxDelay:  cfg.RetryMaxDelay,
+		breaker:        newBreaker(cfg.BreakerThreshold, cfg.BreakerCooldown),
+	}
+}
+
+// CreatePayment создает платеж. Повтор с тем же idempotenceKey вернет тот же платеж.
+func (c *Client) CreatePayment(ctx context.Context, req *CreatePaymentRequest, idempotenceKey string) (*Payment, error) {
+	var payment Payment
+	if err := c.do(ctx, http.MethodPost, "/payments", req, idempotenceKey, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// GetPayment возвращает текущее состояние платежа
+func (c *Client) GetPayment(ctx context.Context, paymentID string) (*Payment, error) {
+	var payment Payment
+	if err := c.do(ctx, http.MethodGet, "/payments/"+paymentID, nil, "", &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// CapturePayment списывает холдированный платеж целиком или частично
+func (c *Client) CapturePayment(ctx context.Context, paymentID string, req *CapturePaymentRequest, idempotenceKey string) (*Payment, error) {
+	var payment Payment
+	if err := c.do(ctx, http.MethodPost, "/payments/"+paymentID+"/capture", req, idempotenceKey, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// CancelPayment отменяет неоплаченный или холдированный платеж
+func (c *Client) CancelPayment(ctx context.Context, paymentID, idempotenceKey string) (*Payment, error) {
+	var payment Payment
+	if err := c.do(ctx, http.MethodPost, "/payments/"+paymentID+"/cancel", struct{}{}, idempotenceKey, &payment); err != nil {
+		return nil, err
+	}
+	return &payment, nil
+}
+
+// CreateRefund возвращает покупателю всю сумму платежа или ее часть
+func (c *Client) CreateRefund(ctx context.Context, req *CreateRefundRequest, idempotenceKey string) (*Refund, error) {
+	var refund Refund
+	if err := c.do(ctx, http.MethodPost, "/refunds", req, idempotenceKey, &refund); err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// GetRefund возвращает текущее состояние возврата
+func (c *Client) GetRefund(ctx context.Context, refundID string) (*Refund, error) {
+	var refund Refund
+	if err := c.do(ctx, http.MethodGet, "/refunds/"+refundID, nil, "", &refund); err != nil {
+		return nil, err
+	}
+	return &refund, nil
+}
+
+// CreateReceipt регистрирует отдельный чек по платежу или возврату
+func (c *Client) CreateReceipt(ctx context.Context, req *CreateReceiptRequest, idempotenceKey string) (*ReceiptObject, error) {
+	var receipt ReceiptObject
+	if err := c.do(ctx, http.MethodPost, "/receipts", req, idempotenceKey, &receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// do выполняет запрос к API с повторами. Повторять можно любой запрос:
+// GET не меняет данных, а POST отправляется с одним и тем же ключом
+// идемпотентности во всех попытках. Если ключ не передан, он генерируется:
+// ЮKassa не принимает POST без заголовка Idempotence-Key.
+func (c *Client) do(ctx context.Context, method, path string, in interface{}, idempotenceKey string, out interface{}) error {
+	var payload []byte
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %w", err)
+		}
+		payload = data
+	}
+	if method == http.MethodPost && idempotenceKey == "" {
+		idempotenceKey = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.breaker.allow(); err != nil {
+			return err
+		}
+
+		err := c.attempt(ctx, method, path, payload, idempotenceKey, out)
+		c.breaker.record(requestOutcome(ctx, err))
+
+		if err == nil || attempt >= c.maxRetries || ctx.Err() != nil {
+			return err
+		}
+		delay, ok := c.retryDelay(attempt, err)
+		if !ok {
+			return err
+		}
+
+		logger.Warn("YooKassa request failed, retrying",
+			zap.String("method", method),
+			zap.String("path", path),
+			zap.Int("attempt", attempt+1),
+			zap.Duration("delay", delay),
+			zap.Error(err))
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// requestOutcome определяет, как попытка влияет на выключатель
+func requestOutcome(ctx context.Context, err error) outcome {
+	switch {
+	case err == nil:
+		return outcomeSuccess
+	case ctx.Err() != nil:
+		return outcomeUnknown
+	case errors.Is(err, ErrUnavailable):
+		return outcomeFailure
+	default:
+		return outcomeSuccess
+	}
+}
+
+// retryDelay решает, повторять ли запрос после ошибки, и возвращает паузу
+// перед повтором. Повторяются сбои сети, ответы 5xx и 429.
+func (c *Client) retryDelay(attempt int, err error) (time.Duration, bool) {
+	var apiErr *APIError
+	isAPIErr := errors.As(err, &apiErr)
+	if !errors.Is(err, ErrUnavailable) && !(isAPIErr && apiErr.StatusCode == http.StatusTooManyRequests) {
+		return 0, false
+	}
+
+	if isAPIErr && apiErr.RetryAfter > 0 {
+		if apiErr.RetryAfter > c.retryMaxDelay {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	delay := c.retryBaseDelay << attempt
+	if delay <= 0 || delay > c.retryMaxDelay {
+		delay = c.retryMaxDelay
+	}
+	// Случайная пауза от половины до полной, чтобы повторы не шли залпом
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)), true
+}
+
+// attempt выполняет одну попытку запроса
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, idempotenceKey string, out interface{}) error {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(c.shopID, c.secretKey)
+	req.Header.Set("Accept", "application/json")
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if idempotenceKey != "" {
+		req.Header.Set("Idempotence-Key", idempotenceKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s: %w: %v", method, path, ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return fmt.Errorf("%s %s: failed to read response: %w: %v", method, path, ErrUnavailable, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &APIError{
+			StatusCode: resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		}
+		if err := json.Unmarshal(data, apiErr); err != nil || apiErr.Code == "" {
+			apiErr.Code = "unexpected_response"
+			apiErr.Description = string(data)
+		}
+		return apiErr
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%s %s: failed to parse response: %w", method, path, err)
+	}
+	return nil
+}
+
+// parseRetryAfter разбирает заголовок Retry-After: число секунд или дату
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
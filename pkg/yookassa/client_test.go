@@ -0,0 +1,481 @@
+package yookassa
+
+import (
+	"backend/pkg/logger"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// logger.Init создает каталог логов относительно рабочего каталога -
+	// инициализируем его во временном, чтобы не мусорить в репозитории
+	dir, err := os.MkdirTemp("", "yookassa-test")
+	if err != nil {
+		panic(err)
+	}
+	work := filepath.Join(dir, "work")
+	if err := os.Mkdir(work, 0755); err != nil {
+		panic(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		panic(err)
+	}
+	if err := os.Chdir(work); err != nil {
+		panic(err)
+	}
+	logger.Init("error")
+	if err := os.Chdir(wd); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// hit - запрос, дошедший до тестового API
+type hit struct {
+	at  time.Time
+	key string
+}
+
+// stubAPI - тестовый API ЮKassa. respond получает номер запроса с нуля.
+type stubAPI struct {
+	server  *httptest.Server
+	respond func(n int, w http.ResponseWriter, r *http.Request)
+
+	mu   sync.Mutex
+	hits []hit
+}
+
+func newStubAPI(t *testing.T, respond func(n int, w http.ResponseWriter, r *http.Request)) *stubAPI {
+	api := &stubAPI{respond: respond}
+	api.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		n := len(api.hits)
+		api.hits = append(api.hits, hit{at: time.Now(), key: r.Header.Get("Idempotence-Key")})
+		api.mu.Unlock()
+
+		api.respond(n, w, r)
+	}))
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+func (a *stubAPI) client(cfg Config) *Client {
+	cfg.ShopID = "shop"
+	cfg.SecretKey = "secret"
+	cfg.BaseURL = a.server.URL
+	return NewClient(cfg)
+}
+
+func (a *stubAPI) requests() []hit {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]hit(nil), a.hits...)
+}
+
+func (a *stubAPI) count() int {
+	return len(a.requests())
+}
+
+func writePayment(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"id":"pay-1","status":"pending","amount":{"value":"100.00","currency":"RUB"}}`))
+}
+
+func writeError(w http.ResponseWriter, status int, code string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(`{"type":"error","code":"` + code + `","description":"test"}`))
+}
+
+func createPayment(ctx context.Context, c *Client, key string) (*Payment, error) {
+	return c.CreatePayment(ctx, &CreatePaymentRequest{
+		Amount:  Amount{Value: "100.00", Currency: "RUB"},
+		Capture: true,
+	}, key)
+}
+
+func TestRetriesWithSameIdempotenceKeyAndBackoff(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n < 2 {
+			writeError(w, http.StatusInternalServerError, "internal_server_error")
+			return
+		}
+		writePayment(w)
+	})
+	base := 40 * time.Millisecond
+	c := api.client(Config{MaxRetries: 3, RetryBaseDelay: base, RetryMaxDelay: time.Second})
+
+	payment, err := createPayment(context.Background(), c, "order-1")
+	if err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+	if payment.ID != "pay-1" {
+		t.Fatalf("payment id = %q, want pay-1", payment.ID)
+	}
+
+	hits := api.requests()
+	if len(hits) != 3 {
+		t.Fatalf("attempts = %d, want 3", len(hits))
+	}
+	for i, h := range hits {
+		if h.key != "order-1" {
+			t.Errorf("attempt %d: Idempotence-Key = %q, want order-1", i+1, h.key)
+		}
+	}
+
+	// Пауза перед n-м повтором - от половины до полной base<<n
+	for i := 1; i < len(hits); i++ {
+		gap := hits[i].at.Sub(hits[i-1].at)
+		full := base << (i - 1)
+		if gap < full/2 || gap > full+500*time.Millisecond {
+			t.Errorf("delay before retry %d = %v, want between %v and %v", i, gap, full/2, full)
+		}
+	}
+}
+
+func TestGeneratedIdempotenceKeyIsReusedAcrossRetries(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n == 0 {
+			writeError(w, http.StatusServiceUnavailable, "service_unavailable")
+			return
+		}
+		writePayment(w)
+	})
+	c := api.client(Config{MaxRetries: 1, RetryBaseDelay: time.Millisecond})
+
+	if _, err := createPayment(context.Background(), c, ""); err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+
+	hits := api.requests()
+	if len(hits) != 2 {
+		t.Fatalf("attempts = %d, want 2", len(hits))
+	}
+	if hits[0].key == "" || hits[0].key != hits[1].key {
+		t.Fatalf("Idempotence-Key = %q, %q, want the same non-empty key", hits[0].key, hits[1].key)
+	}
+}
+
+func TestStopsAfterMaxRetries(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusBadGateway, "bad_gateway")
+	})
+	c := api.client(Config{MaxRetries: 2, RetryBaseDelay: time.Millisecond})
+
+	_, err := createPayment(context.Background(), c, "order-1")
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("err = %v, want ErrUnavailable", err)
+	}
+	if n := api.count(); n != 3 {
+		t.Fatalf("attempts = %d, want 3", n)
+	}
+}
+
+func TestDoesNotRetryClientErrors(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusBadRequest, "invalid_request")
+	})
+	c := api.client(Config{MaxRetries: 3, RetryBaseDelay: time.Millisecond})
+
+	_, err := createPayment(context.Background(), c, "order-1")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "invalid_request" {
+		t.Fatalf("err = %v, want APIError invalid_request", err)
+	}
+	if errors.Is(err, ErrUnavailable) {
+		t.Fatalf("4xx must not be reported as ErrUnavailable")
+	}
+	if n := api.count(); n != 1 {
+		t.Fatalf("attempts = %d, want 1", n)
+	}
+}
+
+func TestRetryAfterSeconds(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n == 0 {
+			w.Header().Set("Retry-After", "1")
+			writeError(w, http.StatusTooManyRequests, "too_many_requests")
+			return
+		}
+		writePayment(w)
+	})
+	c := api.client(Config{MaxRetries: 1, RetryBaseDelay: time.Millisecond, RetryMaxDelay: 5 * time.Second})
+
+	if _, err := createPayment(context.Background(), c, "order-1"); err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+
+	hits := api.requests()
+	if len(hits) != 2 {
+		t.Fatalf("attempts = %d, want 2", len(hits))
+	}
+	if gap := hits[1].at.Sub(hits[0].at); gap < time.Second {
+		t.Fatalf("delay = %v, want at least Retry-After 1s", gap)
+	}
+}
+
+func TestRetryAfterHTTPDate(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n == 0 {
+			w.Header().Set("Retry-After", time.Now().Add(2*time.Second).UTC().Format(http.TimeFormat))
+			writeError(w, http.StatusTooManyRequests, "too_many_requests")
+			return
+		}
+		writePayment(w)
+	})
+	c := api.client(Config{MaxRetries: 1, RetryBaseDelay: time.Millisecond, RetryMaxDelay: 5 * time.Second})
+
+	if _, err := createPayment(context.Background(), c, "order-1"); err != nil {
+		t.Fatalf("CreatePayment: %v", err)
+	}
+
+	hits := api.requests()
+	if len(hits) != 2 {
+		t.Fatalf("attempts = %d, want 2", len(hits))
+	}
+	// Дата в заголовке с точностью до секунды: ждать нужно больше секунды
+	if gap := hits[1].at.Sub(hits[0].at); gap < time.Second || gap > 3*time.Second {
+		t.Fatalf("delay = %v, want between 1s and 2s", gap)
+	}
+}
+
+func TestRetryAfterAboveMaxDelayReturnsImmediately(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		writeError(w, http.StatusTooManyRequests, "too_many_requests")
+	})
+	c := api.client(Config{MaxRetries: 3, RetryBaseDelay: time.Millisecond, RetryMaxDelay: time.Second})
+
+	start := time.Now()
+	_, err := createPayment(context.Background(), c, "order-1")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("err = %v, want APIError 429", err)
+	}
+	if apiErr.RetryAfter != time.Minute {
+		t.Fatalf("RetryAfter = %v, want 1m", apiErr.RetryAfter)
+	}
+	if n := api.count(); n != 1 {
+		t.Fatalf("attempts = %d, want 1", n)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Fatalf("returned after %v, want without waiting", elapsed)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if d := parseRetryAfter("3"); d != 3*time.Second {
+		t.Errorf("seconds: got %v, want 3s", d)
+	}
+	date := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	if d := parseRetryAfter(date); d <= 8*time.Second || d > 10*time.Second {
+		t.Errorf("date: got %v, want about 10s", d)
+	}
+	past := time.Now().Add(-time.Minute).UTC().Format(http.TimeFormat)
+	for _, value := range []string{"", "0", "-5", "soon", past} {
+		if d := parseRetryAfter(value); d != 0 {
+			t.Errorf("%q: got %v, want 0", value, d)
+		}
+	}
+}
+
+func TestBreakerOpensAndRecoversAfterProbe(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n < 2 {
+			writeError(w, http.StatusInternalServerError, "internal_server_error")
+			return
+		}
+		writePayment(w)
+	})
+	cooldown := 100 * time.Millisecond
+	c := api.client(Config{BreakerThreshold: 2, BreakerCooldown: cooldown})
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetPayment(context.Background(), "pay-1"); !errors.Is(err, ErrUnavailable) {
+			t.Fatalf("request %d: err = %v, want ErrUnavailable", i+1, err)
+		}
+	}
+
+	// Цепь разомкнута: запрос отклоняется без обращения к API
+	if _, err := c.GetPayment(context.Background(), "pay-1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if n := api.count(); n != 2 {
+		t.Fatalf("API calls = %d, want 2 while the circuit is open", n)
+	}
+
+	time.Sleep(cooldown + 20*time.Millisecond)
+
+	// Пробный запрос прошел - обычный режим
+	for i := 0; i < 2; i++ {
+		if _, err := c.GetPayment(context.Background(), "pay-1"); err != nil {
+			t.Fatalf("request after cooldown %d: %v", i+1, err)
+		}
+	}
+	if n := api.count(); n != 4 {
+		t.Fatalf("API calls = %d, want 4", n)
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusInternalServerError, "internal_server_error")
+	})
+	cooldown := 50 * time.Millisecond
+	c := api.client(Config{BreakerThreshold: 2, BreakerCooldown: cooldown})
+
+	for i := 0; i < 2; i++ {
+		c.GetPayment(context.Background(), "pay-1")
+	}
+	time.Sleep(cooldown + 20*time.Millisecond)
+
+	if _, err := c.GetPayment(context.Background(), "pay-1"); errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("probe: err = %v, want API failure", err)
+	}
+	if _, err := c.GetPayment(context.Background(), "pay-1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("after failed probe: err = %v, want ErrCircuitOpen", err)
+	}
+	if n := api.count(); n != 3 {
+		t.Fatalf("API calls = %d, want 3", n)
+	}
+}
+
+func TestBreakerLetsOnlyOneProbeThrough(t *testing.T) {
+	release := make(chan struct{})
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n < 2 {
+			writeError(w, http.StatusInternalServerError, "internal_server_error")
+			return
+		}
+		<-release
+		writePayment(w)
+	})
+	cooldown := 50 * time.Millisecond
+	c := api.client(Config{BreakerThreshold: 2, BreakerCooldown: cooldown})
+
+	for i := 0; i < 2; i++ {
+		c.GetPayment(context.Background(), "pay-1")
+	}
+	time.Sleep(cooldown + 20*time.Millisecond)
+
+	probe := make(chan error, 1)
+	go func() {
+		_, err := c.GetPayment(context.Background(), "pay-1")
+		probe <- err
+	}()
+	waitForCalls(t, api, 3)
+
+	// Пока проба выполняется, остальные запросы отклоняются
+	if _, err := c.GetPayment(context.Background(), "pay-1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("during probe: err = %v, want ErrCircuitOpen", err)
+	}
+
+	close(release)
+	if err := <-probe; err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if n := api.count(); n != 3 {
+		t.Fatalf("API calls = %d, want 3", n)
+	}
+}
+
+func TestBreakerIgnoresClientErrors(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, "not_found")
+	})
+	c := api.client(Config{BreakerThreshold: 1, BreakerCooldown: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		if _, err := c.GetPayment(context.Background(), "pay-"+strconv.Itoa(i)); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("request %d: circuit opened on 4xx", i+1)
+		}
+	}
+	if n := api.count(); n != 3 {
+		t.Fatalf("API calls = %d, want 3", n)
+	}
+}
+
+func TestBreakerCanceledProbeKeepsCircuitOpen(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		if n == 2 {
+			// Проба: отвечаем, только когда клиент уже ушел
+			<-r.Context().Done()
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "internal_server_error")
+	})
+	cooldown := 50 * time.Millisecond
+	c := api.client(Config{BreakerThreshold: 2, BreakerCooldown: cooldown})
+
+	for i := 0; i < 2; i++ {
+		c.GetPayment(context.Background(), "pay-1")
+	}
+	time.Sleep(cooldown + 20*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	_, err := c.GetPayment(ctx, "pay-1")
+	cancel()
+	if err == nil {
+		t.Fatalf("canceled probe succeeded")
+	}
+
+	// Прерванная проба не считается успехом: следующая проба снова
+	// единственная, и ее сбой сразу размыкает цепь
+	if _, err := c.GetPayment(context.Background(), "pay-1"); errors.Is(err, ErrCircuitOpen) || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("next probe: err = %v, want API failure", err)
+	}
+	if _, err := c.GetPayment(context.Background(), "pay-1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("after failed probe: err = %v, want ErrCircuitOpen", err)
+	}
+	if n := api.count(); n != 4 {
+		t.Fatalf("API calls = %d, want 4", n)
+	}
+}
+
+func TestCircuitOpenMakesNoHTTPCall(t *testing.T) {
+	api := newStubAPI(t, func(n int, w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusServiceUnavailable, "service_unavailable")
+	})
+	c := api.client(Config{MaxRetries: 5, RetryBaseDelay: time.Millisecond, BreakerThreshold: 1, BreakerCooldown: time.Minute})
+
+	// Выключатель срабатывает и прерывает повторы
+	if _, err := createPayment(context.Background(), c, "order-1"); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if n := api.count(); n != 1 {
+		t.Fatalf("API calls = %d, want 1", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := createPayment(context.Background(), c, "order-1"); !errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("err = %v, want ErrCircuitOpen", err)
+		}
+	}
+	if n := api.count(); n != 1 {
+		t.Fatalf("API calls = %d, want 1 while the circuit is open", n)
+	}
+}
+
+// waitForCalls ждет, пока до API дойдет n запросов
+func waitForCalls(t *testing.T, api *stubAPI, n int) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for api.count() < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("API calls = %d, want %d", api.count(), n)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,43 @@
+package yookassa
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrUnavailable - сбой на стороне ЮKassa или по пути до нее (сеть, таймаут,
+// ответ 5xx). Запрос можно повторить позже.
+var ErrUnavailable = errors.New("ЮKassa временно недоступна")
+
+// APIError - объект ошибки, который ЮKassa возвращает в теле ответа
+type APIError struct {
+	StatusCode  int    `json:"-"`
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	Code        string `json:"code"`      // invalid_request, not_supported, forbidden, ...
+	Parameter   string `json:"parameter"` // параметр запроса, из-за которого возникла ошибка
+	Description string `json:"description"`
+	// RetryAfter - через сколько API просит повторить запрос (заголовок Retry-After)
+	RetryAfter time.Duration `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("YooKassa error %d %s", e.StatusCode, e.Code)
+	if e.Parameter != "" {
+		msg += " (" + e.Parameter + ")"
+	}
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// Unwrap позволяет проверить ответ 5xx через errors.Is(err, ErrUnavailable)
+func (e *APIError) Unwrap() error {
+	if e.StatusCode >= http.StatusInternalServerError {
+		return ErrUnavailable
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package yookassa
+
+import "time"
+
+// Статусы платежа и возврата в API ЮKassa
+const (
+	StatusPending           = "pending"
+	StatusWaitingForCapture = "waiting_for_capture"
+	StatusSucceeded         = "succeeded"
+	StatusCanceled          = "canceled"
+)
+
+// Amount - сумма в валюте. Значение передается строкой с двумя знаками после точки.
+type Amount struct {
+	Value    string `json:"value"`
+	Currency string `json:"currency"`
+}
+
+// Сценарии подтверждения платежа
+const (
+	ConfirmationRedirect          = "redirect"
+	ConfirmationEmbedded          = "embedded"
+	ConfirmationQR                = "qr"
+	ConfirmationMobileApplication = "mobile_application"
+)
+
+// Confirmation - способ подтверждения платежа покупателем. В ответе для
+// redirect и mobile_application приходит ConfirmationURL, для embedded -
+// ConfirmationToken для виджета, для qr - ConfirmationData (содержимое QR-кода).
+type Confirmation struct {
+	Type              string `json:"type"`
+	ReturnURL         string `json:"return_url,omitempty"`
+	ConfirmationURL   string `json:"confirmation_url,omitempty"`
+	ConfirmationToken string `json:"confirmation_token,omitempty"`
+	ConfirmationData  string `json:"confirmation_data,omitempty"`
+}
+
+// PaymentMethodData - способ оплаты, выбранный покупателем на сайте магазина
+type PaymentMethodData struct {
+	Type string `json:"type"` // bank_card, sbp, sberbank, tinkoff_bank, yoo_money
+}
+
+// Customer - покупатель, которому отправляется чек
+type Customer struct {
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+}
+
+// Receipt - чек 54-ФЗ
+type Receipt struct {
+	Customer Customer      `json:"customer"`
+	Items    []ReceiptItem `json:"items"`
+}
+
+// ReceiptItem - позиция чека
+type ReceiptItem struct {
+	Description    string `json:"description"`
+	Quantity       string `json:"quantity"`
+	Amount         Amount `json:"amount"`
+	VatCode        string `json:"vat_code"`
+	PaymentMode    string `json:"payment_mode,omitempty"`
+	PaymentSubject string `json:"payment_subject,omitempty"`
+	Measure        string `json:"measure,omitempty"` // piece, gram, kilogram, ...
+	// Для маркированного товара: код единицы и режим обработки кода (0)
+	MarkCodeInfo *MarkCodeInfo `json:"mark_code_info,omitempty"`
+	MarkMode     string        `json:"mark_mode,omitempty"`
+}
+
+// MarkCodeInfo - код маркировки. Заполняется одно поле по типу кода.
+type MarkCodeInfo struct {
+	Gs1m string `json:"gs_1m,omitempty"` // DataMatrix «Честного знака» в base64
+}
+
+// CreatePaymentRequest - тело POST /payments
+type CreatePaymentRequest struct {
+	Amount       Amount                 `json:"amount"`
+	Capture      bool                   `json:"capture"`
+	Confirmation *Confirmation          `json:"confirmation,omitempty"`
+	Description  string                 `json:"description,omitempty"`
+	Receipt      *Receipt               `json:"receipt,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+	// SavePaymentMethod - сохранить способ оплаты для автоплатежей.
+	// PaymentMethodID - списать по сохраненному способу, без подтверждения.
+	SavePaymentMethod bool   `json:"save_payment_method,omitempty"`
+	PaymentMethodID   string `json:"payment_method_id,omitempty"`
+	// PaymentMethodData - способ оплаты, если он выбран на сайте
+	PaymentMethodData *PaymentMethodData `json:"payment_method_data,omitempty"`
+}
+
+// CapturePaymentRequest - тело POST /payments/{id}/capture. Без суммы
+// списывается весь холд.
+type CapturePaymentRequest struct {
+	Amount  *Amount  `json:"amount,omitempty"`
+	Receipt *Receipt `json:"receipt,omitempty"`
+}
+
+// CreateRefundRequest - тело POST /refunds
+type CreateRefundRequest struct {
+	PaymentID   string   `json:"payment_id"`
+	Amount      Amount   `json:"amount"`
+	Description string   `json:"description,omitempty"`
+	Receipt     *Receipt `json:"receipt,omitempty"`
+}
+
+// CancellationDetails - кто и почему отменил платеж или возврат
+type CancellationDetails struct {
+	Party  string `json:"party"`
+	Reason string `json:"reason"`
+}
+
+// Card - данные банковской карты в способе оплаты
+type Card struct {
+	First6        string `json:"first6"`
+	Last4         string `json:"last4"`
+	ExpiryMonth   string `json:"expiry_month"`
+	ExpiryYear    string `json:"expiry_year"`
+	CardType      string `json:"card_type"`
+	IssuerCountry string `json:"issuer_country,omitempty"`
+	IssuerName    string `json:"issuer_name,omitempty"`
+}
+
+// PaymentMethod - способ оплаты, которым покупатель оплатил платеж
+type PaymentMethod struct {
+	Type  string `json:"type"` // bank_card, sbp, yoo_money, ...
+	ID    string `json:"id"`
+	Saved bool   `json:"saved"`
+	Title string `json:"title,omitempty"`
+	Card  *Card  `json:"card,omitempty"`
+}
+
+// Payment - объект платежа
+type Payment struct {
+	ID                  string                 `json:"id"`
+	Status              string                 `json:"status"`
+	Paid                bool                   `json:"paid"`
+	Amount              Amount                 `json:"amount"`
+	IncomeAmount        *Amount                `json:"income_amount,omitempty"`
+	RefundedAmount      *Amount                `json:"refunded_amount,omitempty"`
+	Refundable          bool                   `json:"refundable"`
+	Test                bool                   `json:"test"`
+	Description         string                 `json:"description"`
+	Confirmation        *Confirmation          `json:"confirmation,omitempty"`
+	PaymentMethod       *PaymentMethod         `json:"payment_method,omitempty"`
+	CancellationDetails *CancellationDetails   `json:"cancellation_details,omitempty"`
+	ReceiptRegistration string                 `json:"receipt_registration,omitempty"` // pending, succeeded, canceled
+	Metadata            map[string]interface{} `json:"metadata,omitempty"`
+	CreatedAt           time.Time              `json:"created_at"`
+	CapturedAt          *time.Time             `json:"captured_at,omitempty"`
+	ExpiresAt           *time.Time             `json:"expires_at,omitempty"` // до какого момента можно списать холд
+}
+
+// Refund - объект возврата
+type Refund struct {
+	ID                  string               `json:"id"`
+	PaymentID           string               `json:"payment_id"`
+	Status              string               `json:"status"`
+	Amount              Amount               `json:"amount"`
+	Description         string               `json:"description"`
+	CancellationDetails *CancellationDetails `json:"cancellation_details,omitempty"`
+	CreatedAt           time.Time            `json:"created_at"`
+}
+
+// Settlement - расчет по чеку
+type Settlement struct {
+	Type   string `json:"type"` // cashless, prepayment, postpayment, consideration
+	Amount Amount `json:"amount"`
+}
+
+// CreateReceiptRequest - тело POST /receipts: отдельный чек по платежу,
+// например чек зачета предоплаты после передачи товара
+type CreateReceiptRequest struct {
+	Type        string        `json:"type"` // payment или refund
+	PaymentID   string        `json:"payment_id,omitempty"`
+	RefundID    string        `json:"refund_id,omitempty"`
+	Customer    Customer      `json:"customer"`
+	Items       []ReceiptItem `json:"items"`
+	Settlements []Settlement  `json:"settlements"`
+	Send        bool          `json:"send"`
+}
+
+// ReceiptObject - зарегистрированный чек
+type ReceiptObject struct {
+	ID                   string        `json:"id"`
+	Type                 string        `json:"type"`
+	PaymentID            string        `json:"payment_id,omitempty"`
+	RefundID             string        `json:"refund_id,omitempty"`
+	Status               string        `json:"status"` // pending, succeeded, canceled
+	FiscalDocumentNumber string        `json:"fiscal_document_number,omitempty"`
+	FiscalStorageNumber  string        `json:"fiscal_storage_number,omitempty"`
+	FiscalAttribute      string        `json:"fiscal_attribute,omitempty"`
+	RegisteredAt         *time.Time    `json:"registered_at,omitempty"`
+	Items                []ReceiptItem `json:"items"`
+	Settlements          []Settlement  `json:"settlements,omitempty"`
+}